@@ -0,0 +1,143 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// byteLimit counts the bytes read through its readers and makes them fail
+// once more than max bytes were read in total. It is safe for concurrent
+// use, so that parallel part downloads share the same budget.
+type byteLimit struct {
+	max int64
+	n   int64
+}
+
+// newByteLimit returns a byteLimit allowing max bytes, or nil if max isn't
+// positive.
+func newByteLimit(max int64) *byteLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &byteLimit{max: max}
+}
+
+func (l *byteLimit) err() error {
+	return fmt.Errorf("download exceeds the limit of %d bytes", l.max)
+}
+
+// exceeded reports whether more than max bytes were read. It is false for a
+// nil byteLimit.
+func (l *byteLimit) exceeded() bool {
+	return l != nil && atomic.LoadInt64(&l.n) > l.max
+}
+
+// reader returns a reader counting the bytes read from r.
+func (l *byteLimit) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if atomic.AddInt64(&l.n, int64(n)) > l.max {
+			return n, l.err()
+		}
+		return n, err
+	})
+}
+
+// checkDir counts the size of the files under path, for the getters that
+// don't download through Copy, like the ones running a command. The files
+// recorded unchanged in before, already there before the download, aren't
+// counted.
+func (l *byteLimit) checkDir(path string, before dirSnapshot) error {
+	var size int64
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && before.written(p, info) {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		n := atomic.LoadInt64(&l.n)
+		if size <= n || atomic.CompareAndSwapInt64(&l.n, n, size) {
+			break
+		}
+	}
+	if l.exceeded() {
+		return l.err()
+	}
+	return nil
+}
+
+// dirSnapshot records the files and directories under a destination before
+// a download, so that the ones the download writes can be told apart from
+// the ones it merges into, keyed by path. It is nil if the destination
+// didn't exist.
+type dirSnapshot map[string]os.FileInfo
+
+// snapshotDir returns the dirSnapshot of path.
+func snapshotDir(path string) dirSnapshot {
+	if _, err := os.Lstat(path); err != nil {
+		return nil
+	}
+	s := make(dirSnapshot)
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err == nil {
+			s[p] = info
+		}
+		return nil
+	})
+	return s
+}
+
+// written reports whether the file at path, with info, is new or changed
+// since the snapshot.
+func (s dirSnapshot) written(path string, info os.FileInfo) bool {
+	old, ok := s[path]
+	return !ok || old.Size() != info.Size() || !old.ModTime().Equal(info.ModTime())
+}
+
+// removeWritten removes what a download wrote under path: all of it if
+// path didn't exist before, or else the files and directories that are new
+// or changed since the snapshot.
+func (s dirSnapshot) removeWritten(path string) error {
+	if s == nil {
+		return os.RemoveAll(path)
+	}
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if _, ok := s[p]; !ok && info.IsDir() {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && s.written(p, info) {
+			return os.Remove(p)
+		}
+		return nil
+	})
+}
+
+type byteLimitKey struct{}
+
+// withByteLimit returns a copy of ctx carrying l, for Copy to honor.
+func withByteLimit(ctx context.Context, l *byteLimit) context.Context {
+	return context.WithValue(ctx, byteLimitKey{}, l)
+}
+
+func byteLimitFromContext(ctx context.Context) *byteLimit {
+	l, _ := ctx.Value(byteLimitKey{}).(*byteLimit)
+	return l
+}
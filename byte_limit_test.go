@@ -0,0 +1,200 @@
+package getter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetFile_maxBytes(t *testing.T) {
+	content := strings.Repeat("a", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Name     string
+		MaxBytes int64
+		Err      bool
+	}{
+		{"no limit", 0, false},
+		{"under the limit", 1000, false},
+		{"over the limit", 999, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			td, err := ioutil.TempDir("", "getter")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer os.RemoveAll(td)
+			dst := filepath.Join(td, "file")
+
+			client := &Client{
+				Src:      srv.URL + "/file",
+				Dst:      dst,
+				Mode:     ClientModeFile,
+				MaxBytes: tc.MaxBytes,
+			}
+			err = client.Get()
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+
+			if tc.Err {
+				if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+					t.Fatalf("dst should not exist: %v", err)
+				}
+				return
+			}
+			assertContents(t, dst, content)
+		})
+	}
+}
+
+func TestGetFile_maxBytesDecompress(t *testing.T) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// A small archive decompressing to a large file
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(make([]byte, 10000))
+	w.Close()
+	src := filepath.Join(td, "zeros.gz")
+	if err := ioutil.WriteFile(src, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dst := filepath.Join(td, "zeros")
+	client := &Client{
+		Src:      src,
+		Dst:      dst,
+		Mode:     ClientModeFile,
+		MaxBytes: 1000,
+	}
+	if err := client.Get(); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Fatalf("dst should not exist: %v", err)
+	}
+}
+
+func TestGet_maxBytesGit(t *testing.T) {
+	if !testHasGit {
+		t.Log("git not found, skipping")
+		t.Skip()
+	}
+
+	repo := testGitRepo(t, "max-bytes")
+	repo.commitFile("foo.txt", strings.Repeat("a", 1000))
+
+	dst := tempDir(t)
+	client := &Client{
+		Src:      "git::" + repo.url.String(),
+		Dst:      dst,
+		Mode:     ClientModeDir,
+		MaxBytes: 100,
+	}
+	if err := client.Get(); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Fatalf("dst should not exist: %v", err)
+	}
+}
+
+func TestGet_maxBytesMerge(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Objects map[string]string
+		Err     bool
+	}{
+		{"under the limit", map[string]string{"dir/small.txt": "Hello\n"}, false},
+		{"over the limit", map[string]string{"dir/big.txt": strings.Repeat("a", 1000)}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := testGCSServer(t, "bucket", tc.Objects)
+			defer srv.Close()
+
+			// The files already in dst don't count and are kept
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			keep := filepath.Join(dst, "keep.txt")
+			if err := ioutil.WriteFile(keep, []byte(strings.Repeat("k", 1000)), 0644); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			client := &Client{
+				Src:      "gcs::https://www.googleapis.com/storage/v1/bucket/dir?anonymous=true",
+				Dst:      dst,
+				Mode:     ClientModeDir,
+				Merge:    true,
+				MaxBytes: 100,
+			}
+			err := client.Get()
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+
+			assertContents(t, keep, strings.Repeat("k", 1000))
+			if tc.Err {
+				if _, err := os.Lstat(filepath.Join(dst, "big.txt")); !os.IsNotExist(err) {
+					t.Fatalf("the partial download should be removed: %v", err)
+				}
+				return
+			}
+			assertContents(t, filepath.Join(dst, "small.txt"), "Hello\n")
+		})
+	}
+}
+
+func TestDecompress_maxBytesExistingDir(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	keep := filepath.Join(dst, "keep.txt")
+	if err := ioutil.WriteFile(keep, []byte("keep"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The archive holds 12 bytes
+	src, err := filepath.Abs(filepath.Join(fixtureDir, "decompress-tgz", "multiple_dir.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client := &Client{
+		Src:      src,
+		Dst:      dst,
+		Mode:     ClientModeDir,
+		MaxBytes: 8,
+	}
+	if err := client.Get(); err == nil {
+		t.Fatal("should error")
+	}
+	assertContents(t, keep, "keep")
+	for _, p := range []string{"test1", "dir"} {
+		if _, err := os.Lstat(filepath.Join(dst, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed: %v", p, err)
+		}
+	}
+}
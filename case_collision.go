@@ -0,0 +1,70 @@
+package getter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// CaseCollisionPolicy tells what the built-in decompressors do with an
+// archive entry whose path only differs in case from the one of an entry
+// extracted before, like "Foo.txt" and "foo.txt": on a case-insensitive
+// filesystem, the default on macOS and Windows, the second one would
+// overwrite the first.
+type CaseCollisionPolicy uint
+
+const (
+	// CaseCollisionIgnore extracts the entries at their path regardless.
+	// This is the default.
+	CaseCollisionIgnore CaseCollisionPolicy = iota
+
+	// CaseCollisionError fails the extraction.
+	CaseCollisionError
+
+	// CaseCollisionRename extracts the colliding entry next to the other
+	// one, with a number added to its name, e.g. "foo (1).txt".
+	CaseCollisionRename
+)
+
+// caseCollisions tracks the paths of the files extracted from an archive,
+// by case-folded path, to apply a CaseCollisionPolicy.
+type caseCollisions struct {
+	policy CaseCollisionPolicy
+
+	// paths maps the case-folded paths of the extracted files to their
+	// path, renamed tells the ones made up by CaseCollisionRename.
+	paths   map[string]string
+	renamed map[string]bool
+}
+
+// path returns the path to extract the file at path to according to the
+// policy, recording it.
+func (c *caseCollisions) path(path string) (string, error) {
+	if c == nil || c.policy == CaseCollisionIgnore {
+		return path, nil
+	}
+	if c.paths == nil {
+		c.paths = map[string]string{}
+		c.renamed = map[string]bool{}
+	}
+
+	prev, ok := c.paths[strings.ToLower(path)]
+	if !ok || (prev == path && !c.renamed[path]) {
+		// A new path, or the same entry again
+		c.paths[strings.ToLower(path)] = path
+		return path, nil
+	}
+	if c.policy == CaseCollisionError {
+		return "", fmt.Errorf("%s collides with %s on a case-insensitive filesystem", path, prev)
+	}
+
+	ext := filepath.Ext(path)
+	for n := 1; ; n++ {
+		renamed := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(path, ext), n, ext)
+		if _, ok := c.paths[strings.ToLower(renamed)]; !ok {
+			c.paths[strings.ToLower(renamed)] = renamed
+			c.renamed[renamed] = true
+			return renamed, nil
+		}
+	}
+}
@@ -3,6 +3,7 @@ package getter
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -15,10 +16,65 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	urlhelper "github.com/hashicorp/go-getter/helper/url"
 )
 
+// checksumHashes maps the supported checksum types to their hash.
+var checksumHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// FileChecksums are the checksums computed for a downloaded file, see
+// Client.ComputeChecksums.
+type FileChecksums struct {
+	// Path is the path of the downloaded file. For an archive, it is the
+	// temporary path the archive was downloaded to before decompression.
+	Path string
+
+	// Digests maps each requested checksum type to the hex encoded
+	// checksum of the file.
+	Digests map[string]string
+}
+
+// computeChecksums returns the checksums of the file at path for each of
+// the types, reading it only once.
+func computeChecksums(path string, types []string) (*FileChecksums, error) {
+	hashes := make(map[string]hash.Hash, len(types))
+	writers := make([]io.Writer, 0, len(types))
+	for _, t := range types {
+		t = strings.ToLower(t)
+		newHash, ok := checksumHashes[t]
+		if !ok {
+			return nil, fmt.Errorf("unsupported checksum type: %s", t)
+		}
+		if _, ok := hashes[t]; !ok {
+			hashes[t] = newHash()
+			writers = append(writers, hashes[t])
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file for checksum: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, fmt.Errorf("Failed to hash: %s", err)
+	}
+
+	result := &FileChecksums{Path: path, Digests: make(map[string]string, len(hashes))}
+	for t, h := range hashes {
+		result.Digests[t] = hex.EncodeToString(h.Sum(nil))
+	}
+	return result, nil
+}
+
 // fileChecksum helps verifying the checksum for a file.
 type fileChecksum struct {
 	Type     string
@@ -36,11 +92,23 @@ func (c *fileChecksum) checksum(source string) error {
 	}
 	defer f.Close()
 
-	if _, err := io.Copy(c.Hash, f); err != nil {
+	return c.verify(context.Background(), f)
+}
+
+// verify computes the checksum of the content of r and compares it to the
+// expected value.
+func (c *fileChecksum) verify(ctx context.Context, r io.Reader) error {
+	c.Hash.Reset()
+	if _, err := Copy(ctx, c.Hash, r); err != nil {
 		return fmt.Errorf("Failed to hash: %s", err)
 	}
 
-	if actual := c.Hash.Sum(nil); !bytes.Equal(actual, c.Value) {
+	return c.compare(c.Hash.Sum(nil))
+}
+
+// compare compares the actual checksum to the expected value.
+func (c *fileChecksum) compare(actual []byte) error {
+	if !bytes.Equal(actual, c.Value) {
 		return fmt.Errorf(
 			"Checksums did not match.\nExpected: %s\nGot: %s",
 			hex.EncodeToString(c.Value),
@@ -50,6 +118,58 @@ func (c *fileChecksum) checksum(source string) error {
 	return nil
 }
 
+// stream returns a checksumStream hashing the file as it is downloaded.
+func (c *fileChecksum) stream() *checksumStream {
+	c.Hash.Reset()
+	return &checksumStream{hash: c.Hash}
+}
+
+// verifyStream compares the checksum of the file at path, as computed by s
+// during the download, to the expected value. The file is read again when
+// s didn't see all of it: when the getter resumed a download, downloaded
+// parts in parallel or didn't copy the file through Copy.
+func (c *fileChecksum) verifyStream(s *checksumStream, path string) error {
+	if atomic.LoadInt32(&s.copies) == 1 {
+		if fi, err := os.Stat(path); err == nil && fi.Size() == s.n {
+			return c.compare(s.hash.Sum(nil))
+		}
+	}
+	return c.checksum(path)
+}
+
+// checksumStream hashes the bytes of the first Copy using its context.
+type checksumStream struct {
+	hash   hash.Hash
+	n      int64
+	copies int32
+}
+
+// reader returns a reader hashing the bytes read from r, if it is the
+// first reader of s.
+func (s *checksumStream) reader(r io.Reader) io.Reader {
+	if atomic.AddInt32(&s.copies, 1) > 1 {
+		return r
+	}
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		s.hash.Write(p[:n])
+		s.n += int64(n)
+		return n, err
+	})
+}
+
+type checksumStreamKey struct{}
+
+// withChecksumStream returns a copy of ctx carrying s, for Copy to feed.
+func withChecksumStream(ctx context.Context, s *checksumStream) context.Context {
+	return context.WithValue(ctx, checksumStreamKey{}, s)
+}
+
+func checksumStreamFromContext(ctx context.Context) *checksumStream {
+	s, _ := ctx.Value(checksumStreamKey{}).(*checksumStream)
+	return s
+}
+
 // extractChecksum will return a fileChecksum based on the 'checksum'
 // parameter of u.
 // ex:
@@ -116,19 +236,12 @@ func newChecksumFromType(checksumType, checksumValue, filename string) (*fileChe
 	}
 
 	c.Type = strings.ToLower(checksumType)
-	switch c.Type {
-	case "md5":
-		c.Hash = md5.New()
-	case "sha1":
-		c.Hash = sha1.New()
-	case "sha256":
-		c.Hash = sha256.New()
-	case "sha512":
-		c.Hash = sha512.New()
-	default:
+	newHash, ok := checksumHashes[c.Type]
+	if !ok {
 		return nil, fmt.Errorf(
 			"unsupported checksum type: %s", checksumType)
 	}
+	c.Hash = newHash()
 
 	return c, nil
 }
@@ -172,22 +285,8 @@ func (c *Client) checksumFromFile(checksumFile string, src *url.URL) (*fileCheck
 		return nil, err
 	}
 
-	tempfile, err := tmpFile("", filepath.Base(checksumFileURL.Path))
+	data, err := c.getTempFileContents(checksumFile)
 	if err != nil {
-		return nil, err
-	}
-	defer os.Remove(tempfile)
-
-	c2 := &Client{
-		Getters:       c.Getters,
-		Decompressors: c.Decompressors,
-		Detectors:     c.Detectors,
-		Pwd:           c.Pwd,
-		Dir:           false,
-		Src:           checksumFile,
-		Dst:           tempfile,
-	}
-	if err = c2.Get(); err != nil {
 		return nil, fmt.Errorf(
 			"Error downloading checksum file: %s", err)
 	}
@@ -212,13 +311,7 @@ func (c *Client) checksumFromFile(checksumFile string, src *url.URL) (*fileCheck
 		absPath,        // fullpath; set if local
 	}
 
-	f, err := os.Open(tempfile)
-	if err != nil {
-		return nil, fmt.Errorf(
-			"Error opening downloaded file: %s", err)
-	}
-	defer f.Close()
-	rd := bufio.NewReader(f)
+	rd := bufio.NewReader(bytes.NewReader(data))
 	for {
 		line, err := rd.ReadString('\n')
 		if err != nil {
@@ -3,10 +3,11 @@ package getter
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	urlhelper "github.com/hashicorp/go-getter/helper/url"
@@ -18,6 +19,14 @@ import (
 // Top-level functions such as Get are shortcuts for interacting with a client.
 // Using a client directly allows more fine-grained control over how downloading
 // is done, as well as customizing the protocols supported.
+//
+// A Client runs a single download at a time. To download several sources
+// concurrently, use one Client per download: they may be copies of the same
+// Client and share its Getters, Decompressors and Detectors, as long as
+// these aren't modified during the downloads. The built-in getters are
+// copied for each download, so one instance can serve several clients at
+// once. Custom getters shared this way must be safe for concurrent use,
+// their client is set by Configure.
 type Client struct {
  	// Ctx for cancellation
 	Ctx context.Context
@@ -26,7 +35,8 @@ type Client struct {
 	//
 	// Dst is the path to save the downloaded thing as. If Dir is set to
 	// true, then this should be a directory. If the directory doesn't exist,
-	// it will be created for you.
+	// it will be created for you. A Dst of "-" writes a single file to
+	// Stdout instead, see StdoutDst.
 	//
 	// Pwd is the working directory for detection. If this isn't set, some
 	// detection may fail. Client will not default pwd to the current
@@ -44,7 +54,10 @@ type Client struct {
 	Detectors []Detector
 
 	// Decompressors is the map of decompressors supported by this client.
-	// If this is nil, then the default value is the Decompressors global.
+	// If this is nil, then the default value is a copy of the Decompressors
+	// global. A non-nil map fully replaces the defaults: formats that are not
+	// in the map are never decompressed, so an empty non-nil map disables
+	// decompression entirely, even when the archive parameter is set.
 	Decompressors map[string]Decompressor
 
 	// Getters is the map of protocols supported by this client. If this
@@ -59,18 +72,363 @@ type Client struct {
 	// WARNING: deprecated. If Mode is set, that will take precedence.
 	Dir bool
 
+	// ExpandEnv, if true, expands ${var} or $var references in Src using the
+	// current environment before detection, e.g.
+	// "gcs::https://www.googleapis.com/storage/v1/bucket/${BUILD_ID}/foo".
+	// References to unset variables are replaced by the empty string. This
+	// is off by default so that sources containing a literal '$' keep
+	// working.
+	ExpandEnv bool
+
+	// ProbeBeforeGet, if true, makes the HTTP, S3 and GCS getters check
+	// that the source host is reachable before downloading anything. When
+	// it isn't, the returned error tells DNS failures, refused connections
+	// and TLS errors apart instead of surfacing a low-level network error.
+	// The probe is skipped when the getter connects through a proxy, with
+	// a custom HTTP client or TLS configuration, or pinning certificates,
+	// since it dials the host directly.
+	ProbeBeforeGet bool
+
+	// RequireAuth, if true, makes the S3 and GCS getters fail when no
+	// credentials can be found, instead of sending unauthenticated requests
+	// that private buckets reject later with a less helpful error.
+	RequireAuth bool
+
+	// OnPlan, if set, is called once per Get with the resolved Plan of the
+	// download, after the source is detected and parsed but before any
+	// I/O, e.g. to audit it: the checksum and signature files named by the
+	// source aren't fetched yet either. OnPlan may change the URL of the
+	// plan, or return an error that aborts the Get. Unlike Interceptor, it
+	// isn't called for the checksum and signature files, which are part of
+	// the plan.
+	OnPlan func(*Plan) error
+
+	// Interceptor, if set, is called with the URL of every source before
+	// its getter is picked, including the checksum and signature files,
+	// e.g. to enforce a policy on the hosts or to use a mirror. It returns
+	// the URL to download instead, or an error that aborts the Get. The URL
+	// still holds the magic query parameters, like "checksum". See
+	// WithInterceptor.
+	Interceptor func(*url.URL) (*url.URL, error)
+
+	// RetryPolicy, if set, decides which failed requests of the HttpGetter
+	// are sent again and when, instead of its MaxRetries and MaxRetryWait:
+	// it is consulted after every transport error and every response with
+	// a status code of 400 or more, given as the error the getter returns,
+	// see StatusError. By default only the 429 and 503 responses are
+	// retried, up to HttpGetter.MaxRetries times. Only the HttpGetter, and
+	// the GitHubReleaseGetter which sends its requests through one, consult
+	// it; the other getters don't retry.
+	RetryPolicy RetryPolicy
+
+	// MaxBytes, if greater than zero, is the maximum number of bytes a Get
+	// may download. The same limit separately applies to the bytes written
+	// by the built-in decompressors. Once it is exceeded the download is
+	// aborted and the partial output removed; the files that were already
+	// in an existing destination, e.g. with Merge, are kept and don't
+	// count. Getters running a command, like git and hg, are only checked
+	// once the command completed.
+	MaxBytes int64
+
+	// Merge, if true, writes directory downloads into the existing Dst
+	// instead of deleting it first, so that several sources can be layered
+	// into the same directory. Only the files present in the source are
+	// overwritten. This applies to subdirectories and to the S3, GCS and
+	// HTTP getters.
+	Merge bool
+
+	// ComputeChecksums lists the checksum types, among "md5", "sha1",
+	// "sha256" and "sha512", to compute for a file download, e.g. to pin
+	// the source afterwards. The result is stored in ComputedChecksums.
+	// Directory downloads are not checksummed.
+	ComputeChecksums []string
+
+	// ComputedChecksums is set by Get to the checksums requested with
+	// ComputeChecksums, for file downloads.
+	ComputedChecksums *FileChecksums
+
+	// TreeChecksums, if set, maps the slash-separated paths of the files
+	// a directory download must produce, relative to Dst, to their hex
+	// encoded SHA-256 checksums, e.g. to check the contents of an archive
+	// once unpacked. Get fails if a file is missing or its checksum
+	// doesn't match. The downloaded files are kept.
+	TreeChecksums map[string]string
+
+	// TreeChecksumsStrict, if true, also makes Get fail if Dst holds files
+	// that aren't listed in TreeChecksums.
+	TreeChecksumsStrict bool
+
+	// Resolved is set by Get to the source it downloads, once detected,
+	// intercepted and planned, e.g. to pin it afterwards.
+	Resolved *ResolvedSource
+
+	// ResumeToken is set by Get when the download of a single file by the
+	// HTTP or GCS getter is interrupted, e.g. by canceling Ctx, after part
+	// of it was written to the destination. Pass it to Resume to continue
+	// the download. Archives and files downloaded to FS can't be resumed.
+	ResumeToken *ResumeToken
+
+	// TmpDir is the directory where downloads are staged before being
+	// extracted or copied to Dst, e.g. for archives and subdirectories. It
+	// must exist. If empty, os.TempDir() is used.
+	TmpDir string
+
+	// Overwrite tells which of the existing files at Dst may be replaced.
+	// See OverwritePolicy for the getters and decompressors honoring it.
+	Overwrite OverwritePolicy
+
+	// CaseCollisions tells what the built-in decompressors do with the
+	// entries of an archive whose paths only differ in case, which collide
+	// on a case-insensitive filesystem. See CaseCollisionPolicy.
+	CaseCollisions CaseCollisionPolicy
+
+	// Umask, if non-zero, masks the modes of the files and directories
+	// created by the built-in decompressors instead of the process umask,
+	// e.g. 0002 to keep them group-writable. Files without a mode in the
+	// archive get 0666 and directories DirMode, 0777 by default, before
+	// masking.
+	Umask os.FileMode
+
+	// DirMode is the mode of the directories created by the getters and
+	// the built-in decompressors, such as the parents of Dst, e.g. 0700 in
+	// restrictive environments. It defaults to 0755 and is subject to the
+	// process umask, or to Umask for the decompressors. The directories of
+	// an archive keep their own mode.
+	DirMode os.FileMode
+
+	// FileMode, if non-zero, is the mode of the file written by a single
+	// file download, e.g. 0600 for a secret, including a file unpacked
+	// from a compressed file or an archive. The getters create the file
+	// with it, and it is set again once the download is done, regardless
+	// of the umask. A file linked by the FileGetter keeps the mode of its
+	// source.
+	FileMode os.FileMode
+
+	// FlattenArchive, if true, unpacks a directory archive holding a single
+	// top-level directory without it: the contents of that directory are
+	// written to Dst. Other archives are unpacked as is. By default the
+	// layout of the archive is always kept. See WithFlattenArchive.
+	FlattenArchive bool
+
+	// ExtractToNamedDir, if true, unpacks a directory archive to a
+	// directory of Dst named after the archive without its extension, e.g.
+	// Dst/release for release.tar.gz, instead of to Dst itself. The name
+	// is taken from the URL path, or from the name of a split archive
+	// without the suffix of its parts. A subdirectory of the archive is
+	// copied to that directory too. See WithExtractToNamedDir.
+	ExtractToNamedDir bool
+
+	// SniffArchives, if true, detects the archives and compressed files
+	// whose URL has no known extension, such as "/download?id=123", from
+	// their first bytes: the gzip, bzip2, xz and ZIP formats, and the tar
+	// archives they hold, are unpacked as if they had the matching
+	// extension. It applies to file downloads to the operating system
+	// filesystem without an archive parameter.
+	SniffArchives bool
+
+	// OnFileComplete, if set, is called by the S3 and GCS getters after
+	// each object of a directory download is written, with the name and
+	// the size of the object, e.g. to update a live view of the download.
+	// The calls made by a Get never overlap, even when the objects are
+	// downloaded in parallel parts, but clients downloading concurrently
+	// may call a shared callback at the same time. Objects skipped by
+	// SyncMode aren't reported.
+	OnFileComplete func(name string, size int64)
+
+	// MaxConnections, if set, limits the number of getter operations
+	// running at the same time across the clients sharing it, e.g. the
+	// copies of a Client downloading several sources concurrently. Each
+	// Get or GetFile of a getter takes one connection for its duration,
+	// and the parts of a multipart download fetched in parallel take one
+	// more each.
+	MaxConnections *ConnectionLimit
+
+	// Hosts, if set, maps host names to the headers and credentials sent
+	// to them, so that they don't have to be given in every source URL.
+	// A host uses the configuration of its longest matching key, either
+	// its name or one of its parent domains: "example.com" applies to
+	// "example.com" and "releases.example.com". It is honored by the HTTP,
+	// GCS, S3 and Git getters, see HostConfig and WithHosts.
+	Hosts map[string]HostConfig
+
+	// Credentials, if set, supplies the credentials of the GCS, Artifact
+	// Registry and S3 getters instead of the environment, see
+	// CredentialProvider.
+	Credentials CredentialProvider
+
+	// CredentialHelper, if set, is an external executable the getters run
+	// to obtain the credentials of a host at request time, see
+	// CredentialHelper. Hosts and Credentials take precedence over it.
+	CredentialHelper *CredentialHelper
+
+	// MirrorDir, if set, is a local directory looked up for the sources
+	// before downloading them, e.g. for offline builds. A source found
+	// there is copied from it by the FileGetter instead of being downloaded
+	// by its getter. The entries are named by the hex encoded SHA-256 of
+	// the source URL as given to the getter, prefixed with the getter and
+	// "::", once the magic parameters like "checksum" and "archive" are
+	// removed. An archive is mirrored before being unpacked.
+	MirrorDir string
+
+	// PopulateMirror, if true, stores the sources missing from MirrorDir
+	// in it once downloaded.
+	PopulateMirror bool
+
+	// FS, if set, is the filesystem Dst is written to instead of the one
+	// of the operating system, e.g. an in-memory filesystem in tests. It is
+	// used by the FileGetter and the built-in decompressors: the sources of
+	// other getters must be archives, which are still downloaded to TmpDir
+	// first. Checksums, signatures, ComputeChecksums, subdirectories and
+	// FlattenArchive read Dst back and can't be used with it.
+	FS FS
+
 	// ProgressListener allows to track file downloads.
 	// By default a no op progress listener is used.
 	ProgressListener ProgressTracker
 
+	// UserAgent is the User-Agent sent by the HTTP, S3 and GCS getters. It
+	// defaults to DefaultUserAgent. See WithUserAgent.
+	UserAgent string
+
+	// Logger, if set, receives a description of the operations performed
+	// by the getters, with credentials redacted. See WithLogger.
+	Logger Logger
+
+	// Stdout is the writer a file downloaded to the Dst "-" is written to.
+	// It defaults to os.Stdout.
+	Stdout io.Writer
+
 	Options []ClientOption
 }
 
 // Get downloads the configured source to the destination.
 func (c *Client) Get() error {
+	if c.Dst == StdoutDst {
+		return c.getStdout()
+	}
+
+	if err := c.get(); err != nil {
+		return err
+	}
+
+	if c.TreeChecksums != nil {
+		return verifyTreeChecksums(c.Dst, c.TreeChecksums, c.TreeChecksumsStrict)
+	}
+	return nil
+}
+
+// get implements Get for a destination path.
+func (c *Client) get() error {
 	if err := c.Configure(c.Options...); err != nil {
 		return err
 	}
+	r, err := c.resolve(c.Src)
+	if err != nil {
+		return err
+	}
+	return c.getResolved(r)
+}
+
+// resolution is a source detected, parsed and intercepted, with the getter
+// downloading it.
+type resolution struct {
+	// src is the detected source, without forced getter and subdirectory.
+	src string
+
+	// force is the key of the getter in Client.Getters.
+	force string
+
+	// u is the intercepted URL of src, still with the magic query
+	// parameters.
+	u      *url.URL
+	subDir string
+
+	// g is the getter, bound to the client.
+	g Getter
+}
+
+// resolve detects and parses src as Client.Src, expanding it if ExpandEnv
+// is set, intercepts its URL and picks its getter. It is the first step of
+// Get, Validate, Verify and Filename; the client must be configured.
+func (c *Client) resolve(src string) (*resolution, error) {
+	if c.ExpandEnv {
+		src = os.ExpandEnv(src)
+	}
+
+	src, err := Detect(src, c.Pwd, c.Detectors)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine if we have a forced protocol, i.e. "git::http://..."
+	force, src := getForcedGetter(src)
+	src, subDir := SourceDirSubdir(src)
+
+	u, err := urlhelper.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if u, err = c.intercept(u); err != nil {
+		return nil, err
+	}
+	if force == "" {
+		force = u.Scheme
+	}
+
+	g, ok := c.Getters[force]
+	if !ok {
+		return nil, fmt.Errorf(
+			"download not supported for scheme '%s'", force)
+	}
+	return &resolution{
+		src:    src,
+		force:  force,
+		u:      u,
+		subDir: subDir,
+		g:      bindGetter(g, c),
+	}, nil
+}
+
+// getResolved implements get for the resolved source r.
+func (c *Client) getResolved(r *resolution) error {
+	c.ComputedChecksums = nil
+	c.Resolved = nil
+	c.ResumeToken = nil
+	for _, t := range c.ComputeChecksums {
+		if _, ok := checksumHashes[strings.ToLower(t)]; !ok {
+			return fmt.Errorf("unsupported checksum type: %s", t)
+		}
+	}
+	for path, v := range c.TreeChecksums {
+		if _, err := newChecksumFromType("sha256", v, path); err != nil {
+			return fmt.Errorf("invalid tree checksum of %s: %s", path, err)
+		}
+	}
+
+	// Make the getters count the bytes they download
+	limit := newByteLimit(c.MaxBytes)
+	if limit != nil {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withByteLimit(c.Ctx, limit)
+	}
+
+	// Let the getters create directories with the configured mode
+	if c.DirMode != 0 {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withDirMode(c.Ctx, c.DirMode)
+	}
+
+	// Let the getters downloading in parallel share the connections
+	if c.MaxConnections != nil {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withConnectionLimit(c.Ctx, c.MaxConnections)
+	}
+
+	// Run the credential helper once per host for this download
+	if c.CredentialHelper != nil && credentialHelperCacheFromContext(c.Ctx) == nil {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withCredentialHelperCache(c.Ctx)
+	}
 
 	// Store this locally since there are cases we swap this
 	mode := c.Mode
@@ -82,21 +440,17 @@ func (c *Client) Get() error {
 		}
 	}
 
-	src, err := Detect(c.Src, c.Pwd, c.Detectors)
-	if err != nil {
-		return err
-	}
-
-	// Determine if we have a forced protocol, i.e. "git::http://..."
-	force, src := getForcedGetter(src)
+	src, force, subDir, g := r.src, r.force, r.subDir, r.g
+	u := new(url.URL)
+	*u = *r.u
+	var err error
 
 	// If there is a subdir component, then we download the root separately
 	// and then copy over the proper subdir.
 	var realDst string
 	dst := c.Dst
-	src, subDir := SourceDirSubdir(src)
 	if subDir != "" {
-		td, tdcloser, err := safetemp.Dir("", "getter")
+		td, tdcloser, err := safetemp.Dir(c.TmpDir, "getter")
 		if err != nil {
 			return err
 		}
@@ -106,58 +460,35 @@ func (c *Client) Get() error {
 		dst = td
 	}
 
-	u, err := urlhelper.Parse(src)
-	if err != nil {
-		return err
-	}
-	if force == "" {
-		force = u.Scheme
-	}
-
-	g, ok := c.Getters[force]
-	if !ok {
-		return fmt.Errorf(
-			"download not supported for scheme '%s'", force)
-	}
-
 	// We have magic query parameters that we use to signal different features
-	q := u.Query()
+	magic := u.Query()
 
 	// Determine if we have an archive type
-	archiveV := q.Get("archive")
-	if archiveV != "" {
-		// Delete the paramter since it is a magic parameter we don't
-		// want to pass on to the Getter
-		q.Del("archive")
-		u.RawQuery = q.Encode()
-
-		// If we can parse the value as a bool and it is false, then
-		// set the archive to "-" which should never map to a decompressor
-		if b, err := strconv.ParseBool(archiveV); err == nil && !b {
-			archiveV = "-"
-		}
-	}
-	if archiveV == "" {
-		// We don't appear to... but is it part of the filename?
-		matchingLen := 0
-		for k := range c.Decompressors {
-			if strings.HasSuffix(u.Path, "."+k) && len(k) > matchingLen {
-				archiveV = k
-				matchingLen = len(k)
-			}
-		}
-	}
+	archiveV, split := c.archiveType(u)
+	q := u.Query()
 
 	// If we have a decompressor, then we need to change the destination
 	// to download to a temporary path. We unarchive this into the final,
 	// real path.
 	var decompressDst string
 	var decompressDir bool
+	var archiveFile bool
 	decompressor := c.Decompressors[archiveV]
 	if decompressor != nil {
+		// A subdir of a file download names a file inside the archive,
+		// e.g. "https://host/release.tar.gz//path/inside/archive.txt". The
+		// archive is then unpacked as a directory and that file copied out.
+		archiveFile = mode == ClientModeFile && subDir != ""
+
+		// The subdir is looked up in the unpacked archive, it must not
+		// point outside of it
+		if containsDotDot(subDir) {
+			return fmt.Errorf("archive: subdir contains '..': %s", subDir)
+		}
+
 		// Create a temporary directory to store our archive. We delete
 		// this at the end of everything.
-		td, err := ioutil.TempDir("", "getter")
+		td, err := ioutil.TempDir(c.TmpDir, "getter")
 		if err != nil {
 			return fmt.Errorf(
 				"Error creating temporary directory for archive: %s", err)
@@ -167,46 +498,156 @@ func (c *Client) Get() error {
 		// Swap the download directory to be our temporary path and
 		// store the old values.
 		decompressDst = dst
-		decompressDir = mode != ClientModeFile
+		decompressDir = mode != ClientModeFile || archiveFile
 		dst = filepath.Join(td, "archive")
 		mode = ClientModeFile
 	}
 
-	// Determine checksum if we have one
-	checksum, err := c.extractChecksum(u)
-	if err != nil {
-		return fmt.Errorf("invalid checksum: %s", err)
+	// Determine checksum if we have one. A checksum file is only fetched
+	// once the plan is approved.
+	var checksum *fileChecksum
+	checksumFile := strings.TrimPrefix(q.Get("checksum"), "file:")
+	if checksumFile == q.Get("checksum") {
+		checksumFile = ""
+		if checksum, err = c.extractChecksum(u); err != nil {
+			return fmt.Errorf("invalid checksum: %s", err)
+		}
 	}
 
 	// Delete the query parameter if we have it.
 	q.Del("checksum")
 	u.RawQuery = q.Encode()
 
-	if mode == ClientModeAny {
-		// Ask the getter which client mode to use
-		mode, err = g.ClientMode(u)
-		if err != nil {
+	// Determine signature if we have one, fetched once the plan is approved
+	sigV, keyV := q.Get("signature"), q.Get("pubkey")
+
+	// Delete the query parameters if we have them.
+	q.Del("signature")
+	q.Del("pubkey")
+	u.RawQuery = q.Encode()
+
+	// Let OnPlan see what was resolved before anything is downloaded
+	if c.OnPlan != nil {
+		p := &Plan{
+			Src:          c.Src,
+			Getter:       force,
+			URL:          new(url.URL),
+			Subdir:       subDir,
+			Split:        split != nil,
+			ChecksumURL:  checksumFile,
+			Signed:       sigV != "",
+			SignatureURL: sigV,
+			Dst:          c.Dst,
+			Mode:         mode,
+		}
+		if !isArmoredPublicKey(keyV) {
+			p.PublicKeyURL = keyV
+		}
+		*p.URL = *u
+		if decompressor != nil {
+			p.Decompressor = archiveV
+			p.Mode = ClientModeFile
+			if decompressDir {
+				p.Mode = ClientModeDir
+			}
+		}
+		if checksum != nil {
+			p.Checksum = fmt.Sprintf("%s:%x", checksum.Type, checksum.Value)
+		}
+		if u, err = c.plan(p); err != nil {
 			return err
 		}
+		q = u.Query()
+	}
 
-		// Destination is the base name of the URL path in "any" mode when
-		// a file source is detected.
-		if mode == ClientModeFile {
-			filename := filepath.Base(u.Path)
+	// The source as planned, with the magic query parameters, see Resolved
+	resolved := *u
+	rq := resolved.Query()
+	for _, k := range []string{"archive", "checksum", "signature", "pubkey"} {
+		if vs, ok := magic[k]; ok {
+			rq[k] = vs
+		}
+	}
+	resolved.RawQuery = rq.Encode()
+	c.Resolved = &ResolvedSource{URL: joinSourceSubdir(resolved.String(), subDir), Getter: force}
 
-			// Determine if we have a custom file name
-			if v := q.Get("filename"); v != "" {
-				// Delete the query parameter if we have it.
-				q.Del("filename")
-				u.RawQuery = q.Encode()
+	if checksumFile != "" {
+		if checksum, err = c.checksumFromFile(checksumFile, u); err != nil {
+			return fmt.Errorf("invalid checksum: %s", err)
+		}
+	}
+	signature, err := c.extractSignature(sigV, keyV)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+
+	if c.ProbeBeforeGet && shouldProbe(force, g, u) {
+		if err := probe(c.Ctx, u); err != nil {
+			return err
+		}
+	}
+
+	// Look the source up in the mirror
+	mirrorPath, mirrorMode := c.mirrorEntry(force, u)
+
+	if c.FS != nil {
+		if err := c.checkFS(subDir, checksum != nil, signature != nil); err != nil {
+			return err
+		}
+		if decompressor == nil {
+			// Only the FileGetter writes to FS, the other getters
+			// download archives to TmpDir.
+			if _, ok := g.(*FileGetter); !ok {
+				return fmt.Errorf("download to Client.FS not supported for scheme '%s'", force)
+			}
+			defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+			c.Ctx = withFS(c.Ctx, c.FS)
+		}
+	}
+
+	// A file found to be an archive by SniffArchives is unpacked as one
+	// matched by its extension in this mode, to this destination
+	sniff := c.SniffArchives && archiveV == "" && c.FS == nil
+	sniffDir := mode == ClientModeAny
+	sniffDst := dst
+
+	if mode == ClientModeAny {
+		// Ask the getter which client mode to use, unless it already knows
+		// or the mirror has the source
+		mode = mirrorMode
+		if h, ok := g.(ClientModeHinter); ok && mode == ClientModeInvalid {
+			mode = h.ClientModeHint(u)
+		}
+		if mode != ClientModeFile && mode != ClientModeDir {
+			mode, err = g.ClientMode(u)
+			if err != nil {
+				return err
+			}
+		}
 
-				filename = v
+		// Destination is named by the getter in "any" mode when a file
+		// source is detected, see Filename.
+		if mode == ClientModeFile {
+			filename, err := downloadFilename(g, u)
+			if err != nil {
+				return err
 			}
 
 			dst = filepath.Join(dst, filename)
 		}
 	}
 
+	// Let the getter find a checksum if none was given, unless the file is
+	// copied from the mirror without reaching the network
+	if mode == ClientModeFile && checksum == nil && mirrorMode != ClientModeFile {
+		if a, ok := g.(autoChecksummer); ok {
+			checksum, err = a.autoChecksum(u)
+			if err != nil {
+				return fmt.Errorf("invalid checksum: %s", err)
+			}
+		}
+	}
+
 	// If we're not downloading a directory, then just download the file
 	// and return.
 	if mode == ClientModeFile {
@@ -218,26 +659,160 @@ func (c *Client) Get() error {
 			}
 		}
 		if getFile {
-			err := g.GetFile(dst, u)
+			if err := c.MaxConnections.acquire(c.Ctx); err != nil {
+				return err
+			}
+
+			// Let the getter create the file with the configured mode
+			if c.FileMode != 0 {
+				defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+				c.Ctx = withFileMode(c.Ctx, c.FileMode)
+			}
+
+			// Copy the file of the mirror instead if it has one
+			fg, fu := g, u
+			if mirrorMode == ClientModeFile {
+				fg = bindGetter(&FileGetter{Copy: true}, c)
+				fu = &url.URL{Scheme: "file", Path: mirrorPath}
+			} else if split != nil {
+				fg = &splitGetter{Getter: g, split: split, client: c}
+			}
+
+			// Let the getter record what identifies the file, in case
+			// the download has to be resumed
+			var resume *resumeState
+			if _, ok := fg.(resumer); ok && decompressor == nil && c.FS == nil {
+				resume = new(resumeState)
+				defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+				c.Ctx = withResumeState(c.Ctx, resume)
+			}
+
+			var stream *checksumStream
+			if checksum != nil {
+				// Hash the file while it is downloaded
+				stream = checksum.stream()
+				ctx := c.Ctx
+				c.Ctx = withChecksumStream(ctx, stream)
+				err = fg.GetFile(dst, fu)
+				c.Ctx = ctx
+			} else {
+				err = fg.GetFile(dst, fu)
+			}
+			c.MaxConnections.release()
 			if err != nil {
+				if limit.exceeded() {
+					fsFromContext(c.Ctx).Remove(dst)
+				} else {
+					c.ResumeToken = resume.token(force, u, dst)
+				}
 				return err
 			}
 
 			if checksum != nil {
-				if err := checksum.checksum(dst); err != nil {
+				if err := checksum.verifyStream(stream, dst); err != nil {
+					// Never leave a corrupted file behind
+					os.Remove(dst)
+					return err
+				}
+			}
+		}
+
+		if signature != nil {
+			if err := signature.verify(dst); err != nil {
+				// Never leave an untrusted file behind
+				os.Remove(dst)
+				return err
+			}
+		}
+
+		if getFile && mirrorMode != ClientModeFile {
+			if err := c.populateMirror(mirrorPath, dst, ClientModeFile); err != nil {
+				return fmt.Errorf("error populating the mirror: %s", err)
+			}
+		}
+
+		if len(c.ComputeChecksums) > 0 {
+			c.ComputedChecksums, err = computeChecksums(dst, c.ComputeChecksums)
+			if err != nil {
+				return err
+			}
+		}
+
+		if decompressor == nil && sniff {
+			if key := sniffDecompressor(c.Decompressors, dst); key != "" {
+				// Move the file aside to unpack it to its destination
+				td, err := ioutil.TempDir(c.TmpDir, "getter")
+				if err != nil {
+					return fmt.Errorf(
+						"Error creating temporary directory for archive: %s", err)
+				}
+				defer os.RemoveAll(td)
+
+				archive := filepath.Join(td, "archive")
+				if err := moveFile(archive, dst); err != nil {
 					return err
 				}
+				decompressor = c.Decompressors[key]
+				archiveV = key
+				archiveFile = !sniffDir && subDir != ""
+				decompressDir = sniffDir || archiveFile
+				decompressDst = dst
+				if sniffDir {
+					decompressDst = sniffDst
+				}
+				dst = archive
 			}
 		}
 
 		if decompressor != nil {
 			// We have a decompressor, so decompress the current destination
 			// into the final destination with the proper mode.
-			err := decompressor.Decompress(decompressDst, dst, decompressDir)
+			// Only the subdir of the archive, a file or a directory whose
+			// contents are copied to the destination, needs to be unpacked
+			flatten := c.FlattenArchive && decompressDir && !archiveFile
+			only := ""
+			if !flatten {
+				only = subDir
+			}
+			name := filepath.Base(u.Path)
+			if split != nil {
+				name = filepath.Base(split.name)
+			}
+
+			// Unpack a directory archive to a directory named after it
+			if c.ExtractToNamedDir && decompressDir && !archiveFile {
+				dir, err := archiveDirName(c.Decompressors, name, archiveV)
+				if err != nil {
+					return err
+				}
+				if subDir != "" {
+					// The subdir is copied from the unpacked archive
+					realDst = filepath.Join(realDst, dir)
+				} else {
+					decompressDst = filepath.Join(decompressDst, dir)
+				}
+			}
+
+			target := decompressDst
+			if flatten {
+				// Unpack next to the archive to find its top-level entries
+				target = filepath.Join(filepath.Dir(dst), "contents")
+			}
+			err := c.decompress(decompressor, target, dst, decompressDir, only, name)
+			if err == nil && flatten {
+				err = c.flattenArchive(decompressDst, target)
+			}
 			if err != nil {
 				return err
 			}
 
+			if archiveFile {
+				if err := c.copyArchiveFile(realDst, decompressDst, subDir); err != nil {
+					return err
+				}
+				return c.chmodFile(realDst)
+			}
+
 			// Swap the information back
 			dst = decompressDst
 			if decompressDir {
@@ -251,7 +826,7 @@ func (c *Client) Get() error {
 		// if we were unarchiving. If we're still only Get-ing a file, then
 		// we're done.
 		if mode == ClientModeFile {
-			return nil
+			return c.chmodFile(dst)
 		}
 	}
 
@@ -266,22 +841,81 @@ func (c *Client) Get() error {
 			return fmt.Errorf(
 				"checksum cannot be specified for directory download")
 		}
+		if signature != nil {
+			return fmt.Errorf(
+				"signature cannot be specified for directory download")
+		}
+
+		// Make sure the getter can give us a subdir before downloading
+		// anything.
+		if subDir != "" {
+			if r, ok := g.(subdirRejecter); ok {
+				if err := r.rejectSubdir(u); err != nil {
+					return fmt.Errorf("error downloading '%s': %s", src, err)
+				}
+			}
+		}
 
 		// We're downloading a directory, which might require a bit more work
 		// if we're specifying a subdir.
-		err := g.Get(dst, u)
+		if err := c.MaxConnections.acquire(c.Ctx); err != nil {
+			return err
+		}
+		// Tell the files already in dst, e.g. with Merge, from the ones
+		// counted and removed for MaxBytes
+		var before dirSnapshot
+		var existed bool
+		if limit != nil {
+			if c.FS == nil {
+				before = snapshotDir(dst)
+			} else {
+				_, err := c.FS.Lstat(dst)
+				existed = err == nil
+			}
+		}
+
+		var err error
+		if mirrorMode == ClientModeDir {
+			err = c.getMirrorDir(dst, mirrorPath)
+		} else {
+			err = g.Get(dst, u)
+		}
+		c.MaxConnections.release()
+		if err == nil && limit != nil && c.FS == nil {
+			err = limit.checkDir(dst, before)
+		}
 		if err != nil {
-			err = fmt.Errorf("error downloading '%s': %s", src, err)
+			if limit.exceeded() && c.FS == nil {
+				before.removeWritten(dst)
+			} else if limit.exceeded() && !existed {
+				c.FS.RemoveAll(dst)
+			}
+			err = fmt.Errorf("error downloading '%s': %w", src, err)
 			return err
 		}
+
+		if mirrorMode != ClientModeDir {
+			if err := c.populateMirror(mirrorPath, dst, ClientModeDir); err != nil {
+				return fmt.Errorf("error populating the mirror: %s", err)
+			}
+		}
+
+		// Record the commit to pin the source to
+		if gg, ok := g.(*GitGetter); ok {
+			if commit, err := gg.ResolvedCommit(dst); err == nil {
+				c.Resolved.Commit = commit
+			}
+		}
 	}
 
 	// If we have a subdir, copy that over
 	if subDir != "" {
-		if err := os.RemoveAll(realDst); err != nil {
-			return err
+		if !c.Merge {
+			if err := os.RemoveAll(realDst); err != nil {
+				return err
+			}
 		}
-		if err := os.MkdirAll(realDst, 0755); err != nil {
+		if err := os.MkdirAll(realDst, dirModeFromContext(c.Ctx)); err != nil {
 			return err
 		}
 
@@ -296,3 +930,199 @@ func (c *Client) Get() error {
 
 	return nil
 }
+
+// chmodFile sets the mode of the file downloaded to dst to FileMode, if
+// set. A symlink to the source of the FileGetter is left alone.
+func (c *Client) chmodFile(dst string) error {
+	if c.FileMode == 0 {
+		return nil
+	}
+	fs := fsFromContext(c.Ctx)
+	fi, err := fs.Lstat(dst)
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+	return fs.Chmod(dst, c.FileMode)
+}
+
+// checkFS returns an error if a feature reading Dst back is used with FS.
+func (c *Client) checkFS(subDir string, checksum, signature bool) error {
+	var feature string
+	switch {
+	case subDir != "":
+		feature = "subdirectories"
+	case checksum:
+		feature = "checksums"
+	case signature:
+		feature = "signatures"
+	case len(c.ComputeChecksums) > 0:
+		feature = "ComputeChecksums"
+	case c.FlattenArchive:
+		feature = "FlattenArchive"
+	case c.TreeChecksums != nil:
+		feature = "TreeChecksums"
+	case c.MirrorDir != "":
+		feature = "MirrorDir"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s can't be used with Client.FS", feature)
+}
+
+// intercept returns the URL to download instead of u, as given by the
+// Interceptor if there is one.
+func (c *Client) intercept(u *url.URL) (*url.URL, error) {
+	if c.Interceptor == nil {
+		return u, nil
+	}
+	nu, err := c.Interceptor(u)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", redactURL(u), err)
+	}
+	if nu == nil {
+		return nil, fmt.Errorf("%s: the interceptor returned no URL", redactURL(u))
+	}
+	if c.Logger != nil && nu.String() != u.String() {
+		c.Logger.Printf("rewrote %s to %s", redactURL(u), redactURL(nu))
+	}
+	return nu, nil
+}
+
+// decompress decompresses src into dst with d, applying the MaxBytes limit,
+// the overwrite policy and the cancellation of Ctx when d supports them. If
+// only is set, d may skip the entries not matching it. The extraction is
+// reported to the ProgressListener as name.
+func (c *Client) decompress(d Decompressor, dst, src string, dir bool, only, name string) error {
+	od, ok := d.(optionsDecompressor)
+	if !ok {
+		if c.FS != nil {
+			return fmt.Errorf("decompressor %T doesn't support Client.FS", d)
+		}
+		return d.Decompress(dst, src, dir)
+	}
+
+	opts := &decompressOptions{
+		limit:          newByteLimit(c.MaxBytes),
+		overwrite:      c.Overwrite,
+		caseCollisions: &caseCollisions{policy: c.CaseCollisions},
+		only:           only,
+		umask:          c.Umask,
+		dirMode:        c.DirMode,
+		fs:             c.FS,
+		ctx:            c.Ctx,
+		progress:       c.ProgressListener,
+		name:           name,
+	}
+	_, statErr := opts.filesystem().Lstat(dst)
+	var before dirSnapshot
+	if opts.limit != nil && c.FS == nil {
+		before = snapshotDir(dst)
+	}
+	err := od.decompress(dst, src, dir, opts)
+	if err != nil && opts.limit.exceeded() {
+		// Only remove what was extracted from an existing directory
+		if c.FS == nil {
+			before.removeWritten(dst)
+		} else if os.IsNotExist(statErr) {
+			opts.filesystem().RemoveAll(dst)
+		}
+	} else if err != nil && opts.err() != nil && os.IsNotExist(statErr) {
+		// Canceled: remove the partially extracted output, unless it went
+		// into an existing directory holding other files.
+		opts.filesystem().RemoveAll(dst)
+	}
+	return err
+}
+
+// flattenArchive moves the archive unpacked in dir to dst, without its
+// top-level directory if it is the only entry. dst is replaced by a rename
+// when it doesn't exist, the files are copied into it otherwise.
+func (c *Client) flattenArchive(dst, dir string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(fis) == 1 && fis[0].IsDir() {
+		dir = filepath.Join(dir, fis[0].Name())
+	}
+
+	if _, err := os.Lstat(dst); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dst), dirModeFromContext(c.Ctx)); err != nil {
+			return err
+		}
+		if err := os.Rename(dir, dst); err == nil {
+			return nil
+		}
+	}
+
+	// The bytes were counted when unpacking
+	if err := os.MkdirAll(dst, dirModeFromContext(c.Ctx)); err != nil {
+		return err
+	}
+	return copyDir(withByteLimit(c.Ctx, nil), dst, dir, false)
+}
+
+// moveFile moves the file src to dst, copying it when they are on different
+// filesystems.
+func moveFile(dst, src string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	srcF, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcF.Close()
+
+	dstF, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstF, srcF); err != nil {
+		dstF.Close()
+		return err
+	}
+	if err := dstF.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyArchiveFile copies the single file matching subDir in the unpacked
+// archive dir to dst.
+func (c *Client) copyArchiveFile(dst, dir, subDir string) error {
+	path, err := SubdirGlob(dir, subDir)
+	if err != nil {
+		return fmt.Errorf("archive: %s", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("archive: %q is a directory, expected a file", subDir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), dirModeFromContext(c.Ctx)); err != nil {
+		return err
+	}
+
+	srcF, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer srcF.Close()
+
+	dstF, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileModeFromContext(c.Ctx))
+	if err != nil {
+		return err
+	}
+	defer dstF.Close()
+
+	if _, err := Copy(c.Ctx, dstF, srcF); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode())
+}
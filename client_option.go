@@ -1,6 +1,9 @@
 package getter
 
-import "context"
+import (
+	"context"
+	"net/url"
+)
 
 // A ClientOption allows to configure a client
 type ClientOption func(*Client) error
@@ -17,9 +20,13 @@ func (c *Client) Configure(opts ...ClientOption) error {
 			return err
 		}
 	}
-	// Default decompressor values
+	// Default decompressor values. The global map is copied so that changes
+	// made to this client's decompressors don't leak into other clients.
 	if c.Decompressors == nil {
-		c.Decompressors = Decompressors
+		c.Decompressors = make(map[string]Decompressor, len(Decompressors))
+		for k, v := range Decompressors {
+			c.Decompressors[k] = v
+		}
 	}
 	// Default detector values
 	if c.Detectors == nil {
@@ -30,12 +37,55 @@ func (c *Client) Configure(opts ...ClientOption) error {
 		c.Getters = Getters
 	}
 
+	// The other getters are bound to c for each download, see bindGetter.
 	for _, getter := range c.Getters {
-		getter.SetClient(c)
+		if _, ok := asClientBinder(getter); !ok {
+			getter.SetClient(c)
+		}
 	}
 	return nil
 }
 
+// WithUserAgent sets the User-Agent sent by the HTTP, S3 and GCS getters.
+func WithUserAgent(ua string) func(*Client) error {
+	return func(c *Client) error {
+		c.UserAgent = ua
+		return nil
+	}
+}
+
+// WithFlattenArchive sets Client.FlattenArchive.
+func WithFlattenArchive(flatten bool) func(*Client) error {
+	return func(c *Client) error {
+		c.FlattenArchive = flatten
+		return nil
+	}
+}
+
+// WithExtractToNamedDir sets Client.ExtractToNamedDir.
+func WithExtractToNamedDir(named bool) func(*Client) error {
+	return func(c *Client) error {
+		c.ExtractToNamedDir = named
+		return nil
+	}
+}
+
+// WithInterceptor sets Client.Interceptor.
+func WithInterceptor(f func(*url.URL) (*url.URL, error)) func(*Client) error {
+	return func(c *Client) error {
+		c.Interceptor = f
+		return nil
+	}
+}
+
+// WithHosts sets Client.Hosts.
+func WithHosts(hosts map[string]HostConfig) func(*Client) error {
+	return func(c *Client) error {
+		c.Hosts = hosts
+		return nil
+	}
+}
+
 // WithContext allows to pass a context to operation
 // in order to be able to cancel a download in progress.
 func WithContext(ctx context.Context) func(*Client) error {
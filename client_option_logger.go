@@ -0,0 +1,134 @@
+package getter
+
+import (
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// WithLogger allows for a user to see the operations performed by the
+// getters: the commands they run, the URLs they fetch and the number of
+// bytes they download. Credentials are redacted from everything that is
+// logged.
+// Not all getters log their operations yet.
+func WithLogger(l Logger) func(*Client) error {
+	return func(c *Client) error {
+		c.Logger = l
+		return nil
+	}
+}
+
+// Logger receives the log lines describing the operations performed by
+// getters. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// redacted replaces secrets in logged values.
+const redacted = "redacted"
+
+// sensitiveQueryParams are the query parameters holding credentials, their
+// values are never logged.
+var sensitiveQueryParams = map[string]bool{
+	"access_token":          true,
+	"aws_access_key_secret": true,
+	"aws_access_token":      true,
+	"sshkey":                true,
+	"token":                 true,
+	"x-amz-credential":      true,
+	"x-amz-security-token":  true,
+	"x-amz-signature":       true,
+	"x-goog-credential":     true,
+	"x-goog-signature":      true,
+}
+
+// redactURL returns u as a string with its password, or its user name but
+// for SSH URLs, and the values of sensitive query parameters redacted.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	ru := *u
+	if _, ok := ru.User.Password(); ok {
+		ru.User = url.UserPassword(ru.User.Username(), redacted)
+	} else if ru.User != nil && ru.Scheme != "ssh" {
+		// A user name alone may be a token, as in
+		// "https://TOKEN@github.com/...", only the SSH ones are logins
+		ru.User = url.User(redacted)
+	}
+
+	if ru.RawQuery != "" {
+		q := ru.Query()
+		changed := false
+		for k := range q {
+			if sensitiveQueryParams[strings.ToLower(k)] {
+				q.Set(k, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			ru.RawQuery = q.Encode()
+		}
+	}
+
+	return ru.String()
+}
+
+// stripCredentials removes the credentials of u, for the URLs persisted by
+// go-getter such as the ones of a Lock or a ResumeToken: its userinfo, but
+// the user name of an SSH URL, e.g. "git", and its sensitive query
+// parameters. The user name of the other URLs is removed too since it may
+// be a token, as in "https://TOKEN@github.com/...".
+func stripCredentials(u *url.URL) {
+	if u.User != nil && u.Scheme == "ssh" {
+		u.User = url.User(u.User.Username())
+	} else {
+		u.User = nil
+	}
+
+	if u.RawQuery == "" {
+		return
+	}
+	q := u.Query()
+	changed := false
+	for k := range q {
+		if sensitiveQueryParams[strings.ToLower(k)] {
+			q.Del(k)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+}
+
+// redactArgs returns a copy of the command line args with the credentials
+// of URL arguments redacted.
+func redactArgs(args []string) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = arg
+		if !strings.Contains(arg, "://") {
+			continue
+		}
+		if u, err := url.Parse(arg); err == nil {
+			result[i] = redactURL(u)
+		}
+	}
+	return result
+}
+
+// logf logs an operation of the getter if its client has a Logger.
+func (g *getter) logf(format string, v ...interface{}) {
+	if g == nil || g.client == nil || g.client.Logger == nil {
+		return
+	}
+	g.client.Logger.Printf(format, v...)
+}
+
+// runCommand logs cmd, with credentials redacted, and runs it.
+func (g *getter) runCommand(cmd *exec.Cmd) error {
+	g.logf("running %s", strings.Join(redactArgs(cmd.Args), " "))
+	return getRunCommand(cmd)
+}
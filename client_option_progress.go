@@ -17,6 +17,11 @@ func WithProgress(pl ProgressTracker) func(*Client) error {
 }
 
 // ProgressTracker allows to track the progress of downloads.
+//
+// The extraction of tar and ZIP archives is tracked too, as a stream of the
+// contents of their entries named after the archive. Its total size is the
+// size of the files of a ZIP archive, and -1 for tar archives, whose size is
+// only known at the end.
 type ProgressTracker interface {
 	// TrackProgress should be called when
 	// a new object is being downloaded.
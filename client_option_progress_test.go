@@ -63,3 +63,72 @@ func TestGet_progress(t *testing.T) {
 		}
 	}
 }
+
+// extractionTracker records the total and the bytes read of the tracked
+// streams.
+type extractionTracker struct {
+	totals map[string]int64
+	read   map[string]int64
+	closed map[string]bool
+}
+
+func (p *extractionTracker) TrackProgress(src string,
+	currentSize, totalSize int64, stream io.ReadCloser) (body io.ReadCloser) {
+	p.totals[src] = totalSize
+	return &trackedReader{stream, func(n int) { p.read[src] += int64(n) }, func() { p.closed[src] = true }}
+}
+
+type trackedReader struct {
+	io.ReadCloser
+	onRead  func(int)
+	onClose func()
+}
+
+func (r *trackedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.onRead(n)
+	return n, err
+}
+
+func (r *trackedReader) Close() error {
+	r.onClose()
+	return r.ReadCloser.Close()
+}
+
+func TestGet_progressExtraction(t *testing.T) {
+	cases := []struct {
+		Archive string
+		Total   int64
+	}{
+		// The size of a tar stream is unknown
+		{"decompress-tgz/multiple.tar.gz", -1},
+		{"decompress-zip/multiple.zip", 8},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Archive, func(t *testing.T) {
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			p := &extractionTracker{
+				totals: map[string]int64{},
+				read:   map[string]int64{},
+				closed: map[string]bool{},
+			}
+			if err := Get(dst, testModule(tc.Archive), WithProgress(p)); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			name := filepath.Base(tc.Archive)
+			if total, ok := p.totals[name]; !ok || total != tc.Total {
+				t.Fatalf("expected the extraction of %s to be tracked with total %d, got %v", name, tc.Total, p.totals)
+			}
+			if p.read[name] != 8 {
+				t.Fatalf("expected 8 bytes to be extracted, got %d", p.read[name])
+			}
+			if !p.closed[name] {
+				t.Fatal("expected the tracking to end")
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	safetemp "github.com/hashicorp/go-safetemp"
+)
+
+// StdoutDst is the Client.Dst writing the downloaded file to Client.Stdout
+// instead of a path, like "-" on the command line.
+const StdoutDst = "-"
+
+// getStdout downloads the source as a single file to the Stdout writer. The
+// file is streamed to the writer when the getter can open it, see
+// streamStdout, and otherwise downloaded to a temporary path first, e.g. to
+// verify its checksum or unpack it.
+func (c *Client) getStdout() error {
+	if c.Mode == ClientModeDir || (c.Mode == ClientModeInvalid && c.Dir) {
+		return fmt.Errorf("only a single file can be downloaded to stdout")
+	}
+	if c.FS != nil {
+		return fmt.Errorf("downloads to stdout can't be used with Client.FS")
+	}
+
+	if err := c.Configure(c.Options...); err != nil {
+		return err
+	}
+	r, err := c.resolve(c.Src)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := c.streamStdout(r); ok || err != nil {
+		return err
+	}
+
+	td, tdcloser, err := safetemp.Dir(c.TmpDir, "getter")
+	if err != nil {
+		return err
+	}
+	defer tdcloser.Close()
+
+	// Download to the temporary file with the same, already resolved,
+	// source and getter
+	defer func(dst string, mode ClientMode, dir bool) {
+		c.Dst, c.Mode, c.Dir = dst, mode, dir
+	}(c.Dst, c.Mode, c.Dir)
+	c.Dst = filepath.Join(td, "file")
+	c.Mode = ClientModeFile
+	c.Dir = false
+	if err := c.getResolved(r); err != nil {
+		return err
+	}
+	if c.TreeChecksums != nil {
+		err := verifyTreeChecksums(c.Dst, c.TreeChecksums, c.TreeChecksumsStrict)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(c.Dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(c.stdout(), f)
+	return err
+}
+
+// streamStdout copies the resolved source straight from the getter to the
+// Stdout writer, without creating a file, and returns true, unless the
+// download needs a file on disk: to verify a checksum or a signature, to
+// unpack an archive, to copy a subdirectory, or to be looked up in the
+// mirror. It returns false without downloading anything then, or if the
+// getter can't stream files, which only the HTTP and GCS getters can.
+func (c *Client) streamStdout(r *resolution) (bool, error) {
+	if len(c.ComputeChecksums) > 0 || c.MirrorDir != "" || c.SniffArchives {
+		return false, nil
+	}
+	if r.subDir != "" {
+		return false, nil
+	}
+	if c.CredentialHelper != nil && credentialHelperCacheFromContext(c.Ctx) == nil {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withCredentialHelperCache(c.Ctx)
+	}
+
+	src, force, g := r.src, r.force, r.g
+	u := new(url.URL)
+	*u = *r.u
+	var err error
+	o, ok := g.(fileOpener)
+	if !ok {
+		return false, nil
+	}
+	if h, ok := g.(*HttpGetter); ok && h.AutoChecksum {
+		return false, nil
+	}
+
+	q := u.Query()
+	for _, k := range []string{"checksum", "signature", "pubkey"} {
+		if q.Get(k) != "" {
+			return false, nil
+		}
+	}
+	if v := q.Get("archive"); v != "" {
+		if b, err := strconv.ParseBool(v); err != nil || b {
+			return false, nil
+		}
+	} else if matchDecompressor(c.Decompressors, u.Path) != "" || parseSplitArchive(u.Path) != nil {
+		return false, nil
+	}
+
+	c.ComputedChecksums = nil
+
+	// Delete the magic query parameters, they aren't part of the source
+	archiveV := q.Get("archive")
+	q.Del("archive")
+	q.Del("filename")
+	u.RawQuery = q.Encode()
+
+	if u, err = c.plan(&Plan{
+		Src:    c.Src,
+		Getter: force,
+		URL:    u,
+		Dst:    c.Dst,
+		Mode:   ClientModeFile,
+	}); err != nil {
+		return true, err
+	}
+	resolved := *u
+	if archiveV != "" {
+		rq := resolved.Query()
+		rq.Set("archive", archiveV)
+		resolved.RawQuery = rq.Encode()
+	}
+	c.Resolved = &ResolvedSource{URL: resolved.String(), Getter: force}
+
+	if c.ProbeBeforeGet && shouldProbe(force, g, u) {
+		if err := probe(c.Ctx, u); err != nil {
+			return true, err
+		}
+	}
+
+	ctx := c.Ctx
+	if limit := newByteLimit(c.MaxBytes); limit != nil {
+		ctx = withByteLimit(ctx, limit)
+	}
+
+	if err := c.MaxConnections.acquire(ctx); err != nil {
+		return true, err
+	}
+	defer c.MaxConnections.release()
+
+	rc, err := o.openFile(u)
+	if err != nil {
+		return true, fmt.Errorf("error downloading '%s': %w", src, err)
+	}
+	defer rc.Close()
+
+	if _, err := Copy(ctx, c.stdout(), rc); err != nil {
+		return true, fmt.Errorf("error downloading '%s': %w", src, err)
+	}
+	return true, nil
+}
+
+// stdout returns the Stdout writer, defaulting to os.Stdout.
+func (c *Client) stdout() io.Writer {
+	if c.Stdout == nil {
+		return os.Stdout
+	}
+	return c.Stdout
+}
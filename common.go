@@ -1,7 +1,13 @@
 package getter
 
 import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 func tmpFile(dir, pattern string) (string, error) {
@@ -12,3 +18,63 @@ func tmpFile(dir, pattern string) (string, error) {
 	f.Close()
 	return f.Name(), nil
 }
+
+// missingDir returns the topmost directory that os.MkdirAll(path) would
+// create, or "" if path already exists.
+func missingDir(path string) string {
+	missing := ""
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return missing
+		}
+		missing = path
+		parent := filepath.Dir(path)
+		if parent == path {
+			return missing
+		}
+		path = parent
+	}
+}
+
+// fileMatches reports whether the regular file at path has the given size
+// and the checksum sum computed by h, for the sync modes of the getters.
+func fileMatches(path string, size int64, h hash.Hash, sum []byte) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != size {
+		return false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return bytes.Equal(h.Sum(nil), sum)
+}
+
+// ObjectPathMapper maps the name of an object of a directory download to
+// the path of its file, relative to the destination. Returning skip omits
+// the object. See GCSGetter.PathMapper and S3Getter.PathMapper.
+type ObjectPathMapper func(name string) (path string, skip bool)
+
+// mapObject returns the path of the object name relative to the
+// destination, def with a nil mapper. ok is false for the objects to skip.
+// The mapped path must be relative and stay within the destination.
+func (m ObjectPathMapper) mapObject(name, def string) (path string, ok bool, err error) {
+	if m == nil {
+		return def, true, nil
+	}
+	path, skip := m(name)
+	if skip {
+		return "", false, nil
+	}
+	path = filepath.Clean(filepath.FromSlash(path))
+	if path == "." || filepath.IsAbs(path) || containsDotDot(path) {
+		return "", false, fmt.Errorf("invalid path %q mapped for object %s", path, name)
+	}
+	return path, true, nil
+}
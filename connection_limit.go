@@ -0,0 +1,54 @@
+package getter
+
+import "context"
+
+// ConnectionLimit caps the number of downloads running at the same time
+// across the clients sharing it, see Client.MaxConnections. It is safe for
+// concurrent use.
+type ConnectionLimit struct {
+	slots chan struct{}
+}
+
+// NewConnectionLimit returns a ConnectionLimit allowing max downloads at
+// the same time, at least one.
+func NewConnectionLimit(max int) *ConnectionLimit {
+	if max < 1 {
+		max = 1
+	}
+	return &ConnectionLimit{slots: make(chan struct{}, max)}
+}
+
+// acquire waits for a free slot, or for ctx to be done. It returns
+// immediately for a nil ConnectionLimit.
+func (l *ConnectionLimit) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot taken with acquire.
+func (l *ConnectionLimit) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+type connectionLimitKey struct{}
+
+// withConnectionLimit returns a copy of ctx carrying l, for the getters
+// opening more connections than the one of their download.
+func withConnectionLimit(ctx context.Context, l *ConnectionLimit) context.Context {
+	return context.WithValue(ctx, connectionLimitKey{}, l)
+}
+
+func connectionLimitFromContext(ctx context.Context) *ConnectionLimit {
+	l, _ := ctx.Value(connectionLimitKey{}).(*ConnectionLimit)
+	return l
+}
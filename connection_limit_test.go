@@ -0,0 +1,159 @@
+package getter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_maxConnections(t *testing.T) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	g := new(concurrencyGetter)
+	base := Client{
+		Getters:        map[string]Getter{"test": g},
+		Mode:           ClientModeFile,
+		MaxConnections: NewConnectionLimit(2),
+	}
+
+	const n = 8
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		c := base
+		c.Src = fmt.Sprintf("test://host/file-%d", i)
+		c.Dst = filepath.Join(td, fmt.Sprintf("file-%d", i))
+
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			errs <- c.Get()
+		}(&c)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if g.calls != n {
+		t.Fatalf("expected %d downloads, got %d", n, g.calls)
+	}
+	if g.max != 2 {
+		t.Fatalf("expected at most 2 concurrent downloads, got %d", g.max)
+	}
+}
+
+func TestMultipartDownload_connectionLimit(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	limit := NewConnectionLimit(2)
+	ctx := withConnectionLimit(context.Background(), limit)
+
+	// The download itself holds a connection
+	if err := limit.acquire(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer limit.release()
+
+	var c concurrencyCounter
+	dst := &bytesWriterAt{buf: make([]byte, len(data))}
+	err := multipartDownload(ctx, dst, 0, int64(len(data)), 100, 4,
+		func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+			c.start()
+			time.Sleep(10 * time.Millisecond)
+			r := bytes.NewReader(data[offset : offset+length])
+			return &closerFunc{Reader: r, close: c.done}, nil
+		})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(dst.buf, data) {
+		t.Fatal("bad contents")
+	}
+	if c.max > 2 {
+		t.Fatalf("expected at most 2 concurrent parts, got %d", c.max)
+	}
+}
+
+// concurrencyCounter records the maximum number of operations running at
+// the same time.
+type concurrencyCounter struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	calls   int
+}
+
+func (c *concurrencyCounter) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running++
+	c.calls++
+	if c.running > c.max {
+		c.max = c.running
+	}
+}
+
+func (c *concurrencyCounter) done() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+}
+
+// concurrencyGetter is a Getter whose downloads last a while, counting how
+// many run at the same time.
+type concurrencyGetter struct {
+	concurrencyCounter
+}
+
+func (g *concurrencyGetter) GetFile(dst string, u *url.URL) error {
+	g.start()
+	defer g.done()
+	time.Sleep(50 * time.Millisecond)
+	return ioutil.WriteFile(dst, []byte(u.Path), 0644)
+}
+
+func (g *concurrencyGetter) Get(dst string, u *url.URL) error {
+	return fmt.Errorf("not supported")
+}
+
+func (g *concurrencyGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	return ClientModeFile, nil
+}
+
+func (g *concurrencyGetter) SetClient(*Client) {}
+
+type closerFunc struct {
+	io.Reader
+	close func()
+}
+
+func (c *closerFunc) Close() error {
+	c.close()
+	return nil
+}
+
+type bytesWriterAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *bytesWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return copy(w.buf[off:], p), nil
+}
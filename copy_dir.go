@@ -46,7 +46,7 @@ func copyDir(ctx context.Context, dst string, src string, ignoreDot bool) error
 				return nil
 			}
 
-			if err := os.MkdirAll(dstPath, 0755); err != nil {
+			if err := os.MkdirAll(dstPath, dirModeFromContext(ctx)); err != nil {
 				return err
 			}
 
@@ -0,0 +1,270 @@
+package getter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// CredentialHelper obtains credentials at request time from an external
+// executable, see Client.CredentialHelper. The helper is run with Args and
+// then the name of a host, or for the GCS and Artifact Registry getters the
+// bucket or repository resource also given to
+// CredentialProvider.GoogleTokenSource, and prints a JSON object:
+//
+//	{
+//	  "username": "...",
+//	  "password": "...",
+//	  "headers": {"X-Token": "..."},
+//	  "aws_access_key_id": "...",
+//	  "aws_secret_access_key": "...",
+//	  "aws_session_token": "...",
+//	  "google_access_token": "...",
+//	  "ttl": 300
+//	}
+//
+// where every field is optional, an empty object meaning that there are no
+// credentials for the host. The username, password, headers and AWS keys
+// are used like the ones of a HostConfig, and google_access_token is the
+// OAuth2 access token of the GCS and Artifact Registry getters. The result
+// is cached for ttl seconds. Without one, it is only cached for the
+// download it was obtained for, and the Google access token used for the
+// whole download.
+//
+// A CredentialHelper may be shared by several clients. It is run once at a
+// time for a host, the concurrent lookups of the host waiting for its
+// result.
+type CredentialHelper struct {
+	// Command is the path of the helper executable, looked up in PATH if
+	// it has no path separator.
+	Command string
+
+	// Args are the arguments the helper is run with, before the host.
+	Args []string
+
+	mu    sync.Mutex
+	cache map[string]*credentialHelperResult
+	calls map[string]*credentialHelperCall
+}
+
+// credentialHelperCall is a run of a CredentialHelper for a host, whose
+// result is set once done is closed.
+type credentialHelperCall struct {
+	done chan struct{}
+	r    *credentialHelperResult
+	err  error
+}
+
+// credentialHelperResult is the output of a credential helper.
+type credentialHelperResult struct {
+	Username           string            `json:"username"`
+	Password           string            `json:"password"`
+	Headers            map[string]string `json:"headers"`
+	AWSAccessKeyID     string            `json:"aws_access_key_id"`
+	AWSSecretAccessKey string            `json:"aws_secret_access_key"`
+	AWSSessionToken    string            `json:"aws_session_token"`
+	GoogleAccessToken  string            `json:"google_access_token"`
+	TTL                int64             `json:"ttl"`
+
+	expires time.Time
+}
+
+// hostConfig returns the configuration of the credentials of the result,
+// and whether there are any.
+func (r *credentialHelperResult) hostConfig() (HostConfig, bool) {
+	hc := HostConfig{
+		Username:           r.Username,
+		Password:           r.Password,
+		AWSAccessKeyID:     r.AWSAccessKeyID,
+		AWSSecretAccessKey: r.AWSSecretAccessKey,
+		AWSSessionToken:    r.AWSSessionToken,
+	}
+	if len(r.Headers) > 0 {
+		hc.Header = make(http.Header, len(r.Headers))
+		for k, v := range r.Headers {
+			hc.Header.Set(k, v)
+		}
+	}
+	ok := hc.Username != "" || hc.AWSAccessKeyID != "" || len(hc.Header) > 0
+	return hc, ok
+}
+
+// lookup returns the credentials of host, from the caches or else from
+// the helper. The helper isn't run for host while another lookup runs it.
+func (h *CredentialHelper) lookup(ctx context.Context, host string) (*credentialHelperResult, error) {
+	download := credentialHelperCacheFromContext(ctx)
+	if r := download.get(h, host); r != nil {
+		return r, nil
+	}
+
+	h.mu.Lock()
+	if r, ok := h.cache[host]; ok && time.Now().Before(r.expires) {
+		h.mu.Unlock()
+		return r, nil
+	}
+	if call, ok := h.calls[host]; ok {
+		h.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.r, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &credentialHelperCall{done: make(chan struct{})}
+	if h.calls == nil {
+		h.calls = make(map[string]*credentialHelperCall)
+	}
+	h.calls[host] = call
+	h.mu.Unlock()
+
+	call.r, call.err = h.run(ctx, host)
+
+	h.mu.Lock()
+	delete(h.calls, host)
+	if call.err == nil && call.r.TTL > 0 {
+		if h.cache == nil {
+			h.cache = make(map[string]*credentialHelperResult)
+		}
+		h.cache[host] = call.r
+	}
+	h.mu.Unlock()
+	close(call.done)
+
+	if call.err == nil && call.r.TTL <= 0 {
+		download.set(h, host, call.r)
+	}
+	return call.r, call.err
+}
+
+// run runs the helper for host.
+func (h *CredentialHelper) run(ctx context.Context, host string) (*credentialHelperResult, error) {
+	args := append(append([]string{}, h.Args...), host)
+	cmd := exec.CommandContext(ctx, h.Command, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running credential helper %s for %s: %s: %s",
+			h.Command, host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	r := new(credentialHelperResult)
+	if err := json.Unmarshal(stdout.Bytes(), r); err != nil {
+		return nil, fmt.Errorf("error decoding the output of credential helper %s for %s: %s",
+			h.Command, host, err)
+	}
+	if r.TTL > 0 {
+		r.expires = time.Now().Add(time.Duration(r.TTL) * time.Second)
+	}
+	return r, nil
+}
+
+// credentialHelperCache holds the results without a TTL of the helpers run
+// during one download, see withCredentialHelperCache.
+type credentialHelperCache struct {
+	mu      sync.Mutex
+	results map[credentialHelperKey]*credentialHelperResult
+}
+
+type credentialHelperKey struct {
+	helper *CredentialHelper
+	host   string
+}
+
+func (c *credentialHelperCache) get(h *CredentialHelper, host string) *credentialHelperResult {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[credentialHelperKey{h, host}]
+}
+
+func (c *credentialHelperCache) set(h *CredentialHelper, host string, r *credentialHelperResult) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil {
+		c.results = make(map[credentialHelperKey]*credentialHelperResult)
+	}
+	c.results[credentialHelperKey{h, host}] = r
+}
+
+type credentialHelperCacheKey struct{}
+
+// withCredentialHelperCache returns ctx caching the results of the
+// credential helpers that have no TTL, for the download ctx is the context
+// of.
+func withCredentialHelperCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, credentialHelperCacheKey{}, new(credentialHelperCache))
+}
+
+func credentialHelperCacheFromContext(ctx context.Context) *credentialHelperCache {
+	c, _ := ctx.Value(credentialHelperCacheKey{}).(*credentialHelperCache)
+	return c
+}
+
+// hostConfig returns the configuration of the credentials of host, and
+// whether there are any.
+func (h *CredentialHelper) hostConfig(ctx context.Context, host string) (HostConfig, bool, error) {
+	r, err := h.lookup(ctx, host)
+	if err != nil {
+		return HostConfig{}, false, err
+	}
+	hc, ok := r.hostConfig()
+	return hc, ok, nil
+}
+
+// helperCredentials is the CredentialProvider of the Google access tokens
+// of a CredentialHelper. The AWS credentials are found from the host
+// configuration of the helper instead.
+type helperCredentials struct {
+	EnvCredentials
+
+	helper *CredentialHelper
+}
+
+func (p helperCredentials) GoogleTokenSource(ctx context.Context, resource string) (oauth2.TokenSource, error) {
+	r, err := p.helper.lookup(ctx, resource)
+	if err != nil || r.GoogleAccessToken == "" {
+		return nil, err
+	}
+	ts := &helperTokenSource{helper: p.helper, resource: resource}
+	return oauth2.ReuseTokenSource(ts.token(r), ts), nil
+}
+
+// helperTokenSource is a token source asking a CredentialHelper for the
+// token of resource again once it expires.
+type helperTokenSource struct {
+	helper   *CredentialHelper
+	resource string
+}
+
+func (ts *helperTokenSource) Token() (*oauth2.Token, error) {
+	// The token source outlives the download context
+	r, err := ts.helper.lookup(context.Background(), ts.resource)
+	if err != nil {
+		return nil, err
+	}
+	if r.GoogleAccessToken == "" {
+		return nil, fmt.Errorf("credential helper %s returned no Google access token for %s",
+			ts.helper.Command, ts.resource)
+	}
+	return ts.token(r), nil
+}
+
+// token returns the OAuth2 token of the result r.
+func (ts *helperTokenSource) token(r *credentialHelperResult) *oauth2.Token {
+	return &oauth2.Token{AccessToken: r.GoogleAccessToken, Expiry: r.expires}
+}
@@ -0,0 +1,267 @@
+package getter
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCredentialHelper writes a credential helper script printing output,
+// and recording the hosts it is run for in a log file, to dir, creating it.
+func testCredentialHelper(t *testing.T, dir, output string) (*CredentialHelper, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper scripts need a POSIX shell")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	log := filepath.Join(dir, "helper.log")
+	script := filepath.Join(dir, "helper.sh")
+	contents := "#!/bin/sh\necho \"$2\" >> \"$1\"\ncat <<'EOF'\n" + output + "\nEOF\n"
+	if err := ioutil.WriteFile(script, []byte(contents), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &CredentialHelper{Command: script, Args: []string{log}}, log
+}
+
+// testCredentialHelperRuns returns the hosts the helper logging to log was
+// run for.
+func testCredentialHelperRuns(t *testing.T, log string) []string {
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestCredentialHelper_http(t *testing.T) {
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	helper, log := testCredentialHelper(t, td,
+		`{"username": "foo", "password": "bar", "headers": {"X-Token": "secret"}, "ttl": 60}`)
+
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	g := new(HttpGetter)
+	g.SetClient(&Client{Ctx: context.Background(), CredentialHelper: helper})
+	for _, name := range []string{"a", "b"} {
+		if err := g.GetFile(filepath.Join(td, name), testURL(srv.URL+"/file")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	for _, r := range requests {
+		if user, pass, _ := r.BasicAuth(); user != "foo" || pass != "bar" {
+			t.Fatalf("bad credentials: %q %q", user, pass)
+		}
+		if v := r.Header.Get("X-Token"); v != "secret" {
+			t.Fatalf("bad X-Token: %q", v)
+		}
+	}
+
+	// The credentials were cached for their TTL
+	if runs := testCredentialHelperRuns(t, log); len(runs) != 1 || runs[0] != "127.0.0.1" {
+		t.Fatalf("bad helper runs: %q", runs)
+	}
+}
+
+func TestCredentialHelper_noTTL(t *testing.T) {
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	helper, log := testCredentialHelper(t, td, `{"username": "foo"}`)
+	for i := 0; i < 2; i++ {
+		if _, ok, err := helper.hostConfig(context.Background(), "example.com"); err != nil || !ok {
+			t.Fatalf("expected credentials, got %v", err)
+		}
+	}
+	if runs := testCredentialHelperRuns(t, log); len(runs) != 2 {
+		t.Fatalf("bad helper runs: %q", runs)
+	}
+}
+
+func TestCredentialHelper_gcs(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	helper, log := testCredentialHelper(t, filepath.Dir(dst), `{"google_access_token": "secret", "ttl": 60}`)
+
+	// The storage client never authenticates the requests to an emulator,
+	// unless they go through a custom transport
+	g := &GCSGetter{Transport: &TransportOptions{}}
+	g.SetClient(&Client{Ctx: context.Background(), CredentialHelper: helper})
+	if err := g.GetFile(dst, testURL("gcs://bucket/foo.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	for _, r := range srv.Requests() {
+		if v := r.Header.Get("Authorization"); v != "Bearer secret" {
+			t.Fatalf("%s %s: bad Authorization %q", r.Method, r.URL, v)
+		}
+	}
+	if runs := testCredentialHelperRuns(t, log); len(runs) == 0 || runs[0] != "bucket" {
+		t.Fatalf("bad helper runs: %q", runs)
+	}
+}
+
+func TestCredentialHelper_error(t *testing.T) {
+	helper := &CredentialHelper{Command: "false"}
+	_, _, err := helper.hostConfig(context.Background(), "example.com")
+	if err == nil || !strings.Contains(err.Error(), "credential helper") {
+		t.Fatalf("expected a helper error, got %v", err)
+	}
+}
+
+func TestCredentialHelper_noTTLDownload(t *testing.T) {
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	helper, log := testCredentialHelper(t, td, `{"username": "foo", "password": "bar"}`)
+
+	content := strings.Repeat("a", 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "foo" || pass != "bar" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	// The parts of a download share the result of the helper, which is run
+	// again for the next download
+	for _, name := range []string{"a", "b"} {
+		client := &Client{
+			Src:              srv.URL + "/file",
+			Dst:              filepath.Join(td, name),
+			Mode:             ClientModeFile,
+			CredentialHelper: helper,
+			Getters:          map[string]Getter{"http": &HttpGetter{PartSize: 10}},
+		}
+		if err := client.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		assertContents(t, client.Dst, content)
+	}
+	if runs := testCredentialHelperRuns(t, log); len(runs) != 2 {
+		t.Fatalf("bad helper runs: %q", runs)
+	}
+}
+
+func TestCredentialHelper_concurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("credential helper scripts need a POSIX shell")
+	}
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	if err := os.MkdirAll(td, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A slow helper is run once for the lookups of a host made meanwhile
+	log := filepath.Join(td, "helper.log")
+	script := filepath.Join(td, "helper.sh")
+	contents := "#!/bin/sh\necho \"$2\" >> \"$1\"\nsleep 1\necho '{\"username\": \"foo\"}'\n"
+	if err := ioutil.WriteFile(script, []byte(contents), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	helper := &CredentialHelper{Command: script, Args: []string{log}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := helper.hostConfig(context.Background(), "example.com")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if runs := testCredentialHelperRuns(t, log); len(runs) != 1 {
+		t.Fatalf("bad helper runs: %q", runs)
+	}
+}
+
+func TestCredentialHelper_errorFailsDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	// The S3 credentials of the host can't be looked up either
+	for _, src := range []string{srv.URL + "/file", "s3::" + srv.URL + "/bucket/file"} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		client := &Client{
+			Src:              src,
+			Dst:              dst,
+			Mode:             ClientModeFile,
+			CredentialHelper: &CredentialHelper{Command: "false"},
+		}
+		if err := client.Get(); err == nil || !strings.Contains(err.Error(), "credential helper") {
+			t.Fatalf("%s: expected a helper error, got %v", src, err)
+		}
+	}
+}
+
+func TestCredentialHelper_checksumFile(t *testing.T) {
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	helper, _ := testCredentialHelper(t, td, `{"username": "foo", "password": "bar"}`)
+
+	const content = "Hello\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "foo" || pass != "bar" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/file.sha256" {
+			fmt.Fprintf(w, "%x  file\n", sha256.Sum256([]byte(content)))
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	// The checksum file is fetched with the credentials of the helper too
+	dst := filepath.Join(td, "file")
+	client := &Client{
+		Src:              srv.URL + "/file?checksum=file:" + srv.URL + "/file.sha256",
+		Dst:              dst,
+		Mode:             ClientModeFile,
+		CredentialHelper: helper,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, content)
+}
@@ -0,0 +1,40 @@
+package getter
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/oauth2"
+)
+
+// CredentialProvider supplies the credentials of the cloud getters
+// programmatically, see Client.Credentials. A method returning nil lets the
+// getter look up the credentials of the environment as usual. The
+// credentials given in the source URL, and the ones of Client.Hosts, take
+// precedence over the provider.
+//
+// Embed EnvCredentials in a provider to only override some of the methods.
+type CredentialProvider interface {
+	// GoogleTokenSource returns the token source authenticating the
+	// requests for resource: the bucket of a GCS object, or the repository
+	// of an Artifact Registry file, as
+	// "projects/PROJECT/locations/LOCATION/repositories/REPOSITORY".
+	GoogleTokenSource(ctx context.Context, resource string) (oauth2.TokenSource, error)
+
+	// AWSCredentials returns the credentials of the S3 requests for
+	// bucket, on the host of the source URL.
+	AWSCredentials(ctx context.Context, host, bucket string) (*credentials.Credentials, error)
+}
+
+// EnvCredentials is the default CredentialProvider: the getters use the
+// credentials of the environment, such as the application default
+// credentials of Google Cloud and the credential chain of AWS.
+type EnvCredentials struct{}
+
+func (EnvCredentials) GoogleTokenSource(context.Context, string) (oauth2.TokenSource, error) {
+	return nil, nil
+}
+
+func (EnvCredentials) AWSCredentials(context.Context, string, string) (*credentials.Credentials, error) {
+	return nil, nil
+}
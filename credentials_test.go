@@ -0,0 +1,38 @@
+package getter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"golang.org/x/oauth2"
+)
+
+// testCredentialProvider is a CredentialProvider recording the resources
+// it is asked credentials for.
+type testCredentialProvider struct {
+	EnvCredentials
+
+	token string
+	aws   *credentials.Credentials
+
+	mu        sync.Mutex
+	resources []string
+}
+
+func (p *testCredentialProvider) GoogleTokenSource(_ context.Context, resource string) (oauth2.TokenSource, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resources = append(p.resources, resource)
+	if p.token == "" {
+		return nil, nil
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.token}), nil
+}
+
+func (p *testCredentialProvider) AWSCredentials(_ context.Context, host, bucket string) (*credentials.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resources = append(p.resources, host+"/"+bucket)
+	return p.aws, nil
+}
@@ -1,7 +1,16 @@
 package getter
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Decompressor defines the interface that must be implemented to add
@@ -17,6 +26,280 @@ type Decompressor interface {
 	Decompress(dst, src string, dir bool) error
 }
 
+// decompressOptions are the Client settings honored by the built-in
+// decompressors. A nil *decompressOptions means no options.
+type decompressOptions struct {
+	// limit, if set, caps the number of bytes decompressed.
+	limit *byteLimit
+
+	// overwrite tells which existing files may be replaced.
+	overwrite OverwritePolicy
+
+	// caseCollisions, if set, applies the CaseCollisionPolicy to the paths
+	// of the extracted files.
+	caseCollisions *caseCollisions
+
+	// only, if set, is the path or glob pattern of the archive entries to
+	// extract in directory mode, along with the entries below them, the
+	// other entries are skipped.
+	only string
+
+	// umask, if set, masks the modes of the extracted files and
+	// directories instead of the process umask.
+	umask os.FileMode
+
+	// dirMode, if set, is the mode of the directories created for the
+	// entries, as Client.DirMode.
+	dirMode os.FileMode
+
+	// fs, if set, is the filesystem the entries are extracted to instead
+	// of OSFS.
+	fs FS
+
+	// ctx, if set, aborts the decompression when done.
+	ctx context.Context
+
+	// progress, if set, tracks the extraction of the tar and ZIP archives,
+	// reported as name.
+	progress ProgressTracker
+	name     string
+}
+
+// optionsDecompressor is implemented by the decompressors that honor
+// decompressOptions.
+type optionsDecompressor interface {
+	decompress(dst, src string, dir bool, opts *decompressOptions) error
+}
+
+// reader wraps r according to the options.
+func (o *decompressOptions) reader(r io.Reader) io.Reader {
+	if o == nil {
+		return r
+	}
+	if o.limit != nil {
+		r = o.limit.reader(r)
+	}
+	if o.ctx != nil {
+		r = contextReader(o.ctx, r)
+	}
+	return r
+}
+
+// err returns the error of the context once it is done, so that the
+// decompressors can stop between two entries.
+func (o *decompressOptions) err() error {
+	if o == nil || o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// contextReader returns a reader failing with the error of ctx once it is
+// done, so that the extraction of a large entry stops promptly.
+func contextReader(ctx context.Context, r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		return r.Read(p)
+	})
+}
+
+// trackProgress starts tracking the extraction of the archive src, whose
+// entries hold total bytes, -1 if unknown. It returns nil without a
+// ProgressTracker.
+func (o *decompressOptions) trackProgress(src string, total int64) *extractProgress {
+	if o == nil || o.progress == nil {
+		return nil
+	}
+	name := o.name
+	if name == "" {
+		name = filepath.Base(src)
+	}
+	p := &extractProgress{}
+	p.body = o.progress.TrackProgress(name, 0, total, p)
+	return p
+}
+
+// extractProgress is the stream given to a ProgressTracker for the
+// extraction of an archive: the contents of its entries, one after the
+// other.
+type extractProgress struct {
+	entry io.Reader
+	body  io.ReadCloser
+
+	// mu serializes the reads of the entries extracted in parallel.
+	mu sync.Mutex
+}
+
+func (p *extractProgress) Read(b []byte) (int, error) { return p.entry.Read(b) }
+
+func (p *extractProgress) Close() error { return nil }
+
+// reader returns the reader of the contents r of an entry, tracked by the
+// ProgressTracker.
+func (p *extractProgress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	p.entry = r
+	return p.body
+}
+
+// concurrentReader is reader for the entries extracted in parallel: the
+// contents are read from r concurrently, and then passed through the
+// ProgressTracker one read at a time.
+func (p *extractProgress) concurrentReader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		if n == 0 {
+			return n, err
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.entry = bytes.NewReader(b[:n])
+		for m := 0; m < n; {
+			k, rerr := p.body.Read(b[m:n])
+			m += k
+			if rerr != nil {
+				break
+			}
+		}
+		return n, err
+	})
+}
+
+// close ends the tracking of the extraction.
+func (p *extractProgress) close() {
+	if p != nil {
+		p.body.Close()
+	}
+}
+
+// filesystem returns the FS the entries are extracted to.
+func (o *decompressOptions) filesystem() FS {
+	if o == nil || o.fs == nil {
+		return OSFS
+	}
+	return o.fs
+}
+
+// shouldWrite reports whether a file last modified at mtime must be
+// extracted at path according to the overwrite policy.
+func (o *decompressOptions) shouldWrite(path string, mtime time.Time) (bool, error) {
+	if o == nil {
+		return true, nil
+	}
+	return o.overwrite.shouldWriteFS(o.filesystem(), path, mtime)
+}
+
+// mode returns the mode to give to an extracted entry of mode m.
+func (o *decompressOptions) mode(m os.FileMode) os.FileMode {
+	if o == nil {
+		return m
+	}
+	return m &^ o.umask
+}
+
+// chmod sets the mode of an entry extracted at path to m, masked with
+// umask.
+func (o *decompressOptions) chmod(path string, m os.FileMode) error {
+	return o.filesystem().Chmod(path, o.mode(m))
+}
+
+// chtimes sets the access and modification times of an entry extracted at
+// path.
+func (o *decompressOptions) chtimes(path string, atime, mtime time.Time) error {
+	return o.filesystem().Chtimes(path, atime, mtime)
+}
+
+// create creates the file path for writing. With umask set, it gets the
+// mode 0666 masked with it.
+func (o *decompressOptions) create(path string) (io.WriteCloser, error) {
+	fs := o.filesystem()
+	f, err := fs.Create(path)
+	if err != nil || o == nil || o.umask == 0 {
+		return f, err
+	}
+	if err := fs.Chmod(path, o.mode(0666)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// mkdirAll creates the directory path and its parents with the mode
+// dirMode, 0755 by default. With umask set, the created directories get
+// dirMode, 0777 by default, masked with it.
+func (o *decompressOptions) mkdirAll(path string) error {
+	fs := o.filesystem()
+	if o == nil || o.umask == 0 {
+		if o == nil || o.dirMode == 0 {
+			return fs.MkdirAll(path, defaultDirMode)
+		}
+		return fs.MkdirAll(path, o.dirMode)
+	}
+	perm := o.dirMode
+	if perm == 0 {
+		perm = 0777
+	}
+
+	// Find the directories to create to chmod them afterwards, MkdirAll
+	// is subject to the process umask.
+	var created []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := fs.Lstat(p); err == nil || !os.IsNotExist(err) {
+			break
+		}
+		created = append(created, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	if err := fs.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	for _, p := range created {
+		if err := fs.Chmod(p, o.mode(perm)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// casePath returns the path to extract the file at path to, according to
+// the CaseCollisionPolicy.
+func (o *decompressOptions) casePath(path string) (string, error) {
+	if o == nil {
+		return path, nil
+	}
+	return o.caseCollisions.path(path)
+}
+
+// skip reports whether the archive entry name must not be extracted
+// according to the options.
+func (o *decompressOptions) skip(name string) bool {
+	if o == nil || o.only == "" {
+		return false
+	}
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	only := strings.Trim(path.Clean("/"+filepath.ToSlash(o.only)), "/")
+
+	// Match the leading elements of name, as many as the pattern has, so
+	// that the entries below a matching directory are kept too
+	n := strings.Count(only, "/") + 1
+	if elems := strings.SplitN(name, "/", n+1); len(elems) > n {
+		name = strings.Join(elems[:n], "/")
+	}
+	ok, _ := path.Match(only, name)
+	return !ok
+}
+
 // Decompressors is the mapping of extension to the Decompressor implementation
 // that will decompress that extension/type.
 var Decompressors map[string]Decompressor
@@ -40,6 +323,75 @@ func init() {
 	}
 }
 
+// DecompressorForPath returns the decompressor of Decompressors that a
+// Client would use for a file at path, based on its extension. The longest
+// matching extension wins, so "foo.tar.gz" is matched with "tar.gz" rather
+// than "gz". See matchDecompressor for the names matching nothing.
+func DecompressorForPath(path string) (Decompressor, bool) {
+	d, ok := Decompressors[matchDecompressor(Decompressors, path)]
+	return d, ok
+}
+
+// matchDecompressor returns the longest key of decompressors that is an
+// extension of the base name of path, compared case-insensitively, or "" if
+// none is or the match is ambiguous.
+//
+// Only the last segments of the name count: "foo.tar.gz.part" matches
+// nothing. A match is ambiguous when it ends a longer key whose other
+// segments appear earlier in the name, as for "foo.tar.backup.gz" and
+// "tar.gz": the file may hold a tar archive that "gz" alone would leave
+// packed.
+func matchDecompressor(decompressors map[string]Decompressor, path string) string {
+	name := strings.ToLower(path[strings.LastIndexAny(path, `/\`)+1:])
+
+	match := ""
+	for k := range decompressors {
+		ext := "." + strings.ToLower(k)
+		if len(name) > len(ext) && strings.HasSuffix(name, ext) && len(k) > len(match) {
+			match = k
+		}
+	}
+	if match == "" {
+		return ""
+	}
+
+	// The extensions before the match, e.g. ".tar.backup." for
+	// "foo.tar.backup.gz"
+	before := name[:len(name)-len(match)-1]
+	i := strings.Index(before, ".")
+	if i < 0 {
+		return match
+	}
+	exts := before[i:] + "."
+	for k := range decompressors {
+		rest := strings.TrimSuffix(strings.ToLower(k), "."+strings.ToLower(match))
+		if len(rest) < len(k) && strings.Contains(exts, "."+rest+".") {
+			return ""
+		}
+	}
+	return match
+}
+
+// archiveDirName returns the name of the directory to unpack the archive
+// name to with Client.ExtractToNamedDir: name without the extension of the
+// decompressor key, or of the one it matches if the archive type was given
+// otherwise, e.g. "release" for "release.tar.gz" or "release.tgz".
+func archiveDirName(decompressors map[string]Decompressor, name, key string) (string, error) {
+	ext := "." + strings.ToLower(key)
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		ext = ""
+		if k := matchDecompressor(decompressors, name); k != "" {
+			ext = "." + k
+		}
+	}
+	if len(name) > len(ext) {
+		if dir, ok := safeFilename(name[:len(name)-len(ext)]); ok {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("cannot name a directory after the archive %q", name)
+}
+
 // containsDotDot checks if the filepath value v contains a ".." entry.
 // This will check filepath components by splitting along / or \. This
 // function is copied directly from the Go net/http implementation.
@@ -13,13 +13,17 @@ import (
 type Bzip2Decompressor struct{}
 
 func (d *Bzip2Decompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *Bzip2Decompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// Directory isn't supported at all
 	if dir {
 		return fmt.Errorf("bzip2-compressed files can only unarchive to a single file")
 	}
 
 	// If we're going into a directory we should make that first
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := opts.mkdirAll(filepath.Dir(dst)); err != nil {
 		return err
 	}
 
@@ -33,13 +37,19 @@ func (d *Bzip2Decompressor) Decompress(dst, src string, dir bool) error {
 	// Bzip2 compression is second
 	bzipR := bzip2.NewReader(f)
 
+	if fi, err := f.Stat(); err != nil {
+		return err
+	} else if ok, err := opts.shouldWrite(dst, fi.ModTime()); err != nil || !ok {
+		return err
+	}
+
 	// Copy it out
-	dstF, err := os.Create(dst)
+	dstF, err := opts.create(dst)
 	if err != nil {
 		return err
 	}
 	defer dstF.Close()
 
-	_, err = io.Copy(dstF, bzipR)
+	_, err = io.Copy(dstF, opts.reader(bzipR))
 	return err
 }
@@ -13,13 +13,17 @@ import (
 type GzipDecompressor struct{}
 
 func (d *GzipDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *GzipDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// Directory isn't supported at all
 	if dir {
 		return fmt.Errorf("gzip-compressed files can only unarchive to a single file")
 	}
 
 	// If we're going into a directory we should make that first
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := opts.mkdirAll(filepath.Dir(dst)); err != nil {
 		return err
 	}
 
@@ -37,13 +41,23 @@ func (d *GzipDecompressor) Decompress(dst, src string, dir bool) error {
 	}
 	defer gzipR.Close()
 
+	mtime := gzipR.ModTime
+	if mtime.IsZero() {
+		if fi, err := f.Stat(); err == nil {
+			mtime = fi.ModTime()
+		}
+	}
+	if ok, err := opts.shouldWrite(dst, mtime); err != nil || !ok {
+		return err
+	}
+
 	// Copy it out
-	dstF, err := os.Create(dst)
+	dstF, err := opts.create(dst)
 	if err != nil {
 		return err
 	}
 	defer dstF.Close()
 
-	_, err = io.Copy(dstF, gzipR)
+	_, err = io.Copy(dstF, opts.reader(gzipR))
 	return err
 }
@@ -0,0 +1,83 @@
+package getter
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/ulikunitz/xz"
+)
+
+// The magic numbers of the formats recognized by sniffDecompressor, along
+// with gzipMagic.
+var (
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zipMagics  = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}
+)
+
+// tarHeaderSize is the size of a tar header, holding the "ustar" magic of
+// the POSIX and GNU formats at tarMagicOffset.
+const (
+	tarHeaderSize  = 512
+	tarMagicOffset = 257
+)
+
+// sniffDecompressor returns the key of decompressors matching the format of
+// the file at path, detected from its first bytes, or "" if the format is
+// unknown or has no decompressor. A gzip, bzip2 or xz stream holding a tar
+// archive is matched with "tar.gz", "tar.bz2" or "tar.xz".
+func sniffDecompressor(decompressors map[string]Decompressor, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	header := make([]byte, tarHeaderSize)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	var key string
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		key = sniffTar(f, "gz", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+	case bytes.HasPrefix(header, bzip2Magic):
+		key = sniffTar(f, "bz2", func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil })
+	case bytes.HasPrefix(header, xzMagic):
+		key = sniffTar(f, "xz", func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) })
+	case bytes.HasPrefix(header, zipMagics[0]) || bytes.HasPrefix(header, zipMagics[1]):
+		key = "zip"
+	case isTarHeader(header):
+		key = "tar"
+	}
+	if _, ok := decompressors[key]; !ok {
+		return ""
+	}
+	return key
+}
+
+// sniffTar returns "tar."+ext if the stream of f, decompressed by the
+// reader returned by newReader, starts with a tar header, ext otherwise.
+func sniffTar(f *os.File, ext string, newReader func(io.Reader) (io.Reader, error)) string {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ext
+	}
+	r, err := newReader(f)
+	if err != nil {
+		return ext
+	}
+	header := make([]byte, tarHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || !isTarHeader(header) {
+		return ext
+	}
+	return "tar." + ext
+}
+
+// isTarHeader reports whether header is a POSIX or GNU tar header.
+func isTarHeader(header []byte) bool {
+	return len(header) == tarHeaderSize &&
+		bytes.HasPrefix(header[tarMagicOffset:], []byte("ustar"))
+}
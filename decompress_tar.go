@@ -6,17 +6,35 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+// tarSymlink is a symlink of a tar archive to create at path once all the
+// other entries are extracted.
+type tarSymlink struct {
+	hdr  *tar.Header
+	path string
+}
+
 // untar is a shared helper for untarring an archive. The reader should provide
 // an uncompressed view of the tar archive.
-func untar(input io.Reader, dst, src string, dir bool) error {
+func untar(input io.Reader, dst, src string, dir bool, opts *decompressOptions) error {
 	tarR := tar.NewReader(input)
 	done := false
 	dirHdrs := []*tar.Header{}
+	symlinks := []tarSymlink{}
 	now := time.Now()
+
+	// The size of a stream isn't known up front
+	progress := opts.trackProgress(src, -1)
+	defer progress.close()
+
 	for {
+		if err := opts.err(); err != nil {
+			return err
+		}
+
 		hdr, err := tarR.Next()
 		if err == io.EOF {
 			if !done {
@@ -42,7 +60,48 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 				return fmt.Errorf("entry contains '..': %s", hdr.Name)
 			}
 
+			if opts.skip(hdr.Name) {
+				// Still counts as content for the empty archive check
+				done = true
+				continue
+			}
+
 			path = filepath.Join(path, hdr.Name)
+			if !hdr.FileInfo().IsDir() {
+				if path, err = opts.casePath(path); err != nil {
+					return err
+				}
+			}
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			if !dir {
+				return fmt.Errorf("expected a single file, got a symlink: %s", src)
+			}
+			if err := checkSymlink(dst, path, hdr.Linkname); err != nil {
+				return err
+			}
+
+			// Create the symlinks once all the files and directories are
+			// written, so that none of them is written through a symlink
+			// and the symlinks may come before their target
+			symlinks = append(symlinks, tarSymlink{hdr: hdr, path: path})
+			done = true
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeLink {
+			if !dir {
+				return fmt.Errorf("expected a single file, got a hard link: %s", src)
+			}
+
+			// The target of a hard link comes before it in the archive, so
+			// it is already extracted
+			if err := extractHardlink(dst, path, hdr, opts); err != nil {
+				return err
+			}
+			done = true
+			continue
 		}
 
 		if hdr.FileInfo().IsDir() {
@@ -51,7 +110,7 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 			}
 
 			// A directory, just make the directory and continue unarchiving...
-			if err := os.MkdirAll(path, 0755); err != nil {
+			if err := opts.mkdirAll(path); err != nil {
 				return err
 			}
 
@@ -66,8 +125,8 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 			dstPath := filepath.Dir(path)
 
 			// Check that the directory exists, otherwise create it
-			if _, err := os.Stat(dstPath); os.IsNotExist(err) {
-				if err := os.MkdirAll(dstPath, 0755); err != nil {
+			if _, err := opts.filesystem().Lstat(dstPath); os.IsNotExist(err) {
+				if err := opts.mkdirAll(dstPath); err != nil {
 					return err
 				}
 			}
@@ -81,19 +140,25 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 		// Mark that we're done so future in single file mode errors
 		done = true
 
+		if ok, err := opts.shouldWrite(path, hdr.ModTime); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
 		// Open the file for writing
-		dstF, err := os.Create(path)
+		dstF, err := opts.create(path)
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(dstF, tarR)
+		_, err = io.Copy(dstF, progress.reader(opts.reader(tarR)))
 		dstF.Close()
 		if err != nil {
 			return err
 		}
 
 		// Chmod the file
-		if err := os.Chmod(path, hdr.FileInfo().Mode()); err != nil {
+		if err := opts.chmod(path, hdr.FileInfo().Mode()); err != nil {
 			return err
 		}
 
@@ -106,7 +171,22 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 		if hdr.ModTime.Unix() > 0 {
 			mTime = hdr.ModTime
 		}
-		if err := os.Chtimes(path, aTime, mTime); err != nil {
+		if err := opts.chtimes(path, aTime, mTime); err != nil {
+			return err
+		}
+	}
+
+	// A symlink target must not go through another symlink, whose own
+	// target isn't taken into account by checkSymlink
+	links := make(map[string]bool, len(symlinks))
+	for _, l := range symlinks {
+		links[l.path] = true
+	}
+	for _, l := range symlinks {
+		if err := checkSymlinkChain(l.path, l.hdr.Linkname, links, opts); err != nil {
+			return err
+		}
+		if err := extractSymlink(dst, l.path, l.hdr, opts); err != nil {
 			return err
 		}
 	}
@@ -115,7 +195,7 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 	for _, dirHdr := range dirHdrs {
 		path := filepath.Join(dst, dirHdr.Name)
 		// Chmod the directory since they might be created before we know the mode flags
-		if err := os.Chmod(path, dirHdr.FileInfo().Mode()); err != nil {
+		if err := opts.chmod(path, dirHdr.FileInfo().Mode()); err != nil {
 			return err
 		}
 		// Set the mtime/atime attributes since they would have been changed during extraction
@@ -127,7 +207,7 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 		if dirHdr.ModTime.Unix() > 0 {
 			mTime = dirHdr.ModTime
 		}
-		if err := os.Chtimes(path, aTime, mTime); err != nil {
+		if err := opts.chtimes(path, aTime, mTime); err != nil {
 			return err
 		}
 	}
@@ -135,17 +215,164 @@ func untar(input io.Reader, dst, src string, dir bool) error {
 	return nil
 }
 
+// checkSymlink returns an error if the symlink to target at path, in the
+// extraction directory dst, doesn't resolve within dst.
+func checkSymlink(dst, path, target string) error {
+	if filepath.IsAbs(target) || filepath.VolumeName(target) != "" || strings.HasPrefix(target, "/") {
+		return fmt.Errorf("symlink target is absolute: %s -> %s", path, target)
+	}
+	rel, err := filepath.Rel(dst, filepath.Join(filepath.Dir(path), filepath.FromSlash(target)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink target is outside the destination: %s -> %s", path, target)
+	}
+	return nil
+}
+
+// checkSymlinkChain returns an error if the target of the symlink at path
+// goes through a directory that is one of the links of the archive, or a
+// symlink already in the destination, e.g. "sub/y/.." with "sub/y -> ..":
+// the target would then resolve from the target of that link instead of
+// from the path checked by checkSymlink.
+func checkSymlinkChain(path, target string, links map[string]bool, opts *decompressOptions) error {
+	fs := opts.filesystem()
+	p := filepath.Dir(path)
+	parts := strings.Split(filepath.ToSlash(target), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if part == "" || part == "." {
+			continue
+		}
+		p = filepath.Join(p, part)
+		if links[p] {
+			return fmt.Errorf("symlink target goes through another symlink: %s -> %s", path, target)
+		}
+		if fi, err := fs.Lstat(p); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("symlink target goes through another symlink: %s -> %s", path, target)
+		}
+	}
+	return nil
+}
+
+// extractSymlink creates the symlink of hdr at path, in the extraction
+// directory dst. The parent directories of path must not be symlinks,
+// which could make the target resolve outside of dst.
+func extractSymlink(dst, path string, hdr *tar.Header, opts *decompressOptions) error {
+	fs := opts.filesystem()
+	dst = filepath.Clean(dst)
+	for p := filepath.Dir(path); len(p) > len(dst); p = filepath.Dir(p) {
+		fi, err := fs.Lstat(p)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("symlink is inside another symlink: %s", hdr.Name)
+		}
+	}
+	if err := opts.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if ok, err := opts.shouldWrite(path, hdr.ModTime); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+	if _, err := fs.Lstat(path); err == nil {
+		if err := fs.Remove(path); err != nil {
+			return err
+		}
+	}
+	return fs.Symlink(filepath.FromSlash(hdr.Linkname), path)
+}
+
+// extractHardlink creates the hard link of hdr at path, in the extraction
+// directory dst, to its target already extracted within dst. If the FS
+// doesn't support hard links, or fails to create one, the target is copied
+// instead.
+func extractHardlink(dst, path string, hdr *tar.Header, opts *decompressOptions) error {
+	if filepath.IsAbs(hdr.Linkname) || filepath.VolumeName(hdr.Linkname) != "" ||
+		strings.HasPrefix(hdr.Linkname, "/") || containsDotDot(hdr.Linkname) {
+		return fmt.Errorf("hard link target is outside the destination: %s -> %s", hdr.Name, hdr.Linkname)
+	}
+	target := filepath.Join(dst, filepath.FromSlash(hdr.Linkname))
+	if target == path {
+		return fmt.Errorf("hard link to itself: %s", hdr.Name)
+	}
+
+	fs := opts.filesystem()
+	fi, err := fs.Lstat(target)
+	if err != nil {
+		return fmt.Errorf("hard link target not found: %s -> %s", hdr.Name, hdr.Linkname)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("hard link target is not a regular file: %s -> %s", hdr.Name, hdr.Linkname)
+	}
+	if err := opts.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if ok, err := opts.shouldWrite(path, hdr.ModTime); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+	if _, err := fs.Lstat(path); err == nil {
+		if err := fs.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if l, ok := fs.(linkFS); ok {
+		if err := l.Link(target, path); err == nil {
+			return nil
+		}
+	}
+	return copyHardlink(fs, target, path, fi)
+}
+
+// copyHardlink copies the file target, of FileInfo fi, to path, in place
+// of a hard link.
+func copyHardlink(fs FS, target, path string, fi os.FileInfo) error {
+	o, ok := fs.(openFS)
+	if !ok {
+		return fmt.Errorf("hard links aren't supported by the filesystem: %s", path)
+	}
+	r, err := o.Open(target)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The copy shares the mode and times of the target, as a link would
+	if err := fs.Chmod(path, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return fs.Chtimes(path, fi.ModTime(), fi.ModTime())
+}
+
 // tarDecompressor is an implementation of Decompressor that can
 // unpack tar files.
 type tarDecompressor struct{}
 
 func (d *tarDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *tarDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// If we're going into a directory we should make that first
 	mkdir := dst
 	if !dir {
 		mkdir = filepath.Dir(dst)
 	}
-	if err := os.MkdirAll(mkdir, 0755); err != nil {
+	if err := opts.mkdirAll(mkdir); err != nil {
 		return err
 	}
 
@@ -156,5 +383,5 @@ func (d *tarDecompressor) Decompress(dst, src string, dir bool) error {
 	}
 	defer f.Close()
 
-	return untar(f, dst, src, dir)
+	return untar(f, dst, src, dir, opts)
 }
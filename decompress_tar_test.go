@@ -1,7 +1,10 @@
 package getter
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -41,3 +44,176 @@ func TestTar(t *testing.T) {
 
 	TestDecompressor(t, new(tarDecompressor), cases)
 }
+
+func TestTar_symlinkBeforeTarget(t *testing.T) {
+	dst := filepath.Join(tempDir(t), "result")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	src := filepath.Join("./test-fixtures", "decompress-tar", "symlink_before_target.tar")
+	if err := new(tarDecompressor).Decompress(dst, src, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for link, target := range map[string]string{
+		"link":                            "dir",
+		filepath.Join("dir", "file-link"): "file",
+	} {
+		actual, err := os.Readlink(filepath.Join(dst, link))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != target {
+			t.Fatalf("%s: bad target %q, expected %q", link, actual, target)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "link", "file-link"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "hello\n" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestTar_symlinkUnsafe(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   string
+	}{
+		{"symlink_outside.tar", "outside the destination"},
+		{"symlink_absolute.tar", "absolute"},
+		{"symlink_in_symlink.tar", "inside another symlink"},
+		{"symlink_chain.tar", "through another symlink"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			td := tempDir(t)
+			defer os.RemoveAll(td)
+			dst := filepath.Join(td, "result")
+
+			src := filepath.Join("./test-fixtures", "decompress-tar", tc.Input)
+			err := new(tarDecompressor).Decompress(dst, src, true)
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+			if _, err := os.Lstat(filepath.Join(td, "outside")); !os.IsNotExist(err) {
+				t.Fatalf("expected nothing outside of the destination: %v", err)
+			}
+		})
+	}
+}
+
+func TestTar_symlinkSingleFile(t *testing.T) {
+	dst := filepath.Join(tempDir(t), "result")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	src := filepath.Join("./test-fixtures", "decompress-tar", "symlink_absolute.tar")
+	if err := new(tarDecompressor).Decompress(dst, src, false); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestTar_hardlink(t *testing.T) {
+	dst := filepath.Join(tempDir(t), "result")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	src := filepath.Join("./test-fixtures", "decompress-tar", "hardlink.tar")
+	if err := new(tarDecompressor).Decompress(dst, src, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	target, err := os.Stat(filepath.Join(dst, "file"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, name := range []string{"link", filepath.Join("dir", "link")} {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !os.SameFile(target, fi) {
+			t.Fatalf("%s: expected a hard link to file", name)
+		}
+	}
+}
+
+func TestTar_hardlinkCopy(t *testing.T) {
+	fs := newMemFS()
+	dst := filepath.Join(tempDir(t), "result")
+
+	src := filepath.Join("./test-fixtures", "decompress-tar", "hardlink.tar")
+	if err := new(tarDecompressor).decompress(dst, src, true, &decompressOptions{fs: fs}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, name := range []string{"link", filepath.Join("dir", "link")} {
+		if actual := fs.contents(t, filepath.Join(dst, name)); actual != "hello\n" {
+			t.Fatalf("%s: bad: %q", name, actual)
+		}
+		fi, err := fs.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Mode() != 0640 {
+			t.Fatalf("%s: expected mode 0640, got %s", name, fi.Mode())
+		}
+	}
+}
+
+func TestTar_hardlinkUnsafe(t *testing.T) {
+	cases := []struct {
+		Input string
+		Err   string
+	}{
+		{"hardlink_outside.tar", "outside the destination"},
+		{"hardlink_missing.tar", "target not found"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			td := tempDir(t)
+			defer os.RemoveAll(td)
+			dst := filepath.Join(td, "result")
+
+			src := filepath.Join("./test-fixtures", "decompress-tar", tc.Input)
+			err := new(tarDecompressor).Decompress(dst, src, true)
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestTar_caseCollision(t *testing.T) {
+	src := filepath.Join("./test-fixtures", "decompress-tar", "case_collision.tar")
+	dst := filepath.Join(tempDir(t), "result")
+
+	// Both files are extracted at their path by default
+	fs := newMemFS()
+	if err := new(tarDecompressor).decompress(dst, src, true, &decompressOptions{fs: fs}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := fs.contents(t, filepath.Join(dst, "foo.txt")); actual != "lower\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+
+	opts := &decompressOptions{fs: newMemFS(), caseCollisions: &caseCollisions{policy: CaseCollisionError}}
+	err := new(tarDecompressor).decompress(dst, src, true, opts)
+	if err == nil || !strings.Contains(err.Error(), "case-insensitive") {
+		t.Fatalf("expected a collision error, got %v", err)
+	}
+
+	fs = newMemFS()
+	opts = &decompressOptions{fs: fs, caseCollisions: &caseCollisions{policy: CaseCollisionRename}}
+	if err := new(tarDecompressor).decompress(dst, src, true, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := fs.contents(t, filepath.Join(dst, "Foo.txt")); actual != "upper\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+	if actual := fs.contents(t, filepath.Join(dst, "foo (1).txt")); actual != "lower\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
@@ -11,12 +11,16 @@ import (
 type TarBzip2Decompressor struct{}
 
 func (d *TarBzip2Decompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *TarBzip2Decompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// If we're going into a directory we should make that first
 	mkdir := dst
 	if !dir {
 		mkdir = filepath.Dir(dst)
 	}
-	if err := os.MkdirAll(mkdir, 0755); err != nil {
+	if err := opts.mkdirAll(mkdir); err != nil {
 		return err
 	}
 
@@ -29,5 +33,5 @@ func (d *TarBzip2Decompressor) Decompress(dst, src string, dir bool) error {
 
 	// Bzip2 compression is second
 	bzipR := bzip2.NewReader(f)
-	return untar(bzipR, dst, src, dir)
+	return untar(bzipR, dst, src, dir, opts)
 }
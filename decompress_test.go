@@ -0,0 +1,201 @@
+package getter
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecompressorForPath(t *testing.T) {
+	cases := []struct {
+		Path     string
+		Expected Decompressor
+	}{
+		{"foo.tar.gz", Decompressors["tar.gz"]},
+		{"/releases/foo-1.0.tgz", Decompressors["tgz"]},
+		{"foo.gz", Decompressors["gz"]},
+		{"foo.zip", Decompressors["zip"]},
+		{"foo.tar.xz", Decompressors["tar.xz"]},
+		{"foo.TAR.GZ", Decompressors["tar.gz"]},
+		{"foo-1.2.3.tar.gz", Decompressors["tar.gz"]},
+		{"foo.backup.gz", Decompressors["gz"]},
+		{"foo.tar.zip", Decompressors["zip"]},
+		{"foo.tar.gz/bar.zip", Decompressors["zip"]},
+		{"foo.txt", nil},
+		{"zip", nil},
+		{".gz", nil},
+		{"dir/.zip", nil},
+		{"", nil},
+		{"foo.tar.gz.part", nil},
+		{"foo.zip.sha256", nil},
+		{"my.tar.backup.gz", nil},
+		{"my.tar.2020.bz2", nil},
+	}
+
+	for _, tc := range cases {
+		d, ok := DecompressorForPath(tc.Path)
+		if ok != (tc.Expected != nil) {
+			t.Fatalf("%q: unexpected match %v", tc.Path, ok)
+		}
+		if d != tc.Expected {
+			t.Fatalf("%q: expected %T, got %T", tc.Path, tc.Expected, d)
+		}
+	}
+}
+
+func TestDecompressors_shorthands(t *testing.T) {
+	aliases := map[string]string{
+		"tgz":  "tar.gz",
+		"tbz2": "tar.bz2",
+		"txz":  "tar.xz",
+	}
+	for alias, ext := range aliases {
+		if Decompressors[alias] == nil || Decompressors[alias] != Decompressors[ext] {
+			t.Fatalf("expected %s to be decompressed like %s", alias, ext)
+		}
+		if d, _ := DecompressorForPath("foo." + alias); d != Decompressors[ext] {
+			t.Fatalf("expected foo.%s to be decompressed like %s", alias, ext)
+		}
+	}
+}
+
+func TestArchiveDirName(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Key      string
+		Expected string
+	}{
+		{"release.tar.gz", "tar.gz", "release"},
+		{"release-1.0.TAR.GZ", "tar.gz", "release-1.0"},
+		{"release.tgz", "tar.gz", "release"},
+		{"release.zip", "zip", "release"},
+		{"download", "zip", "download"},
+		{".zip", "zip", ""},
+		{".", "zip", ""},
+	}
+
+	for _, tc := range cases {
+		dir, err := archiveDirName(Decompressors, tc.Name, tc.Key)
+		if (err != nil) != (tc.Expected == "") {
+			t.Fatalf("%q: unexpected error: %v", tc.Name, err)
+		}
+		if dir != tc.Expected {
+			t.Fatalf("%q: expected %q, got %q", tc.Name, tc.Expected, dir)
+		}
+	}
+}
+
+func TestDecompressOptions_skip(t *testing.T) {
+	cases := []struct {
+		Only string
+		Name string
+		Skip bool
+	}{
+		{"", "foo/bar", false},
+		{"foo", "foo", false},
+		{"foo", "foo/", false},
+		{"foo", "foo/bar/baz", false},
+		{"foo/", "./foo/bar", false},
+		{"foo/bar", "foo/bar/baz", false},
+		{"foo/b*", "foo/bar/baz", false},
+		{"foo", "foobar/baz", true},
+		{"foo/bar", "foo", true},
+		{"foo/bar", "foo/baz", true},
+		{"foo/b?r", "foo/bar.txt", true},
+	}
+
+	for _, tc := range cases {
+		opts := &decompressOptions{only: tc.Only}
+		if skip := opts.skip(tc.Name); skip != tc.Skip {
+			t.Fatalf("%q, %q: expected skip %t", tc.Only, tc.Name, tc.Skip)
+		}
+	}
+}
+
+func TestSniffDecompressor(t *testing.T) {
+	cases := []struct {
+		Path     string
+		Expected string
+	}{
+		{"decompress-tgz/single.tar.gz", "tar.gz"},
+		{"decompress-tbz2/single.tar.bz2", "tar.bz2"},
+		{"decompress-txz/single.tar.xz", "tar.xz"},
+		{"decompress-gz/single.gz", "gz"},
+		{"decompress-bz2/single.bz2", "bz2"},
+		{"decompress-xz/single.xz", "xz"},
+		{"decompress-zip/single.zip", "zip"},
+		{"decompress-zip/empty.zip", "zip"},
+		// No tar decompressor by default
+		{"decompress-tar/implied_dir.tar", ""},
+		{"basic-file/foo.txt", ""},
+		{"basic-file/missing.txt", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Path, func(t *testing.T) {
+			actual := sniffDecompressor(Decompressors, filepath.Join(fixtureDir, tc.Path))
+			if actual != tc.Expected {
+				t.Fatalf("expected %q, got %q", tc.Expected, actual)
+			}
+		})
+	}
+
+	// Only the formats with a decompressor are matched
+	decompressors := map[string]Decompressor{"tar": new(TarGzipDecompressor), "gz": new(GzipDecompressor)}
+	if actual := sniffDecompressor(decompressors, filepath.Join(fixtureDir, "decompress-tar/implied_dir.tar")); actual != "tar" {
+		t.Fatalf("expected tar, got %q", actual)
+	}
+	if actual := sniffDecompressor(decompressors, filepath.Join(fixtureDir, "decompress-tgz/single.tar.gz")); actual != "" {
+		t.Fatalf("expected no match, got %q", actual)
+	}
+}
+
+// cancelFS is an FS canceling a context once a file has been created.
+type cancelFS struct {
+	FS
+	cancel context.CancelFunc
+}
+
+func (fs *cancelFS) Create(name string) (io.WriteCloser, error) {
+	defer fs.cancel()
+	return fs.FS.Create(name)
+}
+
+func TestDecompressOptions_cancel(t *testing.T) {
+	cases := []struct {
+		Decompressor optionsDecompressor
+		Archive      string
+	}{
+		{new(TarGzipDecompressor), "decompress-tgz/nested_dir.tar.gz"},
+		{new(ZipDecompressor), "decompress-zip/multiple.zip"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Archive, func(t *testing.T) {
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			opts := &decompressOptions{ctx: ctx, fs: &cancelFS{FS: OSFS, cancel: cancel}}
+
+			// The extraction stops after the first file
+			src := filepath.Join(fixtureDir, tc.Archive)
+			if err := tc.Decompressor.decompress(dst, src, true, opts); err != context.Canceled {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+			var files int
+			filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					files++
+				}
+				return nil
+			})
+			if files != 1 {
+				t.Fatalf("expected a single file to be extracted, got %d", files)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package getter
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"os"
@@ -12,12 +14,16 @@ import (
 type TarGzipDecompressor struct{}
 
 func (d *TarGzipDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *TarGzipDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// If we're going into a directory we should make that first
 	mkdir := dst
 	if !dir {
 		mkdir = filepath.Dir(dst)
 	}
-	if err := os.MkdirAll(mkdir, 0755); err != nil {
+	if err := opts.mkdirAll(mkdir); err != nil {
 		return err
 	}
 
@@ -35,5 +41,15 @@ func (d *TarGzipDecompressor) Decompress(dst, src string, dir bool) error {
 	}
 	defer gzipR.Close()
 
-	return untar(gzipR, dst, src, dir)
+	// A tar archive compressed twice would only fail with an invalid tar
+	// header error
+	r := bufio.NewReader(gzipR)
+	if magic, _ := r.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		return fmt.Errorf("%s appears doubly-compressed: its gzip-decompressed contents are gzip-compressed again", src)
+	}
+
+	return untar(r, dst, src, dir, opts)
 }
+
+// gzipMagic is the header starting gzip streams.
+var gzipMagic = []byte{0x1f, 0x8b}
@@ -1,7 +1,10 @@
 package getter
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -85,6 +88,16 @@ func TestTarGzipDecompressor(t *testing.T) {
 			"",
 			nil,
 		},
+
+		// Tests that a tar.gz compressed twice is rejected
+		{
+			"double.tar.gz",
+			true,
+			true,
+			nil,
+			"",
+			nil,
+		},
 	}
 
 	for i, tc := range cases {
@@ -93,3 +106,17 @@ func TestTarGzipDecompressor(t *testing.T) {
 
 	TestDecompressor(t, new(TarGzipDecompressor), cases)
 }
+
+func TestTarGzipDecompressor_doublyCompressed(t *testing.T) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	src := filepath.Join("./test-fixtures", "decompress-tgz", "double.tar.gz")
+	err = new(TarGzipDecompressor).Decompress(filepath.Join(td, "result"), src, true)
+	if err == nil || !strings.Contains(err.Error(), "appears doubly-compressed") {
+		t.Fatalf("expected a doubly-compressed error, got %v", err)
+	}
+}
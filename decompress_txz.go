@@ -13,12 +13,16 @@ import (
 type TarXzDecompressor struct{}
 
 func (d *TarXzDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *TarXzDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// If we're going into a directory we should make that first
 	mkdir := dst
 	if !dir {
 		mkdir = filepath.Dir(dst)
 	}
-	if err := os.MkdirAll(mkdir, 0755); err != nil {
+	if err := opts.mkdirAll(mkdir); err != nil {
 		return err
 	}
 
@@ -35,5 +39,5 @@ func (d *TarXzDecompressor) Decompress(dst, src string, dir bool) error {
 		return fmt.Errorf("Error opening an xz reader for %s: %s", src, err)
 	}
 
-	return untar(txzR, dst, src, dir)
+	return untar(txzR, dst, src, dir, opts)
 }
@@ -14,13 +14,17 @@ import (
 type XzDecompressor struct{}
 
 func (d *XzDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *XzDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// Directory isn't supported at all
 	if dir {
 		return fmt.Errorf("xz-compressed files can only unarchive to a single file")
 	}
 
 	// If we're going into a directory we should make that first
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := opts.mkdirAll(filepath.Dir(dst)); err != nil {
 		return err
 	}
 
@@ -37,13 +41,19 @@ func (d *XzDecompressor) Decompress(dst, src string, dir bool) error {
 		return err
 	}
 
+	if fi, err := f.Stat(); err != nil {
+		return err
+	} else if ok, err := opts.shouldWrite(dst, fi.ModTime()); err != nil || !ok {
+		return err
+	}
+
 	// Copy it out
-	dstF, err := os.Create(dst)
+	dstF, err := opts.create(dst)
 	if err != nil {
 		return err
 	}
 	defer dstF.Close()
 
-	_, err = io.Copy(dstF, xzR)
+	_, err = io.Copy(dstF, opts.reader(xzR))
 	return err
 }
@@ -2,23 +2,35 @@ package getter
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
+	"sync"
 )
 
 // ZipDecompressor is an implementation of Decompressor that can
 // decompress tar.gzip files.
-type ZipDecompressor struct{}
+type ZipDecompressor struct {
+	// Concurrency, if greater than 1, is the number of files of an archive
+	// extracted in parallel to a directory, e.g. to unpack archives of
+	// many files faster on multi-core machines. The directories are still
+	// created in the order of the archive, before the files are written. A
+	// custom Client.FS must then be safe for concurrent use.
+	Concurrency int
+}
 
 func (d *ZipDecompressor) Decompress(dst, src string, dir bool) error {
+	return d.decompress(dst, src, dir, nil)
+}
+
+func (d *ZipDecompressor) decompress(dst, src string, dir bool, opts *decompressOptions) error {
 	// If we're going into a directory we should make that first
 	mkdir := dst
 	if !dir {
 		mkdir = filepath.Dir(dst)
 	}
-	if err := os.MkdirAll(mkdir, 0755); err != nil {
+	if err := opts.mkdirAll(mkdir); err != nil {
 		return err
 	}
 
@@ -38,8 +50,24 @@ func (d *ZipDecompressor) Decompress(dst, src string, dir bool) error {
 		return fmt.Errorf("expected a single file: %s", src)
 	}
 
-	// Go through and unarchive
+	// The size of the files to extract is known from the central directory
+	var total int64
+	for _, f := range zipR.File {
+		if !f.FileInfo().IsDir() && !(dir && opts.skip(f.Name)) {
+			total += int64(f.UncompressedSize64)
+		}
+	}
+	progress := opts.trackProgress(src, total)
+	defer progress.close()
+
+	// Go through and unarchive, the files of a directory archive being
+	// extracted afterwards in parallel with a Concurrency
+	var files []zipFile
 	for _, f := range zipR.File {
+		if err := opts.err(); err != nil {
+			return err
+		}
+
 		path := dst
 		if dir {
 			// Disallow parent traversal
@@ -47,7 +75,17 @@ func (d *ZipDecompressor) Decompress(dst, src string, dir bool) error {
 				return fmt.Errorf("entry contains '..': %s", f.Name)
 			}
 
+			if opts.skip(f.Name) {
+				continue
+			}
+
 			path = filepath.Join(path, f.Name)
+			if !f.FileInfo().IsDir() {
+				var err error
+				if path, err = opts.casePath(path); err != nil {
+					return err
+				}
+			}
 		}
 
 		if f.FileInfo().IsDir() {
@@ -56,7 +94,7 @@ func (d *ZipDecompressor) Decompress(dst, src string, dir bool) error {
 			}
 
 			// A directory, just make the directory and continue unarchiving...
-			if err := os.MkdirAll(path, 0755); err != nil {
+			if err := opts.mkdirAll(path); err != nil {
 				return err
 			}
 
@@ -67,35 +105,126 @@ func (d *ZipDecompressor) Decompress(dst, src string, dir bool) error {
 		// required to contain entries for just the directories so this
 		// can happen.
 		if dir {
-			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			if err := opts.mkdirAll(filepath.Dir(path)); err != nil {
 				return err
 			}
 		}
 
-		// Open the file for reading
-		srcF, err := f.Open()
-		if err != nil {
+		if ok, err := opts.shouldWrite(path, f.Modified); err != nil {
 			return err
+		} else if !ok {
+			continue
 		}
 
-		// Open the file for writing
-		dstF, err := os.Create(path)
-		if err != nil {
-			srcF.Close()
-			return err
+		if dir && d.Concurrency > 1 {
+			files = append(files, zipFile{f, path})
+			continue
 		}
-		_, err = io.Copy(dstF, srcF)
-		srcF.Close()
-		dstF.Close()
-		if err != nil {
+		if err := extractZipFile(f, path, opts, progress.reader); err != nil {
 			return err
 		}
+	}
 
-		// Chmod the file
-		if err := os.Chmod(path, f.Mode()); err != nil {
-			return err
+	return extractZipFiles(files, d.Concurrency, opts, progress)
+}
+
+// zipFile is a file of a ZIP archive to extract to path.
+type zipFile struct {
+	f    *zip.File
+	path string
+}
+
+// extractZipFile writes the contents of f to path, read through track.
+func extractZipFile(f *zip.File, path string, opts *decompressOptions, track func(io.Reader) io.Reader) error {
+	// Open the file for reading
+	srcF, err := f.Open()
+	if err != nil {
+		return err
+	}
+
+	// Open the file for writing
+	dstF, err := opts.create(path)
+	if err != nil {
+		srcF.Close()
+		return err
+	}
+	_, err = io.Copy(dstF, track(opts.reader(srcF)))
+	srcF.Close()
+	dstF.Close()
+	if err != nil {
+		return err
+	}
+
+	// Chmod the file
+	return opts.chmod(path, f.Mode())
+}
+
+// extractZipFiles extracts files with concurrency workers. Only the last
+// file of the archive with a given path is written, as when extracting
+// them one after the other. The first error stops the extraction.
+func extractZipFiles(files []zipFile, concurrency int, opts *decompressOptions, progress *extractProgress) error {
+	if len(files) == 0 {
+		return nil
+	}
+	last := make(map[string]int, len(files))
+	for i, zf := range files {
+		last[zf.path] = i
+	}
+
+	ctx := context.Background()
+	if opts != nil && opts.ctx != nil {
+		ctx = opts.ctx
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan zipFile)
+	go func() {
+		defer close(jobs)
+		for i, zf := range files {
+			if last[zf.path] != i {
+				continue
+			}
+			select {
+			case jobs <- zf:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		retErr  error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			retErr = err
+			cancel()
+		})
+	}
+
+	// The entries are read in parallel but tracked one read at a time
+	track := func(r io.Reader) io.Reader {
+		return progress.concurrentReader(contextReader(ctx, r))
 	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for zf := range jobs {
+				if err := extractZipFile(zf.f, zf.path, opts, track); err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
 
-	return nil
+	if retErr != nil {
+		return retErr
+	}
+	return ctx.Err()
 }
@@ -1,7 +1,15 @@
 package getter
 
 import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -96,3 +104,172 @@ func TestZipDecompressor(t *testing.T) {
 
 	TestDecompressor(t, new(ZipDecompressor), cases)
 }
+
+func TestZipDecompressor_caseCollision(t *testing.T) {
+	src := filepath.Join("./test-fixtures", "decompress-zip", "case_collision.zip")
+	dst := filepath.Join(tempDir(t), "result")
+
+	opts := &decompressOptions{fs: newMemFS(), caseCollisions: &caseCollisions{policy: CaseCollisionError}}
+	err := new(ZipDecompressor).decompress(dst, src, true, opts)
+	if err == nil || !strings.Contains(err.Error(), "case-insensitive") {
+		t.Fatalf("expected a collision error, got %v", err)
+	}
+
+	fs := newMemFS()
+	opts = &decompressOptions{fs: fs, caseCollisions: &caseCollisions{policy: CaseCollisionRename}}
+	if err := new(ZipDecompressor).decompress(dst, src, true, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := fs.contents(t, filepath.Join(dst, "Foo.txt")); actual != "upper\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+	if actual := fs.contents(t, filepath.Join(dst, "foo (1).txt")); actual != "lower\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+// writeTestZip writes a ZIP archive of n files spread in nested directories,
+// without directory entries, the last file repeating the path of the first
+// one with other contents.
+func writeTestZip(tb testing.TB, path string, n int) {
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	name := func(i int) string {
+		return fmt.Sprintf("dir%d/sub%d/file%d.txt", i%7, i%3, i)
+	}
+	for i := 0; i < n; i++ {
+		fw, err := w.Create(name(i))
+		if err != nil {
+			tb.Fatalf("err: %s", err)
+		}
+		fmt.Fprintf(fw, "%s\n", strings.Repeat(fmt.Sprintf("file %d ", i), 100+i%50))
+	}
+	fw, err := w.Create(name(0))
+	if err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+	io.WriteString(fw, "last\n")
+	if err := w.Close(); err != nil {
+		tb.Fatalf("err: %s", err)
+	}
+}
+
+// readTree returns the contents of the files under dir by relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	tree := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return tree
+}
+
+// countingTracker is a ProgressTracker counting the bytes read.
+type countingTracker struct {
+	n int64
+}
+
+func (c *countingTracker) TrackProgress(_ string, _, _ int64, stream io.ReadCloser) io.ReadCloser {
+	return &closerFunc{
+		Reader: readerFunc(func(b []byte) (int, error) {
+			n, err := stream.Read(b)
+			atomic.AddInt64(&c.n, int64(n))
+			return n, err
+		}),
+		close: func() { stream.Close() },
+	}
+}
+
+func TestZipDecompressor_concurrency(t *testing.T) {
+	td := tempDir(t)
+	if err := os.MkdirAll(td, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	src := filepath.Join(td, "many.zip")
+	writeTestZip(t, src, 200)
+
+	serial := filepath.Join(td, "serial")
+	serialProgress := new(countingTracker)
+	opts := &decompressOptions{progress: serialProgress}
+	if err := new(ZipDecompressor).decompress(serial, src, true, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	parallel := filepath.Join(td, "parallel")
+	parallelProgress := new(countingTracker)
+	opts = &decompressOptions{progress: parallelProgress}
+	if err := (&ZipDecompressor{Concurrency: 8}).decompress(parallel, src, true, opts); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := readTree(t, serial)
+	if len(expected) != 200 || expected["dir0/sub0/file0.txt"] != "last\n" {
+		t.Fatalf("bad serial extraction: %d files", len(expected))
+	}
+	if actual := readTree(t, parallel); !reflect.DeepEqual(actual, expected) {
+		t.Fatal("the parallel extraction differs from the serial one")
+	}
+
+	// The first file with the path of the last one is only extracted
+	// serially
+	first := int64(len(fmt.Sprintf("%s\n", strings.Repeat("file 0 ", 100))))
+	if parallelProgress.n != serialProgress.n-first {
+		t.Fatalf("bad progress: %d, expected %d", parallelProgress.n, serialProgress.n-first)
+	}
+}
+
+func TestZipDecompressor_concurrencyLimit(t *testing.T) {
+	td := tempDir(t)
+	if err := os.MkdirAll(td, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	src := filepath.Join(td, "many.zip")
+	writeTestZip(t, src, 50)
+
+	opts := &decompressOptions{limit: newByteLimit(10000)}
+	err := (&ZipDecompressor{Concurrency: 4}).decompress(filepath.Join(td, "out"), src, true, opts)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Fatalf("expected a limit error, got %v", err)
+	}
+}
+
+func BenchmarkZipDecompressor(b *testing.B) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		b.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+	src := filepath.Join(td, "many.zip")
+	writeTestZip(b, src, 2000)
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			d := &ZipDecompressor{Concurrency: concurrency}
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(td, fmt.Sprintf("out-%d-%d", concurrency, i))
+				if err := d.decompress(dst, src, true, nil); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				os.RemoveAll(dst)
+			}
+		})
+	}
+}
@@ -40,7 +40,19 @@ func init() {
 //
 // This is safe to be called with an already valid source string: Detect
 // will just return it.
+//
+// A detector may return another shorthand, which is detected in turn, and
+// may prefix its result with a forced getter, e.g. "git::ssh://...". A
+// forced getter in src takes precedence over the ones set by detectors.
 func Detect(src string, pwd string, ds []Detector) (string, error) {
+	return detect(src, pwd, ds, 0)
+}
+
+// maxDetectDepth bounds the number of times a source is detected again,
+// so that detectors returning their input don't loop forever.
+const maxDetectDepth = 10
+
+func detect(src string, pwd string, ds []Detector, depth int) (string, error) {
 	getForce, getSrc := getForcedGetter(src)
 
 	// Separate out the subdir if there is one, we don't pass that to detect
@@ -98,6 +110,16 @@ func Detect(src string, pwd string, ds []Detector) (string, error) {
 			result = fmt.Sprintf("%s::%s", detectForce, result)
 		}
 
+		// The detector may have returned another shorthand
+		_, resultSrc := getForcedGetter(result)
+		resultSrc, _ = SourceDirSubdir(resultSrc)
+		if u, err := url.Parse(resultSrc); err != nil || u.Scheme == "" {
+			if depth >= maxDetectDepth {
+				return "", fmt.Errorf("invalid source string, too many detections: %s", src)
+			}
+			return detect(result, pwd, ds, depth+1)
+		}
+
 		return result, nil
 	}
 
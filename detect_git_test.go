@@ -22,6 +22,10 @@ func TestGitDetector(t *testing.T) {
 			"git@github.com:hashicorp/foo.git?foo=bar",
 			"git::ssh://git@github.com/hashicorp/foo.git?foo=bar",
 		},
+		{
+			"git@github.com:hashicorp/foo.git#v1.2.3",
+			"git::ssh://git@github.com/hashicorp/foo.git#v1.2.3",
+		},
 		{
 			"git@github.xyz.com:org/project.git",
 			"git::ssh://git@github.xyz.com/org/project.git",
@@ -7,7 +7,10 @@ import (
 )
 
 // GitHubDetector implements Detector to detect GitHub URLs and turn
-// them into URLs that the Git Getter can understand.
+// them into URLs that the Git Getter can understand. The download URLs of
+// release assets, github.com/username/repo/releases/download/TAG/ASSET or
+// github.com/username/repo/releases/latest/download/ASSET, are turned into
+// URLs of the GitHubReleaseGetter instead.
 type GitHubDetector struct{}
 
 func (d *GitHubDetector) Detect(src, _ string) (string, bool, error) {
@@ -29,6 +32,11 @@ func (d *GitHubDetector) detectHTTP(src string) (string, bool, error) {
 			"GitHub URLs should be github.com/username/repo")
 	}
 
+	if len(parts) > 6 && parts[3] == "releases" &&
+		(parts[4] == "download" || parts[4] == "latest" && parts[5] == "download") {
+		return "ghrelease::https://" + src, true, nil
+	}
+
 	urlStr := fmt.Sprintf("https://%s", strings.Join(parts[:3], "/"))
 	url, err := url.Parse(urlStr)
 	if err != nil {
@@ -24,6 +24,20 @@ func TestGitHubDetector(t *testing.T) {
 			"github.com/hashicorp/foo.git?foo=bar",
 			"git::https://github.com/hashicorp/foo.git?foo=bar",
 		},
+		{
+			"github.com/hashicorp/foo#v1.2.3",
+			"git::https://github.com/hashicorp/foo.git#v1.2.3",
+		},
+
+		// Release assets
+		{
+			"github.com/hashicorp/foo/releases/download/v1.2.3/foo.zip",
+			"ghrelease::https://github.com/hashicorp/foo/releases/download/v1.2.3/foo.zip",
+		},
+		{
+			"github.com/hashicorp/foo/releases/latest/download/foo.zip",
+			"ghrelease::https://github.com/hashicorp/foo/releases/latest/download/foo.zip",
+		},
 	}
 
 	pwd := "/pwd"
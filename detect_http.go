@@ -0,0 +1,90 @@
+package getter
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HTTPDetector implements Detector to detect host names followed by a path,
+// like "example.com/file.tar.gz", and turn them into HTTP URLs.
+//
+// Only a first path element looking like a domain name, optionally with a
+// port, is taken for a host, and it must not exist in the working
+// directory: "./example.com/file", "/example.com/file" and
+// "example.com/file" with an "example.com" directory in pwd are left to the
+// FileDetector. Nothing is detected without a pwd.
+//
+// It isn't part of the default Detectors, since a relative path like
+// "release.tar.gz/file" is taken for a host name when it doesn't exist; add
+// it before the FileDetector to opt in.
+type HTTPDetector struct {
+	// Scheme is the scheme of the detected URLs, "https" if empty.
+	Scheme string
+}
+
+func (d *HTTPDetector) Detect(src, pwd string) (string, bool, error) {
+	i := strings.Index(src, "/")
+	if i <= 0 || !isHostPort(src[:i]) {
+		return "", false, nil
+	}
+
+	// A local path wins over a host name. Without a pwd, it can't be told
+	// apart from "release.tar.gz/file" or "config.json/file".
+	if pwd == "" {
+		return "", false, nil
+	}
+	if _, err := os.Lstat(filepath.Join(pwd, src[:i])); err == nil {
+		return "", false, nil
+	}
+
+	scheme := d.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	u, err := url.Parse(scheme + "://" + src)
+	if err != nil {
+		return "", true, fmt.Errorf("error parsing HTTP URL: %s", err)
+	}
+	return u.String(), true, nil
+}
+
+// isHostPort reports whether s looks like a domain name, with at least two
+// labels and an alphabetic top-level domain, optionally followed by a port.
+func isHostPort(s string) bool {
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		port := s[i+1:]
+		if port == "" || strings.Trim(port, "0123456789") != "" {
+			return false
+		}
+		s = s[:i]
+	}
+
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	if len(tld) < 2 {
+		return false
+	}
+	for _, r := range tld {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package getter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPDetector(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"example.com/file.tar.gz", "https://example.com/file.tar.gz"},
+		{"example.com/dir/file?archive=zip", "https://example.com/dir/file?archive=zip"},
+		{"releases.example.co.uk:8443/v1/app.zip", "https://releases.example.co.uk:8443/v1/app.zip"},
+		{"my-host.example.com/", "https://my-host.example.com/"},
+	}
+
+	pwd := tempDir(t)
+	f := new(HTTPDetector)
+	for i, tc := range cases {
+		output, ok, err := f.Detect(tc.Input, pwd)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !ok {
+			t.Fatalf("%d: should be ok", i)
+		}
+		if output != tc.Output {
+			t.Fatalf("%d: bad: %#v", i, output)
+		}
+	}
+}
+
+func TestHTTPDetector_scheme(t *testing.T) {
+	f := &HTTPDetector{Scheme: "http"}
+	output, ok, err := f.Detect("example.com/file.tar.gz", tempDir(t))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ok || output != "http://example.com/file.tar.gz" {
+		t.Fatalf("bad: %q %t", output, ok)
+	}
+}
+
+func TestHTTPDetector_notHost(t *testing.T) {
+	cases := []string{
+		"",
+		"example.com",
+		"./example.com/file",
+		"../example.com/file",
+		"/example.com/file",
+		"foo/bar",
+		"foo.v2/bar",
+		"foo.c/bar",
+		"-foo.com/bar",
+		"foo..com/bar",
+		"foo.com:/bar",
+		"foo.com:http/bar",
+		"user@example.com/bar",
+		`C:\example.com\file`,
+	}
+
+	f := new(HTTPDetector)
+	for _, tc := range cases {
+		if output, ok, err := f.Detect(tc, "/pwd"); err != nil || ok {
+			t.Fatalf("%q: expected no detection, got %q %t %v", tc, output, ok, err)
+		}
+	}
+}
+
+func TestHTTPDetector_localPath(t *testing.T) {
+	pwd := tempDir(t)
+	if err := os.MkdirAll(filepath.Join(pwd, "example.com"), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(pwd)
+
+	f := new(HTTPDetector)
+	if output, ok, err := f.Detect("example.com/file", pwd); err != nil || ok {
+		t.Fatalf("expected no detection, got %q %t %v", output, ok, err)
+	}
+
+	output, err := Detect("example.com/file", pwd, Detectors)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := fmtFileURL(filepath.Join(pwd, "example.com", "file")); output != expected {
+		t.Fatalf("bad: %q, expected %q", output, expected)
+	}
+}
+
+func TestHTTPDetector_noPwd(t *testing.T) {
+	cases := []string{
+		"example.com/file.tar.gz",
+		"release.tar.gz/x",
+		"config.json/y",
+	}
+
+	f := new(HTTPDetector)
+	for _, tc := range cases {
+		if output, ok, err := f.Detect(tc, ""); err != nil || ok {
+			t.Fatalf("%q: expected no detection, got %q %t %v", tc, output, ok, err)
+		}
+	}
+}
+
+func TestHTTPDetector_fileLike(t *testing.T) {
+	pwd := tempDir(t)
+	defer os.RemoveAll(pwd)
+	for _, p := range []string{"release.tar.gz", "config.json"} {
+		if err := os.MkdirAll(filepath.Join(pwd, p), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	f := new(HTTPDetector)
+	for _, tc := range []string{"release.tar.gz/x", "config.json/y"} {
+		if output, ok, err := f.Detect(tc, pwd); err != nil || ok {
+			t.Fatalf("%q: expected no detection, got %q %t %v", tc, output, ok, err)
+		}
+	}
+}
@@ -27,6 +27,12 @@ func detectSSH(src string) (*url.URL, error) {
 	user := matched[1]
 	host := matched[2]
 	path := matched[3]
+
+	var fragment string
+	if idx := strings.Index(path, "#"); idx > -1 {
+		path, fragment = path[:idx], path[idx+1:]
+	}
+
 	qidx := strings.Index(path, "?")
 	if qidx == -1 {
 		qidx = len(path)
@@ -37,6 +43,7 @@ func detectSSH(src string) (*url.URL, error) {
 	u.User = url.User(user)
 	u.Host = host
 	u.Path = path[0:qidx]
+	u.Fragment = fragment
 	if qidx < len(path) {
 		q, err := url.ParseQuery(path[qidx+1:])
 		if err != nil {
@@ -2,6 +2,8 @@ package getter
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -76,6 +78,15 @@ func TestDetect(t *testing.T) {
 			"git::ssh://git@my.custom.git/dir1/dir2",
 			false,
 		},
+		{
+			"example.com/foo.tar.gz",
+			"/pwd",
+			"file:///pwd/example.com/foo.tar.gz",
+			false,
+		},
+		{"release.tar.gz/x", "/pwd", "file:///pwd/release.tar.gz/x", false},
+		{"foo/bar", "/pwd", "file:///pwd/foo/bar", false},
+		{"/foo.com/bar", "/pwd", "file:///foo.com/bar", false},
 	}
 
 	for i, tc := range cases {
@@ -90,3 +101,93 @@ func TestDetect(t *testing.T) {
 		})
 	}
 }
+
+func TestDetect_http(t *testing.T) {
+	// Host names are only detected with an HTTPDetector, which is opt-in
+	ds := []Detector{new(HTTPDetector), new(FileDetector)}
+	cases := []struct {
+		Input  string
+		Output string
+	}{
+		{"example.com/foo.tar.gz", "https://example.com/foo.tar.gz"},
+		{"example.com/archive.zip//sub", "https://example.com/archive.zip//sub"},
+		{"foo/bar", "file:///pwd/foo/bar"},
+	}
+	for _, tc := range cases {
+		output, err := Detect(tc.Input, "/pwd", ds)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad output: %s\nexpected: %s", tc.Input, output, tc.Output)
+		}
+	}
+}
+
+// testAcmeDetector expands the "acme/<repo>" shorthand to the git
+// repository of an internal host, and "acme-github/<repo>" to another
+// shorthand. "loop/<x>" is detected as itself.
+type testAcmeDetector struct{}
+
+func (d *testAcmeDetector) Detect(src, _ string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(src, "acme/"):
+		return "git::ssh://git@git.acme.test/" + strings.TrimPrefix(src, "acme/") + ".git", true, nil
+	case strings.HasPrefix(src, "acme-github/"):
+		return "github.com/acme/" + strings.TrimPrefix(src, "acme-github/"), true, nil
+	case strings.HasPrefix(src, "loop/"):
+		return src, true, nil
+	}
+	return "", false, nil
+}
+
+func TestDetect_chained(t *testing.T) {
+	ds := append([]Detector{new(testAcmeDetector)}, Detectors...)
+	cases := []struct {
+		Input  string
+		Output string
+		Err    bool
+	}{
+		{"acme/foo", "git::ssh://git@git.acme.test/foo.git", false},
+		{"acme/foo//sub", "git::ssh://git@git.acme.test/foo.git//sub", false},
+		{"hg::acme/foo", "hg::ssh://git@git.acme.test/foo.git", false},
+		{"acme-github/foo", "git::https://github.com/acme/foo.git", false},
+		{"acme-github/foo//sub", "git::https://github.com/acme/foo.git//sub", false},
+		{"loop/foo", "", true},
+	}
+
+	for _, tc := range cases {
+		output, err := Detect(tc.Input, "/pwd", ds)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: bad err: %v", tc.Input, err)
+		}
+		if output != tc.Output {
+			t.Fatalf("%s: bad output: %s\nexpected: %s", tc.Input, output, tc.Output)
+		}
+	}
+}
+
+func TestGet_detectorForcedGetter(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	g := new(MockGetter)
+	c := &Client{
+		Src:       "acme/foo",
+		Dst:       dst,
+		Dir:       true,
+		Detectors: append([]Detector{new(testAcmeDetector)}, Detectors...),
+		Getters:   map[string]Getter{"git": g, "ssh": new(MockGetter)},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The git getter is forced by the detector, not chosen from the scheme
+	if !g.GetCalled {
+		t.Fatal("expected the git getter to be used")
+	}
+	if actual := g.GetURL.String(); actual != "ssh://git@git.acme.test/foo.git" {
+		t.Fatalf("bad url: %s", actual)
+	}
+}
@@ -0,0 +1,30 @@
+package getter
+
+import (
+	"context"
+	"os"
+)
+
+// defaultDirMode is the mode of the created directories when
+// Client.DirMode is unset.
+const defaultDirMode os.FileMode = 0755
+
+type dirModeKey struct{}
+
+// withDirMode returns a copy of ctx carrying mode, the mode of the
+// directories created by the getters, see Client.DirMode.
+func withDirMode(ctx context.Context, mode os.FileMode) context.Context {
+	return context.WithValue(ctx, dirModeKey{}, mode)
+}
+
+// dirModeFromContext returns the directory mode carried by ctx, or
+// defaultDirMode.
+func dirModeFromContext(ctx context.Context) os.FileMode {
+	if ctx == nil {
+		return defaultDirMode
+	}
+	if mode, ok := ctx.Value(dirModeKey{}).(os.FileMode); ok && mode != 0 {
+		return mode
+	}
+	return defaultDirMode
+}
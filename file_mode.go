@@ -0,0 +1,30 @@
+package getter
+
+import (
+	"context"
+	"os"
+)
+
+// defaultFileMode is the mode, before the umask, of the files created by
+// the getters when Client.FileMode is unset, as with os.Create.
+const defaultFileMode os.FileMode = 0666
+
+type fileModeKey struct{}
+
+// withFileMode returns a copy of ctx carrying mode, the mode of the file
+// created by a single file download, see Client.FileMode.
+func withFileMode(ctx context.Context, mode os.FileMode) context.Context {
+	return context.WithValue(ctx, fileModeKey{}, mode)
+}
+
+// fileModeFromContext returns the file mode carried by ctx, or
+// defaultFileMode.
+func fileModeFromContext(ctx context.Context) os.FileMode {
+	if ctx == nil {
+		return defaultFileMode
+	}
+	if mode, ok := ctx.Value(fileModeKey{}).(os.FileMode); ok && mode != 0 {
+		return mode
+	}
+	return defaultFileMode
+}
@@ -0,0 +1,114 @@
+package getter
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// Filename returns the name of the file a download of src is written to
+// when Dst is a directory, without downloading it, e.g. to check that two
+// sources don't collide before getting them side by side. src is detected
+// and parsed as Client.Src.
+//
+// The name is the "filename" query parameter if set, otherwise what the
+// getter would use: the Content-Disposition header of a HEAD request for
+// the HttpGetter with ContentDisposition set, the base name of the object
+// for GCS, the name of the matched asset for GitHub releases, and the base
+// name of the URL path for the other getters. Get uses the same name. An
+// archive, given by the "archive" query parameter or the extension of the
+// source, has no name since it is unpacked into the destination. The
+// source isn't checked to be a file, see Validate.
+func (c *Client) Filename(src string) (string, error) {
+	if err := c.Configure(c.Options...); err != nil {
+		return "", err
+	}
+
+	r, err := c.resolve(src)
+	if err != nil {
+		return "", err
+	}
+	src, u, g := r.src, r.u, r.g
+
+	// An archive isn't written under a name, Get unpacks it into Dst
+	archiveV, _ := c.archiveType(u)
+	if c.Decompressors[archiveV] != nil {
+		return "", fmt.Errorf(
+			"'%s' is an archive unpacked into the destination, not a named file", src)
+	}
+	// Delete the magic query parameters, they aren't part of the source
+	q := u.Query()
+	for _, k := range []string{"checksum", "signature", "pubkey"} {
+		q.Del(k)
+	}
+	u.RawQuery = q.Encode()
+
+	name, err := downloadFilename(g, u)
+	if err != nil {
+		return "", fmt.Errorf("error naming '%s': %w", src, err)
+	}
+	return name, nil
+}
+
+// downloadFilename returns the name of the file downloaded from u by g
+// into a directory: the "filename" query parameter, which is deleted from
+// u, or else the name given by getterFilename.
+func downloadFilename(g Getter, u *url.URL) (string, error) {
+	q := u.Query()
+	if v := q.Get("filename"); v != "" {
+		q.Del("filename")
+		u.RawQuery = q.Encode()
+		return v, nil
+	}
+	return getterFilename(g, u)
+}
+
+// getterFilename returns the name of the file downloaded from u by g into
+// a directory: the one of the filenamer, or else the base name of the URL
+// path.
+func getterFilename(g Getter, u *url.URL) (string, error) {
+	if f, ok := g.(filenamer); ok {
+		return f.filename(u)
+	}
+	if name, ok := safeFilename(path.Base(u.Path)); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("cannot determine a filename for %s", redactURL(u))
+}
+
+// archiveType returns the key of the decompressor of u in Decompressors,
+// from the "archive" query parameter, which is deleted from u, or from the
+// extension of the URL path. split is the split archive u is a part of, if
+// any. The key has no decompressor if u isn't an archive.
+func (c *Client) archiveType(u *url.URL) (archiveV string, split *splitArchive) {
+	q := u.Query()
+	archiveV = q.Get("archive")
+	if archiveV != "" {
+		// Delete the paramter since it is a magic parameter we don't
+		// want to pass on to the Getter
+		q.Del("archive")
+		u.RawQuery = q.Encode()
+
+		// If we can parse the value as a bool and it is false, then
+		// set the archive to "-" which should never map to a decompressor
+		if b, err := strconv.ParseBool(archiveV); err == nil && !b {
+			archiveV = "-"
+		}
+		return archiveV, nil
+	}
+
+	// We don't appear to... but is it part of the filename?
+	if archiveV = matchDecompressor(c.Decompressors, u.Path); archiveV != "" {
+		return archiveV, nil
+	}
+
+	// Or of the name of a split archive, e.g. "foo.zip.001"?
+	if split = parseSplitArchive(u.Path); split != nil {
+		archiveV = matchDecompressor(c.Decompressors, split.name)
+	}
+	if archiveV == "" {
+		split = nil
+	}
+	return archiveV, split
+}
@@ -0,0 +1,149 @@
+package getter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClient_Filename_http(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if r.URL.Path == "/download" {
+			w.Header().Set("Content-Disposition", `attachment; filename="../release.zip"`)
+		}
+		w.Write([]byte("Hello\n"))
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Src                string
+		ContentDisposition bool
+		Filename           string
+	}{
+		{"/download?id=1", true, "release.zip"},
+		{"/download?id=1", false, "download"},
+		{"/files/foo.txt", true, "foo.txt"},
+		{"/files/foo.txt?filename=bar.txt", true, "bar.txt"},
+		{"/files/foo.tar.gz?checksum=md5:bad&archive=false", false, "foo.tar.gz"},
+	}
+
+	for _, tc := range cases {
+		mu.Lock()
+		methods = nil
+		mu.Unlock()
+
+		client := &Client{
+			Getters: map[string]Getter{
+				"http": &HttpGetter{ContentDisposition: tc.ContentDisposition},
+			},
+		}
+		filename, err := client.Filename(srv.URL + tc.Src)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Src, err)
+		}
+		if filename != tc.Filename {
+			t.Fatalf("%s: expected %q, got %q", tc.Src, tc.Filename, filename)
+		}
+		for _, m := range methods {
+			if m != "HEAD" {
+				t.Fatalf("%s: expected no download, got %v", tc.Src, methods)
+			}
+		}
+	}
+}
+
+func TestClient_Filename_gcs(t *testing.T) {
+	cases := []struct {
+		Src      string
+		Filename string
+	}{
+		{"gcs::https://www.googleapis.com/storage/v1/bucket/path/to/foo.txt", "foo.txt"},
+		{"gcs://bucket/path/to/foo.txt", "foo.txt"},
+		{"gcs://bucket/foo.txt?filename=bar.txt", "bar.txt"},
+	}
+	for _, tc := range cases {
+		filename, err := new(Client).Filename(tc.Src)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Src, err)
+		}
+		if filename != tc.Filename {
+			t.Fatalf("%s: expected %q, got %q", tc.Src, tc.Filename, filename)
+		}
+	}
+
+	if _, err := new(Client).Filename("gcs::https://www.googleapis.com/storage/v1/bucket"); err == nil {
+		t.Fatal("expected an error for an invalid GCS URL")
+	}
+}
+
+func TestClient_Filename_file(t *testing.T) {
+	client := &Client{Pwd: fixtureDir}
+	filename, err := client.Filename("basic/main.tf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filename != "main.tf" {
+		t.Fatalf("bad: %q", filename)
+	}
+
+	// Archives are unpacked, not written under a name
+	for _, src := range []string{
+		filepath.Join(fixtureDir, "archive.tar.gz") + "//sub",
+		"basic/main.tf?archive=zip",
+	} {
+		_, err = client.Filename(src)
+		if err == nil || !strings.Contains(err.Error(), "unpacked") {
+			t.Fatalf("%s: expected an error, got %v", src, err)
+		}
+	}
+	filename, err = client.Filename("archive.tgz?archive=false")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filename != "archive.tgz" {
+		t.Fatalf("bad: %q", filename)
+	}
+
+	_, err = client.Filename("/")
+	if err == nil || !strings.Contains(err.Error(), "cannot determine a filename") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+func TestClient_Filename_matchesGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="release.txt"`)
+		w.Write([]byte("Hello\n"))
+	}))
+	defer srv.Close()
+
+	for _, src := range []string{
+		srv.URL + "/download?id=1",
+		srv.URL + "/download?id=1&filename=custom.txt",
+	} {
+		client := &Client{
+			Src:  src,
+			Dst:  tempDir(t),
+			Mode: ClientModeAny,
+			Getters: map[string]Getter{
+				"http": &HttpGetter{ContentDisposition: true},
+			},
+		}
+		filename, err := client.Filename(src)
+		if err != nil {
+			t.Fatalf("%s: err: %s", src, err)
+		}
+		if err := client.Get(); err != nil {
+			t.Fatalf("%s: err: %s", src, err)
+		}
+		assertContents(t, filepath.Join(client.Dst, filename), "Hello\n")
+	}
+}
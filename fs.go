@@ -0,0 +1,92 @@
+package getter
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// FS is a filesystem the downloads are written to. See Client.FS.
+//
+// The paths given to its methods are the destination paths, as built with
+// the path/filepath package.
+type FS interface {
+	// MkdirAll creates the directory path and any missing parent, as
+	// os.MkdirAll.
+	MkdirAll(path string, perm os.FileMode) error
+
+	// Create creates or truncates the file name for writing, as os.Create.
+	Create(name string) (io.WriteCloser, error)
+
+	// Symlink creates newname as a symbolic link to oldname, as os.Symlink.
+	Symlink(oldname, newname string) error
+
+	// Chmod changes the mode of the file name, as os.Chmod.
+	Chmod(name string, mode os.FileMode) error
+
+	// Chtimes changes the access and modification times of the file name,
+	// as os.Chtimes.
+	Chtimes(name string, atime, mtime time.Time) error
+
+	// Lstat returns the FileInfo of the file name without following a
+	// final symbolic link, as os.Lstat. It returns an error satisfying
+	// os.IsNotExist when the file doesn't exist.
+	Lstat(name string) (os.FileInfo, error)
+
+	// Remove removes the file or empty directory name, as os.Remove.
+	Remove(name string) error
+
+	// RemoveAll removes name and any children it contains, as os.RemoveAll.
+	RemoveAll(name string) error
+}
+
+// OSFS is the FS of the operating system, used when Client.FS is nil.
+var OSFS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Create(name string) (io.WriteCloser, error)   { return os.Create(name) }
+func (osFS) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (osFS) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (osFS) Lstat(name string) (os.FileInfo, error)       { return os.Lstat(name) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+
+func (osFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (osFS) Link(oldname, newname string) error      { return os.Link(oldname, newname) }
+func (osFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+// linkFS is implemented by the FS supporting hard links, such as OSFS.
+type linkFS interface {
+	// Link creates newname as a hard link to the file oldname, as os.Link.
+	Link(oldname, newname string) error
+}
+
+// openFS is implemented by the FS whose files can be read back, such as
+// OSFS. The hard links of an archive are extracted as copies of their
+// target on an FS that doesn't support them.
+type openFS interface {
+	// Open opens the file name for reading, as os.Open.
+	Open(name string) (io.ReadCloser, error)
+}
+
+type fsKey struct{}
+
+// withFS returns a copy of ctx carrying fs, the filesystem the getters
+// supporting Client.FS write the destination to.
+func withFS(ctx context.Context, fs FS) context.Context {
+	return context.WithValue(ctx, fsKey{}, fs)
+}
+
+// fsFromContext returns the FS carried by ctx, or OSFS.
+func fsFromContext(ctx context.Context) FS {
+	if fs, ok := ctx.Value(fsKey{}).(FS); ok && fs != nil {
+		return fs
+	}
+	return OSFS
+}
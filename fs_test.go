@@ -0,0 +1,257 @@
+package getter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet_fsFile(t *testing.T) {
+	fs := newMemFS()
+	dst := filepath.Join(tempDir(t), "mem", "foo.txt")
+
+	client := &Client{
+		Src:     testModule("basic-file/foo.txt"),
+		Dst:     dst,
+		Mode:    ClientModeFile,
+		FS:      fs,
+		Getters: map[string]Getter{"file": &FileGetter{Copy: true}},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join(fixtureDir, "basic-file", "foo.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual := fs.contents(t, dst); actual != string(expected) {
+		t.Fatalf("bad: %q", actual)
+	}
+	if _, err := os.Lstat(filepath.Dir(dst)); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written to the OS filesystem: %v", err)
+	}
+}
+
+func TestGet_fsArchive(t *testing.T) {
+	fs := newMemFS()
+	dst := filepath.Join(tempDir(t), "mem")
+
+	client := &Client{
+		Src:  testModule("archive-rooted/archive.tar.gz"),
+		Dst:  dst,
+		Mode: ClientModeDir,
+		FS:   fs,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if actual := fs.contents(t, filepath.Join(dst, "root", "hello.txt")); actual != "hello\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+	if fi, err := fs.Lstat(filepath.Join(dst, "root")); err != nil || !fi.IsDir() {
+		t.Fatalf("expected a directory: %v", err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written to the OS filesystem: %v", err)
+	}
+}
+
+func TestGet_fsChecksum(t *testing.T) {
+	client := &Client{
+		Src:  testModule("basic-file/foo.txt") + "?checksum=md5:09f7e02f1290be211da707a266f153b3",
+		Dst:  filepath.Join(tempDir(t), "foo.txt"),
+		Mode: ClientModeFile,
+		FS:   newMemFS(),
+	}
+	err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "can't be used with Client.FS") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+// memFS is an in-memory FS.
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+	target  string
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string]*memFile{}}
+}
+
+// contents returns the contents of the regular file name.
+func (fs *memFS) contents(t *testing.T, name string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[filepath.Clean(name)]
+	if !ok || !f.mode.IsRegular() {
+		t.Fatalf("no file at %s", name)
+	}
+	return string(f.data)
+}
+
+func (fs *memFS) MkdirAll(path string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if f, ok := fs.files[p]; ok {
+			if !f.mode.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+			}
+			return nil
+		}
+		fs.files[p] = &memFile{mode: os.ModeDir | perm, modTime: time.Now()}
+		if filepath.Dir(p) == p {
+			return nil
+		}
+	}
+}
+
+func (fs *memFS) Create(name string) (io.WriteCloser, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name = filepath.Clean(name)
+	if err := fs.checkParent(name); err != nil {
+		return nil, err
+	}
+	f := &memFile{mode: 0666, modTime: time.Now()}
+	fs.files[name] = f
+	return &memWriter{fs: fs, f: f}, nil
+}
+
+func (fs *memFS) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	newname = filepath.Clean(newname)
+	if _, ok := fs.files[newname]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	if err := fs.checkParent(newname); err != nil {
+		return err
+	}
+	fs.files[newname] = &memFile{mode: os.ModeSymlink | 0777, modTime: time.Now(), target: oldname}
+	return nil
+}
+
+// Open implements openFS, memFS doesn't support hard links.
+func (fs *memFS) Open(name string) (io.ReadCloser, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[filepath.Clean(name)]
+	if !ok || !f.mode.IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (fs *memFS) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[filepath.Clean(name)]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: os.ErrNotExist}
+	}
+	f.mode = f.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (fs *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f, ok := fs.files[filepath.Clean(name)]
+	if !ok {
+		return &os.PathError{Op: "chtimes", Path: name, Err: os.ErrNotExist}
+	}
+	f.modTime = mtime
+	return nil
+}
+
+func (fs *memFS) Lstat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name = filepath.Clean(name)
+	f, ok := fs.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFileInfo{name: filepath.Base(name), f: *f}, nil
+}
+
+func (fs *memFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := fs.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	for p := range fs.files {
+		if filepath.Dir(p) == name && p != name {
+			return &os.PathError{Op: "remove", Path: name, Err: os.ErrExist}
+		}
+	}
+	delete(fs.files, name)
+	return nil
+}
+
+func (fs *memFS) RemoveAll(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	name = filepath.Clean(name)
+	for p := range fs.files {
+		if p == name || strings.HasPrefix(p, name+string(filepath.Separator)) {
+			delete(fs.files, p)
+		}
+	}
+	return nil
+}
+
+// checkParent returns an error if the parent directory of name doesn't
+// exist.
+func (fs *memFS) checkParent(name string) error {
+	if f, ok := fs.files[filepath.Dir(name)]; !ok || !f.mode.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+type memWriter struct {
+	fs  *memFS
+	f   *memFile
+	buf bytes.Buffer
+}
+
+func (w *memWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.f.data = w.buf.Bytes()
+	return nil
+}
+
+type memFileInfo struct {
+	name string
+	f    memFile
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return int64(len(fi.f.data)) }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.f.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.f.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.f.mode.IsDir() }
+func (fi *memFileInfo) Sys() interface{}   { return nil }
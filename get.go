@@ -14,6 +14,7 @@ package getter
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"net/url"
 	"os/exec"
 	"regexp"
@@ -48,6 +49,53 @@ type Getter interface {
 	SetClient(*Client)
 }
 
+// ClientModeHinter can be implemented by a Getter knowing the mode of some
+// sources without a round trip, e.g. because of the form of the URL. When
+// downloading with ClientModeAny, the Client then uses the hint instead of
+// calling ClientMode.
+type ClientModeHinter interface {
+	// ClientModeHint returns ClientModeFile or ClientModeDir when the mode
+	// of u is certain, and ClientModeInvalid otherwise.
+	ClientModeHint(*url.URL) ClientMode
+}
+
+// subdirRejecter is implemented by getters that can refuse to download a
+// source when only a subdirectory of it is requested, for example because
+// the downloaded result has no directory tree to copy from.
+type subdirRejecter interface {
+	rejectSubdir(*url.URL) error
+}
+
+// autoChecksummer is implemented by getters that can find the checksum of a
+// file next to it, when the source doesn't specify one.
+type autoChecksummer interface {
+	autoChecksum(*url.URL) (*fileChecksum, error)
+}
+
+// fileOpener is implemented by getters that can stream a single file
+// instead of writing it to disk, see Client.Verify.
+type fileOpener interface {
+	openFile(*url.URL) (io.ReadCloser, error)
+}
+
+// validator is implemented by getters that can check that a source exists
+// without downloading it, see Client.Validate.
+type validator interface {
+	validate(*url.URL) error
+}
+
+// filenamer is implemented by getters naming the downloaded file other
+// than by the base name of the URL path, see Client.Filename.
+type filenamer interface {
+	filename(*url.URL) (string, error)
+}
+
+// resumer is implemented by getters that can continue the interrupted
+// download of a file, see Client.Resume.
+type resumer interface {
+	resume(dst string, u *url.URL, token *ResumeToken) error
+}
+
 // Getters is the mapping of scheme to the Getter implementation that will
 // be used to get a dependency.
 var Getters map[string]Getter
@@ -63,15 +111,22 @@ func init() {
 	httpGetter := &HttpGetter{
 		Netrc: true,
 	}
+	ipfsGetter := new(IPFSGetter)
 
 	Getters = map[string]Getter{
-		"file":  new(FileGetter),
-		"git":   new(GitGetter),
-		"gcs":   new(GCSGetter),
-		"hg":    new(HgGetter),
-		"s3":    new(S3Getter),
-		"http":  httpGetter,
-		"https": httpGetter,
+		"ar":        new(ArtifactRegistryGetter),
+		"data":      new(DataGetter),
+		"file":      new(FileGetter),
+		"git":       new(GitGetter),
+		"gcs":       new(GCSGetter),
+		"ghrelease": new(GitHubReleaseGetter),
+		"hg":        new(HgGetter),
+		"ipfs":      ipfsGetter,
+		"ipns":      ipfsGetter,
+		"s3":        new(S3Getter),
+		"smb":       new(SMBGetter),
+		"http":      httpGetter,
+		"https":     httpGetter,
 	}
 }
 
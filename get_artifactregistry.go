@@ -0,0 +1,228 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// defaultArtifactRegistryEndpoint is the default of
+// ArtifactRegistryGetter.Endpoint.
+const defaultArtifactRegistryEndpoint = "https://artifactregistry.googleapis.com"
+
+// artifactRegistryScope is the OAuth2 scope of the downloads.
+const artifactRegistryScope = "https://www.googleapis.com/auth/cloud-platform.read-only"
+
+// ArtifactRegistryGetter is a Getter implementation that downloads a file of
+// a Google Artifact Registry generic repository. URLs have the form
+//
+//	ar://LOCATION-generic.pkg.dev/PROJECT/REPOSITORY/PACKAGE/VERSION/FILE
+//
+// where the host may also be the location alone, e.g.
+// "ar://us-central1/my-project/my-repo/my-package/1.0.0/app.tar.gz". The
+// requests are authenticated with the application default credentials.
+type ArtifactRegistryGetter struct {
+	getter
+
+	// Endpoint is the base URL of the Artifact Registry API, defaulting to
+	// https://artifactregistry.googleapis.com.
+	Endpoint string
+
+	// TokenSource, if set, provides the OAuth2 tokens of the requests
+	// instead of the application default credentials.
+	TokenSource oauth2.TokenSource
+
+	// Transport, if set, tunes the HTTP transport used to reach Artifact
+	// Registry.
+	Transport *TransportOptions
+}
+
+// withClient implements clientBinder.
+func (g *ArtifactRegistryGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
+// ClientMode always returns ClientModeFile: a URL names a single file of a
+// package version.
+func (g *ArtifactRegistryGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	if _, err := parseArtifactRegistryURL(u); err != nil {
+		return 0, err
+	}
+	return ClientModeFile, nil
+}
+
+// ClientModeHint implements ClientModeHinter.
+func (g *ArtifactRegistryGetter) ClientModeHint(_ *url.URL) ClientMode {
+	return ClientModeFile
+}
+
+func (g *ArtifactRegistryGetter) Get(dst string, u *url.URL) error {
+	return fmt.Errorf("Artifact Registry files can only be downloaded as a file")
+}
+
+func (g *ArtifactRegistryGetter) GetFile(dst string, u *url.URL) error {
+	ctx := g.Context()
+
+	f, err := parseArtifactRegistryURL(u)
+	if err != nil {
+		return err
+	}
+
+	body, size, err := g.open(ctx, f)
+	if err != nil {
+		return err
+	}
+	if g.client != nil && g.client.ProgressListener != nil {
+		body = g.client.ProgressListener.TrackProgress(f.name, 0, size, body)
+	}
+	defer body.Close()
+
+	// Create all the parent directories
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := Copy(ctx, out, body)
+	g.logf("downloaded %d bytes from %s", n, f)
+	return err
+}
+
+// openFile implements fileOpener.
+func (g *ArtifactRegistryGetter) openFile(u *url.URL) (io.ReadCloser, error) {
+	f, err := parseArtifactRegistryURL(u)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := g.open(g.Context(), f)
+	return body, err
+}
+
+// open sends the download request of f, returning the body of the response
+// and its size, -1 if unknown.
+func (g *ArtifactRegistryGetter) open(ctx context.Context, f *artifactRegistryFile) (io.ReadCloser, int64, error) {
+	client, err := g.httpClient(ctx, f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = defaultArtifactRegistryEndpoint
+	}
+	req, err := http.NewRequest("GET", f.downloadURL(endpoint), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+
+	g.logf("reading %s", f)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("bad response code fetching %s: %d", f, resp.StatusCode)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// httpClient returns the client authenticating the requests for f with the
+// TokenSource, or else the token source of the client's CredentialProvider,
+// or else the application default credentials.
+func (g *ArtifactRegistryGetter) httpClient(ctx context.Context, f *artifactRegistryFile) (*http.Client, error) {
+	ts := g.TokenSource
+	if ts == nil {
+		var err error
+		ts, err = g.credentials().GoogleTokenSource(ctx, f.repository())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ts == nil {
+		// The token source outlives the download context, its tokens are
+		// refreshed lazily
+		var err error
+		ts, err = google.DefaultTokenSource(context.Background(), artifactRegistryScope)
+		if err != nil {
+			return nil, fmt.Errorf("no Artifact Registry credentials found: %s", err)
+		}
+	}
+
+	var base http.RoundTripper
+	if g.Transport != nil {
+		base = g.Transport.httpTransport()
+	} else {
+		base = cleanhttp.DefaultTransport()
+	}
+	base = g.hostTransport(base)
+	return &http.Client{Transport: &oauth2.Transport{Source: ts, Base: base}}, nil
+}
+
+// artifactRegistryFile is a file of a generic repository.
+type artifactRegistryFile struct {
+	location, project, repo string
+	pkg, version, name      string
+}
+
+// repository returns the resource name of the repository of the file.
+func (f *artifactRegistryFile) repository() string {
+	return fmt.Sprintf("projects/%s/locations/%s/repositories/%s", f.project, f.location, f.repo)
+}
+
+// String returns the resource name of the file.
+func (f *artifactRegistryFile) String() string {
+	return fmt.Sprintf("projects/%s/locations/%s/repositories/%s/files/%s:%s:%s",
+		f.project, f.location, f.repo, f.pkg, f.version, f.name)
+}
+
+// downloadURL returns the URL downloading the contents of the file from
+// the API at endpoint.
+func (f *artifactRegistryFile) downloadURL(endpoint string) string {
+	return fmt.Sprintf("%s/download/v1/projects/%s/locations/%s/repositories/%s/files/%s:download?alt=media",
+		strings.TrimSuffix(endpoint, "/"),
+		url.PathEscape(f.project), url.PathEscape(f.location), url.PathEscape(f.repo),
+		url.PathEscape(f.pkg+":"+f.version+":"+f.name))
+}
+
+// parseArtifactRegistryURL returns the file named by the URL u, see
+// ArtifactRegistryGetter.
+func parseArtifactRegistryURL(u *url.URL) (*artifactRegistryFile, error) {
+	location := strings.TrimSuffix(u.Hostname(), "-generic.pkg.dev")
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 5)
+	if location == "" || len(parts) != 5 {
+		return nil, fmt.Errorf("URL is not a valid Artifact Registry URL, expected " +
+			"ar://LOCATION-generic.pkg.dev/PROJECT/REPOSITORY/PACKAGE/VERSION/FILE")
+	}
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("URL is not a valid Artifact Registry URL: empty path element in %s", u.Path)
+		}
+	}
+
+	return &artifactRegistryFile{
+		location: location,
+		project:  parts[0],
+		repo:     parts[1],
+		pkg:      parts[2],
+		version:  parts[3],
+		name:     parts[4],
+	}, nil
+}
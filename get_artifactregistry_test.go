@@ -0,0 +1,153 @@
+package getter
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestArtifactRegistryGetter_impl(t *testing.T) {
+	var _ Getter = new(ArtifactRegistryGetter)
+}
+
+// testArtifactRegistryServer starts a fake Artifact Registry API serving
+// files (resource name to contents) to the requests holding the token
+// "secret".
+func testArtifactRegistryServer(t *testing.T, files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/download/v1/")
+		if !strings.HasSuffix(name, ":download") || r.URL.Query().Get("alt") != "media" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		contents, ok := files[strings.TrimSuffix(name, ":download")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(contents))
+	}))
+}
+
+func testArtifactRegistryGetter(endpoint, token string) *ArtifactRegistryGetter {
+	g := &ArtifactRegistryGetter{
+		Endpoint:    endpoint,
+		TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+	}
+	g.SetClient(&Client{Ctx: context.Background()})
+	return g
+}
+
+func TestArtifactRegistryGetter_GetFile(t *testing.T) {
+	srv := testArtifactRegistryServer(t, map[string]string{
+		"projects/my-project/locations/us-central1/repositories/my-repo/files/my-package:1.0.0:app.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	cases := []string{
+		"ar://us-central1-generic.pkg.dev/my-project/my-repo/my-package/1.0.0/app.txt",
+		"ar://us-central1/my-project/my-repo/my-package/1.0.0/app.txt",
+		"https://us-central1-generic.pkg.dev/my-project/my-repo/my-package/1.0.0/app.txt",
+	}
+	for _, tc := range cases {
+		t.Run(tc, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := testArtifactRegistryGetter(srv.URL, "secret")
+			if err := g.GetFile(dst, testURL(tc)); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, "Hello\n")
+		})
+	}
+}
+
+func TestArtifactRegistryGetter_GetFile_errors(t *testing.T) {
+	srv := testArtifactRegistryServer(t, map[string]string{
+		"projects/p/locations/l/repositories/r/files/pkg:1.0.0:app.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		Name  string
+		URL   string
+		Token string
+		Err   string
+	}{
+		{"not found", "ar://l/p/r/pkg/2.0.0/app.txt", "secret", "404"},
+		{"unauthenticated", "ar://l/p/r/pkg/1.0.0/app.txt", "bad", "401"},
+		{"no file", "ar://l/p/r/pkg/1.0.0", "secret", "not a valid Artifact Registry URL"},
+		{"empty element", "ar://l/p/r//1.0.0/app.txt", "secret", "empty path element"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := testArtifactRegistryGetter(srv.URL, tc.Token)
+			err := g.GetFile(dst, testURL(tc.URL))
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestArtifactRegistryGetter_ClientMode(t *testing.T) {
+	g := new(ArtifactRegistryGetter)
+	mode, err := g.ClientMode(testURL("ar://us-central1/p/r/pkg/1.0.0/app.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mode != ClientModeFile {
+		t.Fatal("expect ClientModeFile")
+	}
+
+	if _, err := g.ClientMode(testURL("ar://us-central1/p/r")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestArtifactRegistryGetter_client(t *testing.T) {
+	archive, err := ioutil.ReadFile(filepath.Join(fixtureDir, "archive.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	srv := testArtifactRegistryServer(t, map[string]string{
+		"projects/p/locations/l/repositories/r/files/pkg:1.0.0:app.tar.gz": string(archive),
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	client := &Client{
+		Src:  "ar://l/p/r/pkg/1.0.0/app.tar.gz",
+		Dst:  dst,
+		Mode: ClientModeAny,
+		Getters: map[string]Getter{
+			"ar": &ArtifactRegistryGetter{
+				Endpoint:    srv.URL,
+				TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret"}),
+			},
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
@@ -1,6 +1,10 @@
 package getter
 
-import "context"
+import (
+	"context"
+	"net/http"
+	"os"
+)
 
 // getter is our base getter; it regroups
 // fields all getters have in common.
@@ -10,6 +14,39 @@ type getter struct {
 
 func (g *getter) SetClient(c *Client) { g.client = c }
 
+// clientBinder is implemented by the getters that are copied for each
+// download, bound to the downloading client. This way the getters shared by
+// several clients, like the ones of Getters, are never modified and can be
+// used concurrently.
+type clientBinder interface {
+	withClient(c *Client) Getter
+}
+
+// asClientBinder returns g as a clientBinder if it is one of the built-in
+// getters. A type embedding a built-in getter also has its withClient
+// method, which would return a copy of the embedded getter without the
+// methods the type overrides: such getters aren't bound.
+func asClientBinder(g Getter) (clientBinder, bool) {
+	switch g := g.(type) {
+	case *ArtifactRegistryGetter, *DataGetter, *FileGetter, *GCSGetter,
+		*GitGetter, *GitHubReleaseGetter, *HgGetter, *HttpGetter,
+		*IPFSGetter, *S3Getter, *SMBGetter:
+		b, ok := g.(clientBinder)
+		return b, ok
+	}
+	return nil, false
+}
+
+// bindGetter returns the getter running a download of c with g. Getters
+// that aren't built-in clientBinders are used as is, their client is set
+// by Configure.
+func bindGetter(g Getter, c *Client) Getter {
+	if b, ok := asClientBinder(g); ok {
+		return b.withClient(c)
+	}
+	return g
+}
+
 // Context tries to returns the Contex from the getter's
 // client. otherwise context.Background() is returned.
 func (g *getter) Context() context.Context {
@@ -18,3 +55,107 @@ func (g *getter) Context() context.Context {
 	}
 	return g.client.Ctx
 }
+
+// fs returns the filesystem the getter writes the destination to, OSFS
+// unless the getter supports Client.FS and the client has one.
+func (g *getter) fs() FS {
+	return fsFromContext(g.Context())
+}
+
+// dirMode returns the mode of the directories created by the getter, see
+// Client.DirMode.
+func (g *getter) dirMode() os.FileMode {
+	return dirModeFromContext(g.Context())
+}
+
+// fileMode returns the mode of the file created by a single file download
+// of the getter, see Client.FileMode.
+func (g *getter) fileMode() os.FileMode {
+	return fileModeFromContext(g.Context())
+}
+
+// fileComplete reports the object name of size bytes, written by a
+// directory download, to the OnFileComplete callback of the getter's
+// client.
+func (g *getter) fileComplete(name string, size int64) {
+	if g == nil || g.client == nil || g.client.OnFileComplete == nil {
+		return
+	}
+	g.client.OnFileComplete(name, size)
+}
+
+// hostConfig returns the configuration of host from the Hosts of the
+// getter's client, or else from its CredentialHelper. An error of the
+// helper fails the download, as it fails the requests of hostTransport.
+func (g *getter) hostConfig(host string) (HostConfig, bool, error) {
+	if g == nil || g.client == nil {
+		return HostConfig{}, false, nil
+	}
+	if hc, ok := matchHostConfig(g.client.Hosts, host); ok || g.client.CredentialHelper == nil {
+		return hc, ok, nil
+	}
+	return g.client.CredentialHelper.hostConfig(g.Context(), host)
+}
+
+// hostTransport returns base adding the headers configured for each host
+// by the getter's client, or base itself if there are none.
+func (g *getter) hostTransport(base http.RoundTripper) http.RoundTripper {
+	if g == nil || g.client == nil || (len(g.client.Hosts) == 0 && g.client.CredentialHelper == nil) {
+		return base
+	}
+	return &hostConfigTransport{base: base, hosts: g.client.Hosts, helper: g.client.CredentialHelper}
+}
+
+// credentials returns the CredentialProvider of the getter's client,
+// defaulting to the one of its CredentialHelper, and then to
+// EnvCredentials.
+func (g *getter) credentials() CredentialProvider {
+	switch {
+	case g == nil || g.client == nil:
+		return EnvCredentials{}
+	case g.client.Credentials != nil:
+		return g.client.Credentials
+	case g.client.CredentialHelper != nil:
+		return helperCredentials{helper: g.client.CredentialHelper}
+	default:
+		return EnvCredentials{}
+	}
+}
+
+// tmpDir returns the TmpDir of the getter's client, "" meaning the default
+// temporary directory.
+func (g *getter) tmpDir() string {
+	if g == nil || g.client == nil {
+		return ""
+	}
+	return g.client.TmpDir
+}
+
+// merge reports whether directory downloads must be written into the
+// existing destination, see Client.Merge.
+func (g *getter) merge() bool {
+	return g != nil && g.client != nil && g.client.Merge
+}
+
+// requireAuth reports whether the source must be accessed with credentials,
+// see Client.RequireAuth.
+func (g *getter) requireAuth() bool {
+	return g != nil && g.client != nil && g.client.RequireAuth
+}
+
+// retryPolicy returns the RetryPolicy of the getter's client, if any.
+func (g *getter) retryPolicy() RetryPolicy {
+	if g == nil || g.client == nil {
+		return nil
+	}
+	return g.client.RetryPolicy
+}
+
+// userAgent returns the User-Agent of the getter's client, defaulting to
+// DefaultUserAgent.
+func (g *getter) userAgent() string {
+	if g == nil || g.client == nil || g.client.UserAgent == "" {
+		return DefaultUserAgent
+	}
+	return g.client.UserAgent
+}
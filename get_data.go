@@ -0,0 +1,99 @@
+package getter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DataGetter is a Getter implementation that writes the payload of a data
+// URI (RFC 2397) to a file, e.g.:
+//
+//	data:text/plain;base64,SGVsbG8K
+//	data:,Hello%0A
+//
+// Data URIs always refer to a single file. The query string of the URI holds
+// the go-getter options, so '?' and '#' must be percent-encoded in percent
+// encoded payloads.
+type DataGetter struct {
+	getter
+}
+
+// withClient implements clientBinder.
+func (g *DataGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
+func (g *DataGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	return ClientModeFile, nil
+}
+
+// ClientModeHint implements ClientModeHinter.
+func (g *DataGetter) ClientModeHint(_ *url.URL) ClientMode {
+	return ClientModeFile
+}
+
+func (g *DataGetter) Get(dst string, u *url.URL) error {
+	return fmt.Errorf("data URIs can only be downloaded as a file")
+}
+
+func (g *DataGetter) GetFile(dst string, u *url.URL) error {
+	ctx := g.Context()
+
+	data, err := parseDataURI(u)
+	if err != nil {
+		return err
+	}
+
+	// Create all the parent directories
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = Copy(ctx, f, bytes.NewReader(data))
+	return err
+}
+
+// parseDataURI returns the decoded payload of the data URI u.
+func parseDataURI(u *url.URL) ([]byte, error) {
+	if u.Opaque == "" {
+		return nil, fmt.Errorf("malformed data URI: expected data:[<mediatype>][;base64],<data>")
+	}
+
+	idx := strings.Index(u.Opaque, ",")
+	if idx == -1 {
+		return nil, fmt.Errorf("malformed data URI: missing ',' before the data")
+	}
+	meta, payload := u.Opaque[:idx], u.Opaque[idx+1:]
+
+	payload, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed data URI: %s", err)
+	}
+
+	if !strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		return []byte(payload), nil
+	}
+
+	enc := base64.StdEncoding
+	if !strings.HasSuffix(payload, "=") && len(payload)%4 != 0 {
+		enc = base64.RawStdEncoding
+	}
+	data, err := enc.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed data URI: invalid base64 data: %s", err)
+	}
+	return data, nil
+}
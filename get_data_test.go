@@ -0,0 +1,99 @@
+package getter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataGetter_impl(t *testing.T) {
+	var _ Getter = new(DataGetter)
+}
+
+func TestDataGetter_GetFile(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Source   string
+		Expected string
+		Err      bool
+	}{
+		{
+			"base64",
+			"data:application/octet-stream;base64,SGVsbG8K",
+			"Hello\n",
+			false,
+		},
+		{
+			"base64 without padding",
+			"data:;base64,SGVsbG8",
+			"Hello",
+			false,
+		},
+		{
+			"base64 containing slashes",
+			"data:;base64,///+",
+			"\xff\xff\xfe",
+			false,
+		},
+		{
+			"percent-encoded",
+			"data:text/plain,Hello%2C%20World%0A",
+			"Hello, World\n",
+			false,
+		},
+		{
+			"empty media type",
+			"data:,Hello",
+			"Hello",
+			false,
+		},
+		{
+			"with checksum",
+			"data:,Hello?checksum=md5:8b1a9953c4611296a827abf8c47804d7",
+			"Hello",
+			false,
+		},
+		{
+			"missing comma",
+			"data:text/plain;base64",
+			"",
+			true,
+		},
+		{
+			"invalid base64",
+			"data:;base64,!!!!",
+			"",
+			true,
+		},
+		{
+			"invalid percent-encoding",
+			"data:,100%",
+			"",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			err := GetFile(dst, tc.Source)
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+			if !tc.Err {
+				assertContents(t, dst, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestDataGetter_Get(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	if err := Get(dst, "data:,Hello"); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -14,6 +14,13 @@ type FileGetter struct {
 	Copy bool
 }
 
+// withClient implements clientBinder.
+func (g *FileGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
 func (g *FileGetter) ClientMode(u *url.URL) (ClientMode, error) {
 	path := u.Path
 	if u.RawPath != "" {
@@ -32,3 +39,9 @@ func (g *FileGetter) ClientMode(u *url.URL) (ClientMode, error) {
 
 	return ClientModeFile, nil
 }
+
+// validate implements validator.
+func (g *FileGetter) validate(u *url.URL) error {
+	_, err := g.ClientMode(u)
+	return err
+}
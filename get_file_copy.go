@@ -10,8 +10,18 @@ type readerFunc func(p []byte) (n int, err error)
 
 func (rf readerFunc) Read(p []byte) (n int, err error) { return rf(p) }
 
-// Copy is a io.Copy cancellable by context
+// Copy is a io.Copy cancellable by context. When ctx carries the byte limit
+// of a Client with MaxBytes set, the bytes copied count towards it. When a
+// checksum is expected, the bytes of the file downloaded by the Client are
+// hashed as they are copied.
 func Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	if l := byteLimitFromContext(ctx); l != nil {
+		src = l.reader(src)
+	}
+	if s := checksumStreamFromContext(ctx); s != nil {
+		src = s.reader(src)
+	}
+
 	// Copy will call the Reader and Writer interface multiple time, in order
 	// to copy by chunk (avoiding loading the whole file in memory).
 	return io.Copy(dst, readerFunc(func(p []byte) (int, error) {
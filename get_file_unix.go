@@ -16,13 +16,20 @@ func (g *FileGetter) Get(dst string, u *url.URL) error {
 	}
 
 	// The source path must exist and be a directory to be usable.
-	if fi, err := os.Stat(path); err != nil {
-		return fmt.Errorf("source path error: %s", err)
-	} else if !fi.IsDir() {
+	srcFi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("source path error: %w", err)
+	} else if !srcFi.IsDir() {
 		return fmt.Errorf("source path must be a directory")
 	}
 
-	fi, err := os.Lstat(dst)
+	// Keep dst if the overwrite policy says so
+	fs := g.fs()
+	if ok, err := g.overwritePolicy().shouldWriteFS(fs, dst, srcFi.ModTime()); err != nil || !ok {
+		return err
+	}
+
+	fi, err := fs.Lstat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -35,17 +42,17 @@ func (g *FileGetter) Get(dst string, u *url.URL) error {
 		}
 
 		// Remove the destination
-		if err := os.Remove(dst); err != nil {
+		if err := fs.Remove(dst); err != nil {
 			return err
 		}
 	}
 
 	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := fs.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
-	return os.Symlink(path, dst)
+	return fs.Symlink(path, dst)
 }
 
 func (g *FileGetter) GetFile(dst string, u *url.URL) error {
@@ -56,13 +63,20 @@ func (g *FileGetter) GetFile(dst string, u *url.URL) error {
 	}
 
 	// The source path must exist and be a file to be usable.
-	if fi, err := os.Stat(path); err != nil {
-		return fmt.Errorf("source path error: %s", err)
-	} else if fi.IsDir() {
+	srcFi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("source path error: %w", err)
+	} else if srcFi.IsDir() {
 		return fmt.Errorf("source path must be a file")
 	}
 
-	_, err := os.Lstat(dst)
+	// Keep dst if the overwrite policy says so
+	fs := g.fs()
+	if ok, err := g.overwritePolicy().shouldWriteFS(fs, dst, srcFi.ModTime()); err != nil || !ok {
+		return err
+	}
+
+	_, err = fs.Lstat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -70,19 +84,19 @@ func (g *FileGetter) GetFile(dst string, u *url.URL) error {
 	// If the destination already exists, it must be a symlink
 	if err == nil {
 		// Remove the destination
-		if err := os.Remove(dst); err != nil {
+		if err := fs.Remove(dst); err != nil {
 			return err
 		}
 	}
 
 	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := fs.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
 	// If we're not copying, just symlink and we're done
 	if !g.Copy {
-		return os.Symlink(path, dst)
+		return fs.Symlink(path, dst)
 	}
 
 	// Copy
@@ -92,7 +106,7 @@ func (g *FileGetter) GetFile(dst string, u *url.URL) error {
 	}
 	defer srcF.Close()
 
-	dstF, err := os.Create(dst)
+	dstF, err := fs.Create(dst)
 	if err != nil {
 		return err
 	}
@@ -2,20 +2,122 @@ package getter
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 )
 
 // GCSGetter is a Getter implementation that will download a module from
 // a GCS bucket.
 type GCSGetter struct {
 	getter
+
+	// PartSize, if greater than zero, enables multipart downloads. Objects
+	// larger than PartSize are fetched as several ranges of PartSize bytes in
+	// parallel, other objects are downloaded as a single stream.
+	PartSize int64
+
+	// MaxConcurrency is the maximum number of parts fetched at the same
+	// time during a multipart download. It defaults to 4.
+	MaxConcurrency int
+
+	// ChunkSize, if greater than zero, is the size of the read buffer of
+	// the downloads: the response of GCS is read ChunkSize bytes at a time
+	// into the buffer, which is then copied to the destination, e.g. to
+	// read large objects in bigger chunks on fast links. Otherwise it is
+	// read in the chunks of the copy to the destination, 32 KB. It doesn't
+	// change the requests sent to GCS.
+	ChunkSize int
+
+	// UseMetadataCredentials, if true, authenticates with the service
+	// account of the GCE instance or GKE workload, whose tokens are fetched
+	// from the metadata server. GOOGLE_APPLICATION_CREDENTIALS and the other
+	// sources of application default credentials are ignored.
+	UseMetadataCredentials bool
+
+	// Transport, if set, tunes the HTTP transport used to reach GCS.
+	Transport *TransportOptions
+
+	// HTTPClient, if set, is the HTTP client used to reach GCS, e.g. one
+	// sending the requests through an egress proxy. The requests are still
+	// authenticated by the getter. It takes precedence over Transport.
+	HTTPClient *http.Client
+
+	// SyncMode, if true, makes directory downloads skip the objects whose
+	// local copy already has the same size and CRC32C checksum. The
+	// destination is kept, as with Client.Merge.
+	SyncMode bool
+
+	// MetadataFile, if set, is the path of a JSON file that directory
+	// downloads write with the name, size, storage class and generation of
+	// every object of the download, see GCSObjectMetadata, e.g. to upload
+	// them again with the same storage class. A relative path is relative to
+	// the destination directory.
+	MetadataFile string
+
+	// PathMapper, if set, chooses the path of each object of a directory
+	// download, relative to the destination, or skips it. By default the
+	// objects keep their name relative to the downloaded prefix. The
+	// directory placeholders aren't created with a PathMapper.
+	PathMapper ObjectPathMapper
+
+	// AllowEmpty, if true, makes a directory download of a prefix or glob
+	// matching no objects create an empty destination directory instead of
+	// failing.
+	AllowEmpty bool
+
+	// KeepPartial, if true, makes a canceled directory download keep the
+	// objects already downloaded and return a PartialDownloadError listing
+	// the completed and pending objects, e.g. to resume the download later
+	// with SyncMode. The objects are still listed after the cancellation
+	// to report the pending ones.
+	KeepPartial bool
+
+	// QuotaProject, if set, is the project the requests are billed to and
+	// counted against the quota of, instead of the project of the
+	// credentials, e.g. when they give access to several projects. The
+	// "quota_project" query parameter takes precedence.
+	QuotaProject string
+}
+
+// GCSObjectMetadata is an object listed in the GCSGetter.MetadataFile.
+type GCSObjectMetadata struct {
+	Bucket       string `json:"bucket"`
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	StorageClass string `json:"storageClass"`
+	Generation   int64  `json:"generation"`
+}
+
+// crc32cTable is the table of the CRC32C checksums of GCS objects.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// computeTokenSource returns the token source of the metadata server. It is
+// a variable so that tests can replace it.
+var computeTokenSource = google.ComputeTokenSource
+
+// withClient implements clientBinder.
+func (g *GCSGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
 }
 
 func (g *GCSGetter) ClientMode(u *url.URL) (ClientMode, error) {
@@ -26,9 +128,12 @@ func (g *GCSGetter) ClientMode(u *url.URL) (ClientMode, error) {
 	if err != nil {
 		return 0, err
 	}
+	if _, glob := gcsListPrefix(object); glob {
+		return ClientModeDir, nil
+	}
 
 	sctx := context.Background()
-	client, err := storage.NewClient(sctx)
+	client, err := g.getClient(sctx, u)
 	if err != nil {
 		return 0, err
 	}
@@ -53,6 +158,20 @@ func (g *GCSGetter) ClientMode(u *url.URL) (ClientMode, error) {
 	}
 }
 
+// ClientModeHint implements ClientModeHinter: an object path ending with a
+// slash or containing a glob, or the whole bucket, can only be downloaded as
+// a directory.
+func (g *GCSGetter) ClientModeHint(u *url.URL) ClientMode {
+	_, object, err := g.parseURL(u)
+	if err != nil || (u.Scheme != "gcs" && !strings.Contains(u.Host, "googleapis.com")) {
+		return ClientModeInvalid
+	}
+	if _, glob := gcsListPrefix(object); glob || object == "" || strings.HasSuffix(object, "/") {
+		return ClientModeDir
+	}
+	return ClientModeInvalid
+}
+
 func (g *GCSGetter) Get(dst string, u *url.URL) error {
 	ctx := g.Context()
 
@@ -62,31 +181,54 @@ func (g *GCSGetter) Get(dst string, u *url.URL) error {
 		return err
 	}
 
-	// Remove destination if it already exists
+	// Remove destination if it already exists, unless merging into it
 	_, err = os.Stat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	if err == nil {
+	if err == nil && !g.merge() && !g.SyncMode {
 		// Remove the destination
 		if err := os.RemoveAll(dst); err != nil {
 			return err
 		}
 	}
 
-	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	// Create all the parent directories, remembering the topmost one
+	// created so that it can be removed if nothing is downloaded.
+	created := missingDir(filepath.Dir(dst))
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
 	sctx := context.Background()
-	client, err := storage.NewClient(sctx)
+	client, err := g.getClient(sctx, u)
 	if err != nil {
 		return err
 	}
 
-	// Iterate through all matching objects.
-	iter := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: object})
+	// With a progress tracker, list the objects a first time to report
+	// the size of the whole download.
+	var current, total int64
+	if g.client != nil && g.client.ProgressListener != nil {
+		total, err = g.prefixSize(ctx, client, bucket, object)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Iterate through all matching objects. A partial download lists the
+	// pending objects after the cancellation.
+	prefix, _ := gcsListPrefix(object)
+	g.logf("listing gs://%s/%s", bucket, prefix)
+	listCtx := ctx
+	if g.KeepPartial {
+		listCtx = context.WithoutCancel(ctx)
+	}
+	iter := client.Bucket(bucket).Objects(listCtx, &storage.Query{Prefix: prefix})
+	found := false
+	metadata := []GCSObjectMetadata{}
+	var completed []string
+	var partial *PartialDownloadError
 	for {
 		obj, err := iter.Next()
 		if err != nil && err != iterator.Done {
@@ -96,17 +238,115 @@ func (g *GCSGetter) Get(dst string, u *url.URL) error {
 			break
 		}
 
+		// The "dir/" placeholders created by gsutil and the console stand
+		// for a directory, possibly empty
+		if strings.HasSuffix(obj.Name, "/") {
+			dirDst, ok, err := gcsMatchDir(object, obj.Name)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			found = true
+			if g.PathMapper != nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Join(dst, dirDst), g.dirMode()); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// Get the object destination path
-		objDst, err := filepath.Rel(object, obj.Name)
+		objDst, ok, err := gcsMatchObject(object, obj.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		objDst, ok, err = g.PathMapper.mapObject(obj.Name, objDst)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			continue
+		}
 		objDst = filepath.Join(dst, objDst)
+		metadata = append(metadata, GCSObjectMetadata{
+			Bucket:       bucket,
+			Name:         obj.Name,
+			Size:         obj.Size,
+			StorageClass: obj.StorageClass,
+			Generation:   obj.Generation,
+		})
+		if g.SyncMode && gcsObjectMatches(objDst, obj) {
+			g.logf("skipping up-to-date gs://%s/%s", bucket, obj.Name)
+			completed = append(completed, obj.Name)
+			current += obj.Size
+			continue
+		}
+		if partial != nil {
+			partial.Pending = append(partial.Pending, obj.Name)
+			continue
+		}
+
 		// Download the matching object.
-		err = g.getObject(ctx, client, objDst, bucket, obj.Name)
+		err = g.getObject(ctx, client, objDst, bucket, obj.Name, current, total)
+		if err != nil && g.KeepPartial && ctx.Err() != nil {
+			// Only keep the complete objects
+			os.Remove(objDst)
+			partial = &PartialDownloadError{Err: err, Completed: completed, Pending: []string{obj.Name}}
+			continue
+		}
 		if err != nil {
 			return err
 		}
+		g.fileComplete(obj.Name, obj.Size)
+		completed = append(completed, obj.Name)
+		current += obj.Size
+	}
+	if partial != nil {
+		return partial
+	}
+
+	if !found && g.AllowEmpty {
+		if err := os.MkdirAll(dst, g.dirMode()); err != nil {
+			return err
+		}
+	} else if !found {
+		if created != "" {
+			os.RemoveAll(created)
+		}
+		if _, glob := gcsListPrefix(object); glob {
+			return fmt.Errorf("no objects matching %q in bucket %q", object, bucket)
+		}
+		return fmt.Errorf("no objects found under prefix %q in bucket %q", object, bucket)
+	}
+	if g.MetadataFile != "" {
+		return g.writeMetadata(dst, metadata)
+	}
+	return nil
+}
+
+// writeMetadata writes the metadata of the objects downloaded to dst to the
+// MetadataFile.
+func (g *GCSGetter) writeMetadata(dst string, metadata []GCSObjectMetadata) error {
+	path := g.MetadataFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dst, path)
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), g.dirMode()); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing the GCS metadata file: %s", err)
 	}
 	return nil
 }
@@ -121,36 +361,523 @@ func (g *GCSGetter) GetFile(dst string, u *url.URL) error {
 	}
 
 	sctx := context.Background()
-	client, err := storage.NewClient(sctx)
+	client, err := g.getClient(sctx, u)
+	if err != nil {
+		return err
+	}
+	return g.getObject(ctx, client, dst, bucket, object, 0, 0)
+}
+
+// prefixSize returns the total size of the objects a directory download of
+// object gets.
+func (g *GCSGetter) prefixSize(ctx context.Context, client *storage.Client, bucket, object string) (int64, error) {
+	prefix, _ := gcsListPrefix(object)
+	g.logf("listing gs://%s/%s", bucket, prefix)
+	iter := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+
+	var size int64
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		rel, ok, _ := gcsMatchObject(object, obj.Name)
+		if ok {
+			_, ok, _ = g.PathMapper.mapObject(obj.Name, rel)
+		}
+		if ok {
+			size += obj.Size
+		}
+	}
+}
+
+// openFile implements fileOpener.
+func (g *GCSGetter) openFile(u *url.URL) (io.ReadCloser, error) {
+	ctx := g.Context()
+
+	bucket, object, err := g.parseURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := g.getClient(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	g.logf("reading gs://%s/%s", bucket, object)
+	r, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate implements validator: the attributes of the object are read,
+// or else the objects of the directory are listed until one matches.
+func (g *GCSGetter) validate(u *url.URL) error {
+	ctx := g.Context()
+
+	bucket, object, err := g.parseURL(u)
+	if err != nil {
+		return err
+	}
+
+	client, err := g.getClient(context.Background(), u)
+	if err != nil {
+		return err
+	}
+
+	prefix, glob := gcsListPrefix(object)
+	if !glob && object != "" && !strings.HasSuffix(object, "/") {
+		g.logf("reading the attributes of gs://%s/%s", bucket, object)
+		_, err := client.Bucket(bucket).Object(object).Attrs(ctx)
+		if !errors.Is(err, storage.ErrObjectNotExist) {
+			return err
+		}
+	}
+
+	g.logf("listing gs://%s/%s", bucket, prefix)
+	iter := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		obj, err := iter.Next()
+		if err == iterator.Done {
+			return fmt.Errorf("no objects found at gs://%s/%s", bucket, object)
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok, err := gcsMatchObject(object, obj.Name); err != nil {
+			return err
+		} else if ok {
+			return nil
+		}
+	}
+}
+
+// resume implements resumer: the rest of the object is read from the
+// generation of the token, or the whole object again if that generation
+// was replaced.
+func (g *GCSGetter) resume(dst string, u *url.URL, token *ResumeToken) error {
+	ctx := g.Context()
+
+	bucket, object, err := g.parseURL(u)
+	if err != nil {
+		return err
+	}
+
+	client, err := g.getClient(context.Background(), u)
 	if err != nil {
 		return err
 	}
-	return g.getObject(ctx, client, dst, bucket, object)
+
+	if token.Generation != 0 {
+		f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, g.fileMode())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		offset, err := resumeOffset(f, token)
+		if err != nil {
+			return err
+		}
+
+		obj := client.Bucket(bucket).Object(object).Generation(token.Generation)
+		g.logf("reading gs://%s/%s (from byte %d)", bucket, object, offset)
+		r, err := obj.NewRangeReader(ctx, offset, -1)
+		if err == nil {
+			resumeStateFromContext(ctx).setGeneration(token.Generation)
+			rc := g.chunkReader(r)
+			if g.client != nil && g.client.ProgressListener != nil {
+				rc = g.client.ProgressListener.TrackProgress(object, offset, r.Attrs.Size, rc)
+			}
+			defer rc.Close()
+
+			n, err := Copy(ctx, f, rc)
+			g.logf("downloaded %d bytes from gs://%s/%s", n, bucket, object)
+			if err1 := f.Close(); err == nil {
+				err = err1
+			}
+			return err
+		}
+		if !errors.Is(err, storage.ErrObjectNotExist) {
+			return err
+		}
+		f.Close()
+		g.logf("gs://%s/%s changed since the download was interrupted, restarting", bucket, object)
+	}
+
+	return g.getObject(ctx, client, dst, bucket, object, 0, 0)
+}
+
+// getObject downloads object to dst. When the object is part of a directory
+// download, total is the size of the whole download and current the number
+// of bytes downloaded before this object, for progress tracking. A zero
+// total makes the object tracked on its own.
+//
+// An interrupted read is resumed by the storage client from where it
+// stopped, pinned to the generation of the object first read so that the
+// file never mixes two versions. If that generation is replaced during the
+// download, the download restarts from zero with the new one, up to
+// gcsMaxRestarts times.
+func (g *GCSGetter) getObject(ctx context.Context, client *storage.Client, dst, bucket, object string, current, total int64) error {
+	for restarts := 0; ; restarts++ {
+		err := g.getObjectOnce(ctx, client, dst, bucket, object, current, total)
+		if err != errGCSGenerationChanged || restarts >= gcsMaxRestarts {
+			return err
+		}
+		g.logf("gs://%s/%s changed during the download, restarting", bucket, object)
+	}
 }
 
-func (g *GCSGetter) getObject(ctx context.Context, client *storage.Client, dst, bucket, object string) error {
-	rc, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+// gcsMaxRestarts is the number of times the download of an object replaced
+// while it is read restarts with the new generation.
+const gcsMaxRestarts = 3
+
+// errGCSGenerationChanged is returned by getObjectOnce when the generation
+// of the object being read no longer exists.
+var errGCSGenerationChanged = errors.New("object changed during the download")
+
+// getObjectOnce is a single attempt of getObject.
+func (g *GCSGetter) getObjectOnce(ctx context.Context, client *storage.Client, dst, bucket, object string, current, total int64) error {
+	obj := client.Bucket(bucket).Object(object)
+	if g.PartSize > 0 {
+		attrs, err := obj.Attrs(ctx)
+		if err != nil {
+			return err
+		}
+
+		// Objects stored with gzip content encoding are decompressed on
+		// the fly by GCS and can't be read by range.
+		if attrs.Size > g.PartSize && attrs.ContentEncoding != "gzip" {
+			err := g.getObjectMultipart(ctx, obj.Generation(attrs.Generation), dst, attrs.Size)
+			if errors.Is(err, storage.ErrObjectNotExist) {
+				return errGCSGenerationChanged
+			}
+			return err
+		}
+	}
+
+	g.logf("reading gs://%s/%s", bucket, object)
+	r, err := obj.NewReader(ctx)
 	if err != nil {
 		return err
 	}
+	if !r.Attrs.Decompressed {
+		// The bytes written are the ones of the object, the download can
+		// be resumed at their end
+		resumeStateFromContext(ctx).setGeneration(r.Attrs.Generation)
+	}
+
+	rc := g.chunkReader(r)
+	if g.client != nil && g.client.ProgressListener != nil {
+		if total == 0 {
+			total = r.Attrs.Size
+		}
+		rc = g.client.ProgressListener.TrackProgress(object, current, total, rc)
+	}
 	defer rc.Close()
 
 	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
-	f, err := os.Create(dst)
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	_, err = Copy(ctx, f, rc)
+	n, err := Copy(ctx, f, rc)
+	g.logf("downloaded %d bytes from gs://%s/%s", n, bucket, object)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		// The object existed when the reader was opened: only the
+		// generation the reader is pinned to is gone.
+		return errGCSGenerationChanged
+	}
 	return err
 }
 
+// getObjectMultipart downloads an object of the given size using parallel
+// range reads. obj should be pinned to a generation so that all the parts
+// come from the same version of the object.
+func (g *GCSGetter) getObjectMultipart(ctx context.Context, obj *storage.ObjectHandle, dst string, size int64) error {
+	// Create all the parent directories
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return multipartDownload(ctx, f, 0, size, g.PartSize, g.MaxConcurrency,
+		func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+			g.logf("reading gs://%s/%s (bytes %d-%d)", obj.BucketName(), obj.ObjectName(), offset, offset+length-1)
+			r, err := obj.NewRangeReader(ctx, offset, length)
+			if err != nil {
+				return nil, err
+			}
+			return g.chunkReader(r), nil
+		})
+}
+
+// chunkReader returns a reader reading r in chunks of ChunkSize bytes, or
+// r itself without a ChunkSize.
+func (g *GCSGetter) chunkReader(r io.ReadCloser) io.ReadCloser {
+	if g.ChunkSize <= 0 {
+		return r
+	}
+	return &chunkReadCloser{ReadCloser: r, buf: make([]byte, g.ChunkSize)}
+}
+
+// chunkReadCloser reads the reader it wraps into a buffer filled one chunk
+// at a time, whatever the size of the reads from it. Unlike a bufio.Reader,
+// it never reads straight into a read buffer as large as its own.
+type chunkReadCloser struct {
+	io.ReadCloser
+	buf        []byte
+	start, end int
+	err        error
+}
+
+func (c *chunkReadCloser) Read(p []byte) (int, error) {
+	if c.start == c.end {
+		if c.err != nil {
+			return 0, c.err
+		}
+		n, err := io.ReadFull(c.ReadCloser, c.buf)
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		c.start, c.end, c.err = 0, n, err
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf[c.start:c.end])
+	c.start += n
+	return n, nil
+}
+
+// gcsObjectPath returns the path, relative to the destination of a
+// directory download, of the object name listed under prefix.
+//
+// Both '/' and '\' separate path elements and empty elements are dropped,
+// so that neither backslashes nor leading slashes can produce a path outside
+// of the destination, and names with ".." elements are rejected. ok is false
+// for the objects to skip: directory placeholders and the objects that only
+// share a name prefix with the downloaded directory, like "foo-v2" for "foo".
+func gcsObjectPath(prefix, name string) (path string, ok bool, err error) {
+	if strings.HasSuffix(name, "/") {
+		return "", false, nil
+	}
+
+	rel := strings.TrimPrefix(name, prefix)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") && rel != "" && !isSlashRune(rune(rel[0])) {
+		return "", false, nil
+	}
+
+	var elems []string
+	for _, elem := range strings.FieldsFunc(rel, isSlashRune) {
+		switch elem {
+		case ".":
+			continue
+		case "..":
+			return "", false, fmt.Errorf("object name contains '..': %s", name)
+		}
+		elems = append(elems, elem)
+	}
+	return filepath.Join(append([]string{"."}, elems...)...), true, nil
+}
+
+// gcsListPrefix returns the static prefix of the object path of a directory
+// download, before any glob metacharacter. glob reports whether object is a
+// glob pattern.
+func gcsListPrefix(object string) (prefix string, glob bool) {
+	if i := strings.IndexAny(object, "*?["); i > -1 {
+		return object[:i], true
+	}
+	return object, false
+}
+
+// gcsMatchObject is gcsObjectPath for a directory download of object, which
+// may be a glob pattern. With a glob, only the names matching it are
+// downloaded, relative to the directory of the static prefix.
+func gcsMatchObject(object, name string) (rel string, ok bool, err error) {
+	prefix, glob := gcsListPrefix(object)
+	if !glob {
+		return gcsObjectPath(object, name)
+	}
+
+	match, err := path.Match(object, name)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid object glob %q: %s", object, err)
+	}
+	if !match {
+		return "", false, nil
+	}
+	return gcsObjectPath(prefix[:strings.LastIndex(prefix, "/")+1], name)
+}
+
+// gcsMatchDir is gcsMatchObject for the directory placeholder name, ending
+// with a slash, returning the path of its directory.
+func gcsMatchDir(object, name string) (rel string, ok bool, err error) {
+	// The "." element is dropped by gcsObjectPath, leaving the path of the
+	// directory, "." for the downloaded prefix itself
+	return gcsMatchObject(object, name+".")
+}
+
+// gcsObjectMatches reports whether the file at path has the size and the
+// CRC32C checksum of obj.
+func gcsObjectMatches(path string, obj *storage.ObjectAttrs) bool {
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, obj.CRC32C)
+	return fileMatches(path, obj.Size, crc32.New(crc32cTable), sum)
+}
+
+// getClient returns a storage client configured for the source u.
+func (g *GCSGetter) getClient(ctx context.Context, u *url.URL) (*storage.Client, error) {
+	opts, err := g.clientOptions(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, option.WithUserAgent(g.userAgent()))
+	if project := g.quotaProject(u); project != "" {
+		opts = append(opts, option.WithQuotaProject(project))
+	}
+
+	var base http.RoundTripper
+	hc := new(http.Client)
+	switch {
+	case g.HTTPClient != nil:
+		*hc = *g.HTTPClient
+		base = g.HTTPClient.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+	case g.Transport != nil:
+		base = g.Transport.httpTransport()
+	}
+
+	// Add the headers configured for the hosts in Client.Hosts or by
+	// Client.CredentialHelper
+	if g.client != nil && (len(g.client.Hosts) > 0 || g.client.CredentialHelper != nil) {
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		base = g.hostTransport(base)
+	}
+
+	if base != nil {
+		// Authenticate the requests sent through the custom transport
+		opts = append([]option.ClientOption{option.WithScopes(storage.ScopeReadOnly)}, opts...)
+		rt, err := htransport.NewTransport(ctx, base, opts...)
+		if err != nil {
+			return nil, err
+		}
+		hc.Transport = rt
+		opts = append(opts, option.WithHTTPClient(hc))
+	}
+	return storage.NewClient(ctx, opts...)
+}
+
+// quotaProject returns the quota project of the source u, from its
+// "quota_project" query parameter or else QuotaProject.
+func (g *GCSGetter) quotaProject(u *url.URL) string {
+	if project := u.Query().Get("quota_project"); project != "" {
+		return project
+	}
+	return g.QuotaProject
+}
+
+// clientOptions returns the options used to create the storage client for
+// the source u.
+//
+// The token source of the client's CredentialProvider, if any, takes
+// precedence over the application default credentials. Public objects can
+// be read without any credentials: this is requested explicitly with the
+// "anonymous" query parameter, and it is also the fallback when no
+// application default credentials can be found, unless
+// UseMetadataCredentials or Client.RequireAuth is set.
+func (g *GCSGetter) clientOptions(ctx context.Context, u *url.URL) ([]option.ClientOption, error) {
+	anonymous := false
+	if v := u.Query().Get("anonymous"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid anonymous value %q: %s", v, err)
+		}
+		if b && g.requireAuth() {
+			return nil, fmt.Errorf("anonymous access to GCS is not allowed, credentials are required")
+		}
+		anonymous = b
+	} else if !g.UseMetadataCredentials {
+		bucket, _, err := g.parseURL(u)
+		if err != nil {
+			return nil, err
+		}
+		ts, err := g.credentials().GoogleTokenSource(g.Context(), bucket)
+		if err != nil {
+			return nil, err
+		}
+		if ts != nil {
+			return []option.ClientOption{option.WithTokenSource(ts)}, nil
+		}
+
+		if _, err := google.FindDefaultCredentials(ctx, storage.ScopeReadOnly); err != nil {
+			if g.requireAuth() {
+				return nil, fmt.Errorf("no GCS credentials found: %s", err)
+			}
+			anonymous = true
+		}
+	}
+
+	switch {
+	case anonymous:
+		return []option.ClientOption{option.WithoutAuthentication()}, nil
+	case g.UseMetadataCredentials:
+		return []option.ClientOption{
+			option.WithTokenSource(computeTokenSource("", storage.ScopeReadOnly)),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// filename implements filenamer with the base name of the object.
+func (g *GCSGetter) filename(u *url.URL) (string, error) {
+	_, object, err := g.parseURL(u)
+	if err != nil {
+		return "", err
+	}
+	if filename, ok := safeFilename(path.Base(object)); ok {
+		return filename, nil
+	}
+	return "", fmt.Errorf("cannot determine a filename for %s", redactURL(u))
+}
+
+// parseURL returns the bucket and object path of u. The object path is
+// taken from the decoded path of u, so that an object name with spaces or
+// other percent-encoded characters is used as is, never the raw path.
 func (g *GCSGetter) parseURL(u *url.URL) (bucket, path string, err error) {
+	if u.Scheme == "gcs" {
+		// gcs://bucket/path
+		if u.Host == "" {
+			err = fmt.Errorf("URL is not a valid GCS URL")
+			return
+		}
+		bucket = u.Host
+		path = strings.TrimPrefix(u.Path, "/")
+		return
+	}
+
 	if strings.Contains(u.Host, "googleapis.com") {
 		hostParts := strings.Split(u.Host, ".")
 		if len(hostParts) != 3 {
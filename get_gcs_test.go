@@ -0,0 +1,1481 @@
+package getter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+func TestGCSGetter_impl(t *testing.T) {
+	var _ Getter = new(GCSGetter)
+}
+
+func TestGCSGetter_anonymous(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"public/foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+	defer tempEnv(t, "GOOGLE_APPLICATION_CREDENTIALS", "/nonexistent")()
+
+	g := new(GCSGetter)
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/public/foo.txt?anonymous=true")
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	for _, r := range srv.Requests() {
+		if v := r.Header.Get("Authorization"); v != "" {
+			t.Fatalf("unexpected authorization header on %s: %s", r.URL, v)
+		}
+		if v := r.UserAgent(); !strings.Contains(v, DefaultUserAgent) {
+			t.Fatalf("bad user agent on %s: %s", r.URL, v)
+		}
+	}
+}
+
+func TestGCSGetter_quotaProject(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"public/foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		Name    string
+		Field   string
+		Query   string
+		Project string
+	}{
+		{"field", "billing", "", "billing"},
+		{"query", "", "?quota_project=other", "other"},
+		{"query over field", "billing", "?quota_project=other", "other"},
+		{"none", "", "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			// The storage client only sends the quota project with
+			// authenticated requests, the ones to an emulator going through
+			// a custom transport
+			g := &GCSGetter{Transport: &TransportOptions{}, QuotaProject: tc.Field}
+			g.SetClient(&Client{Ctx: context.Background(), Credentials: &testCredentialProvider{token: "secret"}})
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			n := len(srv.Requests())
+			u := testURL("https://www.googleapis.com/storage/v1/bucket/public/foo.txt" + tc.Query)
+			if err := g.GetFile(dst, u); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, "Hello\n")
+
+			reqs := srv.Requests()[n:]
+			if len(reqs) == 0 {
+				t.Fatal("no requests")
+			}
+			for _, r := range reqs {
+				if v := r.Header.Get("X-Goog-User-Project"); v != tc.Project {
+					t.Fatalf("bad quota project on %s: %q", r.URL, v)
+				}
+			}
+		})
+	}
+}
+
+func TestGCSGetter_requireAuth(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"private/foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+	defer tempEnv(t, "GOOGLE_APPLICATION_CREDENTIALS", "/nonexistent")()
+
+	g := new(GCSGetter)
+	g.SetClient(&Client{Ctx: context.Background(), RequireAuth: true})
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	for _, query := range []string{"", "?anonymous=true"} {
+		u := testURL("gcs://bucket/private/foo.txt" + query)
+		if err := g.GetFile(dst, u); err == nil || !strings.Contains(err.Error(), "credentials") {
+			t.Fatalf("%q: expected a credentials error, got %v", query, err)
+		}
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Fatalf("expected no requests, got %d", n)
+	}
+}
+
+func TestGCSGetter_getNoObjects(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"other/foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	g := new(GCSGetter)
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "sub", "dst")
+
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/missing?anonymous=true")
+	err := g.Get(dst, u)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "no objects found") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Lstat(td); !os.IsNotExist(err) {
+		t.Fatalf("created directories should be removed: %v", err)
+	}
+}
+
+func TestGCSGetter_getNoObjectsAllowEmpty(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"other/foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	for _, prefix := range []string{"missing", "other/*.json"} {
+		t.Run(prefix, func(t *testing.T) {
+			td := tempDir(t)
+			defer os.RemoveAll(td)
+			dst := filepath.Join(td, "sub", "dst")
+
+			g := &GCSGetter{AllowEmpty: true}
+			if err := g.Get(dst, testURL("gcs://bucket/"+prefix+"?anonymous=true")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			fis, err := ioutil.ReadDir(dst)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if len(fis) != 0 {
+				t.Fatalf("expected an empty directory, got %d entries", len(fis))
+			}
+		})
+	}
+}
+
+func TestGCSGetter_getDirPlaceholders(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/":             "",
+		"dir/empty/":       "",
+		"dir/sub/":         "",
+		"dir/sub/zero.txt": "",
+		"dir/foo.txt":      "Hello\n",
+		"dir/zero":         "",
+		"only/":            "",
+	})
+	defer srv.Close()
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "dst")
+
+	g := new(GCSGetter)
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The placeholders are directories, the zero-byte objects files
+	for name, dir := range map[string]bool{
+		"empty":        true,
+		"sub":          true,
+		"sub/zero.txt": false,
+		"zero":         false,
+	} {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.IsDir() != dir {
+			t.Fatalf("%s: expected a directory: %t, got mode %s", name, dir, fi.Mode())
+		}
+		if !dir && fi.Size() != 0 {
+			t.Fatalf("%s: expected an empty file, got %d bytes", name, fi.Size())
+		}
+	}
+	assertContents(t, filepath.Join(dst, "foo.txt"), "Hello\n")
+	if _, err := os.Lstat(filepath.Join(dst, "dir")); !os.IsNotExist(err) {
+		t.Fatalf("expected no directory for the placeholder of the prefix: %v", err)
+	}
+
+	// A prefix holding a placeholder only is an empty directory
+	dst = filepath.Join(td, "only")
+	if err := g.Get(dst, testURL("gcs://bucket/only/?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fis, err := ioutil.ReadDir(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(fis) != 0 {
+		t.Fatalf("expected an empty directory, got %d entries", len(fis))
+	}
+}
+
+func TestGCSGetter_metadataCredentials(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"foo.txt": "Hello\n",
+	})
+	defer srv.Close()
+
+	// Talk to the fake server as if it was the real endpoint, so that the
+	// client authenticates its requests.
+	defer tempEnv(t, "STORAGE_EMULATOR_HOST", "")()
+	defer tempEnv(t, "GOOGLE_APPLICATION_CREDENTIALS", "/nonexistent")()
+
+	defer func(f func(string, ...string) oauth2.TokenSource) {
+		computeTokenSource = f
+	}(computeTokenSource)
+	computeTokenSource = func(string, ...string) oauth2.TokenSource {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "metadata-token"})
+	}
+
+	g := new(GCSGetter)
+	g.UseMetadataCredentials = true
+
+	ctx := context.Background()
+	opts, err := g.clientOptions(ctx, testURL("https://www.googleapis.com/storage/v1/bucket/foo.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	opts = append(opts, option.WithEndpoint(srv.URL+"/storage/v1/"))
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer client.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	if err := g.getObject(ctx, client, dst, "bucket", "foo.txt", 0, 0); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	reqs := srv.Requests()
+	if len(reqs) == 0 {
+		t.Fatal("no request made")
+	}
+	for _, r := range reqs {
+		if v := r.Header.Get("Authorization"); v != "Bearer metadata-token" {
+			t.Fatalf("bad authorization header on %s: %q", r.URL, v)
+		}
+	}
+}
+
+func TestGCSGetter_getObjectNames(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/a\\b.txt":  "a",
+		"dir//lead.txt": "lead",
+		"dir/sub/":      "",
+		"dir/sub/c.txt": "c",
+		"dir-v2/d.txt":  "d",
+	})
+	defer srv.Close()
+
+	g := new(GCSGetter)
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/dir?anonymous=true")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	assertContents(t, filepath.Join(dst, "a", "b.txt"), "a")
+	assertContents(t, filepath.Join(dst, "lead.txt"), "lead")
+	assertContents(t, filepath.Join(dst, "sub", "c.txt"), "c")
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dst), "dir-v2")); !os.IsNotExist(err) {
+		t.Fatalf("dir-v2 should not be downloaded: %v", err)
+	}
+}
+
+func TestGCSGetter_getEncodedNames(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/hello world.txt": "space",
+		"dir/naïve ✓.txt":     "unicode",
+		"dir/100%.txt":        "percent",
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		URL      string
+		Contents string
+	}{
+		{"gcs://bucket/dir/hello%20world.txt", "space"},
+		{"gcs://bucket/dir/na%C3%AFve%20%E2%9C%93.txt", "unicode"},
+		{"gcs://bucket/dir/naïve ✓.txt", "unicode"},
+		{"gcs://bucket/dir/100%25.txt", "percent"},
+		{"https://www.googleapis.com/storage/v1/bucket/dir/hello%20world.txt", "space"},
+		{"https://www.googleapis.com/storage/v1/bucket/dir/na%C3%AFve%20%E2%9C%93.txt", "unicode"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.URL, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := new(GCSGetter)
+			if err := g.GetFile(dst, testURL(tc.URL+"?anonymous=true")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, tc.Contents)
+		})
+	}
+
+	// The names are kept in directory downloads
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	g := new(GCSGetter)
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "hello world.txt"), "space")
+	assertContents(t, filepath.Join(dst, "naïve ✓.txt"), "unicode")
+	assertContents(t, filepath.Join(dst, "100%.txt"), "percent")
+}
+
+func TestGCSGetter_getObjectNameTraversal(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/../escape.txt": "escape",
+	})
+	defer srv.Close()
+
+	g := new(GCSGetter)
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "dst")
+
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/dir?anonymous=true")
+	if err := g.Get(dst, u); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := os.Stat(filepath.Join(td, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("escape.txt should not be written: %v", err)
+	}
+}
+
+func TestGCSGetter_getGlob(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"logs/a.json":         "a",
+		"logs/b.json":         "b",
+		"logs/c.txt":          "c",
+		"logs/sub/d.json":     "d",
+		"logs/2020-01/e.json": "e",
+		"logs/2020-02/f.json": "f",
+		"logs/2021-01/g.json": "g",
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		Object   string
+		Expected []string
+	}{
+		{"logs/*.json", []string{"a.json", "b.json"}},
+		{"logs/[ab].*", []string{"a.json", "b.json"}},
+		{"logs/202[0]-*/*.json", []string{"2020-01/e.json", "2020-02/f.json"}},
+		// "?" must be escaped in URLs
+		{"logs/%3F.txt", []string{"c.txt"}},
+	}
+
+	for _, tc := range cases {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		g := new(GCSGetter)
+		u := testURL("gcs://bucket/" + tc.Object + "?anonymous=true")
+		if mode, err := g.ClientMode(u); err != nil || mode != ClientModeDir {
+			t.Fatalf("%s: expected dir mode, got %d %v", tc.Object, mode, err)
+		}
+		if err := g.Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", tc.Object, err)
+		}
+
+		var actual []string
+		filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dst, path)
+				actual = append(actual, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.Object, tc.Expected, actual)
+		}
+	}
+}
+
+func TestGCSGetter_getGlobNoMatch(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"logs/a.txt": "a"})
+	defer srv.Close()
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "dst")
+
+	g := new(GCSGetter)
+	err := g.Get(dst, testURL("gcs://bucket/logs/*.json?anonymous=true"))
+	if err == nil || !strings.Contains(err.Error(), "no objects matching") {
+		t.Fatalf("expected a no match error, got %v", err)
+	}
+	if _, err := os.Stat(td); !os.IsNotExist(err) {
+		t.Fatalf("expected the destination parents to be removed: %v", err)
+	}
+}
+
+func TestGCSGetter_getProgress(t *testing.T) {
+	objects := map[string]string{
+		"dir/a.txt":     "Hello\n",
+		"dir/sub/b.txt": "World!!\n",
+		"dir-v2/c.txt":  "ignored",
+	}
+
+	cases := []struct {
+		Name     string
+		Tracker  *testGCSProgress
+		Listings int
+	}{
+		{"without tracker", nil, 1},
+		{"with tracker", new(testGCSProgress), 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := testGCSServer(t, "bucket", objects)
+			defer srv.Close()
+
+			c := &Client{Ctx: context.Background()}
+			if tc.Tracker != nil {
+				c.ProgressListener = tc.Tracker
+			}
+			g := new(GCSGetter)
+			g.SetClient(c)
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			u := testURL("https://www.googleapis.com/storage/v1/bucket/dir?anonymous=true")
+			if err := g.Get(dst, u); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, filepath.Join(dst, "sub", "b.txt"), "World!!\n")
+
+			listings := 0
+			for _, r := range srv.Requests() {
+				if r.URL.Path == "/storage/v1/b/bucket/o" {
+					listings++
+				}
+			}
+			if listings != tc.Listings {
+				t.Fatalf("expected %d listings, got %d", tc.Listings, listings)
+			}
+
+			if tc.Tracker == nil {
+				return
+			}
+			expected := []string{
+				"dir/a.txt 0/14",
+				"dir/sub/b.txt 6/14",
+			}
+			if !reflect.DeepEqual(tc.Tracker.calls, expected) {
+				t.Fatalf("bad progress calls: %q, expected %q", tc.Tracker.calls, expected)
+			}
+		})
+	}
+}
+
+// testGCSProgress records the progress tracking calls.
+type testGCSProgress struct {
+	calls []string
+}
+
+func (p *testGCSProgress) TrackProgress(src string, currentSize, totalSize int64, stream io.ReadCloser) io.ReadCloser {
+	p.calls = append(p.calls, fmt.Sprintf("%s %d/%d", src, currentSize, totalSize))
+	return stream
+}
+
+func TestGCSGetter_clientModeHint(t *testing.T) {
+	cases := []struct {
+		URL  string
+		Mode ClientMode
+	}{
+		{"https://www.googleapis.com/storage/v1/bucket/dir/", ClientModeDir},
+		{"https://www.googleapis.com/storage/v1/bucket/", ClientModeDir},
+		{"https://www.googleapis.com/storage/v1/bucket/dir", ClientModeInvalid},
+		{"https://www.googleapis.com/storage/v1/bucket/foo.txt", ClientModeInvalid},
+		{"https://example.com/storage/v1/bucket/dir/", ClientModeInvalid},
+		{"https://www.googleapis.com/storage/v1/bucket/logs/*.json", ClientModeDir},
+		{"gcs://bucket/dir/", ClientModeDir},
+		{"gcs://bucket/foo.txt", ClientModeInvalid},
+	}
+
+	g := new(GCSGetter)
+	for _, tc := range cases {
+		if mode := g.ClientModeHint(testURL(tc.URL)); mode != tc.Mode {
+			t.Fatalf("%s: expected mode %d, got %d", tc.URL, tc.Mode, mode)
+		}
+	}
+}
+
+func TestGCSGetter_clientModeAny(t *testing.T) {
+	objects := map[string]string{
+		"dir/a.txt":     "Hello\n",
+		"dir/sub/b.txt": "World!!\n",
+	}
+
+	cases := []struct {
+		Name     string
+		Src      string
+		Listings int
+	}{
+		{"hinted", "dir/", 1},
+		{"probed", "dir", 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := testGCSServer(t, "bucket", objects)
+			defer srv.Close()
+
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			c := &Client{
+				Ctx:     context.Background(),
+				Src:     "gcs::https://www.googleapis.com/storage/v1/bucket/" + tc.Src + "?anonymous=true",
+				Dst:     dst,
+				Mode:    ClientModeAny,
+				Getters: map[string]Getter{"gcs": new(GCSGetter)},
+			}
+			if err := c.Get(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, filepath.Join(dst, "sub", "b.txt"), "World!!\n")
+
+			listings := 0
+			for _, r := range srv.Requests() {
+				if r.URL.Path == "/storage/v1/b/bucket/o" {
+					listings++
+				}
+			}
+			if listings != tc.Listings {
+				t.Fatalf("expected %d listings, got %d", tc.Listings, listings)
+			}
+		})
+	}
+}
+
+func TestGCSGetter_transport(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	g := &GCSGetter{
+		Transport: &TransportOptions{MaxIdleConnsPerHost: 32, ForceAttemptHTTP2: true},
+	}
+	g.SetClient(&Client{Ctx: context.Background()})
+
+	// Record the requests going through the configured transport
+	used := 0
+	tr := g.Transport.httpTransport()
+	tr.Proxy = func(*http.Request) (*url.URL, error) {
+		used++
+		return nil, nil
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/foo.txt?anonymous=true")
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	if used == 0 {
+		t.Fatal("expected the requests to use the configured transport")
+	}
+	if tr.MaxIdleConnsPerHost != 32 || !tr.ForceAttemptHTTP2 {
+		t.Fatalf("transport settings not applied: %#v", tr)
+	}
+}
+
+func TestGCSGetter_getMerge(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"base/a.txt":    "base\n",
+		"base/b.txt":    "base\n",
+		"overlay/b.txt": "overlay\n",
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	g := new(GCSGetter)
+	g.SetClient(&Client{Ctx: context.Background(), Merge: true})
+	for _, prefix := range []string{"base", "overlay"} {
+		u := testURL("https://www.googleapis.com/storage/v1/bucket/" + prefix + "?anonymous=true")
+		if err := g.Get(dst, u); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	assertContents(t, filepath.Join(dst, "a.txt"), "base\n")
+	assertContents(t, filepath.Join(dst, "b.txt"), "overlay\n")
+}
+
+func TestGCSGetter_getSync(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/same.txt":    "same\n",
+		"dir/changed.txt": "new\n",
+		"dir/resized.txt": "longer\n",
+		"dir/missing.txt": "missing\n",
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for name, contents := range map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "old\n",
+		"resized.txt": "short\n",
+		"local.txt":   "local\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dst, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	g := &GCSGetter{SyncMode: true}
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	assertContents(t, filepath.Join(dst, "same.txt"), "same\n")
+	assertContents(t, filepath.Join(dst, "changed.txt"), "new\n")
+	assertContents(t, filepath.Join(dst, "resized.txt"), "longer\n")
+	assertContents(t, filepath.Join(dst, "missing.txt"), "missing\n")
+	assertContents(t, filepath.Join(dst, "local.txt"), "local\n")
+
+	var read []string
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r.URL.Path, "/bucket/") {
+			read = append(read, r.URL.Path)
+		}
+	}
+	sort.Strings(read)
+	expected := []string{"/bucket/dir/changed.txt", "/bucket/dir/missing.txt", "/bucket/dir/resized.txt"}
+	if !reflect.DeepEqual(read, expected) {
+		t.Fatalf("expected to read %q, read %q", expected, read)
+	}
+}
+
+func TestGCSGetter_metadataFile(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/hot.txt":  "hot\n",
+		"dir/cold.txt": "cold!\n",
+	})
+	srv.storageClasses = map[string]string{"dir/cold.txt": "ARCHIVE"}
+	srv.generation = 7
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	g := &GCSGetter{MetadataFile: ".gcs-metadata.json"}
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "hot.txt"), "hot\n")
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, ".gcs-metadata.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var actual []GCSObjectMetadata
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []GCSObjectMetadata{
+		{Bucket: "bucket", Name: "dir/cold.txt", Size: 6, StorageClass: "ARCHIVE", Generation: 7},
+		{Bucket: "bucket", Name: "dir/hot.txt", Size: 4, StorageClass: "STANDARD", Generation: 7},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, actual)
+	}
+}
+
+func TestGCSGetter_pathMapper(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/app.log":     "log\n",
+		"dir/sub/db.log":  "db\n",
+		"dir/readme.txt":  "readme\n",
+		"dir/scratch.tmp": "tmp\n",
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// The logs are routed to logs/, the temporary files skipped
+	g := &GCSGetter{
+		PathMapper: func(name string) (string, bool) {
+			switch path.Ext(name) {
+			case ".log":
+				return "logs/" + path.Base(name), false
+			case ".tmp":
+				return "", true
+			}
+			return strings.TrimPrefix(name, "dir/"), false
+		},
+	}
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "logs", "app.log"), "log\n")
+	assertContents(t, filepath.Join(dst, "logs", "db.log"), "db\n")
+	assertContents(t, filepath.Join(dst, "readme.txt"), "readme\n")
+	for _, name := range []string{"app.log", "sub", "scratch.tmp"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected not to exist: %v", name, err)
+		}
+	}
+
+	// The mapped paths must stay within the destination
+	g.PathMapper = func(name string) (string, bool) { return "../" + name, false }
+	err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true"))
+	if err == nil || !strings.Contains(err.Error(), "invalid path") {
+		t.Fatalf("expected an invalid path error, got %v", err)
+	}
+}
+
+func TestGCSGetter_onFileComplete(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/a.txt":     "Hello\n",
+		"dir/sub/b.txt": "Hello, World\n",
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	var mu sync.Mutex
+	var events []string
+	g := &GCSGetter{PartSize: 4}
+	g.SetClient(&Client{
+		Ctx: context.Background(),
+		OnFileComplete: func(name string, size int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, fmt.Sprintf("%s %d", name, size))
+		},
+	})
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"dir/a.txt 6", "dir/sub/b.txt 13"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %q, got %q", expected, events)
+	}
+	assertContents(t, filepath.Join(dst, "sub", "b.txt"), "Hello, World\n")
+}
+
+func TestGCSGetter_multipart(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": content})
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &GCSGetter{PartSize: 16, MaxConcurrency: 3}
+	if err := g.GetFile(dst, testURL("gcs://bucket/large.bin?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, content)
+
+	var ranges []string
+	for _, r := range srv.Requests() {
+		if r.URL.Path != "/bucket/large.bin" {
+			continue
+		}
+		if r.URL.Query().Get("generation") != "1" {
+			t.Fatalf("the part isn't pinned to the generation: %s", r.URL)
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+	}
+	sort.Strings(ranges)
+	expected := []string{
+		"bytes=0-15", "bytes=16-31", "bytes=32-47", "bytes=48-63",
+		"bytes=64-79", "bytes=80-95", "bytes=96-99",
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected the ranges %q, got %q", expected, ranges)
+	}
+}
+
+func TestGCSGetter_keepPartial(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"dir/a.txt": "a\n",
+		"dir/b.txt": "b\n",
+		"dir/c.txt": "c\n",
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// Cancel the download once the first object is written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &GCSGetter{KeepPartial: true}
+	g.SetClient(&Client{
+		Ctx:            ctx,
+		OnFileComplete: func(string, int64) { cancel() },
+	})
+	err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true"))
+
+	var partial *PartialDownloadError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a partial download error, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancellation, got %v", err)
+	}
+	if !reflect.DeepEqual(partial.Completed, []string{"dir/a.txt"}) {
+		t.Fatalf("bad completed objects: %q", partial.Completed)
+	}
+	if !reflect.DeepEqual(partial.Pending, []string{"dir/b.txt", "dir/c.txt"}) {
+		t.Fatalf("bad pending objects: %q", partial.Pending)
+	}
+	assertContents(t, filepath.Join(dst, "a.txt"), "a\n")
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected no file, got %v", name, err)
+		}
+	}
+
+	// The download is resumed with SyncMode
+	g = &GCSGetter{SyncMode: true}
+	if err := g.Get(dst, testURL("gcs://bucket/dir?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "c.txt"), "c\n")
+}
+
+func TestGCSGetter_chunkSize(t *testing.T) {
+	contents := strings.Repeat("0123456789abcdef", 16*1024)
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": contents})
+	defer srv.Close()
+
+	for _, size := range []int{4 * 1024, 128 * 1024} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		progress := new(testChunkProgress)
+		g := &GCSGetter{ChunkSize: size}
+		g.SetClient(&Client{Ctx: context.Background(), ProgressListener: progress})
+		if err := g.GetFile(dst, testURL("gcs://bucket/large.bin?anonymous=true")); err != nil {
+			t.Fatalf("%d: err: %s", size, err)
+		}
+		assertContents(t, dst, contents)
+
+		// A chunk smaller than the reads of the copy is still buffered
+		if size < 32*1024 && progress.max != size {
+			t.Fatalf("%d: expected reads of %d bytes, got %d", size, size, progress.max)
+		}
+	}
+
+	// The object is read in chunks of ChunkSize bytes, whatever the size of
+	// the reads from the buffer
+	for _, size := range []int{4 * 1024, 128 * 1024} {
+		r := &testChunkReader{Reader: strings.NewReader(contents)}
+		g := &GCSGetter{ChunkSize: size}
+		if _, err := io.Copy(ioutil.Discard, g.chunkReader(r)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if r.max != size {
+			t.Fatalf("expected reads of %d bytes, got %d", size, r.max)
+		}
+	}
+
+	// Without ChunkSize the reader is used as is
+	r := &testChunkReader{Reader: strings.NewReader(contents)}
+	if rc := new(GCSGetter).chunkReader(r); rc != io.ReadCloser(r) {
+		t.Fatalf("expected the reader itself, got %T", rc)
+	}
+}
+
+// testChunkProgress records the largest read returned by the tracked
+// streams.
+type testChunkProgress struct {
+	max int
+}
+
+func (p *testChunkProgress) TrackProgress(_ string, _, _ int64, stream io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{readerFunc(func(b []byte) (int, error) {
+		n, err := stream.Read(b)
+		if n > p.max {
+			p.max = n
+		}
+		return n, err
+	}), stream}
+}
+
+// testChunkReader records the largest read from it.
+type testChunkReader struct {
+	io.Reader
+	max int
+}
+
+func (r *testChunkReader) Read(p []byte) (int, error) {
+	if len(p) > r.max {
+		r.max = len(p)
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *testChunkReader) Close() error { return nil }
+
+func TestGCSGetter_getFileResume(t *testing.T) {
+	contents := strings.Repeat("0123456789abcdef", 64*1024)
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": contents})
+	defer srv.Close()
+
+	interrupted := false
+	srv.interrupt = func(name string, offset int64) int {
+		if interrupted {
+			return 0
+		}
+		interrupted = true
+		return len(contents) / 3
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := new(GCSGetter)
+	if err := g.GetFile(dst, testURL("gcs://bucket/large.bin?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, contents)
+
+	var resumed bool
+	for _, r := range srv.Requests() {
+		if r.URL.Path != "/bucket/large.bin" || r.Header.Get("Range") == "" {
+			continue
+		}
+		resumed = true
+		if r.URL.Query().Get("generation") != "1" {
+			t.Fatalf("expected the resumed read to be pinned to generation 1: %s", r.URL)
+		}
+		var offset int64
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+		if offset == 0 || offset > int64(len(contents)/3) {
+			t.Fatalf("bad resume offset: %s", r.Header.Get("Range"))
+		}
+	}
+	if !resumed {
+		t.Fatal("expected the download to be resumed")
+	}
+}
+
+func TestGCSGetter_getFileGenerationChanged(t *testing.T) {
+	oldContents := strings.Repeat("old ", 256*1024)
+	newContents := strings.Repeat("new!", 200*1024)
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": oldContents})
+	defer srv.Close()
+
+	interrupted := false
+	srv.interrupt = func(name string, offset int64) int {
+		if interrupted {
+			return 0
+		}
+		interrupted = true
+		// The object is replaced while the first read is in flight.
+		srv.setObjects(map[string]string{"large.bin": newContents}, 2)
+		return len(oldContents) / 2
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := new(GCSGetter)
+	if err := g.GetFile(dst, testURL("gcs://bucket/large.bin?anonymous=true")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, newContents)
+}
+
+func TestGCSGetter_httpClient(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	rt := &testGCSRoundTripper{base: http.DefaultTransport}
+	g := &GCSGetter{
+		Transport:  &TransportOptions{},
+		HTTPClient: &http.Client{Transport: rt},
+	}
+	g.SetClient(&Client{Ctx: context.Background()})
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testURL("https://www.googleapis.com/storage/v1/bucket/foo.txt?anonymous=true")
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	if rt.used == 0 {
+		t.Fatal("expected the requests to go through the HTTP client")
+	}
+}
+
+func TestGCSGetter_tlsConfig(t *testing.T) {
+	srv := testGCSTLSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testURL("gcs://bucket/foo.txt?anonymous=true")
+
+	// The CA of the server isn't trusted by default
+	g := &GCSGetter{Transport: &TransportOptions{}}
+	if err := g.GetFile(dst, u); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected the certificate to be rejected, got %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	g = &GCSGetter{Transport: &TransportOptions{
+		TLSConfig: &tls.Config{RootCAs: roots},
+	}}
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestGCSGetter_hosts(t *testing.T) {
+	config := HostConfig{Header: http.Header{"X-Token": []string{"secret"}}}
+	cases := []struct {
+		Name     string
+		Hosts    map[string]HostConfig
+		Expected string
+	}{
+		{"match", map[string]HostConfig{"127.0.0.1": config}, "secret"},
+		{"no match", map[string]HostConfig{"example.com": config}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+			defer srv.Close()
+
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := new(GCSGetter)
+			g.SetClient(&Client{Ctx: context.Background(), Hosts: tc.Hosts})
+			if err := g.GetFile(dst, testURL("gcs://bucket/foo.txt?anonymous=true")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, "Hello\n")
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if len(srv.requests) == 0 {
+				t.Fatal("no requests")
+			}
+			for _, r := range srv.requests {
+				if v := r.Header.Get("X-Token"); v != tc.Expected {
+					t.Fatalf("%s %s: bad X-Token %q, expected %q", r.Method, r.URL, v, tc.Expected)
+				}
+			}
+		})
+	}
+}
+
+func TestGCSGetter_credentialProvider(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The storage client never authenticates the requests to an emulator,
+	// unless they go through a custom transport
+	provider := &testCredentialProvider{token: "secret"}
+	g := &GCSGetter{Transport: &TransportOptions{}}
+	g.SetClient(&Client{Ctx: context.Background(), Credentials: provider})
+	if err := g.GetFile(dst, testURL("gcs://bucket/foo.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	if !reflect.DeepEqual(provider.resources, []string{"bucket"}) {
+		t.Fatalf("bad resources: %q", provider.resources)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.requests) == 0 {
+		t.Fatal("no requests")
+	}
+	for _, r := range srv.requests {
+		if v := r.Header.Get("Authorization"); v != "Bearer secret" {
+			t.Fatalf("%s %s: bad Authorization %q", r.Method, r.URL, v)
+		}
+	}
+}
+
+// testGCSRoundTripper counts the requests sent through it.
+type testGCSRoundTripper struct {
+	base http.RoundTripper
+	used int
+}
+
+func (rt *testGCSRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.used++
+	return rt.base.RoundTrip(req)
+}
+
+func TestGCSObjectPath(t *testing.T) {
+	cases := []struct {
+		Prefix, Name string
+		Expected     string
+		OK, Err      bool
+	}{
+		{"dir", "dir/foo.txt", "foo.txt", true, false},
+		{"dir/", "dir/foo.txt", "foo.txt", true, false},
+		{"", "dir/foo.txt", filepath.Join("dir", "foo.txt"), true, false},
+		{"dir", "dir//foo.txt", "foo.txt", true, false},
+		{"dir", "dir/a\\b", filepath.Join("a", "b"), true, false},
+		{"dir", "dir/./foo.txt", "foo.txt", true, false},
+		{"dir", "dir", ".", true, false},
+		{"", "/foo.txt", "foo.txt", true, false},
+		{"dir", "dir/sub/", "", false, false},
+		{"dir", "dir-v2/foo.txt", "", false, false},
+		{"dir", "dir/../foo.txt", "", false, true},
+		{"dir", "dir/a\\..\\..\\foo.txt", "", false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, ok, err := gcsObjectPath(tc.Prefix, tc.Name)
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+			if ok != tc.OK || actual != tc.Expected {
+				t.Fatalf("expected %q, %t, got %q, %t", tc.Expected, tc.OK, actual, ok)
+			}
+		})
+	}
+}
+
+func TestGCSMatchObject(t *testing.T) {
+	cases := []struct {
+		Object, Name string
+		Expected     string
+		OK, Err      bool
+	}{
+		{"dir", "dir/foo.txt", "foo.txt", true, false},
+		{"dir/*.txt", "dir/foo.txt", "foo.txt", true, false},
+		{"dir/*.txt", "dir/sub/foo.txt", "", false, false},
+		{"dir/*/*.txt", "dir/sub/foo.txt", filepath.Join("sub", "foo.txt"), true, false},
+		{"*.txt", "foo.txt", "foo.txt", true, false},
+		{"dir/f[a-o]o.txt", "dir/foo.txt", "foo.txt", true, false},
+		{"dir/f[^o]o.txt", "dir/foo.txt", "", false, false},
+		{"dir/[", "dir/foo.txt", "", false, true},
+	}
+
+	for _, tc := range cases {
+		actual, ok, err := gcsMatchObject(tc.Object, tc.Name)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: expected error: %t, got: %v", tc.Object, tc.Err, err)
+		}
+		if ok != tc.OK || actual != tc.Expected {
+			t.Fatalf("%s: expected %q, %t, got %q, %t", tc.Object, tc.Expected, tc.OK, actual, ok)
+		}
+	}
+}
+
+func TestGCSGetter_clientOptions(t *testing.T) {
+	cases := []struct {
+		Name     string
+		URL      string
+		Expected []option.ClientOption
+		Err      bool
+	}{
+		{
+			"anonymous",
+			"https://www.googleapis.com/storage/v1/bucket/foo?anonymous=true",
+			[]option.ClientOption{option.WithoutAuthentication()},
+			false,
+		},
+		{
+			"no credentials",
+			"https://www.googleapis.com/storage/v1/bucket/foo",
+			[]option.ClientOption{option.WithoutAuthentication()},
+			false,
+		},
+		{
+			"anonymous disabled",
+			"https://www.googleapis.com/storage/v1/bucket/foo?anonymous=false",
+			nil,
+			false,
+		},
+		{
+			"invalid anonymous",
+			"https://www.googleapis.com/storage/v1/bucket/foo?anonymous=maybe",
+			nil,
+			true,
+		},
+	}
+
+	defer tempEnv(t, "GOOGLE_APPLICATION_CREDENTIALS", "/nonexistent")()
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			g := new(GCSGetter)
+			opts, err := g.clientOptions(g.Context(), testURL(tc.URL))
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+			if !reflect.DeepEqual(opts, tc.Expected) {
+				t.Fatalf("expected options %#v, got %#v", tc.Expected, opts)
+			}
+		})
+	}
+}
+
+// fakeGCS is a minimal GCS server supporting object listing, object
+// metadata and XML API reads of the objects of a single bucket.
+type fakeGCS struct {
+	*httptest.Server
+
+	bucket  string
+	objects map[string]string
+
+	resetEnv func()
+
+	mu       sync.Mutex
+	requests []*http.Request
+
+	// generation is the generation of all the objects, 1 if unset.
+	generation int64
+
+	// storageClasses are the storage classes of the objects, STANDARD if
+	// unset.
+	storageClasses map[string]string
+
+	// interrupt, if set, is called before each read of an object. When it
+	// returns a positive number, the connection is closed after sending
+	// that many bytes of the response body.
+	interrupt func(name string, offset int64) int
+}
+
+// testGCSServer starts a fake GCS server holding objects (name to contents)
+// in bucket, and points the storage client at it through the
+// STORAGE_EMULATOR_HOST environment variable until the server is closed.
+func testGCSServer(t *testing.T, bucket string, objects map[string]string) *fakeGCS {
+	f := &fakeGCS{
+		bucket:  bucket,
+		objects: objects,
+	}
+	f.Server = httptest.NewServer(f)
+	f.resetEnv = tempEnv(t, "STORAGE_EMULATOR_HOST", f.Server.URL)
+	return f
+}
+
+// testGCSTLSServer is testGCSServer serving HTTPS with a certificate of its
+// own CA, see Certificate.
+func testGCSTLSServer(t *testing.T, bucket string, objects map[string]string) *fakeGCS {
+	f := &fakeGCS{
+		bucket:  bucket,
+		objects: objects,
+	}
+	f.Server = httptest.NewTLSServer(f)
+	f.Server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	f.resetEnv = tempEnv(t, "STORAGE_EMULATOR_HOST", f.Server.URL)
+	return f
+}
+
+// Close shuts down the server and restores STORAGE_EMULATOR_HOST.
+func (f *fakeGCS) Close() {
+	f.Server.Close()
+	f.resetEnv()
+}
+
+// Requests returns the requests received so far.
+func (f *fakeGCS) Requests() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request(nil), f.requests...)
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.mu.Unlock()
+
+	apiPrefix := "/storage/v1/b/" + f.bucket + "/o"
+	switch {
+	case r.URL.Path == apiPrefix:
+		f.list(w, r)
+	case strings.HasPrefix(r.URL.Path, apiPrefix+"/"):
+		f.attrs(w, strings.TrimPrefix(r.URL.Path, apiPrefix+"/"))
+	case strings.HasPrefix(r.URL.Path, "/"+f.bucket+"/"):
+		f.read(w, r, strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeGCS) objectJSON(name string) map[string]interface{} {
+	crc32c := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc32c, crc32.Checksum([]byte(f.objects[name]), crc32cTable))
+	storageClass := f.storageClasses[name]
+	if storageClass == "" {
+		storageClass = "STANDARD"
+	}
+	return map[string]interface{}{
+		"kind":         "storage#object",
+		"bucket":       f.bucket,
+		"name":         name,
+		"size":         strconv.Itoa(len(f.objects[name])),
+		"generation":   strconv.FormatInt(f.currentGeneration(), 10),
+		"crc32c":       base64.StdEncoding.EncodeToString(crc32c),
+		"storageClass": storageClass,
+	}
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	items := []interface{}{}
+	for _, name := range names {
+		items = append(items, f.objectJSON(name))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":  "storage#objects",
+		"items": items,
+	})
+}
+
+func (f *fakeGCS) attrs(w http.ResponseWriter, name string) {
+	if _, ok := f.objects[name]; !ok {
+		http.Error(w, `{"error":{"code":404,"message":"Not Found"}}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.objectJSON(name))
+}
+
+func (f *fakeGCS) read(w http.ResponseWriter, r *http.Request, name string) {
+	f.mu.Lock()
+	contents, ok := f.objects[name]
+	f.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	gen := f.currentGeneration()
+	if v := r.URL.Query().Get("generation"); v != "" && v != strconv.FormatInt(gen, 10) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var offset int64
+	fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+	f.mu.Lock()
+	interrupt := f.interrupt
+	f.mu.Unlock()
+	if interrupt != nil {
+		if n := interrupt(name, offset); n > 0 {
+			w = &interruptedResponseWriter{ResponseWriter: w, left: n}
+		}
+	}
+
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(gen, 10))
+	http.ServeContent(w, r, name, time.Time{}, strings.NewReader(contents))
+}
+
+// setObjects replaces the objects served and their generation.
+func (f *fakeGCS) setObjects(objects map[string]string, generation int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects = objects
+	f.generation = generation
+}
+
+func (f *fakeGCS) currentGeneration() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.generation == 0 {
+		return 1
+	}
+	return f.generation
+}
+
+// interruptedResponseWriter aborts the response after left bytes of body.
+type interruptedResponseWriter struct {
+	http.ResponseWriter
+	left int
+}
+
+func (w *interruptedResponseWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n, _ := w.ResponseWriter.Write(p[:w.left])
+		w.left -= n
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.left -= n
+	return n, err
+}
@@ -9,7 +9,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	urlhelper "github.com/hashicorp/go-getter/helper/url"
 	safetemp "github.com/hashicorp/go-safetemp"
@@ -20,12 +24,35 @@ import (
 // a git repository.
 type GitGetter struct {
 	getter
+
+	// Timeout, if greater than zero, bounds each git command talking to
+	// the remote: clone, pull, fetch and submodule update. A command that
+	// is still running after Timeout is sent SIGTERM, then killed if it
+	// doesn't exit within a grace period. On Windows it is killed at once.
+	Timeout time.Duration
+}
+
+// gitKillGrace is how long a git command that timed out is given to exit
+// before it is killed.
+var gitKillGrace = 5 * time.Second
+
+// withClient implements clientBinder.
+func (g *GitGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
 }
 
 func (g *GitGetter) ClientMode(_ *url.URL) (ClientMode, error) {
 	return ClientModeDir, nil
 }
 
+// ClientModeHint implements ClientModeHinter, a repository is always a
+// directory.
+func (g *GitGetter) ClientModeHint(_ *url.URL) ClientMode {
+	return ClientModeDir
+}
+
 func (g *GitGetter) Get(dst string, u *url.URL) error {
 	ctx := g.Context()
 	if _, err := exec.LookPath("git"); err != nil {
@@ -33,84 +60,126 @@ func (g *GitGetter) Get(dst string, u *url.URL) error {
 	}
 
 	// Extract some query parameters we use
-	var ref, sshKey string
+	var ref, constraint, sshKey string
+	var mirror, singleBranch bool
 	q := u.Query()
 	if len(q) > 0 {
 		ref = q.Get("ref")
 		q.Del("ref")
 
+		constraint = q.Get("version")
+		q.Del("version")
+
 		sshKey = q.Get("sshkey")
 		q.Del("sshkey")
 
+		if v := q.Get("mirror"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid mirror value %q: %s", v, err)
+			}
+			mirror = b
+		}
+		q.Del("mirror")
+
+		if v := q.Get("single_branch"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid single_branch value %q: %s", v, err)
+			}
+			singleBranch = b
+		}
+		q.Del("single_branch")
+
 		// Copy the URL
 		var newU url.URL = *u
 		u = &newU
 		u.RawQuery = q.Encode()
 	}
 
-	var sshKeyFile string
-	if sshKey != "" {
-		// Check that the git version is sufficiently new.
-		if err := checkGitVersion("2.3"); err != nil {
-			return fmt.Errorf("Error using ssh key: %v", err)
+	// The ref may also be given as the fragment, e.g. "repo.git#v1.2.3".
+	// It is never part of the URL given to git.
+	if u.Fragment != "" {
+		if ref == "" {
+			ref = u.Fragment
 		}
 
-		// We have an SSH key - decode it.
-		raw, err := base64.StdEncoding.DecodeString(sshKey)
-		if err != nil {
-			return err
-		}
+		var newU url.URL = *u
+		u = &newU
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
 
-		// Create a temp file for the key and ensure it is removed.
-		fh, err := ioutil.TempFile("", "go-getter")
-		if err != nil {
-			return err
-		}
-		sshKeyFile = fh.Name()
+	u, err := g.withHostCredentials(u)
+	if err != nil {
+		return err
+	}
+
+	// A mirror is a bare repository, there is nothing to check out.
+	if mirror && (ref != "" || constraint != "") {
+		return fmt.Errorf("ref cannot be used with a mirror clone")
+	}
+	if mirror && singleBranch {
+		return fmt.Errorf("single_branch cannot be used with a mirror clone")
+	}
+	if ref != "" && ref != "latest" && constraint != "" {
+		return fmt.Errorf("ref and version cannot be used together")
+	}
+
+	sshKeyFile, err := writeSSHKey(sshKey)
+	if err != nil {
+		return err
+	}
+	if sshKeyFile != "" {
 		defer os.Remove(sshKeyFile)
+	}
 
-		// Set the permissions prior to writing the key material.
-		if err := os.Chmod(sshKeyFile, 0600); err != nil {
-			return err
-		}
+	u = fixSCPURL(u)
 
-		// Write the raw key into the temp file.
-		_, err = fh.Write(raw)
-		fh.Close()
+	// A bundle is cloned from its local path, a remote one is downloaded
+	// first
+	bundle := isGitBundle(u)
+	if bundle {
+		path, err := g.bundlePath(u)
 		if err != nil {
 			return err
 		}
+		if path != u.Path {
+			defer os.Remove(path)
+		}
+		u = &url.URL{Path: path}
 	}
 
-	// For SSH-style URLs, if they use the SCP syntax of host:path, then
-	// the URL will be mangled. We detect that here and correct the path.
-	// Example: host:path/bar will turn into host/path/bar
-	if u.Scheme == "ssh" {
-		if idx := strings.Index(u.Host, ":"); idx > -1 {
-			// Copy the URL so we don't modify the input
-			var newU url.URL = *u
-			u = &newU
-
-			// Path includes the part after the ':'.
-			u.Path = u.Host[idx+1:] + u.Path
-			if u.Path[0] != '/' {
-				u.Path = "/" + u.Path
-			}
-
-			// Host trims up to the :
-			u.Host = u.Host[:idx]
+	// Pick the tag to check out among the versions of the remote
+	if ref == "latest" || constraint != "" {
+		tag, err := g.resolveVersion(ctx, sshKeyFile, u, constraint)
+		if err != nil {
+			return err
 		}
+		ref = tag
 	}
 
 	// Clone or update the repository
-	_, err := os.Stat(dst)
+	_, err = os.Stat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	if err == nil {
+	if mirror {
+		if err == nil {
+			return g.updateMirror(ctx, dst, sshKeyFile)
+		}
+		return g.cloneMirror(ctx, dst, sshKeyFile, u)
+	}
+	if err == nil && bundle {
+		// The bundle may have moved since the clone
+		err = g.runCommand(exec.Command("git", "-C", dst, "remote", "set-url", "origin", u.Path))
+		if err == nil {
+			err = g.update(ctx, dst, sshKeyFile, ref)
+		}
+	} else if err == nil {
 		err = g.update(ctx, dst, sshKeyFile, ref)
 	} else {
-		err = g.clone(ctx, dst, sshKeyFile, u)
+		err = g.clone(ctx, dst, sshKeyFile, u, singleBranch, ref)
 	}
 	if err != nil {
 		return err
@@ -124,13 +193,170 @@ func (g *GitGetter) Get(dst string, u *url.URL) error {
 	}
 
 	// Lastly, download any/all submodules.
-	return g.fetchSubmodules(ctx, dst, sshKeyFile)
+	return g.fetchSubmodules(ctx, dst, sshKeyFile, u)
+}
+
+// validate implements validator with git ls-remote, checking that the ref
+// exists too unless it may be a commit, which the remote can't be asked
+// about. A bundle is only checked to exist.
+func (g *GitGetter) validate(u *url.URL) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git must be available and on the PATH")
+	}
+
+	q := u.Query()
+	ref := q.Get("ref")
+	if ref == "" {
+		ref = u.Fragment
+	}
+	sshKey := q.Get("sshkey")
+	for _, k := range []string{"ref", "version", "sshkey", "mirror", "single_branch"} {
+		q.Del(k)
+	}
+
+	// Copy the URL
+	var newU url.URL = *u
+	u = &newU
+	u.RawQuery = q.Encode()
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	u, err := g.withHostCredentials(u)
+	if err != nil {
+		return err
+	}
+	u = fixSCPURL(u)
+	if isGitBundle(u) {
+		switch u.Scheme {
+		case "", "file":
+			_, err := os.Stat(u.Path)
+			return err
+		case "http", "https":
+			hg := new(HttpGetter)
+			hg.SetClient(g.client)
+			return hg.validate(u)
+		default:
+			return fmt.Errorf("git bundles can't be fetched over %s", u.Scheme)
+		}
+	}
+
+	sshKeyFile, err := writeSSHKey(sshKey)
+	if err != nil {
+		return err
+	}
+	if sshKeyFile != "" {
+		defer os.Remove(sshKeyFile)
+	}
+
+	if ref == "" || ref == "latest" || maybeCommitSHA(ref) {
+		ref = "HEAD"
+	}
+	out, err := g.remoteOutput(g.Context(), "", sshKeyFile, "ls-remote", u.String(), ref)
+	if err != nil {
+		return err
+	}
+	if ref != "HEAD" && len(out) == 0 {
+		return fmt.Errorf("ref %q not found", ref)
+	}
+	return nil
+}
+
+// withHostCredentials returns u with the credentials configured for its
+// host, if any, when it is an HTTP(S) remote without credentials.
+func (g *GitGetter) withHostCredentials(u *url.URL) (*url.URL, error) {
+	if u.User != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return u, nil
+	}
+	hc, ok, err := g.hostConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if ok && hc.Username != "" {
+		var newU url.URL = *u
+		u = &newU
+		u.User = url.UserPassword(hc.Username, hc.Password)
+	}
+	return u, nil
+}
+
+// writeSSHKey writes the base64 encoded SSH key sshKey to a temporary file
+// and returns its path, which the caller must remove. It returns "" without
+// a key.
+func writeSSHKey(sshKey string) (string, error) {
+	if sshKey == "" {
+		return "", nil
+	}
+
+	// Check that the git version is sufficiently new.
+	if err := checkGitVersion("2.3"); err != nil {
+		return "", fmt.Errorf("Error using ssh key: %v", err)
+	}
+
+	// We have an SSH key - decode it.
+	raw, err := base64.StdEncoding.DecodeString(sshKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Create a temp file for the key.
+	fh, err := ioutil.TempFile("", "go-getter")
+	if err != nil {
+		return "", err
+	}
+	sshKeyFile := fh.Name()
+
+	// Set the permissions prior to writing the key material.
+	if err := os.Chmod(sshKeyFile, 0600); err != nil {
+		fh.Close()
+		os.Remove(sshKeyFile)
+		return "", err
+	}
+
+	// Write the raw key into the temp file.
+	_, err = fh.Write(raw)
+	fh.Close()
+	if err != nil {
+		os.Remove(sshKeyFile)
+		return "", err
+	}
+	return sshKeyFile, nil
+}
+
+// fixSCPURL corrects the SSH URLs using the SCP syntax of host:path, which
+// are mangled when parsed. Example: host:path/bar will turn into
+// host/path/bar.
+func fixSCPURL(u *url.URL) *url.URL {
+	if u.Scheme != "ssh" {
+		return u
+	}
+	idx := strings.Index(u.Host, ":")
+	if idx < 0 {
+		return u
+	}
+
+	// Copy the URL so we don't modify the input
+	var newU url.URL = *u
+	u = &newU
+
+	// Path includes the part after the ':'.
+	u.Path = u.Host[idx+1:] + u.Path
+	if u.Path[0] != '/' {
+		u.Path = "/" + u.Path
+	}
+
+	// Host trims up to the :
+	u.Host = u.Host[:idx]
+	return u
 }
 
 // GetFile for Git doesn't support updating at this time. It will download
 // the file every time.
 func (g *GitGetter) GetFile(dst string, u *url.URL) error {
-	td, tdcloser, err := safetemp.Dir("", "getter")
+	if isGitMirror(u) {
+		return fmt.Errorf("a single file cannot be downloaded from a mirror clone")
+	}
+
+	td, tdcloser, err := safetemp.Dir(g.tmpDir(), "getter")
 	if err != nil {
 		return err
 	}
@@ -156,16 +382,234 @@ func (g *GitGetter) GetFile(dst string, u *url.URL) error {
 	return fg.GetFile(dst, u)
 }
 
+// ResolvedCommit returns the SHA of the commit checked out at dst by a
+// previous Get, as reported by "git rev-parse HEAD". Tools can record it to
+// pin a branch or a tag to an immutable ref, e.g. in a lock file.
+func (g *GitGetter) ResolvedCommit(dst string) (string, error) {
+	cmd := exec.CommandContext(g.Context(), "git", "rev-parse", "HEAD")
+	cmd.Dir = dst
+	g.logf("running %s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("error resolving the commit of %s: %s", dst, exiterr.Stderr)
+		}
+		return "", fmt.Errorf("error resolving the commit of %s: %s", dst, err)
+	}
+
+	sha := strings.TrimSpace(string(out))
+	if !isCommitSHA(sha) {
+		return "", fmt.Errorf("Unexpected 'git rev-parse HEAD' output: %q", string(out))
+	}
+	return sha, nil
+}
+
+// isCommitSHA reports whether s is a full SHA-1 or SHA-256 commit hash.
+func isCommitSHA(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// maybeCommitSHA reports whether s may be an abbreviated or full commit hash.
+func maybeCommitSHA(s string) bool {
+	if len(s) < 7 || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectSubdir implements subdirRejecter: a mirror clone is a bare
+// repository without a working tree, so no subdirectory can be copied out
+// of it.
+func (g *GitGetter) rejectSubdir(u *url.URL) error {
+	if isGitMirror(u) {
+		return fmt.Errorf("subdirectories cannot be used with a mirror clone")
+	}
+	return nil
+}
+
+// isGitMirror reports whether u requests a mirror clone.
+func isGitMirror(u *url.URL) bool {
+	b, _ := strconv.ParseBool(u.Query().Get("mirror"))
+	return b
+}
+
+// isGitBundle reports whether u points at a git bundle file, by its
+// ".bundle" extension.
+func isGitBundle(u *url.URL) bool {
+	return strings.HasSuffix(u.Path, ".bundle")
+}
+
+// bundlePath returns the local path of the bundle u. A bundle served over
+// HTTP(S) is downloaded to a temporary file, which the caller must remove.
+func (g *GitGetter) bundlePath(u *url.URL) (string, error) {
+	switch u.Scheme {
+	case "", "file":
+		return u.Path, nil
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("git bundles can't be fetched over %s", u.Scheme)
+	}
+
+	path, err := tmpFile(g.tmpDir(), "getter-*.bundle")
+	if err != nil {
+		return "", err
+	}
+	hg := new(HttpGetter)
+	hg.SetClient(g.client)
+	if err := hg.GetFile(path, u); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("error downloading git bundle: %w", err)
+	}
+	return path, nil
+}
+
 func (g *GitGetter) checkout(dst string, ref string) error {
 	cmd := exec.Command("git", "checkout", ref)
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	return g.runCommand(cmd)
 }
 
-func (g *GitGetter) clone(ctx context.Context, dst, sshKeyFile string, u *url.URL) error {
-	cmd := exec.CommandContext(ctx, "git", "clone", u.String(), dst)
+// clone clones the repository at u in dst. A single branch clone only
+// fetches the history of ref, a branch or a tag, or else of the default
+// branch.
+func (g *GitGetter) clone(ctx context.Context, dst, sshKeyFile string, u *url.URL, singleBranch bool, ref string) error {
+	args := []string{"clone"}
+	if singleBranch {
+		args = append(args, "--single-branch")
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+	}
+	return g.runRemote(ctx, "", sshKeyFile, append(args, u.String(), dst)...)
+}
+
+// cloneMirror creates a bare mirror of the repository at u in dst.
+func (g *GitGetter) cloneMirror(ctx context.Context, dst, sshKeyFile string, u *url.URL) error {
+	return g.runRemote(ctx, "", sshKeyFile, "clone", "--mirror", u.String(), dst)
+}
+
+// updateMirror fetches all the refs of an existing mirror, pruning the ones
+// that were deleted upstream.
+func (g *GitGetter) updateMirror(ctx context.Context, dst, sshKeyFile string) error {
+	return g.runRemote(ctx, dst, sshKeyFile, "remote", "update", "--prune")
+}
+
+// resolveVersion returns the tag of the highest version of the remote u
+// matching constraint. Without constraint, the highest version that is not
+// a pre-release is picked.
+func (g *GitGetter) resolveVersion(ctx context.Context, sshKeyFile string, u *url.URL, constraint string) (string, error) {
+	out, err := g.remoteOutput(ctx, "", sshKeyFile, "ls-remote", "--tags", u.String())
+	if err != nil {
+		return "", err
+	}
+	return latestGitTag(out, constraint)
+}
+
+// latestGitTag returns the tag of the highest semantic version matching
+// constraint in the output of git ls-remote --tags. The tags that are not
+// versions are ignored.
+func latestGitTag(lsRemote []byte, constraint string) (string, error) {
+	var cs version.Constraints
+	if constraint != "" {
+		var err error
+		cs, err = version.NewConstraint(constraint)
+		if err != nil {
+			return "", fmt.Errorf("invalid version constraint %q: %s", constraint, err)
+		}
+	}
+
+	var tag string
+	var latest *version.Version
+	for _, line := range strings.Split(string(lsRemote), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/tags/") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(fields[1], "refs/tags/"), "^{}")
+		v, err := version.NewVersion(name)
+		if err != nil {
+			continue
+		}
+		if cs == nil && v.Prerelease() != "" {
+			continue
+		}
+		if cs != nil && !cs.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			tag, latest = name, v
+		}
+	}
+
+	if latest == nil {
+		if constraint == "" {
+			return "", fmt.Errorf("no version tags found")
+		}
+		return "", fmt.Errorf("no version tags matching %q", constraint)
+	}
+	return tag, nil
+}
+
+// runRemote runs a git command talking to the remote in dir, applying the
+// Timeout of the getter.
+func (g *GitGetter) runRemote(ctx context.Context, dir, sshKeyFile string, args ...string) error {
+	_, err := g.remoteCommand(ctx, dir, sshKeyFile, false, args...)
+	return err
+}
+
+// remoteOutput is runRemote returning the standard output of the command.
+func (g *GitGetter) remoteOutput(ctx context.Context, dir, sshKeyFile string, args ...string) ([]byte, error) {
+	return g.remoteCommand(ctx, dir, sshKeyFile, true, args...)
+}
+
+// remoteCommand implements runRemote and remoteOutput.
+func (g *GitGetter) remoteCommand(ctx context.Context, dir, sshKeyFile string, output bool, args ...string) ([]byte, error) {
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
 	setupGitEnv(cmd, sshKeyFile)
-	return getRunCommand(cmd)
+
+	// With a Timeout, ask git to stop first, the process and the pipes of
+	// its children are closed after the grace period. Otherwise, and on
+	// Windows which can't signal a process, git is killed right away.
+	if g.Timeout > 0 && runtime.GOOS != "windows" {
+		cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+		cmd.WaitDelay = gitKillGrace
+	}
+
+	var out []byte
+	var err error
+	if output {
+		g.logf("running %s", strings.Join(redactArgs(cmd.Args), " "))
+		out, err = cmd.Output()
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			err = fmt.Errorf("%s exited with an error: %s", cmd.Path, exiterr.Stderr)
+		}
+	} else {
+		err = g.runCommand(cmd)
+	}
+	if err != nil && g.Timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", strings.Join(redactArgs(cmd.Args), " "), g.Timeout)
+	}
+	return out, err
 }
 
 func (g *GitGetter) update(ctx context.Context, dst, sshKeyFile, ref string) error {
@@ -174,7 +618,7 @@ func (g *GitGetter) update(ctx context.Context, dst, sshKeyFile, ref string) err
 	cmd := exec.CommandContext(ctx, "git", "show-ref", "-q", "--verify", "refs/heads/"+ref)
 	cmd.Dir = dst
 
-	if getRunCommand(cmd) != nil {
+	if g.runCommand(cmd) != nil {
 		// Not a branch, switch to master. This will also catch non-existent
 		// branches, in which case we want to switch to master and then
 		// checkout the proper branch later.
@@ -186,18 +630,31 @@ func (g *GitGetter) update(ctx context.Context, dst, sshKeyFile, ref string) err
 		return err
 	}
 
-	cmd = exec.Command("git", "pull", "--ff-only")
-	cmd.Dir = dst
-	setupGitEnv(cmd, sshKeyFile)
-	return getRunCommand(cmd)
+	return g.runRemote(ctx, dst, sshKeyFile, "pull", "--ff-only")
 }
 
-// fetchSubmodules downloads any configured submodules recursively.
-func (g *GitGetter) fetchSubmodules(ctx context.Context, dst, sshKeyFile string) error {
-	cmd := exec.CommandContext(ctx, "git", "submodule", "update", "--init", "--recursive")
-	cmd.Dir = dst
-	setupGitEnv(cmd, sshKeyFile)
-	return getRunCommand(cmd)
+// fetchSubmodules downloads any configured submodules recursively, with
+// the credentials used to clone u.
+func (g *GitGetter) fetchSubmodules(ctx context.Context, dst, sshKeyFile string, u *url.URL) error {
+	args := []string{"submodule", "update", "--init", "--recursive"}
+	if cfg := gitCredentialsConfig(u); cfg != "" {
+		// git passes -c options on to the nested clones of submodules.
+		args = append([]string{"-c", cfg}, args...)
+	}
+	return g.runRemote(ctx, dst, sshKeyFile, args...)
+}
+
+// gitCredentialsConfig returns a git configuration option adding the user
+// information of the HTTP(S) URL u to the URLs of the same host, so that
+// submodules hosted next to the repository are cloned with the same
+// credentials. It returns "" when u has no user information.
+func gitCredentialsConfig(u *url.URL) string {
+	if u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	base := fmt.Sprintf("%s://%s/", u.Scheme, u.Host)
+	withUser := fmt.Sprintf("%s://%s@%s/", u.Scheme, u.User.String(), u.Host)
+	return fmt.Sprintf("url.%s.insteadOf=%s", withUser, base)
 }
 
 // setupGitEnv sets up the environment for the given command. This is used to
@@ -0,0 +1,360 @@
+package getter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultGitHubAPIEndpoint is the default of GitHubReleaseGetter.Endpoint
+// for the releases of github.com.
+const defaultGitHubAPIEndpoint = "https://api.github.com"
+
+// GitHubReleaseGetter is a Getter implementation that downloads an asset of
+// a GitHub release. URLs have the form
+//
+//	ghrelease://github.com/OWNER/REPO/TAG/ASSET
+//
+// where TAG is the tag of the release, or "latest" for the latest release,
+// and ASSET is the name of the asset or a pattern matching exactly one of
+// them, as with path.Match, e.g.
+// "ghrelease://github.com/hashicorp/terraform/latest/*_linux_amd64.zip". The
+// download URLs of github.com are also accepted with the forced getter, e.g.
+// "ghrelease::https://github.com/OWNER/REPO/releases/download/TAG/ASSET".
+//
+// The release is looked up with the GitHub REST API, authenticated with
+// Token, or else with the GITHUB_TOKEN environment variable, if set.
+// Another host than github.com is a GitHub Enterprise Server, whose API is
+// at https://HOST/api/v3: GITHUB_TOKEN isn't sent to it, its credentials
+// are Token or the Hosts of the client.
+type GitHubReleaseGetter struct {
+	getter
+
+	// Endpoint is the base URL of the API of github.com, defaulting to
+	// https://api.github.com.
+	Endpoint string
+
+	// Token, if set, is the token of the requests.
+	Token string
+
+	// Client is the http.Client to reach the API with. This defaults to
+	// the cleanhttp.DefaultClient shared by the HttpGetters if left unset.
+	Client *http.Client
+
+	// MaxRetries and TokenFunc are the ones of the HttpGetter sending the
+	// requests, see HttpGetter. A token from TokenFunc replaces Token.
+	MaxRetries int
+	TokenFunc  func(ctx context.Context) (string, error)
+}
+
+// withClient implements clientBinder.
+func (g *GitHubReleaseGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
+// ClientMode always returns ClientModeFile: a URL names a single asset of
+// a release.
+func (g *GitHubReleaseGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	if _, err := parseGitHubReleaseURL(u); err != nil {
+		return 0, err
+	}
+	return ClientModeFile, nil
+}
+
+// ClientModeHint implements ClientModeHinter.
+func (g *GitHubReleaseGetter) ClientModeHint(_ *url.URL) ClientMode {
+	return ClientModeFile
+}
+
+func (g *GitHubReleaseGetter) Get(dst string, u *url.URL) error {
+	return fmt.Errorf("GitHub release assets can only be downloaded as a file")
+}
+
+func (g *GitHubReleaseGetter) GetFile(dst string, u *url.URL) error {
+	ctx := g.Context()
+
+	r, err := parseGitHubReleaseURL(u)
+	if err != nil {
+		return err
+	}
+
+	body, asset, err := g.open(ctx, r)
+	if err != nil {
+		return err
+	}
+	if g.client != nil && g.client.ProgressListener != nil {
+		body = g.client.ProgressListener.TrackProgress(asset.Name, 0, asset.Size, body)
+	}
+	defer body.Close()
+
+	// Create all the parent directories
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := Copy(ctx, out, body)
+	g.logf("downloaded %d bytes from %s", n, asset.Name)
+	return err
+}
+
+// openFile implements fileOpener.
+func (g *GitHubReleaseGetter) openFile(u *url.URL) (io.ReadCloser, error) {
+	r, err := parseGitHubReleaseURL(u)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := g.open(g.Context(), r)
+	return body, err
+}
+
+// filename implements filenamer: the name of the asset matched by u.
+func (g *GitHubReleaseGetter) filename(u *url.URL) (string, error) {
+	r, err := parseGitHubReleaseURL(u)
+	if err != nil {
+		return "", err
+	}
+	release, err := g.release(g.Context(), g.httpGetter(), r)
+	if err != nil {
+		return "", err
+	}
+	asset, err := r.match(release)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := safeFilename(asset.Name); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("cannot determine a filename for the asset %q of %s", asset.Name, r)
+}
+
+// gitHubRelease is the part of a release of the GitHub REST API the getter
+// uses.
+type gitHubRelease struct {
+	TagName string               `json:"tag_name"`
+	Assets  []gitHubReleaseAsset `json:"assets"`
+}
+
+// gitHubReleaseAsset is an asset of a gitHubRelease. URL is its API URL,
+// downloading its contents with the "application/octet-stream" Accept
+// header.
+type gitHubReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// httpGetter returns the HttpGetter sending the requests of the getter, so
+// that they are retried as the other HTTP requests of the client.
+func (g *GitHubReleaseGetter) httpGetter() *HttpGetter {
+	hg := &HttpGetter{
+		Client:     g.Client,
+		MaxRetries: g.MaxRetries,
+		TokenFunc:  g.TokenFunc,
+	}
+	hg.client = g.client
+	return hg
+}
+
+// open looks the asset of r up and sends its download request, returning
+// the body of the response and the asset.
+func (g *GitHubReleaseGetter) open(ctx context.Context, r *gitHubReleaseRef) (io.ReadCloser, *gitHubReleaseAsset, error) {
+	client := g.httpGetter()
+
+	release, err := g.release(ctx, client, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	asset, err := r.match(release)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := g.newRequest(ctx, r, asset.URL, "application/octet-stream")
+	if err != nil {
+		return nil, nil, err
+	}
+	g.logf("downloading %s of %s", asset.Name, r)
+	resp, err := client.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("bad response code downloading %s of %s: %d", asset.Name, r, resp.StatusCode)
+	}
+	return resp.Body, asset, nil
+}
+
+// release returns the release of r.
+func (g *GitHubReleaseGetter) release(ctx context.Context, client *HttpGetter, r *gitHubReleaseRef) (*gitHubRelease, error) {
+	req, err := g.newRequest(ctx, r, r.releaseURL(g.endpoint(r.host)), "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+
+	g.logf("looking up %s", r)
+	resp, err := client.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("release not found: %s", r)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad response code looking up %s: %d", r, resp.StatusCode)
+	}
+
+	release := new(gitHubRelease)
+	if err := json.NewDecoder(resp.Body).Decode(release); err != nil {
+		return nil, fmt.Errorf("error decoding the release %s: %s", r, err)
+	}
+	return release, nil
+}
+
+// newRequest returns a GET request of the API URL u for r accepting
+// accept, authenticated with the token of the getter.
+func (g *GitHubReleaseGetter) newRequest(ctx context.Context, r *gitHubReleaseRef, u, accept string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", g.userAgent())
+	if token := g.token(r.host); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req.WithContext(ctx), nil
+}
+
+// token returns the token of the requests to the API of host: Token, or
+// else the GITHUB_TOKEN environment variable for github.com only. It is a
+// token of github.com, never sent to the host named by a URL: a GitHub
+// Enterprise Server needs Token or the Hosts of the client.
+func (g *GitHubReleaseGetter) token(host string) string {
+	if g.Token != "" || host != "github.com" {
+		return g.Token
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// endpoint returns the base URL of the API of host.
+func (g *GitHubReleaseGetter) endpoint(host string) string {
+	if host != "github.com" {
+		return "https://" + host + "/api/v3"
+	}
+	if g.Endpoint != "" {
+		return strings.TrimSuffix(g.Endpoint, "/")
+	}
+	return defaultGitHubAPIEndpoint
+}
+
+// gitHubReleaseRef is an asset of a release named by a URL of the getter.
+type gitHubReleaseRef struct {
+	host, owner, repo string
+
+	// tag is the tag of the release, or empty for the latest one.
+	tag string
+
+	// asset is the name of the asset or a pattern matching it.
+	asset string
+}
+
+// parseGitHubReleaseURL parses the ghrelease URL u, or the download URL of
+// a release asset given with the forced getter.
+func parseGitHubReleaseURL(u *url.URL) (*gitHubReleaseRef, error) {
+	switch u.Scheme {
+	case "ghrelease":
+		// ghrelease://HOST/OWNER/REPO/TAG/ASSET
+		parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 4)
+		if len(parts) == 4 {
+			return newGitHubReleaseRef(u.Host, parts[0], parts[1], parts[2], parts[3])
+		}
+	case "https":
+		parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 6)
+		if len(parts) != 6 || parts[2] != "releases" {
+			break
+		}
+		// https://HOST/OWNER/REPO/releases/download/TAG/ASSET
+		if parts[3] == "download" {
+			return newGitHubReleaseRef(u.Host, parts[0], parts[1], parts[4], parts[5])
+		}
+		// https://HOST/OWNER/REPO/releases/latest/download/ASSET
+		if parts[3] == "latest" && parts[4] == "download" {
+			return newGitHubReleaseRef(u.Host, parts[0], parts[1], "latest", parts[5])
+		}
+	}
+	return nil, fmt.Errorf("URL is not a valid GitHub release asset URL: %s", u)
+}
+
+func newGitHubReleaseRef(host, owner, repo, tag, asset string) (*gitHubReleaseRef, error) {
+	if host == "" || owner == "" || repo == "" || tag == "" || asset == "" {
+		return nil, fmt.Errorf("GitHub release asset URLs need a host, owner, repository, tag and asset")
+	}
+	if _, err := path.Match(asset, ""); err != nil {
+		return nil, fmt.Errorf("invalid asset pattern %q: %s", asset, err)
+	}
+	if tag == "latest" {
+		tag = ""
+	}
+	return &gitHubReleaseRef{host: host, owner: owner, repo: repo, tag: tag, asset: asset}, nil
+}
+
+func (r *gitHubReleaseRef) String() string {
+	tag := r.tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return fmt.Sprintf("%s/%s/%s release %s", r.host, r.owner, r.repo, tag)
+}
+
+// releaseURL returns the API URL of the release of r.
+func (r *gitHubReleaseRef) releaseURL(endpoint string) string {
+	u := fmt.Sprintf("%s/repos/%s/%s/releases/", endpoint, url.PathEscape(r.owner), url.PathEscape(r.repo))
+	if r.tag == "" {
+		return u + "latest"
+	}
+	return u + "tags/" + url.PathEscape(r.tag)
+}
+
+// match returns the asset of release named by r: the one with its exact
+// name, or else the only one matching its pattern.
+func (r *gitHubReleaseRef) match(release *gitHubRelease) (*gitHubReleaseAsset, error) {
+	var matches []*gitHubReleaseAsset
+	for i := range release.Assets {
+		a := &release.Assets[i]
+		if a.Name == r.asset {
+			return a, nil
+		}
+		if ok, _ := path.Match(r.asset, a.Name); ok {
+			matches = append(matches, a)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no asset of %s (%s) matches %q", r, release.TagName, r.asset)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, a := range matches {
+		names[i] = a.Name
+	}
+	return nil, fmt.Errorf("several assets of %s (%s) match %q: %s",
+		r, release.TagName, r.asset, strings.Join(names, ", "))
+}
@@ -0,0 +1,284 @@
+package getter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGitHubReleaseGetter_impl(t *testing.T) {
+	var _ Getter = new(GitHubReleaseGetter)
+}
+
+// testGitHubAPIServer starts a fake GitHub API serving the releases of
+// hashicorp/foo (tag to asset name to contents) to the requests holding
+// the token "secret". The last tag is the latest release.
+func testGitHubAPIServer(t *testing.T, tags []string, releases map[string]map[string]string) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		// Asset downloads
+		if rest := strings.TrimPrefix(r.URL.Path, "/assets/"); rest != r.URL.Path {
+			if r.Header.Get("Accept") != "application/octet-stream" {
+				http.Error(w, "bad accept header", http.StatusBadRequest)
+				return
+			}
+			parts := strings.SplitN(rest, "/", 2)
+			contents, ok := releases[parts[0]][parts[len(parts)-1]]
+			if len(parts) != 2 || !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(contents))
+			return
+		}
+
+		var tag string
+		switch {
+		case r.URL.Path == "/repos/hashicorp/foo/releases/latest":
+			tag = tags[len(tags)-1]
+		case strings.HasPrefix(r.URL.Path, "/repos/hashicorp/foo/releases/tags/"):
+			tag = strings.TrimPrefix(r.URL.Path, "/repos/hashicorp/foo/releases/tags/")
+		}
+		assets, ok := releases[tag]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		release := gitHubRelease{TagName: tag}
+		for name, contents := range assets {
+			release.Assets = append(release.Assets, gitHubReleaseAsset{
+				Name: name,
+				URL:  fmt.Sprintf("%s/assets/%s/%s", srv.URL, tag, name),
+				Size: int64(len(contents)),
+			})
+		}
+		json.NewEncoder(w).Encode(release)
+	}))
+	return srv
+}
+
+func testGitHubReleaseGetter(endpoint, token string) *GitHubReleaseGetter {
+	g := &GitHubReleaseGetter{Endpoint: endpoint, Token: token}
+	g.SetClient(&Client{Ctx: context.Background()})
+	return g
+}
+
+func TestGitHubReleaseGetter_GetFile(t *testing.T) {
+	srv := testGitHubAPIServer(t, []string{"v1.0.0", "v1.1.0"}, map[string]map[string]string{
+		"v1.0.0": {"foo_linux_amd64.zip": "old\n", "SHA256SUMS": "sums\n"},
+		"v1.1.0": {"foo_linux_amd64.zip": "new\n", "foo_darwin_arm64.zip": "mac\n"},
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		URL      string
+		Contents string
+	}{
+		{"ghrelease://github.com/hashicorp/foo/latest/foo_linux_amd64.zip", "new\n"},
+		{"ghrelease://github.com/hashicorp/foo/v1.0.0/foo_linux_amd64.zip", "old\n"},
+		{"ghrelease://github.com/hashicorp/foo/latest/*_darwin_*.zip", "mac\n"},
+		{"ghrelease://github.com/hashicorp/foo/v1.0.0/SHA256SUMS", "sums\n"},
+		{"https://github.com/hashicorp/foo/releases/download/v1.0.0/foo_linux_amd64.zip", "old\n"},
+		{"https://github.com/hashicorp/foo/releases/latest/download/foo_linux_amd64.zip", "new\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.URL, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := testGitHubReleaseGetter(srv.URL, "secret")
+			if err := g.GetFile(dst, testURL(tc.URL)); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, tc.Contents)
+		})
+	}
+}
+
+func TestGitHubReleaseGetter_GetFile_errors(t *testing.T) {
+	srv := testGitHubAPIServer(t, []string{"v1.0.0"}, map[string]map[string]string{
+		"v1.0.0": {"foo_linux_amd64.zip": "linux\n", "foo_darwin_amd64.zip": "mac\n"},
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		Name  string
+		URL   string
+		Token string
+		Err   string
+	}{
+		{"no release", "ghrelease://github.com/hashicorp/foo/v2.0.0/foo.zip", "secret", "release not found"},
+		{"unauthenticated", "ghrelease://github.com/hashicorp/foo/latest/foo.zip", "bad", "401"},
+		{"no match", "ghrelease://github.com/hashicorp/foo/latest/*_windows_*.zip", "secret", "no asset"},
+		{"several matches", "ghrelease://github.com/hashicorp/foo/latest/*_amd64.zip", "secret", "several assets"},
+		{"no asset", "ghrelease://github.com/hashicorp/foo/latest", "secret", "not a valid GitHub release asset URL"},
+		{"bad pattern", "ghrelease://github.com/hashicorp/foo/latest/[", "secret", "invalid asset pattern"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := testGitHubReleaseGetter(srv.URL, tc.Token)
+			err := g.GetFile(dst, testURL(tc.URL))
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestGitHubReleaseGetter_ClientMode(t *testing.T) {
+	g := new(GitHubReleaseGetter)
+	mode, err := g.ClientMode(testURL("ghrelease://github.com/hashicorp/foo/latest/foo.zip"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mode != ClientModeFile {
+		t.Fatal("expect ClientModeFile")
+	}
+
+	if _, err := g.ClientMode(testURL("https://github.com/hashicorp/foo")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestGitHubReleaseGetter_client(t *testing.T) {
+	srv := testGitHubAPIServer(t, []string{"v1.0.0"}, map[string]map[string]string{
+		"v1.0.0": {"foo.txt": "Hello\n"},
+	})
+	defer srv.Close()
+
+	os.Setenv("GITHUB_TOKEN", "secret")
+	defer os.Unsetenv("GITHUB_TOKEN")
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	client := &Client{
+		Src:  "github.com/hashicorp/foo/releases/latest/download/foo.txt",
+		Dst:  dst,
+		Mode: ClientModeFile,
+		Getters: map[string]Getter{
+			"ghrelease": &GitHubReleaseGetter{Endpoint: srv.URL},
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestGitHubReleaseGetter_retry(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	srv := testGitHubAPIServer(t, []string{"v1.0.0"}, map[string]map[string]string{
+		"v1.0.0": {"foo.txt": "Hello\n"},
+	})
+	defer srv.Close()
+
+	// Every request is answered 503 the first time
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	api := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		retried := seen[r.URL.Path]
+		seen[r.URL.Path] = true
+		mu.Unlock()
+		if !retried {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := testGitHubReleaseGetter(srv.URL, "")
+	g.MaxRetries = 1
+	g.TokenFunc = func(context.Context) (string, error) { return "secret", nil }
+	if err := g.GetFile(dst, testURL("ghrelease://github.com/hashicorp/foo/latest/foo.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestGitHubReleaseGetter_enterpriseToken(t *testing.T) {
+	var mu sync.Mutex
+	var auth []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	defer tempEnv(t, "GITHUB_TOKEN", "secret")()
+
+	// The token of github.com isn't sent to the host of the URL, only Token
+	u := testURL("ghrelease://" + srv.Listener.Addr().String() + "/hashicorp/foo/latest/foo.txt")
+	for _, token := range []string{"", "enterprise"} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		g := testGitHubReleaseGetter("", token)
+		g.Client = srv.Client()
+		if err := g.GetFile(dst, u); err == nil || !strings.Contains(err.Error(), "release not found") {
+			t.Fatalf("expected the release not to be found, got %v", err)
+		}
+	}
+
+	expected := []string{"", "Bearer enterprise"}
+	if !reflect.DeepEqual(auth, expected) {
+		t.Fatalf("expected the Authorization headers %q, got %q", expected, auth)
+	}
+}
+
+func TestGitHubReleaseGetter_filename(t *testing.T) {
+	srv := testGitHubAPIServer(t, []string{"v1.0.0"}, map[string]map[string]string{
+		"v1.0.0": {"foo_1.0.0_linux_amd64.zip": "linux\n", "foo_1.0.0_darwin_amd64.zip": "mac\n"},
+	})
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// The file is named after the asset matched by the pattern
+	client := &Client{
+		Src:  "ghrelease://github.com/hashicorp/foo/latest/*_linux_amd64.zip?archive=false",
+		Dst:  dst,
+		Mode: ClientModeAny,
+		Getters: map[string]Getter{
+			"ghrelease": &GitHubReleaseGetter{Endpoint: srv.URL, Token: "secret"},
+		},
+	}
+	name, err := client.Filename(client.Src)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if name != "foo_1.0.0_linux_amd64.zip" {
+		t.Fatalf("bad filename: %q", name)
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, name), "linux\n")
+}
@@ -19,10 +19,23 @@ type HgGetter struct {
 	getter
 }
 
+// withClient implements clientBinder.
+func (g *HgGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
 func (g *HgGetter) ClientMode(_ *url.URL) (ClientMode, error) {
 	return ClientModeDir, nil
 }
 
+// ClientModeHint implements ClientModeHinter, a repository is always a
+// directory.
+func (g *HgGetter) ClientModeHint(_ *url.URL) ClientMode {
+	return ClientModeDir
+}
+
 func (g *HgGetter) Get(dst string, u *url.URL) error {
 	ctx := g.Context()
 	if _, err := exec.LookPath("hg"); err != nil {
@@ -70,7 +83,7 @@ func (g *HgGetter) Get(dst string, u *url.URL) error {
 func (g *HgGetter) GetFile(dst string, u *url.URL) error {
 	// Create a temporary directory to store the full source. This has to be
 	// a non-existent directory.
-	td, tdcloser, err := safetemp.Dir("", "getter")
+	td, tdcloser, err := safetemp.Dir(g.tmpDir(), "getter")
 	if err != nil {
 		return err
 	}
@@ -103,13 +116,13 @@ func (g *HgGetter) GetFile(dst string, u *url.URL) error {
 
 func (g *HgGetter) clone(dst string, u *url.URL) error {
 	cmd := exec.Command("hg", "clone", "-U", u.String(), dst)
-	return getRunCommand(cmd)
+	return g.runCommand(cmd)
 }
 
 func (g *HgGetter) pull(dst string, u *url.URL) error {
 	cmd := exec.Command("hg", "pull")
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	return g.runCommand(cmd)
 }
 
 func (g *HgGetter) update(ctx context.Context, dst string, u *url.URL, rev string) error {
@@ -120,7 +133,7 @@ func (g *HgGetter) update(ctx context.Context, dst string, u *url.URL, rev strin
 
 	cmd := exec.CommandContext(ctx, "hg", args...)
 	cmd.Dir = dst
-	return getRunCommand(cmd)
+	return g.runCommand(cmd)
 }
 
 func fixWindowsDrivePath(u *url.URL) bool {
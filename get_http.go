@@ -1,16 +1,21 @@
 package getter
 
 import (
+	"bytes"
 	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	safetemp "github.com/hashicorp/go-safetemp"
 )
@@ -51,6 +56,102 @@ type HttpGetter struct {
 	// and as such it needs to be initialized before use, via something like
 	// make(http.Header).
 	Header http.Header
+
+	// PartSize, if greater than zero, enables multipart downloads in
+	// GetFile. When the server supports range requests and the file is
+	// larger than PartSize, the file is fetched as several ranges of
+	// PartSize bytes in parallel. Otherwise it is downloaded as a single
+	// stream.
+	PartSize int64
+
+	// MaxConcurrency is the maximum number of parts fetched at the same
+	// time during a multipart download. It defaults to 4.
+	MaxConcurrency int
+
+	// ContentDisposition, if true, lets the server choose the filename when
+	// GetFile is given an existing directory as destination. The name is
+	// read from the Content-Disposition header of the response to the HEAD
+	// request, including the RFC 5987 "filename*" form. If the server doesn't
+	// send one, the base name of the URL path is used instead.
+	ContentDisposition bool
+
+	// ETagStore, if set, enables conditional downloads in GetFile. When the
+	// destination file already exists and the store knows an ETag for the
+	// source URL, the request is sent with an If-None-Match header and the
+	// download is skipped if the server answers 304 Not Modified. The ETag
+	// of every complete download is saved in the store.
+	ETagStore ETagStore
+
+	// IfModifiedSince, if true, enables conditional downloads in GetFile
+	// based on the modification time of the destination file. When it
+	// exists, the request is sent with an If-Modified-Since header holding
+	// that time and the download is skipped if the server answers 304 Not
+	// Modified. Otherwise the file is replaced and its modification time set
+	// to the Last-Modified time of the response, if any.
+	IfModifiedSince bool
+
+	// AutoChecksum, if true, verifies the files downloaded by a Client
+	// against a sidecar checksum file when the source has no checksum
+	// parameter. The URL of the file with ".sha256" appended to its path is
+	// tried first, then the one with ".md5". A missing sidecar, answered
+	// with a 404 or a 403, is ignored unless AutoChecksumRequired is set too.
+	AutoChecksum bool
+
+	// AutoChecksumRequired, if true, makes downloads fail when AutoChecksum
+	// doesn't find a sidecar checksum file.
+	AutoChecksumRequired bool
+
+	// Method and Body configure the request sent by GetFile, for artifact
+	// services expecting for example a POST with a JSON query. Method
+	// defaults to GET, without a body. Downloads using another method are
+	// never resumed nor split in parts.
+	Method string
+	Body   []byte
+
+	// MaxRetries is the number of times a request answered with 429 Too
+	// Many Requests or 503 Service Unavailable is sent again. The getter
+	// first waits for the duration given by the Retry-After header of the
+	// response, in seconds or as an HTTP date, or else for a backoff
+	// starting at one second and doubling after every retry.
+	MaxRetries int
+
+	// MaxRetryWait caps the wait before a retry. It defaults to 30 seconds.
+	MaxRetryWait time.Duration
+
+	// TokenFunc, if set, is called right before every request, retries
+	// included, for a bearer token sent in its Authorization header. It
+	// lets long downloads outlive short-lived tokens. An error aborts the
+	// request.
+	TokenFunc func(ctx context.Context) (string, error)
+
+	// PinnedCertificates, if set, are the SHA256 fingerprints, in hex, of
+	// the certificates the servers are allowed to present: the TLS
+	// connections fail unless one of the certificates of the server's
+	// verified chain, or its public key (the DER of its SubjectPublicKeyInfo), has
+	// one of them. The certificates are still verified as usual. Pinning
+	// needs the transport of Client, if set, to be an *http.Transport.
+	PinnedCertificates []string
+}
+
+// maxSidecarSize bounds the size of the sidecar checksum files read by
+// AutoChecksum.
+const maxSidecarSize = 64 * 1024
+
+// ETagStore stores the ETags of the files downloaded by HttpGetter, keyed
+// by source URL.
+type ETagStore interface {
+	// Get returns the ETag stored for url, or "" if there is none.
+	Get(url string) (string, error)
+
+	// Set stores the ETag of url.
+	Set(url, etag string) error
+}
+
+// withClient implements clientBinder.
+func (g *HttpGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
 }
 
 func (g *HttpGetter) ClientMode(u *url.URL) (ClientMode, error) {
@@ -73,30 +174,26 @@ func (g *HttpGetter) Get(dst string, u *url.URL) error {
 		}
 	}
 
-	if g.Client == nil {
-		g.Client = httpClient
-	}
-
 	// Add terraform-get to the parameter.
 	q := u.Query()
 	q.Add("terraform-get", "1")
 	u.RawQuery = q.Encode()
 
 	// Get the URL
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := g.newRequest("GET", u.String())
 	if err != nil {
 		return err
 	}
 
-	req.Header = g.Header
-	resp, err := g.Client.Do(req)
+	g.logf("GET %s", redactURL(u))
+	resp, err := g.do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+		return statusError(u, resp.StatusCode)
 	}
 
 	// Extract the source URL
@@ -117,17 +214,72 @@ func (g *HttpGetter) Get(dst string, u *url.URL) error {
 	// into a temporary directory, then copy over the proper subdir.
 	source, subDir := SourceDirSubdir(source)
 	if subDir == "" {
-		var opts []ClientOption
-		if g.client != nil {
-			opts = g.client.Options
-		}
-		return Get(dst, source, opts...)
+		return g.getSource(dst, source)
 	}
 
 	// We have a subdir, time to jump some hoops
 	return g.getSubdir(ctx, dst, source, subDir)
 }
 
+// openFile implements fileOpener.
+func (g *HttpGetter) openFile(src *url.URL) (io.ReadCloser, error) {
+	if g.Netrc {
+		// Add auth from netrc if we can
+		if err := addAuthFromNetrc(src); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := g.newRequest("GET", src.String())
+	if err != nil {
+		return nil, err
+	}
+
+	g.logf("GET %s", redactURL(src))
+	resp, err := g.do(req.WithContext(g.Context()))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, statusError(src, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// validate implements validator with a HEAD request, or a GET request
+// whose body isn't read if the server doesn't allow HEAD.
+func (g *HttpGetter) validate(src *url.URL) error {
+	if g.Netrc {
+		// Add auth from netrc if we can
+		if err := addAuthFromNetrc(src); err != nil {
+			return err
+		}
+	}
+
+	for _, method := range []string{"HEAD", "GET"} {
+		req, err := g.newRequest(method, src.String())
+		if err != nil {
+			return err
+		}
+
+		g.logf("%s %s", method, redactURL(src))
+		resp, err := g.do(req.WithContext(g.Context()))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNoContent:
+			return nil
+		case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			continue
+		}
+		return statusError(src, resp.StatusCode)
+	}
+	return statusError(src, http.StatusMethodNotAllowed)
+}
+
 func (g *HttpGetter) GetFile(dst string, src *url.URL) error {
 	ctx := g.Context()
 	if g.Netrc {
@@ -137,47 +289,81 @@ func (g *HttpGetter) GetFile(dst string, src *url.URL) error {
 		}
 	}
 
+	if g.ContentDisposition {
+		if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+			filename, err := g.remoteFilename(src)
+			if err != nil {
+				return err
+			}
+			dst = filepath.Join(dst, filename)
+		}
+	}
+
 	// Create all the parent directories if needed
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, os.FileMode(0666))
-	if err != nil {
-		return err
+	// Only make a conditional request if there is a file to keep.
+	var etag string
+	var modTime time.Time
+	if g.ETagStore != nil || g.IfModifiedSince {
+		if fi, err := os.Stat(dst); err == nil {
+			if g.ETagStore != nil {
+				etag, err = g.ETagStore.Get(src.String())
+				if err != nil {
+					return err
+				}
+			}
+			if g.IfModifiedSince {
+				modTime = fi.ModTime()
+			}
+		}
 	}
+	conditional := etag != "" || !modTime.IsZero()
 
-	if g.Client == nil {
-		g.Client = httpClient
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, g.fileMode())
+	if err != nil {
+		return err
 	}
 
-	var currentFileSize int64
+	var currentFileSize, totalFileSize int64
+	custom := g.Method != "" && !strings.EqualFold(g.Method, "GET")
 
 	// We first make a HEAD request so we can check
 	// if the server supports range queries. If the server/URL doesn't
 	// support HEAD requests, we just fall back to GET.
-	req, err := http.NewRequest("HEAD", src.String(), nil)
+	req, err := g.newRequest("HEAD", src.String())
 	if err != nil {
 		return err
 	}
-	if g.Header != nil {
-		req.Header = g.Header
-	}
-	headResp, err := g.Client.Do(req)
-	if err == nil && headResp != nil {
-		headResp.Body.Close()
-		if headResp.StatusCode == 200 {
-			// If the HEAD request succeeded, then attempt to set the range
-			// query if we can.
-			if headResp.Header.Get("Accept-Ranges") == "bytes" {
-				if fi, err := f.Stat(); err == nil {
-					if _, err = f.Seek(0, os.SEEK_END); err == nil {
-						req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
-						currentFileSize = fi.Size()
-						totalFileSize, _ := strconv.ParseInt(headResp.Header.Get("Content-Length"), 10, 64)
-						if currentFileSize >= totalFileSize {
-							// file already present
-							return nil
+	if conditional {
+		// The whole file is downloaded again if it changed, so there is no
+		// need to check whether it can be resumed.
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if !modTime.IsZero() {
+			req.Header.Set("If-Modified-Since", modTime.UTC().Format(http.TimeFormat))
+		}
+	} else if !custom {
+		g.logf("HEAD %s", redactURL(src))
+		headResp, err := g.do(req.WithContext(ctx))
+		if err == nil && headResp != nil {
+			headResp.Body.Close()
+			if headResp.StatusCode == 200 {
+				// If the HEAD request succeeded, then attempt to set the range
+				// query if we can.
+				if headResp.Header.Get("Accept-Ranges") == "bytes" {
+					if fi, err := f.Stat(); err == nil {
+						if _, err = f.Seek(0, os.SEEK_END); err == nil {
+							req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
+							currentFileSize = fi.Size()
+							totalFileSize, _ = strconv.ParseInt(headResp.Header.Get("Content-Length"), 10, 64)
+							if currentFileSize >= totalFileSize {
+								// file already present
+								return nil
+							}
 						}
 					}
 				}
@@ -185,17 +371,44 @@ func (g *HttpGetter) GetFile(dst string, src *url.URL) error {
 		}
 	}
 	req.Method = "GET"
+	if custom {
+		req.Method = strings.ToUpper(g.Method)
+		body := g.Body
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+		req.ContentLength = int64(len(body))
+	}
+
+	if g.PartSize > 0 && totalFileSize-currentFileSize > g.PartSize {
+		err := g.getMultipart(ctx, f, src, currentFileSize, totalFileSize)
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		return err
+	}
 
-	resp, err := g.Client.Do(req)
+	acceptGzip(req)
+	g.logf("%s %s", req.Method, redactURL(src))
+	resp, err := g.do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	switch resp.StatusCode {
 	case http.StatusOK, http.StatusPartialContent:
 		// all good
+	case http.StatusNotModified:
+		if conditional {
+			// The file at dst is up to date
+			resp.Body.Close()
+			g.logf("%s not modified", redactURL(src))
+			return f.Close()
+		}
+		fallthrough
 	default:
 		resp.Body.Close()
-		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+		return statusError(src, resp.StatusCode)
 	}
 
 	body := resp.Body
@@ -207,7 +420,117 @@ func (g *HttpGetter) GetFile(dst string, src *url.URL) error {
 	}
 	defer body.Close()
 
+	content, decoded, err := decodeBody(resp, body, src)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if !decoded && !custom {
+		// The bytes written are the ones of the file, the download can be
+		// resumed at their end
+		resumeStateFromContext(ctx).setHTTP(resp)
+	}
+
+	if conditional || custom {
+		// The whole file was sent again, replace it.
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	n, err := Copy(ctx, f, content)
+	g.logf("downloaded %d bytes from %s", n, redactURL(src))
+	if err == nil && !decoded && n < resp.ContentLength {
+		err = io.ErrShortWrite
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil && g.ETagStore != nil {
+		if v := resp.Header.Get("ETag"); v != "" {
+			err = g.ETagStore.Set(src.String(), v)
+		}
+	}
+	if err == nil && g.IfModifiedSince {
+		if lastModified, err1 := http.ParseTime(resp.Header.Get("Last-Modified")); err1 == nil {
+			err = os.Chtimes(dst, time.Now(), lastModified)
+		}
+	}
+	return err
+}
+
+// resume implements resumer: the rest of the file is requested with an
+// If-Range condition, so that the server sends the whole file again if it
+// changed since the token was made.
+func (g *HttpGetter) resume(dst string, src *url.URL, token *ResumeToken) error {
+	ctx := g.Context()
+	if g.Netrc {
+		// Add auth from netrc if we can
+		if err := addAuthFromNetrc(src); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := resumeOffset(f, token)
+	if err != nil {
+		return err
+	}
+
+	req, err := g.newRequest("GET", src.String())
+	if err != nil {
+		return err
+	}
+	validator := token.ETag
+	if validator == "" {
+		validator = token.LastModified
+	}
+	if offset > 0 && validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	g.logf("GET %s (from byte %d)", redactURL(src), offset)
+	resp, err := g.do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// The file is unchanged
+	case http.StatusOK:
+		if offset > 0 {
+			g.logf("%s changed since the download was interrupted, restarting", redactURL(src))
+			offset = 0
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	default:
+		return statusError(src, resp.StatusCode)
+	}
+	resumeStateFromContext(ctx).setHTTP(resp)
+
+	var body io.Reader = resp.Body
+	if g.client != nil && g.client.ProgressListener != nil {
+		fn := filepath.Base(src.EscapedPath())
+		tracked := g.client.ProgressListener.TrackProgress(fn, offset, offset+resp.ContentLength, resp.Body)
+		defer tracked.Close()
+		body = tracked
+	}
+
 	n, err := Copy(ctx, f, body)
+	g.logf("downloaded %d bytes from %s", n, redactURL(src))
 	if err == nil && n < resp.ContentLength {
 		err = io.ErrShortWrite
 	}
@@ -217,23 +540,243 @@ func (g *HttpGetter) GetFile(dst string, src *url.URL) error {
 	return err
 }
 
+// autoChecksum implements autoChecksummer: it looks for the sidecar checksum
+// files of src when AutoChecksum is set.
+func (g *HttpGetter) autoChecksum(src *url.URL) (*fileChecksum, error) {
+	if !g.AutoChecksum {
+		return nil, nil
+	}
+
+	filename := path.Base(src.Path)
+	for _, ext := range []string{"sha256", "md5"} {
+		u := *src
+		u.Path += "." + ext
+		if u.RawPath != "" {
+			u.RawPath += "." + ext
+		}
+		if g.Netrc {
+			if err := addAuthFromNetrc(&u); err != nil {
+				return nil, err
+			}
+		}
+
+		data, err := g.getSidecar(&u)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			checksum, err := parseChecksumLine(line)
+			if err != nil || checksum == nil || checksum.Type != ext {
+				continue
+			}
+			switch checksum.Filename {
+			case "", filename, "*" + filename:
+				checksum.Filename = filename
+				return checksum, nil
+			}
+		}
+		return nil, fmt.Errorf("no checksum for %s found in %s", filename, redactURL(&u))
+	}
+
+	if g.AutoChecksumRequired {
+		return nil, fmt.Errorf("no sidecar checksum file found for %s", redactURL(src))
+	}
+	return nil, nil
+}
+
+// getSidecar returns the contents of the sidecar file at u, or nil if the
+// server doesn't have it or forbids it.
+func (g *HttpGetter) getSidecar(u *url.URL) ([]byte, error) {
+	req, err := g.newRequest("GET", u.String())
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(g.Context())
+
+	g.logf("GET %s", redactURL(u))
+	resp, err := g.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(io.LimitReader(resp.Body, maxSidecarSize))
+	case http.StatusNotFound, http.StatusForbidden:
+		// S3 and the hosts backed by it answer 403 for missing objects
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("bad response code fetching %s: %d", redactURL(u), resp.StatusCode)
+	}
+}
+
+// httpClient returns the client to send the requests with, pinning the
+// PinnedCertificates if any. The headers and credentials configured for
+// the host of each request in Client.Hosts are added by its transport, so
+// that they don't follow a redirect to another host.
+func (g *HttpGetter) httpClient() (*http.Client, error) {
+	client := httpClient
+	if g.Client != nil {
+		client = g.Client
+	}
+	if len(g.PinnedCertificates) > 0 {
+		var err error
+		if client, err = pinnedHTTPClient(client, g.PinnedCertificates); err != nil {
+			return nil, err
+		}
+	}
+	if g.client == nil || (len(g.client.Hosts) == 0 && g.client.CredentialHelper == nil) {
+		return client, nil
+	}
+
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cp := *client
+	cp.Transport = &hostConfigTransport{
+		base:      base,
+		hosts:     g.client.Hosts,
+		helper:    g.client.CredentialHelper,
+		basicAuth: true,
+	}
+	return &cp, nil
+}
+
+// newRequest returns a request carrying a copy of the getter's headers and
+// the client's User-Agent, unless the headers set one already.
+func (g *HttpGetter) newRequest(method, url string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range g.Header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", g.userAgent())
+	}
+	return req, nil
+}
+
+// remoteFilename returns the name to save src under when downloading it
+// into a directory. The Content-Disposition header returned by the server
+// takes precedence over the base name of the URL path.
+func (g *HttpGetter) remoteFilename(src *url.URL) (string, error) {
+	req, err := g.newRequest("HEAD", src.String())
+	if err != nil {
+		return "", err
+	}
+	resp, err := g.do(req.WithContext(g.Context()))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == 200 {
+			if filename, ok := parseContentDisposition(resp.Header.Get("Content-Disposition")); ok {
+				return filename, nil
+			}
+		}
+	}
+
+	if filename, ok := safeFilename(path.Base(src.Path)); ok {
+		return filename, nil
+	}
+	return "", fmt.Errorf("cannot determine a filename for %s", redactURL(src))
+}
+
+// filename implements filenamer: the name given by the server in the
+// Content-Disposition header of a HEAD request when ContentDisposition is
+// set, and else the base name of the URL path.
+func (g *HttpGetter) filename(u *url.URL) (string, error) {
+	if g.ContentDisposition {
+		return g.remoteFilename(u)
+	}
+	if filename, ok := safeFilename(path.Base(u.Path)); ok {
+		return filename, nil
+	}
+	return "", fmt.Errorf("cannot determine a filename for %s", redactURL(u))
+}
+
+// parseContentDisposition extracts the filename from the value of a
+// Content-Disposition header. The extended "filename*" parameter from
+// RFC 5987 is decoded and preferred over "filename" by mime.ParseMediaType.
+//
+// Only the base name of the filename is kept, so a malicious server can't
+// make us write outside of the destination directory.
+func parseContentDisposition(v string) (string, bool) {
+	if v == "" {
+		return "", false
+	}
+	_, params, err := mime.ParseMediaType(v)
+	if err != nil {
+		return "", false
+	}
+	return safeFilename(params["filename"])
+}
+
+// safeFilename reduces name to its last path element, returning false if
+// nothing usable is left.
+func safeFilename(name string) (string, bool) {
+	// Handle both separators regardless of the platform
+	if idx := strings.LastIndexAny(name, `/\`); idx > -1 {
+		name = name[idx+1:]
+	}
+	name = strings.TrimSpace(name)
+	switch name {
+	case "", ".", "..":
+		return "", false
+	}
+	return name, true
+}
+
+// getMultipart downloads the bytes of src from offset up to size into f,
+// using parallel range requests.
+func (g *HttpGetter) getMultipart(ctx context.Context, f *os.File, src *url.URL, offset, size int64) error {
+	fn := filepath.Base(src.EscapedPath())
+	return multipartDownload(ctx, f, offset, size-offset, g.PartSize, g.MaxConcurrency,
+		func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+			req, err := g.newRequest("GET", src.String())
+			if err != nil {
+				return nil, err
+			}
+			req = req.WithContext(ctx)
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+			g.logf("GET %s (bytes %d-%d)", redactURL(src), offset, offset+length-1)
+			resp, err := g.do(req)
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode != http.StatusPartialContent {
+				resp.Body.Close()
+				return nil, fmt.Errorf("bad response code for range request: %d", resp.StatusCode)
+			}
+
+			body := resp.Body
+			if g.client != nil && g.client.ProgressListener != nil {
+				body = g.client.ProgressListener.TrackProgress(fn, 0, length, resp.Body)
+			}
+			return body, nil
+		})
+}
+
 // getSubdir downloads the source into the destination, but with
 // the proper subdir.
 func (g *HttpGetter) getSubdir(ctx context.Context, dst, source, subDir string) error {
 	// Create a temporary directory to store the full source. This has to be
 	// a non-existent directory.
-	td, tdcloser, err := safetemp.Dir("", "getter")
+	td, tdcloser, err := safetemp.Dir(g.tmpDir(), "getter")
 	if err != nil {
 		return err
 	}
 	defer tdcloser.Close()
 
-	var opts []ClientOption
-	if g.client != nil {
-		opts = g.client.Options
-	}
 	// Download that into the given directory
-	if err := Get(td, source, opts...); err != nil {
+	if err := g.getSource(td, source); err != nil {
 		return err
 	}
 
@@ -250,18 +793,47 @@ func (g *HttpGetter) getSubdir(ctx context.Context, dst, source, subDir string)
 	}
 
 	// Copy the subdirectory into our actual destination.
-	if err := os.RemoveAll(dst); err != nil {
-		return err
+	if !g.merge() {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
 	}
 
 	// Make the final destination
-	if err := os.MkdirAll(dst, 0755); err != nil {
+	if err := os.MkdirAll(dst, g.dirMode()); err != nil {
 		return err
 	}
 
 	return copyDir(ctx, dst, sourcePath, false)
 }
 
+// getSource downloads the directory source returned by the server to dst,
+// with a copy of the getter's client so that its configuration, like the
+// Interceptor, Hosts and MaxBytes, applies to it too.
+func (g *HttpGetter) getSource(dst, source string) error {
+	if g.client == nil {
+		return Get(dst, source)
+	}
+
+	c := *g.client
+	c.Ctx = g.Context()
+	c.Src = source
+	c.Dst = dst
+	c.Mode = ClientModeDir
+	c.Dir = true
+	// The source comes from the server: it is neither relative to Pwd nor
+	// expanded
+	c.Pwd = ""
+	c.ExpandEnv = false
+	// The parent download already holds a connection of MaxConnections
+	c.MaxConnections = nil
+	// These apply to the parent download only
+	c.Stdout = nil
+	c.ComputeChecksums = nil
+	c.TreeChecksums = nil
+	return c.Get()
+}
+
 // parseMeta looks for the first meta tag in the given reader that
 // will give us the source URL.
 func (g *HttpGetter) parseMeta(r io.Reader) (string, error) {
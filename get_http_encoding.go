@@ -0,0 +1,78 @@
+package getter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// gzipMediaTypes are the Content-Types of gzip-compressed files.
+var gzipMediaTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-tgz":            true,
+	"application/x-compressed-tar": true,
+}
+
+// acceptGzip asks for a gzip Content-Encoding, unless req resumes a download
+// or already sets Accept-Encoding. Setting the header keeps http.Transport
+// from decoding the response transparently, so that decodeBody can tell the
+// compression of the transfer from the one of the file.
+func acceptGzip(req *http.Request) {
+	if req.Header.Get("Range") == "" && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+}
+
+// decodeBody returns the content of the file src read from body, the body
+// of resp, and whether it was decoded.
+//
+// A gzip Content-Encoding is removed, unless src is itself gzip-compressed
+// according to its extension or Content-Type: servers such as S3 send the
+// encoding stored with a .tar.gz file, which must be kept as is. Such a file
+// is only decoded if it was compressed a second time for the transfer.
+func decodeBody(resp *http.Response, body io.Reader, src *url.URL) (io.Reader, bool, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return body, false, nil
+	}
+
+	if !isGzipFile(resp, src) {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, false, fmt.Errorf("error decoding the gzip content encoding: %s", err)
+		}
+		return zr, true, nil
+	}
+
+	// Look at the first decoded bytes, keeping the raw ones to return them
+	// if the file wasn't compressed again.
+	var raw bytes.Buffer
+	zr, err := gzip.NewReader(bufio.NewReader(io.TeeReader(body, &raw)))
+	if err == nil {
+		magic := make([]byte, 2)
+		if _, err := io.ReadFull(zr, magic); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+			return io.MultiReader(bytes.NewReader(magic), zr), true, nil
+		}
+	}
+	return io.MultiReader(&raw, body), false, nil
+}
+
+// isGzipFile reports whether the file src, served with resp, is a gzip
+// compressed file.
+func isGzipFile(resp *http.Response, src *url.URL) bool {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && gzipMediaTypes[mediaType] {
+		return true
+	}
+	switch strings.ToLower(path.Ext(src.Path)) {
+	case ".gz", ".tgz":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package getter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGzipServer serves the files with a gzip Content-Encoding. "raw"
+// files are sent as is, like a .tar.gz stored with the encoding, the others
+// are compressed for the transfer.
+func testGzipServer(t *testing.T, files map[string][]byte, raw map[string]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "GET" && r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("bad Accept-Encoding for %s: %q", r.URL.Path, r.Header.Get("Accept-Encoding"))
+		}
+
+		if !raw[r.URL.Path] {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(data)
+			zw.Close()
+			data = buf.Bytes()
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(data)
+	}))
+}
+
+func TestHttpGetter_gzipEncoding(t *testing.T) {
+	srv := testGzipServer(t, map[string][]byte{"/file.txt": []byte("Hello\n")}, nil)
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := new(HttpGetter)
+	if err := g.GetFile(dst, testURL(srv.URL+"/file.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestHttpGetter_gzipEncodingArchive(t *testing.T) {
+	archive, err := ioutil.ReadFile(filepath.Join(fixtureDir, "archive.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	srv := testGzipServer(t, map[string][]byte{
+		"/stored.tar.gz":  archive,
+		"/encoded.tar.gz": archive,
+	}, map[string]bool{"/stored.tar.gz": true})
+	defer srv.Close()
+
+	for _, name := range []string{"stored.tar.gz", "encoded.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			if err := Get(dst, srv.URL+"/"+name); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package getter
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// StatusError is the error of a response with a status code of 400 or
+// more, returned by the HttpGetter and given to a RetryPolicy. The 401,
+// 403 and 404 status codes are wrapped in an UnauthorizedError,
+// ForbiddenError and NotFoundError instead, which errors.As also finds as
+// a StatusError.
+type StatusError struct {
+	// URL is the requested URL, with its password redacted.
+	URL string
+
+	// StatusCode is the status code of the response.
+	StatusCode int
+
+	// RetryAfter is the wait asked by the Retry-After header of the
+	// response, or 0 without one.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad response code fetching %s: %d", e.URL, e.StatusCode)
+}
+
+// UnauthorizedError is returned by the HttpGetter when the server answers
+// 401 Unauthorized, e.g. because credentials are missing.
+type UnauthorizedError struct {
+	StatusError
+}
+
+func (e *UnauthorizedError) Unwrap() error { return &e.StatusError }
+
+// ForbiddenError is returned by the HttpGetter when the server answers
+// 403 Forbidden, e.g. because the credentials don't grant access.
+type ForbiddenError struct {
+	StatusError
+}
+
+func (e *ForbiddenError) Unwrap() error { return &e.StatusError }
+
+// NotFoundError is returned by the HttpGetter when the server answers
+// 404 Not Found.
+type NotFoundError struct {
+	StatusError
+}
+
+func (e *NotFoundError) Unwrap() error { return &e.StatusError }
+
+// statusError returns the error of a response to u with an unexpected
+// status code, see StatusError.
+func statusError(u *url.URL, code int) error {
+	return newStatusError(StatusError{URL: redactURL(u), StatusCode: code})
+}
+
+// newStatusError returns e, or the UnauthorizedError, ForbiddenError or
+// NotFoundError wrapping it for the status codes they cover.
+func newStatusError(e StatusError) error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return &UnauthorizedError{e}
+	case http.StatusForbidden:
+		return &ForbiddenError{e}
+	case http.StatusNotFound:
+		return &NotFoundError{e}
+	default:
+		return &e
+	}
+}
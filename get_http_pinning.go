@@ -0,0 +1,113 @@
+package getter
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pinnedClients caches the clients of the HTTP getters pinning
+// certificates, so that their connections are reused across downloads.
+var pinnedClients sync.Map // pinnedClientKey -> *http.Client
+
+type pinnedClientKey struct {
+	base *http.Client
+	pins string
+}
+
+// pinnedHTTPClient returns a copy of base whose TLS connections fail unless
+// the server presents a certificate matching one of pins, see
+// HttpGetter.PinnedCertificates.
+func pinnedHTTPClient(base *http.Client, pins []string) (*http.Client, error) {
+	set, err := parseCertificatePins(pins)
+	if err != nil {
+		return nil, err
+	}
+	key := pinnedClientKey{base: base, pins: strings.Join(sortedPins(set), ",")}
+	if c, ok := pinnedClients.Load(key); ok {
+		return c.(*http.Client), nil
+	}
+
+	var t *http.Transport
+	switch rt := base.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = rt.Clone()
+	default:
+		return nil, fmt.Errorf("certificate pinning needs an *http.Transport, the client has a %T", rt)
+	}
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = new(tls.Config)
+	}
+	// VerifyPeerCertificate isn't called for resumed sessions
+	t.TLSClientConfig.ClientSessionCache = nil
+	t.TLSClientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		return verifyCertificatePins(rawCerts, verifiedChains, set)
+	}
+
+	c := *base
+	c.Transport = t
+	actual, _ := pinnedClients.LoadOrStore(key, &c)
+	return actual.(*http.Client), nil
+}
+
+// parseCertificatePins returns the set of the SHA256 fingerprints pins, in
+// hex, case-insensitive and optionally separated by colons as printed by
+// "openssl x509 -fingerprint -sha256".
+func parseCertificatePins(pins []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		p := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(pin), ":", ""))
+		if b, err := hex.DecodeString(p); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin %q: expected a hex SHA256 fingerprint", pin)
+		}
+		set[p] = true
+	}
+	return set, nil
+}
+
+// verifyCertificatePins checks that one of the certificates of the chains
+// verified for the server, or its public key, has one of the fingerprints
+// of pins. The other certificates the server sends are ignored, since
+// anyone can append a public certificate to theirs. Without verified
+// chains, when InsecureSkipVerify is set, only the leaf certificate is
+// checked.
+func verifyCertificatePins(rawCerts [][]byte, verifiedChains [][]*x509.Certificate, pins map[string]bool) error {
+	var certs []*x509.Certificate
+	for _, chain := range verifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(verifiedChains) == 0 && len(rawCerts) > 0 {
+		if cert, err := x509.ParseCertificate(rawCerts[0]); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		if pins[hex.EncodeToString(sum[:])] {
+			return nil
+		}
+		sum = sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if pins[hex.EncodeToString(sum[:])] {
+			return nil
+		}
+	}
+	return fmt.Errorf("no certificate of the server matches the pinned certificates")
+}
+
+func sortedPins(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package getter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPinServer starts a TLS server answering "Hello\n", not logging the
+// handshakes failed by the pins.
+func testPinServer() *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello\n"))
+	}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	return srv
+}
+
+// certificatePin returns the fingerprint of the DER b, as printed by
+// openssl.
+func certificatePin(b []byte) string {
+	sum := sha256.Sum256(b)
+	var parts []string
+	for _, c := range sum {
+		parts = append(parts, strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestHttpGetter_pinnedCertificates(t *testing.T) {
+	srv := testPinServer()
+	defer srv.Close()
+	cert := srv.Certificate()
+
+	cases := []struct {
+		Name string
+		Pins []string
+		Err  string
+	}{
+		{"certificate", []string{certificatePin(cert.Raw)}, ""},
+		{"public key", []string{certificatePin(cert.RawSubjectPublicKeyInfo)}, ""},
+		{"one of several", []string{strings.Repeat("00", 32), certificatePin(cert.Raw)}, ""},
+		{"mismatch", []string{strings.Repeat("ab", 32)}, "no certificate of the server matches"},
+		{"invalid", []string{"abcd"}, "invalid certificate pin"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := &HttpGetter{Client: srv.Client(), PinnedCertificates: tc.Pins}
+			err := g.GetFile(dst, testURL(srv.URL+"/file"))
+			if tc.Err == "" {
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				assertContents(t, dst, "Hello\n")
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestHttpGetter_pinnedCertificatesUntrusted(t *testing.T) {
+	srv := testPinServer()
+	defer srv.Close()
+
+	// The pin doesn't replace the verification of the certificate
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	g := &HttpGetter{PinnedCertificates: []string{certificatePin(srv.Certificate().Raw)}}
+	if err := g.GetFile(dst, testURL(srv.URL+"/file")); err == nil {
+		t.Fatal("expected a certificate verification error")
+	}
+}
+
+func TestHttpGetter_pinnedCertificatesExtra(t *testing.T) {
+	srv := testPinServer()
+	defer srv.Close()
+
+	// A certificate the server sends besides its valid chain doesn't count
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pinned"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	extra, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	srv.TLS.Certificates[0].Certificate = append(srv.TLS.Certificates[0].Certificate, extra)
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	g := &HttpGetter{Client: srv.Client(), PinnedCertificates: []string{certificatePin(extra)}}
+	err = g.GetFile(dst, testURL(srv.URL+"/file"))
+	if err == nil || !strings.Contains(err.Error(), "no certificate of the server matches") {
+		t.Fatalf("expected a pin mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package getter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRetryWait is the default of HttpGetter.MaxRetryWait.
+const defaultMaxRetryWait = 30 * time.Second
+
+// retryBackoff is the first wait between two retries, when the server
+// doesn't send a Retry-After header. It doubles after every retry.
+var retryBackoff = time.Second
+
+// RetryPolicy decides whether a failed request is sent again and how long
+// to wait before, see Client.RetryPolicy. err is the error of the attempt,
+// counting from 1: the error of the transport, or for a response with a
+// status code of 400 or more the same *StatusError, or *NotFoundError and
+// so on, the HttpGetter returns when it gives up.
+type RetryPolicy func(err error, attempt int) (retry bool, backoff time.Duration)
+
+// do sends req with the getter's client, retrying it as decided by the
+// RetryPolicy of the client, or else up to MaxRetries times while the
+// server answers 429 Too Many Requests or 503 Service Unavailable. Every
+// attempt gets a fresh token from TokenFunc, if set.
+func (g *HttpGetter) do(req *http.Request) (*http.Response, error) {
+	client, err := g.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	policy := g.retryPolicy()
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		if g.TokenFunc != nil {
+			token, err := g.TokenFunc(req.Context())
+			if err != nil {
+				return nil, fmt.Errorf("error getting a token for %s: %s", redactURL(req.URL), err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := client.Do(req)
+
+		var wait time.Duration
+		if policy != nil {
+			rerr := attemptError(req, resp, err)
+			if rerr == nil || req.Context().Err() != nil {
+				return resp, err
+			}
+			var retry bool
+			if retry, wait = policy(rerr, attempt+1); !retry {
+				return resp, err
+			}
+		} else {
+			if err != nil || attempt >= g.MaxRetries || !retryableStatus(resp.StatusCode) {
+				return resp, err
+			}
+			var ok bool
+			if wait, ok = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); !ok {
+				wait = backoff
+				backoff *= 2
+			}
+			max := g.MaxRetryWait
+			if max <= 0 {
+				max = defaultMaxRetryWait
+			}
+			if wait > max {
+				wait = max
+			}
+		}
+		if req.Body != nil && req.GetBody == nil {
+			// The body can't be sent again
+			return resp, err
+		}
+
+		var status string
+		if err != nil {
+			status = err.Error()
+		} else {
+			status = resp.Status
+			resp.Body.Close()
+		}
+		g.logf("%s %s: %s, retrying in %s", req.Method, redactURL(req.URL), status, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error rewinding the request body: %s", err)
+			}
+			req.Body = body
+		}
+	}
+}
+
+// attemptError returns the error of the attempt to send req given to a
+// RetryPolicy, or nil if it succeeded.
+func attemptError(req *http.Request, resp *http.Response, err error) error {
+	if err != nil || resp.StatusCode < 400 {
+		return err
+	}
+	retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return newStatusError(StatusError{URL: redactURL(req.URL), StatusCode: resp.StatusCode, RetryAfter: retryAfter})
+}
+
+// retryableStatus reports whether a response with the status code may be
+// retried after a while.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date, into the duration to wait from now.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if wait := t.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
@@ -0,0 +1,331 @@
+package getter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRetryServer answers the first failures requests to /file with code
+// and the Retry-After header retryAfter, and then with "Hello\n". It records
+// the bodies and Authorization headers of the requests.
+type testRetryServer struct {
+	*httptest.Server
+
+	sync.Mutex
+	failures   int
+	code       int
+	retryAfter func() string
+	bodies     []string
+	auths      []string
+}
+
+func newTestRetryServer(failures, code int, retryAfter func() string) *testRetryServer {
+	s := &testRetryServer{failures: failures, code: code, retryAfter: retryAfter}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.Lock()
+		defer s.Unlock()
+		if r.Method == "HEAD" {
+			return
+		}
+		s.bodies = append(s.bodies, string(body))
+		s.auths = append(s.auths, r.Header.Get("Authorization"))
+		if len(s.bodies) <= s.failures {
+			if v := s.retryAfter(); v != "" {
+				w.Header().Set("Retry-After", v)
+			}
+			w.WriteHeader(s.code)
+			return
+		}
+		w.Write([]byte("Hello\n"))
+	}))
+	return s
+}
+
+func (s *testRetryServer) requests() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.bodies)
+}
+
+func TestHttpGetter_retryAfterSeconds(t *testing.T) {
+	srv := newTestRetryServer(1, http.StatusTooManyRequests, func() string { return "1" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &HttpGetter{MaxRetries: 2}
+	start := time.Now()
+	if err := g.GetFile(dst, testURL(srv.URL+"/file")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected to wait for the Retry-After delay, waited %s", elapsed)
+	}
+	if n := srv.requests(); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestHttpGetter_retryAfterDate(t *testing.T) {
+	// The date is an hour away, the wait is capped by MaxRetryWait
+	srv := newTestRetryServer(2, http.StatusServiceUnavailable, func() string {
+		return time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	})
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &HttpGetter{MaxRetries: 2, MaxRetryWait: 50 * time.Millisecond}
+	start := time.Now()
+	if err := g.GetFile(dst, testURL(srv.URL+"/file")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 10*time.Second {
+		t.Fatalf("expected to wait twice MaxRetryWait, waited %s", elapsed)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestHttpGetter_retryExhausted(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	srv := newTestRetryServer(3, http.StatusServiceUnavailable, func() string { return "" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &HttpGetter{MaxRetries: 2}
+	err := g.GetFile(dst, testURL(srv.URL+"/file"))
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestHttpGetter_retryBody(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	srv := newTestRetryServer(1, http.StatusServiceUnavailable, func() string { return "" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &HttpGetter{MaxRetries: 1, Method: "POST", Body: []byte(`{"name":"foo"}`)}
+	if err := g.GetFile(dst, testURL(srv.URL+"/file")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, body := range srv.bodies {
+		if body != `{"name":"foo"}` {
+			t.Fatalf("bad request bodies: %q", srv.bodies)
+		}
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestHttpGetter_retryTokenFunc(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	srv := newTestRetryServer(2, http.StatusServiceUnavailable, func() string { return "" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// Every attempt gets the latest token
+	var calls int
+	g := &HttpGetter{
+		MaxRetries: 2,
+		TokenFunc: func(context.Context) (string, error) {
+			calls++
+			return fmt.Sprintf("token-%d", calls), nil
+		},
+	}
+	if err := g.GetFile(dst, testURL(srv.URL+"/file")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []string{
+		fmt.Sprintf("Bearer token-%d", calls-2),
+		fmt.Sprintf("Bearer token-%d", calls-1),
+		fmt.Sprintf("Bearer token-%d", calls),
+	}
+	if !reflect.DeepEqual(srv.auths, expected) {
+		t.Fatalf("bad Authorization headers: %q", srv.auths)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	// An error aborts the request
+	g.TokenFunc = func(context.Context) (string, error) {
+		return "", errors.New("expired")
+	}
+	err := g.GetFile(dst, testURL(srv.URL+"/file"))
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected a token error, got %v", err)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("expected no more requests, got %d", n)
+	}
+}
+
+func TestClient_RetryPolicy(t *testing.T) {
+	// The server fails with 500, not retried by default, more often than
+	// the policy retries
+	srv := newTestRetryServer(5, http.StatusInternalServerError, func() string { return "7" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	var errs []error
+	var attempts []int
+	client := &Client{
+		Src: srv.URL + "/file",
+		Dst: dst,
+		RetryPolicy: func(err error, attempt int) (bool, time.Duration) {
+			errs = append(errs, err)
+			attempts = append(attempts, attempt)
+			return attempt <= 2, time.Millisecond
+		},
+	}
+	err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected a 500 error, got %v", err)
+	}
+	if n := srv.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Fatalf("bad attempts: %v", attempts)
+	}
+	for _, err := range errs {
+		var serr *StatusError
+		if !errors.As(err, &serr) || serr.StatusCode != 500 || serr.RetryAfter != 7*time.Second {
+			t.Fatalf("bad error: %#v", err)
+		}
+	}
+
+	// The same policy gets the download through two failures
+	srv2 := newTestRetryServer(2, http.StatusInternalServerError, func() string { return "" })
+	defer srv2.Close()
+	client.Src = srv2.URL + "/file"
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+	if n := srv2.requests(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestClient_RetryPolicy_transportError(t *testing.T) {
+	// A closed server refuses the connections
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	var attempts []int
+	client := &Client{
+		Src: srv.URL + "/file",
+		Dst: dst,
+		RetryPolicy: func(err error, attempt int) (bool, time.Duration) {
+			attempts = append(attempts, attempt)
+			var serr *StatusError
+			if errors.As(err, &serr) {
+				t.Fatalf("expected a transport error, got %s", err)
+			}
+			return attempt < 2, time.Millisecond
+		},
+	}
+	if err := client.Get(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Every request is retried once
+	if len(attempts) == 0 || len(attempts)%2 != 0 {
+		t.Fatalf("bad attempts: %v", attempts)
+	}
+	for i, attempt := range attempts {
+		if attempt != i%2+1 {
+			t.Fatalf("bad attempts: %v", attempts)
+		}
+	}
+}
+
+func TestClient_RetryPolicy_notFound(t *testing.T) {
+	srv := newTestRetryServer(10, http.StatusNotFound, func() string { return "" })
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The policy sees the error type Get returns for the status
+	var perr error
+	client := &Client{
+		Src: srv.URL + "/file",
+		Dst: dst,
+		RetryPolicy: func(err error, attempt int) (bool, time.Duration) {
+			perr = err
+			return false, 0
+		},
+	}
+	err := client.Get()
+	for _, err := range []error{perr, err} {
+		var nf *NotFoundError
+		var serr *StatusError
+		if !errors.As(err, &nf) || !errors.As(err, &serr) || serr.StatusCode != 404 {
+			t.Fatalf("bad error: %#v", err)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		Value    string
+		Expected time.Duration
+		OK       bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Thu, 02 Jan 2020 03:04:35 GMT", 30 * time.Second, true},
+		{"Thursday, 02-Jan-20 03:05:05 GMT", time.Minute, true},
+		{"Thu, 02 Jan 2020 03:00:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tc := range cases {
+		actual, ok := parseRetryAfter(tc.Value, now)
+		if ok != tc.OK || actual != tc.Expected {
+			t.Fatalf("%q: expected %s %v, got %s %v", tc.Value, tc.Expected, tc.OK, actual, ok)
+		}
+	}
+}
@@ -1,17 +1,26 @@
 package getter
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestHttpGetter_impl(t *testing.T) {
@@ -96,6 +105,81 @@ func TestHttpGetter_meta(t *testing.T) {
 	}
 }
 
+func TestHttpGetter_metaFlattenArchive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Terraform-Get", testModule("archive-rooted/archive.tar.gz"))
+	}))
+	defer srv.Close()
+
+	for _, flatten := range []bool{true, false} {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		c := &Client{
+			Src:     srv.URL + "/meta",
+			Dst:     dst,
+			Dir:     true,
+			Options: []ClientOption{WithFlattenArchive(flatten)},
+		}
+		if err := c.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		expected := filepath.Join(dst, "root", "hello.txt")
+		if flatten {
+			expected = filepath.Join(dst, "hello.txt")
+		}
+		assertContents(t, expected, "hello\n")
+	}
+}
+
+func TestHttpGetter_metaClientConfig(t *testing.T) {
+	var blocked int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&blocked, 1)
+		http.ServeFile(w, r, filepath.Join(fixtureDir, "archive.tar.gz"))
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := "http://localhost:" + targetURL.Port() + "/archive.tar.gz"
+		if r.URL.Path == "/subdir" {
+			source += "//sub"
+		}
+		w.Header().Set("X-Terraform-Get", source)
+	}))
+	defer srv.Close()
+
+	// The fields of the client apply to the sources the server points to
+	for _, path := range []string{"/meta", "/subdir"} {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		c := &Client{
+			Src: srv.URL + path,
+			Dst: dst,
+			Dir: true,
+			Interceptor: func(u *url.URL) (*url.URL, error) {
+				if u.Hostname() == "localhost" {
+					return nil, fmt.Errorf("host %s is blocked", u.Host)
+				}
+				return u, nil
+			},
+		}
+		err := c.Get()
+		if err == nil || !strings.Contains(err.Error(), "is blocked") {
+			t.Fatalf("%s: expected the source to be blocked, got %v", path, err)
+		}
+	}
+	if n := atomic.LoadInt32(&blocked); n != 0 {
+		t.Fatalf("the blocked host was contacted %d times", n)
+	}
+}
+
 func TestHttpGetter_metaSubdir(t *testing.T) {
 	ln := testHttpServer(t)
 	defer ln.Close()
@@ -286,6 +370,161 @@ func TestHttpGetter_authNetrc(t *testing.T) {
 	}
 }
 
+func TestHttpGetter_multipart(t *testing.T) {
+	content := make([]byte, 64*1024+123)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	// Count the bounded range requests, which are only sent by multipart
+	// downloads.
+	var ranges int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rng := r.Header.Get("Range"); rng != "" && !strings.HasSuffix(rng, "-") {
+			atomic.AddInt32(&ranges, 1)
+		}
+		http.ServeContent(w, r, "large.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	u := testURL(srv.URL + "/large.bin")
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	// Single stream download
+	single := filepath.Join(td, "single")
+	if err := new(HttpGetter).GetFile(single, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Multipart download
+	multi := filepath.Join(td, "multi")
+	g := &HttpGetter{PartSize: 4096, MaxConcurrency: 3}
+	if err := g.GetFile(multi, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	singleData, err := ioutil.ReadFile(single)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	multiData, err := ioutil.ReadFile(multi)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(singleData, content) {
+		t.Fatal("single stream download differs from source")
+	}
+	if !bytes.Equal(multiData, singleData) {
+		t.Fatal("multipart download differs from single stream download")
+	}
+
+	expected := int32(len(content)/4096 + 1)
+	if n := atomic.LoadInt32(&ranges); n != expected {
+		t.Fatalf("expected %d range requests, got %d", expected, n)
+	}
+
+	// A file smaller than a part is downloaded as a single stream
+	small := filepath.Join(td, "small")
+	g = &HttpGetter{PartSize: int64(len(content) + 1)}
+	if err := g.GetFile(small, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := atomic.LoadInt32(&ranges); n != expected {
+		t.Fatalf("expected no additional range requests, got %d", n-expected)
+	}
+	assertContents(t, small, string(content))
+}
+
+func TestHttpGetter_contentDisposition(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Header   string
+		Path     string
+		Filename string
+	}{
+		{
+			"plain",
+			`attachment; filename="x.bin"`,
+			"/download",
+			"x.bin",
+		},
+		{
+			"extended",
+			`attachment; filename*=UTF-8''na%C3%AFve%20file.bin`,
+			"/download",
+			"naïve file.bin",
+		},
+		{
+			"extended preferred over plain",
+			`attachment; filename="fallback.bin"; filename*=UTF-8''real.bin`,
+			"/download",
+			"real.bin",
+		},
+		{
+			"path traversal",
+			`attachment; filename="../../evil.bin"`,
+			"/download",
+			"evil.bin",
+		},
+		{
+			"missing header",
+			"",
+			"/artifact.bin",
+			"artifact.bin",
+		},
+		{
+			"malformed header",
+			`attachment; filename="x.bin`,
+			"/artifact.bin",
+			"artifact.bin",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.Header != "" {
+					w.Header().Set("Content-Disposition", tc.Header)
+				}
+				w.Write([]byte("Hello\n"))
+			}))
+			defer srv.Close()
+
+			dst := tempDir(t)
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer os.RemoveAll(dst)
+
+			g := &HttpGetter{ContentDisposition: true}
+			if err := g.GetFile(dst, testURL(srv.URL+tc.Path)); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			assertContents(t, filepath.Join(dst, tc.Filename), "Hello\n")
+		})
+	}
+}
+
+func TestHttpGetter_contentDispositionFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="x.bin"`)
+		w.Write([]byte("Hello\n"))
+	}))
+	defer srv.Close()
+
+	// When dst isn't a directory, it is used as is
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &HttpGetter{ContentDisposition: true}
+	if err := g.GetFile(dst, testURL(srv.URL+"/download")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
 // test round tripper that only returns an error
 type errRoundTripper struct{}
 
@@ -319,6 +558,558 @@ func TestHttpGetter_cleanhttp(t *testing.T) {
 	}
 }
 
+func TestHttpGetter_etag(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		content     = "Hello, world\n"
+		etag        = `"v1"`
+		ifNoneMatch []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/file")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	store := make(testETagStore)
+	g := new(HttpGetter)
+	g.ETagStore = store
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// First download, the ETag gets stored
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello, world\n")
+	if v := store[u.String()]; v != `"v1"` {
+		t.Fatalf("bad stored etag: %q", v)
+	}
+
+	// Unchanged file, the server answers 304 and dst is kept
+	if err := ioutil.WriteFile(dst, []byte("local\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "local\n")
+
+	// Changed file, dst is replaced and the new ETag stored
+	mu.Lock()
+	content, etag = "Bye\n", `"v2"`
+	mu.Unlock()
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Bye\n")
+	if v := store[u.String()]; v != `"v2"` {
+		t.Fatalf("bad stored etag: %q", v)
+	}
+
+	// Missing dst, the ETag is ignored
+	os.Remove(dst)
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Bye\n")
+
+	expected := []string{"", `"v1"`, `"v1"`, ""}
+	if !reflect.DeepEqual(ifNoneMatch, expected) {
+		t.Fatalf("bad If-None-Match headers: %q, expected %q", ifNoneMatch, expected)
+	}
+}
+
+func TestHttpGetter_ifModifiedSince(t *testing.T) {
+	var (
+		mu              sync.Mutex
+		content         = "Hello, world\n"
+		lastModified    = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		ifModifiedSince []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "GET" {
+			ifModifiedSince = append(ifModifiedSince, r.Header.Get("If-Modified-Since"))
+		}
+		http.ServeContent(w, r, "file", lastModified, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/file")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := &HttpGetter{IfModifiedSince: true}
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// First download, dst gets the Last-Modified time
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello, world\n")
+	assertModTime(t, dst, lastModified)
+
+	// Unchanged file, the server answers 304 and dst is kept
+	if err := ioutil.WriteFile(dst, []byte("local\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Chtimes(dst, lastModified, lastModified); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "local\n")
+
+	// Changed file, dst is replaced and gets the new Last-Modified time
+	mu.Lock()
+	content, lastModified = "Bye\n", lastModified.Add(time.Hour)
+	mu.Unlock()
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Bye\n")
+	assertModTime(t, dst, lastModified)
+
+	// Missing dst, the request isn't conditional
+	os.Remove(dst)
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Bye\n")
+
+	first := "Thu, 02 Jan 2020 03:04:05 GMT"
+	expected := []string{"", first, first, ""}
+	if !reflect.DeepEqual(ifModifiedSince, expected) {
+		t.Fatalf("bad If-Modified-Since headers: %q, expected %q", ifModifiedSince, expected)
+	}
+}
+
+func assertModTime(t *testing.T, path string, expected time.Time) {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !fi.ModTime().Equal(expected) {
+		t.Fatalf("bad modification time of %s: %s, expected %s", path, fi.ModTime(), expected)
+	}
+}
+
+func TestHttpGetter_methodBody(t *testing.T) {
+	const query = `{"artifact":"foo","version":"1.0"}`
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || string(body) != query {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("Hello\n"))
+	}))
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// A previous, longer, file is replaced
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(dst, []byte("previous content\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := &HttpGetter{Method: "POST", Body: []byte(query)}
+	if err := g.GetFile(dst, testURL(srv.URL+"/artifact")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	if !reflect.DeepEqual(methods, []string{"POST"}) {
+		t.Fatalf("bad requests: %q", methods)
+	}
+
+	// The default GET is rejected by the server
+	g = new(HttpGetter)
+	if err := g.GetFile(dst, testURL(srv.URL+"/artifact")); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestHttpGetter_userAgent(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		userAgents []string
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/module", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Terraform-Get", "http://"+r.Host+"/archive.tar.gz")
+		w.WriteHeader(200)
+	})
+	mux.HandleFunc("/archive.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(fixtureDir, "archive.tar.gz"))
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.Method+" "+r.URL.Path+" "+r.UserAgent())
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Name     string
+		Opts     []ClientOption
+		Expected string
+	}{
+		{"default", nil, DefaultUserAgent},
+		{"custom", []ClientOption{WithUserAgent("my-agent/1.0")}, "my-agent/1.0"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			userAgents = nil
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			if err := Get(dst, srv.URL+"/module", tc.Opts...); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			expected := []string{
+				"GET /module " + tc.Expected,
+				"HEAD /archive.tar.gz " + tc.Expected,
+				"GET /archive.tar.gz " + tc.Expected,
+			}
+			if !reflect.DeepEqual(userAgents, expected) {
+				t.Fatalf("bad requests:\n%q\nexpected:\n%q", userAgents, expected)
+			}
+		})
+	}
+}
+
+func TestHttpGetter_hosts(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Get("X-Token")+" "+r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	config := HostConfig{
+		Header:   http.Header{"X-Token": []string{"secret"}},
+		Username: "foo",
+		Password: "bar",
+	}
+	cases := []struct {
+		Name     string
+		Hosts    map[string]HostConfig
+		Expected string
+	}{
+		{"match", map[string]HostConfig{"127.0.0.1": config}, "secret Basic Zm9vOmJhcg=="},
+		{"no match", map[string]HostConfig{"example.com": config}, " "},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			requests = nil
+			dst := filepath.Join(tempDir(t), "file")
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			if err := GetFile(dst, srv.URL+"/file", WithHosts(tc.Hosts)); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if len(requests) == 0 {
+				t.Fatal("no requests")
+			}
+			for _, r := range requests {
+				if r != tc.Expected {
+					t.Fatalf("bad request headers: %q, expected %q", r, tc.Expected)
+				}
+			}
+		})
+	}
+}
+
+func TestHttpGetter_hostsRedirect(t *testing.T) {
+	var header http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte("hello"))
+	}))
+	defer target.Close()
+	targetURL, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The redirect goes to another host name
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			t.Errorf("expected the headers of the host on the first request")
+		}
+		http.Redirect(w, r, "http://localhost:"+targetURL.Port()+"/file", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	hosts := map[string]HostConfig{"127.0.0.1": {
+		Header:   http.Header{"X-Token": []string{"secret"}},
+		Username: "foo",
+		Password: "bar",
+	}}
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+	if err := GetFile(dst, srv.URL+"/file", WithHosts(hosts)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if header == nil {
+		t.Fatal("the redirect wasn't followed")
+	}
+	if v := header.Get("X-Token"); v != "" {
+		t.Fatalf("the header of the first host was sent to the second: %q", v)
+	}
+	if v := header.Get("Authorization"); v != "" {
+		t.Fatalf("the credentials of the first host were sent to the second: %q", v)
+	}
+}
+
+func TestHttpGetter_hostsPrecedence(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	g := &HttpGetter{Header: http.Header{"X-Token": []string{"getter"}}}
+	g.SetClient(&Client{
+		Ctx: context.Background(),
+		Hosts: map[string]HostConfig{"127.0.0.1": {
+			Header:   http.Header{"x-token": []string{"host"}},
+			Username: "foo",
+			Password: "bar",
+		}},
+	})
+
+	u, err := url.Parse(srv.URL + "/file")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	u.User = url.UserPassword("url", "pass")
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if v := header.Values("X-Token"); !reflect.DeepEqual(v, []string{"getter"}) {
+		t.Fatalf("bad X-Token: %q", v)
+	}
+	if user, pass, _ := (&http.Request{Header: header}).BasicAuth(); user != "url" || pass != "pass" {
+		t.Fatalf("bad credentials: %q %q", user, pass)
+	}
+}
+
+func TestHttpGetter_statusErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			code = http.StatusBadRequest
+		}
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Code  int
+		Check func(error) bool
+	}{
+		{401, func(err error) bool { var e *UnauthorizedError; return errors.As(err, &e) && e.StatusCode == 401 }},
+		{403, func(err error) bool { var e *ForbiddenError; return errors.As(err, &e) && e.StatusCode == 403 }},
+		{404, func(err error) bool { var e *NotFoundError; return errors.As(err, &e) && e.StatusCode == 404 }},
+	}
+
+	for _, tc := range cases {
+		t.Run(strconv.Itoa(tc.Code), func(t *testing.T) {
+			td := tempDir(t)
+			defer os.RemoveAll(td)
+
+			src := fmt.Sprintf("%s/%d", srv.URL, tc.Code)
+			err := GetFile(filepath.Join(td, "file"), src)
+			if !tc.Check(err) {
+				t.Fatalf("GetFile: bad error: %#v", err)
+			}
+			if !strings.Contains(err.Error(), src) {
+				t.Fatalf("GetFile: expected the URL in the error: %s", err)
+			}
+
+			if err := Get(filepath.Join(td, "dir"), src); !tc.Check(err) {
+				t.Fatalf("Get: bad error: %#v", err)
+			}
+		})
+	}
+
+	// Other status codes are a StatusError
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	err := GetFile(filepath.Join(td, "file"), srv.URL+"/500")
+	var notFound *NotFoundError
+	var serr *StatusError
+	if err == nil || errors.As(err, &notFound) || !errors.As(err, &serr) || serr.StatusCode != 500 {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestHttpGetter_autoChecksum(t *testing.T) {
+	const content = "Hello\n"
+	sha := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	md5sum := fmt.Sprintf("%x", md5.Sum([]byte(content)))
+
+	cases := []struct {
+		Name     string
+		Sidecars map[string]string
+		Status   int
+		Required bool
+		Err      bool
+	}{
+		{
+			"sha256 sidecar",
+			map[string]string{"/file.txt.sha256": sha + "  file.txt\n"},
+			http.StatusNotFound,
+			false,
+			false,
+		},
+		{
+			"bare sha256 sidecar",
+			map[string]string{"/file.txt.sha256": sha + "\n"},
+			http.StatusNotFound,
+			false,
+			false,
+		},
+		{
+			"md5 sidecar",
+			map[string]string{"/file.txt.md5": "MD5 (file.txt) = " + md5sum + "\n"},
+			http.StatusNotFound,
+			false,
+			false,
+		},
+		{
+			"bad sidecar",
+			map[string]string{"/file.txt.sha256": strings.Repeat("0", 64) + "  file.txt\n"},
+			http.StatusNotFound,
+			false,
+			true,
+		},
+		{
+			"sidecar for another file",
+			map[string]string{"/file.txt.sha256": sha + "  other.txt\n"},
+			http.StatusNotFound,
+			false,
+			true,
+		},
+		{
+			"no sidecar",
+			nil,
+			http.StatusNotFound,
+			false,
+			false,
+		},
+		{
+			"required sidecar",
+			nil,
+			http.StatusNotFound,
+			true,
+			true,
+		},
+		{
+			"forbidden sidecar",
+			nil,
+			http.StatusForbidden,
+			false,
+			false,
+		},
+		{
+			"required forbidden sidecar",
+			nil,
+			http.StatusForbidden,
+			true,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/file.txt" {
+					w.Write([]byte(content))
+					return
+				}
+				if v, ok := tc.Sidecars[r.URL.Path]; ok {
+					w.Write([]byte(v))
+					return
+				}
+				w.WriteHeader(tc.Status)
+			}))
+			defer srv.Close()
+
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			client := &Client{
+				Src:  srv.URL + "/file.txt",
+				Dst:  dst,
+				Mode: ClientModeFile,
+				Getters: map[string]Getter{
+					"http": &HttpGetter{AutoChecksum: true, AutoChecksumRequired: tc.Required},
+				},
+			}
+			err := client.Get()
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+			if !tc.Err {
+				assertContents(t, dst, content)
+			}
+		})
+	}
+}
+
+// testETagStore is an in-memory ETagStore.
+type testETagStore map[string]string
+
+func (s testETagStore) Get(url string) (string, error) { return s[url], nil }
+
+func (s testETagStore) Set(url, etag string) error {
+	s[url] = etag
+	return nil
+}
+
 func testHttpServer(t *testing.T) net.Listener {
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -0,0 +1,203 @@
+package getter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	safetemp "github.com/hashicorp/go-safetemp"
+)
+
+// DefaultIPFSGateway is the gateway used by IPFSGetter when none is set.
+const DefaultIPFSGateway = "https://ipfs.io"
+
+// IPFSGetter is a Getter implementation that will download a file or a
+// directory from IPFS through an HTTP gateway. It accepts
+// ipfs://<cid>/path and ipns://<name>/path URLs. Directories are
+// downloaded as a tar archive generated by the gateway.
+type IPFSGetter struct {
+	getter
+
+	// Gateway is the base URL of the gateway, e.g. the one of a local node
+	// such as "http://127.0.0.1:8080". It defaults to DefaultIPFSGateway.
+	Gateway string
+
+	// Client is the http.Client to use to reach the gateway. This defaults
+	// to a cleanhttp.DefaultClient if left unset.
+	Client *http.Client
+}
+
+// withClient implements clientBinder.
+func (g *IPFSGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
+func (g *IPFSGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	src, err := g.gatewayURL(u)
+	if err != nil {
+		return 0, err
+	}
+
+	// Gateways redirect directories to their path with a trailing slash
+	// and serve a listing for them, don't follow the redirect.
+	client := *g.httpClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	req, err := g.newRequest("HEAD", src)
+	if err != nil {
+		return 0, err
+	}
+	g.logf("HEAD %s", src)
+	resp, err := client.Do(req.WithContext(g.Context()))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		if loc := resp.Header.Get("Location"); strings.HasSuffix(strings.SplitN(loc, "?", 2)[0], "/") {
+			return ClientModeDir, nil
+		}
+	case resp.StatusCode == http.StatusOK:
+		if strings.HasPrefix(resp.Header.Get("Etag"), `"DirIndex-`) {
+			return ClientModeDir, nil
+		}
+	}
+
+	// Let GetFile report errors
+	return ClientModeFile, nil
+}
+
+func (g *IPFSGetter) Get(dst string, u *url.URL) error {
+	ctx := g.Context()
+	src, err := g.gatewayURL(u)
+	if err != nil {
+		return err
+	}
+
+	// Ask the gateway for a tar archive of the directory
+	req, err := g.newRequest("GET", src+"?format=tar")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/x-tar")
+
+	g.logf("GET %s", req.URL)
+	resp, err := g.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	// The archive has the directory itself as root, extract it aside
+	td, tdcloser, err := safetemp.Dir(g.tmpDir(), "getter")
+	if err != nil {
+		return err
+	}
+	defer tdcloser.Close()
+
+	if err := untar(resp.Body, td, src, true, nil); err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(td)
+	if err != nil {
+		return err
+	}
+	if len(fis) != 1 || !fis[0].IsDir() {
+		return fmt.Errorf("expected a single directory in the archive of %s", src)
+	}
+
+	if err := os.MkdirAll(dst, g.dirMode()); err != nil {
+		return err
+	}
+	return copyDir(ctx, dst, filepath.Join(td, fis[0].Name()), false)
+}
+
+func (g *IPFSGetter) GetFile(dst string, u *url.URL) error {
+	ctx := g.Context()
+	src, err := g.gatewayURL(u)
+	if err != nil {
+		return err
+	}
+
+	req, err := g.newRequest("GET", src)
+	if err != nil {
+		return err
+	}
+
+	g.logf("GET %s", src)
+	resp, err := g.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad response code: %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := Copy(ctx, f, resp.Body)
+	g.logf("downloaded %d bytes from %s", n, src)
+	return err
+}
+
+// gatewayURL returns the URL of u on the gateway, without query.
+func (g *IPFSGetter) gatewayURL(u *url.URL) (string, error) {
+	if u.Scheme != "ipfs" && u.Scheme != "ipns" {
+		return "", fmt.Errorf("URL is not a valid IPFS URL: %s", u)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("URL is not a valid IPFS URL, missing the CID or name: %s", u)
+	}
+
+	gateway := g.Gateway
+	if gateway == "" {
+		gateway = DefaultIPFSGateway
+	}
+	base, err := url.Parse(strings.TrimSuffix(gateway, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid IPFS gateway %q: %s", gateway, err)
+	}
+
+	base.Path += "/" + u.Scheme + "/" + u.Host + u.Path
+	base.RawPath = ""
+	return base.String(), nil
+}
+
+func (g *IPFSGetter) httpClient() *http.Client {
+	if g.Client != nil {
+		return g.Client
+	}
+	return httpClient
+}
+
+func (g *IPFSGetter) newRequest(method, url string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", g.userAgent())
+	return req, nil
+}
@@ -0,0 +1,154 @@
+package getter
+
+import (
+	"archive/tar"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testIPFSCID = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+
+func TestIPFSGetter_impl(t *testing.T) {
+	var _ Getter = new(IPFSGetter)
+}
+
+// testIPFSGateway serves testIPFSCID, a directory holding "dir/hello.txt",
+// like an IPFS gateway.
+func testIPFSGateway(t *testing.T) *httptest.Server {
+	root := "/ipfs/" + testIPFSCID
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case root + "/dir/hello.txt", "/ipns/example.com/hello.txt":
+			w.Write([]byte("Hello\n"))
+		case root + "/dir":
+			// Gateways keep the query when redirecting
+			u := *r.URL
+			u.Path += "/"
+			http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+		case root + "/dir/":
+			if r.URL.Query().Get("format") != "tar" {
+				w.Header().Set("Etag", `"DirIndex-1234_CID-`+testIPFSCID+`"`)
+				w.Write([]byte("<html>listing</html>"))
+				return
+			}
+			fallthrough
+		case root:
+			if r.URL.Query().Get("format") != "tar" {
+				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+			tw := tar.NewWriter(w)
+			tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755})
+			tw.WriteHeader(&tar.Header{Name: "dir/hello.txt", Mode: 0644, Size: 6})
+			tw.Write([]byte("Hello\n"))
+			tw.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestIPFSGetter_ClientMode(t *testing.T) {
+	srv := testIPFSGateway(t)
+	defer srv.Close()
+
+	cases := []struct {
+		URL  string
+		Mode ClientMode
+	}{
+		{"ipfs://" + testIPFSCID + "/dir", ClientModeDir},
+		{"ipfs://" + testIPFSCID + "/dir/", ClientModeDir},
+		{"ipfs://" + testIPFSCID + "/dir/hello.txt", ClientModeFile},
+		{"ipns://example.com/hello.txt", ClientModeFile},
+	}
+
+	g := &IPFSGetter{Gateway: srv.URL}
+	for _, tc := range cases {
+		mode, err := g.ClientMode(testURL(tc.URL))
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.URL, err)
+		}
+		if mode != tc.Mode {
+			t.Fatalf("%s: expected mode %d, got %d", tc.URL, tc.Mode, mode)
+		}
+	}
+}
+
+func TestIPFSGetter_GetFile(t *testing.T) {
+	srv := testIPFSGateway(t)
+	defer srv.Close()
+
+	g := &IPFSGetter{Gateway: srv.URL + "/"}
+	for _, src := range []string{
+		"ipfs://" + testIPFSCID + "/dir/hello.txt",
+		"ipns://example.com/hello.txt",
+	} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		if err := g.GetFile(dst, testURL(src)); err != nil {
+			t.Fatalf("%s: err: %s", src, err)
+		}
+		assertContents(t, dst, "Hello\n")
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	err := g.GetFile(dst, testURL("ipfs://"+testIPFSCID+"/nope.txt"))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+}
+
+func TestIPFSGetter_Get(t *testing.T) {
+	srv := testIPFSGateway(t)
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	g := &IPFSGetter{Gateway: srv.URL}
+	if err := g.Get(dst, testURL("ipfs://"+testIPFSCID+"/dir")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "hello.txt"), "Hello\n")
+}
+
+func TestIPFSGetter_client(t *testing.T) {
+	srv := testIPFSGateway(t)
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	c := &Client{
+		Src:     "ipfs://" + testIPFSCID + "/dir",
+		Dst:     dst,
+		Mode:    ClientModeAny,
+		Getters: map[string]Getter{"ipfs": &IPFSGetter{Gateway: srv.URL}},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "hello.txt"), "Hello\n")
+}
+
+func TestIPFSGetter_gatewayURL(t *testing.T) {
+	g := new(IPFSGetter)
+	actual, err := g.gatewayURL(testURL("ipfs://" + testIPFSCID + "/a b.txt"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := DefaultIPFSGateway + "/ipfs/" + testIPFSCID + "/a%20b.txt"
+	if actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	if _, err := g.gatewayURL(testURL("ipfs:///foo")); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -0,0 +1,142 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// defaultMultipartConcurrency is the number of parts downloaded at the same
+// time when a getter's MaxConcurrency is left unset.
+const defaultMultipartConcurrency = 4
+
+// multipartJitter is the upper bound of the random delay applied before each
+// multipart worker starts, so that the initial range requests don't all hit
+// the server at the exact same moment.
+const multipartJitter = 50 * time.Millisecond
+
+// rangeFetcher returns a reader for length bytes of a remote object starting
+// at offset.
+type rangeFetcher func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// offsetWriter is an io.Writer that writes sequentially into an io.WriterAt
+// starting at a given offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// multipartDownload downloads the bytes [offset, offset+size) of a remote
+// object into dst by splitting them into parts of at most partSize bytes.
+// Up to concurrency parts are fetched at the same time and each one is
+// written at its own position in dst with WriteAt.
+//
+// The first error encountered cancels all parts still in flight. With a
+// ConnectionLimit in ctx, each part beyond the first one fetched at the same
+// time takes a connection from it: the first one uses the connection of the
+// download.
+func multipartDownload(ctx context.Context, dst io.WriterAt, offset, size, partSize int64, concurrency int, fetch rangeFetcher) error {
+	if partSize <= 0 {
+		return fmt.Errorf("invalid part size: %d", partSize)
+	}
+	if concurrency <= 0 {
+		concurrency = defaultMultipartConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type part struct {
+		offset, length int64
+	}
+	parts := make(chan part)
+	go func() {
+		defer close(parts)
+		for off := offset; off < offset+size; off += partSize {
+			length := partSize
+			if rest := offset + size - off; rest < length {
+				length = rest
+			}
+			select {
+			case parts <- part{off, length}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		retErr  error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			retErr = err
+			cancel()
+		})
+	}
+
+	limit := connectionLimitFromContext(ctx)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(first bool, jitter time.Duration) {
+			defer wg.Done()
+
+			select {
+			case <-time.After(jitter):
+			case <-ctx.Done():
+				return
+			}
+
+			for p := range parts {
+				if !first {
+					if err := limit.acquire(ctx); err != nil {
+						return
+					}
+				}
+				err := downloadPart(ctx, dst, p.offset, p.length, fetch)
+				if !first {
+					limit.release()
+				}
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}(i == 0, time.Duration(rand.Int63n(int64(multipartJitter))))
+	}
+	wg.Wait()
+
+	if retErr != nil {
+		return retErr
+	}
+	return ctx.Err()
+}
+
+// downloadPart fetches a single part and writes it into dst at offset.
+func downloadPart(ctx context.Context, dst io.WriterAt, offset, length int64, fetch rangeFetcher) error {
+	rc, err := fetch(ctx, offset, length)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	n, err := Copy(ctx, &offsetWriter{w: dst, off: offset}, io.LimitReader(rc, length))
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("short read for bytes %d-%d: got %d bytes", offset, offset+length-1, n)
+	}
+	return nil
+}
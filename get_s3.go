@@ -2,7 +2,12 @@ package getter
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -12,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 )
@@ -20,6 +26,48 @@ import (
 // a S3 bucket.
 type S3Getter struct {
 	getter
+
+	// PartSize, if greater than zero, enables multipart downloads. Objects
+	// larger than PartSize are fetched as several ranges of PartSize bytes in
+	// parallel, other objects are downloaded as a single stream.
+	PartSize int64
+
+	// MaxConcurrency is the maximum number of parts fetched at the same
+	// time during a multipart download. It defaults to 4.
+	MaxConcurrency int
+
+	// Transport, if set, tunes the HTTP transport used to reach S3.
+	Transport *TransportOptions
+
+	// SyncMode, if true, makes directory downloads skip the objects whose
+	// local copy already has the same size and MD5 checksum, as given by
+	// their ETag. Objects uploaded in several parts, whose ETag isn't their
+	// MD5 checksum, are always downloaded. The destination is kept, as with
+	// Client.Merge.
+	SyncMode bool
+
+	// PathMapper, if set, chooses the path of each object of a directory
+	// download, relative to the destination, or skips it. By default the
+	// objects keep their key relative to the downloaded prefix.
+	PathMapper ObjectPathMapper
+
+	// AllowEmpty, if true, makes a directory download of a prefix holding
+	// no objects create an empty destination directory instead of failing.
+	AllowEmpty bool
+
+	// KeepPartial, if true, makes a canceled directory download keep the
+	// objects already downloaded and return a PartialDownloadError listing
+	// the completed and pending objects, e.g. to resume the download later
+	// with SyncMode. The objects are still listed after the cancellation
+	// to report the pending ones.
+	KeepPartial bool
+}
+
+// withClient implements clientBinder.
+func (g *S3Getter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
 }
 
 func (g *S3Getter) ClientMode(u *url.URL) (ClientMode, error) {
@@ -30,9 +78,11 @@ func (g *S3Getter) ClientMode(u *url.URL) (ClientMode, error) {
 	}
 
 	// Create client config
-	config := g.getAWSConfig(region, u, creds)
-	sess := session.New(config)
-	client := s3.New(sess)
+	config, err := g.newAWSConfig(region, bucket, u, creds)
+	if err != nil {
+		return 0, err
+	}
+	client := g.newS3Client(config)
 
 	// List the object(s) at the given prefix
 	req := &s3.ListObjectsInput{
@@ -45,13 +95,13 @@ func (g *S3Getter) ClientMode(u *url.URL) (ClientMode, error) {
 	}
 
 	for _, o := range resp.Contents {
-		// Use file mode on exact match.
-		if *o.Key == path {
+		// Use file mode on exact match, unless the key is a directory.
+		if *o.Key == path && !strings.HasSuffix(path, "/") {
 			return ClientModeFile, nil
 		}
 
 		// Use dir mode if child keys are found.
-		if strings.HasPrefix(*o.Key, path+"/") {
+		if strings.HasPrefix(*o.Key, strings.TrimSuffix(path, "/")+"/") {
 			return ClientModeDir, nil
 		}
 	}
@@ -70,31 +120,38 @@ func (g *S3Getter) Get(dst string, u *url.URL) error {
 		return err
 	}
 
-	// Remove destination if it already exists
+	// Remove destination if it already exists, unless merging into it
 	_, err = os.Stat(dst)
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	if err == nil {
+	if err == nil && !g.merge() && !g.SyncMode {
 		// Remove the destination
 		if err := os.RemoveAll(dst); err != nil {
 			return err
 		}
 	}
 
-	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	// Create all the parent directories, remembering the topmost one
+	// created so that it can be removed if nothing is downloaded.
+	created := missingDir(filepath.Dir(dst))
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
-	config := g.getAWSConfig(region, u, creds)
-	sess := session.New(config)
-	client := s3.New(sess)
+	config, err := g.newAWSConfig(region, bucket, u, creds)
+	if err != nil {
+		return err
+	}
+	client := g.newS3Client(config)
 
 	// List files in path, keep listing until no more objects are found
 	lastMarker := ""
 	hasMore := true
+	found := false
+	var completed []string
+	var partial *PartialDownloadError
 	for hasMore {
 		req := &s3.ListObjectsInput{
 			Bucket: aws.String(bucket),
@@ -104,6 +161,7 @@ func (g *S3Getter) Get(dst string, u *url.URL) error {
 			req.Marker = aws.String(lastMarker)
 		}
 
+		g.logf("listing s3://%s/%s", bucket, path)
 		resp, err := client.ListObjects(req)
 		if err != nil {
 			return err
@@ -115,6 +173,7 @@ func (g *S3Getter) Get(dst string, u *url.URL) error {
 		for _, object := range resp.Contents {
 			lastMarker = aws.StringValue(object.Key)
 			objPath := aws.StringValue(object.Key)
+			found = true
 
 			// If the key ends with a backslash assume it is a directory and ignore
 			if strings.HasSuffix(objPath, "/") {
@@ -126,14 +185,52 @@ func (g *S3Getter) Get(dst string, u *url.URL) error {
 			if err != nil {
 				return err
 			}
+			objDst, ok, err := g.PathMapper.mapObject(objPath, objDst)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
 			objDst = filepath.Join(dst, objDst)
 
-			if err := g.getObject(ctx, client, objDst, bucket, objPath, ""); err != nil {
+			if g.SyncMode && s3ObjectMatches(objDst, object) {
+				g.logf("skipping up-to-date s3://%s/%s", bucket, objPath)
+				completed = append(completed, objPath)
+				continue
+			}
+			if partial != nil {
+				partial.Pending = append(partial.Pending, objPath)
+				continue
+			}
+
+			err = g.getObject(ctx, client, objDst, bucket, objPath, "")
+			if err != nil && g.KeepPartial && ctx.Err() != nil {
+				// Only keep the complete objects
+				os.Remove(objDst)
+				partial = &PartialDownloadError{Err: err, Completed: completed, Pending: []string{objPath}}
+				continue
+			}
+			if err != nil {
 				return err
 			}
+			g.fileComplete(objPath, aws.Int64Value(object.Size))
+			completed = append(completed, objPath)
 		}
 	}
+	if partial != nil {
+		return partial
+	}
 
+	if !found {
+		if g.AllowEmpty {
+			return os.MkdirAll(dst, g.dirMode())
+		}
+		if created != "" {
+			os.RemoveAll(created)
+		}
+		return fmt.Errorf("no objects found under prefix %q in bucket %q", path, bucket)
+	}
 	return nil
 }
 
@@ -144,9 +241,16 @@ func (g *S3Getter) GetFile(dst string, u *url.URL) error {
 		return err
 	}
 
-	config := g.getAWSConfig(region, u, creds)
-	sess := session.New(config)
-	client := s3.New(sess)
+	// Keys ending with a slash are the pseudo-directories of the console
+	if strings.HasSuffix(path, "/") {
+		return fmt.Errorf("s3://%s/%s is a directory, not a file", bucket, path)
+	}
+
+	config, err := g.newAWSConfig(region, bucket, u, creds)
+	if err != nil {
+		return err
+	}
+	client := g.newS3Client(config)
 	return g.getObject(ctx, client, dst, bucket, path, version)
 }
 
@@ -159,26 +263,143 @@ func (g *S3Getter) getObject(ctx context.Context, client *s3.S3, dst, bucket, ke
 		req.VersionId = aws.String(version)
 	}
 
+	var size int64
+	if g.PartSize > 0 {
+		head, err := client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:    req.Bucket,
+			Key:       req.Key,
+			VersionId: req.VersionId,
+		})
+		if err != nil {
+			return err
+		}
+		size = aws.Int64Value(head.ContentLength)
+	}
+
+	if g.PartSize > 0 && size > g.PartSize {
+		// Create all the parent directories
+		if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return multipartDownload(ctx, f, 0, size, g.PartSize, g.MaxConcurrency,
+			func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+				partReq := *req
+				partReq.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+				g.logf("reading s3://%s/%s (bytes %d-%d)", bucket, key, offset, offset+length-1)
+				resp, err := client.GetObjectWithContext(ctx, &partReq)
+				if err != nil {
+					return nil, err
+				}
+				return resp.Body, nil
+			})
+	}
+
+	g.logf("reading s3://%s/%s", bucket, key)
 	resp, err := client.GetObject(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if isS3DirectoryMarker(resp) {
+		return fmt.Errorf("s3://%s/%s is a directory marker, not a file", bucket, key)
+	}
 
 	// Create all the parent directories
-	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
 		return err
 	}
 
-	f, err := os.Create(dst)
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.fileMode())
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	_, err = Copy(ctx, f, resp.Body)
+	n, err := Copy(ctx, f, resp.Body)
+	g.logf("downloaded %d bytes from s3://%s/%s", n, bucket, key)
 	return err
 }
 
+// isS3DirectoryMarker reports whether resp is the one of an empty object
+// standing for a directory, as created by some S3 tools.
+func isS3DirectoryMarker(resp *s3.GetObjectOutput) bool {
+	if aws.Int64Value(resp.ContentLength) != 0 {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(aws.StringValue(resp.ContentType))
+	return err == nil && mediaType == "application/x-directory"
+}
+
+// s3ObjectMatches reports whether the file at path has the size and the
+// MD5 checksum of object. It is false when the ETag of object isn't an MD5
+// checksum.
+func s3ObjectMatches(path string, object *s3.Object) bool {
+	sum, err := hex.DecodeString(strings.Trim(aws.StringValue(object.ETag), `"`))
+	if err != nil || len(sum) != md5.Size {
+		return false
+	}
+	return fileMatches(path, aws.Int64Value(object.Size), md5.New(), sum)
+}
+
+// checkCredentials fails if the client requires authentication and the
+// credentials of config can't be resolved.
+func (g *S3Getter) checkCredentials(config *aws.Config) error {
+	if !g.requireAuth() {
+		return nil
+	}
+	if _, err := config.Credentials.Get(); err != nil {
+		return fmt.Errorf("no S3 credentials found: %s", err)
+	}
+	return nil
+}
+
+// newS3Client returns an S3 client for config, adding the User-Agent of the
+// getter's client to the one of the SDK.
+func (g *S3Getter) newS3Client(config *aws.Config) *s3.S3 {
+	client := s3.New(session.New(config))
+	client.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(g.userAgent()))
+	return client
+}
+
+// newAWSConfig returns the configuration of the requests for bucket, with
+// the credentials given in the URL, creds, or else the ones resolved by
+// resolveCredentials. It fails if credentials are required but missing.
+func (g *S3Getter) newAWSConfig(region, bucket string, u *url.URL, creds *credentials.Credentials) (*aws.Config, error) {
+	if creds == nil {
+		var err error
+		if creds, err = g.resolveCredentials(u, bucket); err != nil {
+			return nil, err
+		}
+	}
+	config := g.getAWSConfig(region, u, creds)
+	if err := g.checkCredentials(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// resolveCredentials returns the credentials configured for the host of u
+// in Client.Hosts, or else the ones of the client's CredentialProvider for
+// bucket. nil means the default credential chain of the environment.
+func (g *S3Getter) resolveCredentials(u *url.URL, bucket string) (*credentials.Credentials, error) {
+	hc, ok, err := g.hostConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if ok && hc.AWSAccessKeyID != "" {
+		return credentials.NewStaticCredentials(
+			hc.AWSAccessKeyID, hc.AWSSecretAccessKey, hc.AWSSessionToken), nil
+	}
+	return g.credentials().AWSCredentials(g.Context(), u.Hostname(), bucket)
+}
+
 func (g *S3Getter) getAWSConfig(region string, url *url.URL, creds *credentials.Credentials) *aws.Config {
 	conf := &aws.Config{}
 	if creds == nil {
@@ -200,8 +421,10 @@ func (g *S3Getter) getAWSConfig(region string, url *url.URL, creds *credentials.
 			})
 	}
 
-	if creds != nil {
-		conf.Endpoint = &url.Host
+	if creds != nil && url.Scheme != "s3" {
+		// s3:// URLs only name the bucket, let the SDK pick the
+		// endpoint of the region.
+		conf.Endpoint = aws.String(s3Endpoint(url))
 		conf.S3ForcePathStyle = aws.Bool(true)
 		if url.Scheme == "http" {
 			conf.DisableSSL = aws.Bool(true)
@@ -209,6 +432,9 @@ func (g *S3Getter) getAWSConfig(region string, url *url.URL, creds *credentials.
 	}
 
 	conf.Credentials = creds
+	if g.Transport != nil {
+		conf.HTTPClient = &http.Client{Transport: g.Transport.httpTransport()}
+	}
 	if region != "" {
 		conf.Region = aws.String(region)
 	}
@@ -220,7 +446,38 @@ func (g *S3Getter) parseUrl(u *url.URL) (region, bucket, path, version string, c
 	// This just check whether we are dealing with S3 or
 	// any other S3 compliant service. S3 has a predictable
 	// url as others do not
-	if strings.Contains(u.Host, "amazonaws.com") {
+	if u.Scheme == "s3" {
+		// Canonical style: s3://bucket/path
+		bucket = u.Host
+		path = strings.TrimPrefix(u.Path, "/")
+		if bucket == "" {
+			err = fmt.Errorf("URL is not a valid S3 URL")
+			return
+		}
+		version = u.Query().Get("version")
+		region = u.Query().Get("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+
+	} else if isS3VhostStyle(u.Host) {
+		// Virtual-hosted style: bucket.s3.amazonaws.com/path, the region
+		// may follow the "s3-" prefix of the second part, or be the third
+		// part as in bucket.s3.eu-west-1.amazonaws.com.
+		hostParts := strings.Split(u.Host, ".")
+		region = strings.TrimPrefix(strings.TrimPrefix(hostParts[1], "s3-"), "s3")
+		if len(hostParts) == 5 {
+			region = hostParts[2]
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		bucket = hostParts[0]
+		path = strings.TrimPrefix(u.Path, "/")
+		version = u.Query().Get("version")
+
+	} else if strings.Contains(u.Host, "amazonaws.com") {
 		// Expected host style: s3.amazonaws.com. They always have 3 parts,
 		// although the first may differ if we're accessing a specific region.
 		hostParts := strings.Split(u.Host, ".")
@@ -273,3 +530,30 @@ func (g *S3Getter) parseUrl(u *url.URL) (region, bucket, path, version string, c
 
 	return
 }
+
+// isS3VhostStyle reports whether host is a virtual-hosted style S3 host,
+// such as bucket.s3.amazonaws.com, bucket.s3-eu-west-1.amazonaws.com or
+// bucket.s3.eu-west-1.amazonaws.com.
+func isS3VhostStyle(host string) bool {
+	hostParts := strings.Split(host, ".")
+	n := len(hostParts)
+	if n < 4 || hostParts[n-2] != "amazonaws" || hostParts[n-1] != "com" {
+		return false
+	}
+	switch n {
+	case 4:
+		return strings.HasPrefix(hostParts[1], "s3")
+	case 5:
+		return hostParts[1] == "s3" && hostParts[2] != ""
+	}
+	return false
+}
+
+// s3Endpoint returns the endpoint to send path-style requests to for u,
+// dropping the bucket of virtual-hosted style hosts.
+func s3Endpoint(u *url.URL) string {
+	if isS3VhostStyle(u.Host) {
+		return u.Host[strings.Index(u.Host, ".")+1:]
+	}
+	return u.Host
+}
@@ -1,12 +1,26 @@
 package getter
 
 import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
 func init() {
@@ -189,6 +203,54 @@ func TestS3Getter_Url(t *testing.T) {
 			path:    "foo/bar.baz",
 			version: "1234",
 		},
+		{
+			name:    "AWSPathStyle",
+			url:     "s3::https://s3.amazonaws.com/bucket/foo/bar.baz",
+			region:  "us-east-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "",
+		},
+		{
+			name:    "AWSVhostStyle",
+			url:     "s3::https://bucket.s3.amazonaws.com/foo/bar.baz?version=1234",
+			region:  "us-east-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "1234",
+		},
+		{
+			name:    "AWSVhostStyleRegion",
+			url:     "s3::https://bucket.s3-eu-west-1.amazonaws.com/foo/bar.baz",
+			region:  "eu-west-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "",
+		},
+		{
+			name:    "AWSVhostStyleDottedRegion",
+			url:     "s3::https://bucket.s3.eu-west-1.amazonaws.com/foo/bar.baz",
+			region:  "eu-west-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "",
+		},
+		{
+			name:    "S3Scheme",
+			url:     "s3::s3://bucket/foo/bar.baz?version=1234",
+			region:  "us-east-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "1234",
+		},
+		{
+			name:    "S3SchemeRegion",
+			url:     "s3::s3://bucket/foo/bar.baz?region=eu-west-1",
+			region:  "eu-west-1",
+			bucket:  "bucket",
+			path:    "foo/bar.baz",
+			version: "",
+		},
 		{
 			name:    "localhost-1",
 			url:     "s3::http://127.0.0.1:9000/test-bucket/hello.txt?aws_access_key_id=TESTID&aws_access_key_secret=TestSecret&region=us-east-2&version=1",
@@ -251,3 +313,485 @@ func TestS3Getter_Url(t *testing.T) {
 		})
 	}
 }
+
+func TestS3Getter_UrlEndpoint(t *testing.T) {
+	cases := []struct {
+		url      string
+		endpoint string
+	}{
+		{"https://s3-eu-west-1.amazonaws.com/bucket/foo", "s3-eu-west-1.amazonaws.com"},
+		{"https://bucket.s3.amazonaws.com/foo", "s3.amazonaws.com"},
+		{"https://bucket.s3-eu-west-1.amazonaws.com/foo", "s3-eu-west-1.amazonaws.com"},
+		{"https://bucket.s3.eu-west-1.amazonaws.com/foo", "s3.eu-west-1.amazonaws.com"},
+		{"http://127.0.0.1:9000/bucket/foo", "127.0.0.1:9000"},
+		{"s3://bucket/foo", ""},
+	}
+
+	g := new(S3Getter)
+	for _, tc := range cases {
+		t.Run(tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			creds := credentials.NewStaticCredentials("id", "secret", "")
+			config := g.getAWSConfig("us-east-1", u, creds)
+			if actual := aws.StringValue(config.Endpoint); actual != tc.endpoint {
+				t.Fatalf("expected %q, got %q", tc.endpoint, actual)
+			}
+		})
+	}
+}
+
+func TestS3Getter_UrlInvalid(t *testing.T) {
+	u, err := url.Parse("s3:///foo/bar.baz")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	g := new(S3Getter)
+	if _, _, _, _, _, err := g.parseUrl(u); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestS3Getter_transport(t *testing.T) {
+	g := &S3Getter{
+		Transport: &TransportOptions{MaxIdleConnsPerHost: 32, ForceAttemptHTTP2: true},
+	}
+
+	u, err := url.Parse("https://s3.amazonaws.com/bucket/foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	config := g.getAWSConfig("us-east-1", u, nil)
+	if config.HTTPClient == nil {
+		t.Fatal("expected a custom HTTP client")
+	}
+	tr, ok := config.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("bad transport: %T", config.HTTPClient.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != 32 || !tr.ForceAttemptHTTP2 {
+		t.Fatalf("transport settings not applied: %#v", tr)
+	}
+}
+
+func TestS3Getter_getSync(t *testing.T) {
+	objects := map[string]string{
+		"dir/same.txt":    "same\n",
+		"dir/changed.txt": "new\n",
+		"dir/multi.txt":   "multi\n",
+		"dir/missing.txt": "missing\n",
+	}
+
+	var mu sync.Mutex
+	var read []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bucket" || r.URL.Path == "/bucket/" {
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>`)
+			for _, key := range keys {
+				etag := fmt.Sprintf("%x", md5.Sum([]byte(objects[key])))
+				if key == "dir/multi.txt" {
+					// Objects uploaded in parts don't have an MD5 ETag
+					etag += "-2"
+				}
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>&quot;%s&quot;</ETag><Size>%d</Size></Contents>`,
+					key, etag, len(objects[key]))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		contents, ok := objects[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		read = append(read, key)
+		mu.Unlock()
+		fmt.Fprint(w, contents)
+	}))
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for name, contents := range map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "old\n",
+		"multi.txt":   "multi\n",
+		"local.txt":   "local\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dst, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	g := &S3Getter{SyncMode: true}
+	u := testURL(srv.URL + "/bucket/dir?aws_access_key_id=id&aws_access_key_secret=secret")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, contents := range map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "new\n",
+		"multi.txt":   "multi\n",
+		"missing.txt": "missing\n",
+		"local.txt":   "local\n",
+	} {
+		assertContents(t, filepath.Join(dst, name), contents)
+	}
+
+	sort.Strings(read)
+	expected := []string{"dir/changed.txt", "dir/missing.txt", "dir/multi.txt"}
+	if !reflect.DeepEqual(read, expected) {
+		t.Fatalf("expected to read %q, read %q", expected, read)
+	}
+}
+
+func TestS3Getter_onFileComplete(t *testing.T) {
+	objects := map[string]string{
+		"dir/":          "",
+		"dir/a.txt":     "Hello\n",
+		"dir/sub/b.txt": "Hello, World\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bucket" || r.URL.Path == "/bucket/" {
+			var keys []string
+			for key := range objects {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>`)
+			for _, key := range keys {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, key, len(objects[key]))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		fmt.Fprint(w, objects[strings.TrimPrefix(r.URL.Path, "/bucket/")])
+	}))
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	var events []string
+	g := new(S3Getter)
+	g.SetClient(&Client{
+		Ctx: context.Background(),
+		OnFileComplete: func(name string, size int64) {
+			events = append(events, fmt.Sprintf("%s %d", name, size))
+		},
+	})
+	u := testURL(srv.URL + "/bucket/dir?aws_access_key_id=id&aws_access_key_secret=secret")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"dir/a.txt 6", "dir/sub/b.txt 13"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected %q, got %q", expected, events)
+	}
+}
+
+func TestS3Getter_multipart(t *testing.T) {
+	content := strings.Repeat("0123456789", 10)
+
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/large.bin" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "GET" {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "large.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	g := &S3Getter{PartSize: 16, MaxConcurrency: 3}
+	u := testURL(srv.URL + "/bucket/large.bin?aws_access_key_id=id&aws_access_key_secret=secret")
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, content)
+
+	sort.Strings(ranges)
+	expected := []string{
+		"bytes=0-15", "bytes=16-31", "bytes=32-47", "bytes=48-63",
+		"bytes=64-79", "bytes=80-95", "bytes=96-99",
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("expected the ranges %q, got %q", expected, ranges)
+	}
+}
+
+func TestS3Getter_getNoObjects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated></ListBucketResult>`)
+	}))
+	defer srv.Close()
+
+	u := testURL(srv.URL + "/bucket/missing?aws_access_key_id=id&aws_access_key_secret=secret")
+
+	// Nothing is downloaded by default, the created directories are removed
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "sub", "dst")
+	err := new(S3Getter).Get(dst, u)
+	if err == nil || !strings.Contains(err.Error(), "no objects found") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+	if _, err := os.Lstat(td); !os.IsNotExist(err) {
+		t.Fatalf("created directories should be removed: %v", err)
+	}
+
+	// AllowEmpty creates an empty destination
+	g := &S3Getter{AllowEmpty: true}
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fis, err := ioutil.ReadDir(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(fis) != 0 {
+		t.Fatalf("expected an empty directory, got %d entries", len(fis))
+	}
+}
+
+func TestS3Getter_pathMapper(t *testing.T) {
+	objects := map[string]string{
+		"dir/app.log":     "log\n",
+		"dir/readme.txt":  "readme\n",
+		"dir/scratch.tmp": "tmp\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bucket" || r.URL.Path == "/bucket/" {
+			var keys []string
+			for key := range objects {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>`)
+			for _, key := range keys {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size></Contents>`, key, len(objects[key]))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+			return
+		}
+		fmt.Fprint(w, objects[strings.TrimPrefix(r.URL.Path, "/bucket/")])
+	}))
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// The logs are routed to logs/, the temporary files skipped
+	g := &S3Getter{
+		PathMapper: func(name string) (string, bool) {
+			switch path.Ext(name) {
+			case ".log":
+				return "logs/" + path.Base(name), false
+			case ".tmp":
+				return "", true
+			}
+			return path.Base(name), false
+		},
+	}
+	u := testURL(srv.URL + "/bucket/dir?aws_access_key_id=id&aws_access_key_secret=secret")
+	if err := g.Get(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "logs", "app.log"), "log\n")
+	assertContents(t, filepath.Join(dst, "readme.txt"), "readme\n")
+	for _, name := range []string{"app.log", "scratch.tmp"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected not to exist: %v", name, err)
+		}
+	}
+}
+
+func TestS3Getter_hosts(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, "Hello\n")
+	}))
+	defer srv.Close()
+
+	// The credentials of the environment are used for the other hosts
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "envid",
+		"AWS_SECRET_ACCESS_KEY": "envsecret",
+		"AWS_SESSION_TOKEN":     "",
+	} {
+		defer tempEnv(t, k, v)()
+	}
+
+	config := HostConfig{AWSAccessKeyID: "hostid", AWSSecretAccessKey: "hostsecret"}
+	cases := []struct {
+		Name     string
+		Hosts    map[string]HostConfig
+		Expected string
+	}{
+		{"match", map[string]HostConfig{"127.0.0.1": config}, "Credential=hostid/"},
+		{"no match", map[string]HostConfig{"example.com": config}, "Credential=envid/"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := filepath.Join(tempDir(t), "file")
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			g := new(S3Getter)
+			g.SetClient(&Client{Ctx: context.Background(), Hosts: tc.Hosts})
+			if err := g.GetFile(dst, testURL(srv.URL+"/bucket/file")); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !strings.Contains(authorization, tc.Expected) {
+				t.Fatalf("expected %q in the authorization, got %q", tc.Expected, authorization)
+			}
+		})
+	}
+}
+
+func TestS3Getter_credentialProvider(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, "Hello\n")
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	provider := &testCredentialProvider{
+		aws: credentials.NewStaticCredentials("providerid", "providersecret", ""),
+	}
+	g := new(S3Getter)
+	g.SetClient(&Client{Ctx: context.Background(), Credentials: provider})
+	if err := g.GetFile(dst, testURL(srv.URL+"/bucket/file")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(authorization, "Credential=providerid/") {
+		t.Fatalf("expected the credentials of the provider, got %q", authorization)
+	}
+	if expected := []string{"127.0.0.1/bucket"}; !reflect.DeepEqual(provider.resources, expected) {
+		t.Fatalf("bad resources: %q, expected %q", provider.resources, expected)
+	}
+
+	// The credentials of the URL take precedence
+	provider.resources = nil
+	u := testURL(srv.URL + "/bucket/file?aws_access_key_id=urlid&aws_access_key_secret=urlsecret")
+	if err := g.GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(authorization, "Credential=urlid/") {
+		t.Fatalf("expected the credentials of the URL, got %q", authorization)
+	}
+	if len(provider.resources) != 0 {
+		t.Fatalf("expected the provider not to be called, got %q", provider.resources)
+	}
+}
+
+func TestS3Getter_requireAuth(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	// Hide the credentials of the environment
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY":              "",
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_KEY":              "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent",
+		"AWS_EC2_METADATA_DISABLED":   "true",
+		"AWS_METADATA_URL":            srv.URL,
+	} {
+		defer tempEnv(t, k, v)()
+	}
+
+	g := new(S3Getter)
+	g.SetClient(&Client{Ctx: context.Background(), RequireAuth: true})
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	err := g.Get(dst, testURL("https://s3.amazonaws.com/bucket/private"))
+	if err == nil || !strings.Contains(err.Error(), "no S3 credentials found") {
+		t.Fatalf("expected a credentials error, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no requests, got %d", requests)
+	}
+}
+
+func TestS3Getter_GetFile_directoryMarker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bucket/folder/", "/bucket/marker":
+			// Empty objects standing for directories
+			w.Header().Set("Content-Type", "application/x-directory; charset=UTF-8")
+			w.Header().Set("Content-Length", "0")
+		case "/bucket", "/bucket/":
+			fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>`+
+				`<Contents><Key>folder/</Key><Size>0</Size></Contents></ListBucketResult>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	g := new(S3Getter)
+	creds := "?aws_access_key_id=id&aws_access_key_secret=secret"
+	for _, key := range []string{"folder/", "marker"} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		err := g.GetFile(dst, testURL(srv.URL+"/bucket/"+key+creds))
+		if err == nil || !strings.Contains(err.Error(), "is a directory") {
+			t.Fatalf("%s: expected a directory error, got %v", key, err)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected no file, got %v", key, err)
+		}
+	}
+
+	mode, err := g.ClientMode(testURL(srv.URL + "/bucket/folder/" + creds))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mode != ClientModeDir {
+		t.Fatalf("expected dir mode, got %d", mode)
+	}
+}
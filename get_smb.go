@@ -0,0 +1,213 @@
+package getter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SMBGetter is a Getter implementation that will download a module from
+// an SMB/CIFS share, using the smbclient command. URLs have the form
+// smb://[[domain;]user[:password]@]host[:port]/share/path, without user
+// information the share is accessed anonymously.
+type SMBGetter struct {
+	getter
+}
+
+// withClient implements clientBinder.
+func (g *SMBGetter) withClient(c *Client) Getter {
+	cp := *g
+	cp.client = c
+	return &cp
+}
+
+func (g *SMBGetter) ClientMode(u *url.URL) (ClientMode, error) {
+	share, path, err := parseSMBURL(u)
+	if err != nil {
+		return 0, err
+	}
+	if path == "" {
+		// The root of the share
+		return ClientModeDir, nil
+	}
+
+	out, err := g.smbclient(u, share, fmt.Sprintf("allinfo %s", smbQuote(path)), true)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "attributes:") {
+			if attrs := strings.Fields(strings.TrimPrefix(line, "attributes:")); len(attrs) > 0 &&
+				strings.Contains(attrs[0], "D") {
+				return ClientModeDir, nil
+			}
+			return ClientModeFile, nil
+		}
+	}
+
+	// Let GetFile report a missing file
+	return ClientModeFile, nil
+}
+
+func (g *SMBGetter) Get(dst string, u *url.URL) error {
+	share, path, err := parseSMBURL(u)
+	if err != nil {
+		return err
+	}
+	if err := checkSMBDst(dst); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dst, g.dirMode()); err != nil {
+		return err
+	}
+
+	cmds := []string{"prompt OFF", "recurse ON"}
+	if path != "" {
+		cmds = append(cmds, "cd "+smbQuote(path))
+	}
+	cmds = append(cmds, "lcd "+smbQuote(dst), "mget *")
+	_, err = g.smbclient(u, share, strings.Join(cmds, "; "), false)
+	return err
+}
+
+func (g *SMBGetter) GetFile(dst string, u *url.URL) error {
+	share, path, err := parseSMBURL(u)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("SMB URL must reference a file: %s", redactURL(u))
+	}
+	if err := checkSMBDst(dst); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), g.dirMode()); err != nil {
+		return err
+	}
+
+	_, err = g.smbclient(u, share, fmt.Sprintf("get %s %s", smbQuote(path), smbQuote(dst)), false)
+	return err
+}
+
+// smbclient runs the smbclient commands cmds on share, authenticating with
+// the user information of u. If output is true, the standard output is
+// returned.
+func (g *SMBGetter) smbclient(u *url.URL, share, cmds string, output bool) ([]byte, error) {
+	if _, err := exec.LookPath("smbclient"); err != nil {
+		return nil, fmt.Errorf("smbclient must be available and on the PATH")
+	}
+
+	args := []string{fmt.Sprintf("//%s/%s", u.Hostname(), share)}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+
+	if u.User == nil {
+		args = append(args, "-N")
+	} else {
+		// Pass the credentials in a file so that they don't show in the
+		// process list.
+		authFile, err := smbAuthFile(u.User)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(authFile)
+		args = append(args, "-A", authFile)
+	}
+	args = append(args, "-c", cmds)
+
+	cmd := exec.CommandContext(g.Context(), "smbclient", args...)
+	if !output {
+		return nil, g.runCommand(cmd)
+	}
+
+	g.logf("running %s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("smbclient exited with an error: %s%s", exiterr.Stderr, out)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// smbAuthFile writes the credentials of user to a temporary smbclient
+// authentication file and returns its path. user is "[domain;]name".
+func smbAuthFile(user *url.Userinfo) (string, error) {
+	var content strings.Builder
+	name := user.Username()
+	if idx := strings.Index(name, ";"); idx > -1 {
+		fmt.Fprintf(&content, "domain = %s\n", name[:idx])
+		name = name[idx+1:]
+	}
+	fmt.Fprintf(&content, "username = %s\n", name)
+	if password, ok := user.Password(); ok {
+		fmt.Fprintf(&content, "password = %s\n", password)
+	}
+
+	fh, err := ioutil.TempFile("", "go-getter")
+	if err != nil {
+		return "", err
+	}
+
+	// Set the permissions prior to writing the credentials.
+	if err := os.Chmod(fh.Name(), 0600); err != nil {
+		fh.Close()
+		os.Remove(fh.Name())
+		return "", err
+	}
+
+	_, err = fh.WriteString(content.String())
+	fh.Close()
+	if err != nil {
+		os.Remove(fh.Name())
+		return "", err
+	}
+	return fh.Name(), nil
+}
+
+// parseSMBURL returns the share and the path within the share of u.
+func parseSMBURL(u *url.URL) (share, path string, err error) {
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("URL is not a valid SMB URL: missing host")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	share = parts[0]
+	if share == "" {
+		return "", "", fmt.Errorf("URL is not a valid SMB URL: missing share")
+	}
+	if len(parts) == 2 {
+		path = strings.Trim(parts[1], "/")
+	}
+
+	if containsDotDot(path) {
+		return "", "", fmt.Errorf("SMB path contains '..': %s", path)
+	}
+	if strings.ContainsAny(share+path, "\";") {
+		return "", "", fmt.Errorf("SMB path cannot contain '\"' or ';': %s", path)
+	}
+	return share, path, nil
+}
+
+// smbQuote quotes path for a smbclient command. path must not contain '"'
+// or ';', see parseSMBURL.
+func smbQuote(path string) string {
+	return `"` + path + `"`
+}
+
+// checkSMBDst checks that dst can be used in a smbclient command.
+func checkSMBDst(dst string) error {
+	if strings.ContainsAny(dst, "\";") {
+		return fmt.Errorf("SMB destination cannot contain '\"' or ';': %s", dst)
+	}
+	return nil
+}
@@ -1,10 +1,23 @@
 package getter
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGet_badSchema(t *testing.T) {
@@ -134,6 +147,40 @@ func TestGet_archive(t *testing.T) {
 	}
 }
 
+func TestGet_archiveShorthand(t *testing.T) {
+	contents := func(ext string) map[string]string {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		u, _ := filepath.Abs(filepath.Join("./test-fixtures", "archive."+ext))
+		if err := Get(dst, u); err != nil {
+			t.Fatalf("%s: err: %s", ext, err)
+		}
+
+		result := make(map[string]string)
+		err := filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			raw, err := ioutil.ReadFile(path)
+			result[path[len(dst):]] = string(raw)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", ext, err)
+		}
+		return result
+	}
+
+	expected := contents("tar.gz")
+	if len(expected) == 0 {
+		t.Fatal("expected files in the tar.gz archive")
+	}
+	if actual := contents("tgz"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("tgz extracted %#v, expected %#v", actual, expected)
+	}
+}
+
 func TestGetAny_archive(t *testing.T) {
 	dst := tempDir(t)
 	u := filepath.Join("./test-fixtures", "archive.tar.gz")
@@ -176,15 +223,661 @@ func TestGet_archiveSubdirWild(t *testing.T) {
 	}
 }
 
-func TestGet_archiveSubdirWildMultiMatch(t *testing.T) {
-	dst := tempDir(t)
-	u := testModule("archive-rooted-multi/archive.tar.gz")
-	u += "//*"
-	if err := Get(dst, u); err == nil {
-		t.Fatal("should error")
-	} else if !strings.Contains(err.Error(), "multiple") {
+func TestGet_archiveSubdirWildMultiMatch(t *testing.T) {
+	dst := tempDir(t)
+	u := testModule("archive-rooted-multi/archive.tar.gz")
+	u += "//*"
+	if err := Get(dst, u); err == nil {
+		t.Fatal("should error")
+	} else if !strings.Contains(err.Error(), "multiple") {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGet_archiveSubdirNested(t *testing.T) {
+	for _, subDir := range []string{"top/sub", "top/sub/", "top/s*b"} {
+		t.Run(subDir, func(t *testing.T) {
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+			u := testModule("decompress-tgz/nested_dir.tar.gz") + "//" + subDir
+
+			if err := Get(dst, u); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			// The contents of the subdir are placed directly in dst
+			assertContents(t, filepath.Join(dst, "a.txt"), "a\n")
+			assertContents(t, filepath.Join(dst, "deep", "b.txt"), "b\n")
+			for _, name := range []string{"top", "sub", "other.txt", "subway.txt"} {
+				if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+					t.Fatalf("%s: expected not to exist: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGet_archiveCanceled(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &Client{
+		Ctx:  ctx,
+		Src:  testModule("decompress-tgz/nested_dir.tar.gz"),
+		Dst:  dst,
+		Mode: ClientModeDir,
+		FS:   &cancelFS{FS: OSFS, cancel: cancel},
+	}
+	if err := client.Get(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// The partially extracted output is removed
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected dst to be removed: %v", err)
+	}
+}
+
+func TestGet_sniffArchives(t *testing.T) {
+	cases := []struct {
+		Fixture string
+		Mode    ClientMode
+		Path    string
+	}{
+		{"decompress-tgz/single.tar.gz", ClientModeAny, "file"},
+		{"decompress-tbz2/single.tar.bz2", ClientModeAny, "file"},
+		{"decompress-txz/single.tar.xz", ClientModeAny, "file"},
+		{"decompress-zip/single.zip", ClientModeAny, "file"},
+		{"decompress-gz/single.gz", ClientModeFile, ""},
+		{"decompress-bz2/single.bz2", ClientModeFile, ""},
+		{"decompress-xz/single.xz", ClientModeFile, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Fixture, func(t *testing.T) {
+			// The source has no extension
+			src := filepath.Join(tempDir(t), "download")
+			defer os.RemoveAll(filepath.Dir(src))
+			copyTestFile(t, src, filepath.Join(fixtureDir, tc.Fixture))
+
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+			client := &Client{
+				Src:           src,
+				Dst:           dst,
+				Mode:          tc.Mode,
+				SniffArchives: true,
+			}
+			if err := client.Get(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, filepath.Join(dst, tc.Path), "foo\n")
+		})
+	}
+}
+
+func TestGet_sniffArchivesPlainFile(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	client := &Client{
+		Src:           testModule("basic-file/foo.txt"),
+		Dst:           dst,
+		Mode:          ClientModeFile,
+		SniffArchives: true,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	// The archive parameter disables sniffing
+	src := filepath.Join(tempDir(t), "download")
+	defer os.RemoveAll(filepath.Dir(src))
+	copyTestFile(t, src, filepath.Join(fixtureDir, "decompress-gz/single.gz"))
+	client.Src = src + "?archive=false"
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join(fixtureDir, "decompress-gz/single.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, string(expected))
+}
+
+func TestGet_archiveSubdirDotDot(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	u := testModule("decompress-tgz/nested_dir.tar.gz") + "//top/../.."
+
+	if err := Get(dst, u); err == nil || !strings.Contains(err.Error(), "'..'") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+func TestGet_flattenArchive(t *testing.T) {
+	// An existing destination is merged into
+	existing := tempDir(t)
+	defer os.RemoveAll(existing)
+	if err := os.MkdirAll(existing, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, dst := range []string{tempDir(t), existing} {
+		defer os.RemoveAll(dst)
+
+		c := &Client{
+			Src:            testModule("archive-rooted/archive.tar.gz"),
+			Dst:            dst,
+			Dir:            true,
+			FlattenArchive: true,
+		}
+		if err := c.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		assertContents(t, filepath.Join(dst, "hello.txt"), "hello\n")
+		if _, err := os.Stat(filepath.Join(dst, "root")); !os.IsNotExist(err) {
+			t.Fatalf("expected the top-level directory to be flattened: %v", err)
+		}
+	}
+}
+
+func TestGet_flattenArchiveMulti(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// Several top-level directories are kept
+	c := &Client{
+		Src:            testModule("archive-rooted-multi/archive.tar.gz"),
+		Dst:            dst,
+		Dir:            true,
+		FlattenArchive: true,
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, p := range []string{"root/hello.txt", "root2/hello.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, p)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func TestGet_extractToNamedDir(t *testing.T) {
+	archive, err := filepath.Abs(filepath.Join(fixtureDir, "decompress-tgz", "multiple_dir.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	split := testSplitArchive(t, ".001", ".002")
+	defer os.RemoveAll(filepath.Dir(split))
+
+	cases := []struct {
+		Src      string
+		Expected map[string]string
+	}{
+		{archive, map[string]string{"multiple_dir/test1": "Hello\n", "multiple_dir/dir/test2": "Hello\n"}},
+		{archive + "//dir", map[string]string{"multiple_dir/test2": "Hello\n"}},
+		{split + ".001", map[string]string{"multiple_dir/test1": "Hello\n", "multiple_dir/dir/test2": "Hello\n"}},
+	}
+
+	for _, tc := range cases {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		c := &Client{
+			Src:               tc.Src,
+			Dst:               dst,
+			Dir:               true,
+			ExtractToNamedDir: true,
+		}
+		if err := c.Get(); err != nil {
+			t.Fatalf("%s: err: %s", tc.Src, err)
+		}
+
+		fis, err := ioutil.ReadDir(dst)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(fis) != 1 || fis[0].Name() != "multiple_dir" {
+			t.Fatalf("%s: expected only the named directory in dst, got %v", tc.Src, fis)
+		}
+		for p, contents := range tc.Expected {
+			assertContents(t, filepath.Join(dst, filepath.FromSlash(p)), contents)
+		}
+	}
+}
+
+func TestGet_expandEnv(t *testing.T) {
+	defer tempEnv(t, "GETTER_TEST_MODULE", "basic")()
+
+	dst := tempDir(t)
+	client := &Client{
+		Src:       testModule("${GETTER_TEST_MODULE}"),
+		Dst:       dst,
+		Dir:       true,
+		ExpandEnv: true,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGet_expandEnvUnset(t *testing.T) {
+	os.Unsetenv("GETTER_TEST_UNSET")
+
+	// Unset variables expand to the empty string
+	dst := tempDir(t)
+	client := &Client{
+		Src:       testModule("basic${GETTER_TEST_UNSET}"),
+		Dst:       dst,
+		Dir:       true,
+		ExpandEnv: true,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mainPath := filepath.Join(dst, "main.tf")
+	if _, err := os.Stat(mainPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGet_expandEnvDisabled(t *testing.T) {
+	defer tempEnv(t, "GETTER_TEST_MODULE", "basic")()
+
+	// Without ExpandEnv, the reference is used literally
+	dst := tempDir(t)
+	client := &Client{
+		Src: testModule("${GETTER_TEST_MODULE}"),
+		Dst: dst,
+		Dir: true,
+	}
+	if err := client.Get(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestGet_tmpDir(t *testing.T) {
+	tmp := tempDir(t)
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// A subdir is downloaded under TmpDir before being copied
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+	g := &MockGetter{Proxy: new(FileGetter)}
+	c := &Client{
+		Src:     "mock::" + testModule("basic") + "//subdir",
+		Dst:     dst,
+		Dir:     true,
+		TmpDir:  tmp,
+		Getters: map[string]Getter{"mock": g},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(g.GetDst, tmp+string(filepath.Separator)) {
+		t.Fatalf("expected the download to be staged under %s, got %s", tmp, g.GetDst)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "sub.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// An archive is downloaded under TmpDir before being decompressed
+	dst = tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	d := &testTmpDirDecompressor{Decompressor: new(TarGzipDecompressor)}
+	c = &Client{
+		Src:           testModule("basic-file-archive/archive.tar.gz"),
+		Dst:           dst,
+		TmpDir:        tmp,
+		Decompressors: map[string]Decompressor{"tar.gz": d},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.HasPrefix(d.src, tmp+string(filepath.Separator)) {
+		t.Fatalf("expected the archive to be staged under %s, got %s", tmp, d.src)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	// Nothing is left behind
+	if fis, err := ioutil.ReadDir(tmp); err != nil || len(fis) != 0 {
+		t.Fatalf("expected an empty TmpDir, got %d entries (%v)", len(fis), err)
+	}
+}
+
+// testTmpDirDecompressor records the path of the archive it decompresses.
+type testTmpDirDecompressor struct {
+	Decompressor
+	src string
+}
+
+func (d *testTmpDirDecompressor) Decompress(dst, src string, dir bool) error {
+	d.src = src
+	return d.Decompressor.Decompress(dst, src, dir)
+}
+
+func TestGet_merge(t *testing.T) {
+	for _, merge := range []bool{true, false} {
+		dst := tempDir(t)
+		defer os.RemoveAll(dst)
+
+		for _, src := range []string{
+			testModule("basic") + "//subdir",
+			testModule("basic-subdir") + "//foo",
+		} {
+			c := &Client{Src: src, Dst: dst, Dir: true, Merge: merge}
+			if err := c.Get(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(dst, "sub", "main.tf")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		_, err := os.Stat(filepath.Join(dst, "sub.tf"))
+		if merge && err != nil {
+			t.Fatalf("expected the first source to be kept: %s", err)
+		}
+		if !merge && !os.IsNotExist(err) {
+			t.Fatalf("expected the first source to be removed, got %v", err)
+		}
+	}
+}
+
+func TestGet_umask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows since the test checks unix modes")
+	}
+
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// "e" is implied by "e/f"
+	src := filepath.Join(td, "archive.tar.gz")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range []*tar.Header{
+		{Name: "d/", Typeflag: tar.TypeDir, Mode: 0777},
+		{Name: "d/a", Mode: 0777},
+		{Name: "b", Mode: 0600},
+		{Name: "e/f", Mode: 0666},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	f.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	c := &Client{Src: src, Dst: dst, Dir: true, Umask: 0002}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, expected := range map[string]os.FileMode{
+		"d":   os.ModeDir | 0775,
+		"d/a": 0775,
+		"b":   0600,
+		"e":   os.ModeDir | 0775,
+		"e/f": 0664,
+	} {
+		fi, err := os.Stat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Mode() != expected {
+			t.Fatalf("%s: expected mode %s, got %s", name, expected, fi.Mode())
+		}
+	}
+}
+
+func TestGetFile_umask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows since the test checks unix modes")
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	c := &Client{
+		Src:   testModule("decompress-gz/single.gz"),
+		Dst:   dst,
+		Mode:  ClientModeFile,
+		Umask: 0002,
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode() != 0664 {
+		t.Fatalf("expected mode 0664, got %s", fi.Mode())
+	}
+}
+
+func TestGet_dirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows since the test checks unix modes")
+	}
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	// The parents of a file
+	dst := filepath.Join(td, "a", "b", "file")
+	c := &Client{
+		Src:     testModule("basic-file/foo.txt"),
+		Dst:     dst,
+		Mode:    ClientModeFile,
+		DirMode: 0700,
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The directories implied by the entries of an archive
+	c = &Client{
+		Src:     testModule("decompress-zip/subdir_missing_dir.zip"),
+		Dst:     filepath.Join(td, "c", "archive"),
+		Mode:    ClientModeDir,
+		DirMode: 0700,
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, name := range []string{"a", "a/b", "c", "c/archive/subdir"} {
+		fi, err := os.Stat(filepath.Join(td, name))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Mode() != os.ModeDir|0700 {
+			t.Fatalf("%s: expected mode %s, got %s", name, os.ModeDir|0700, fi.Mode())
+		}
+	}
+}
+
+func TestGetFile_fileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping on windows since the test checks unix modes")
+	}
+
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+
+	srcs := map[string]string{
+		"http": fmt.Sprintf("http://%s/file", ln.Addr().String()),
+		"gz":   testModule("decompress-gz/single.gz"),
+	}
+	for name, src := range srcs {
+		dst := filepath.Join(td, name)
+		c := &Client{
+			Src:      src,
+			Dst:      dst,
+			Mode:     ClientModeFile,
+			FileMode: 0600,
+		}
+		if err := c.Get(); err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		fi, err := os.Stat(dst)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if fi.Mode() != 0600 {
+			t.Fatalf("%s: expected mode %s, got %s", name, os.FileMode(0600), fi.Mode())
+		}
+	}
+
+	// The source of a symlink is left alone
+	src := testModule("basic-file/foo.txt")
+	before, err := os.Stat(testModuleURL("basic-file/foo.txt").Path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	c := &Client{
+		Src:      src,
+		Dst:      filepath.Join(td, "link"),
+		Mode:     ClientModeFile,
+		FileMode: 0600,
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	after, err := os.Stat(filepath.Join(td, "link"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if after.Mode() != before.Mode() {
+		t.Fatalf("expected mode %s, got %s", before.Mode(), after.Mode())
+	}
+}
+
+func TestGet_concurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer srv.Close()
+
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	// The copies of base share its getters and decompressors, each download
+	// must still use the settings of its own client.
+	base := Client{
+		Getters:       Getters,
+		Decompressors: Decompressors,
+	}
+
+	const n = 8
+	errs := make(chan error, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		file := base
+		file.Src = srv.URL + "/file"
+		file.Dst = filepath.Join(td, fmt.Sprintf("file-%d", i))
+		file.Mode = ClientModeFile
+		file.UserAgent = fmt.Sprintf("agent-%d", i)
+
+		dir := base
+		dir.Src = testModule("basic-tgz")
+		dir.Dst = filepath.Join(td, fmt.Sprintf("dir-%d", i))
+		dir.Mode = ClientModeAny
+
+		for _, c := range []*Client{&file, &dir} {
+			wg.Add(1)
+			go func(c *Client) {
+				defer wg.Done()
+				errs <- c.Get()
+			}(c)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		assertContents(t, filepath.Join(td, fmt.Sprintf("file-%d", i)), fmt.Sprintf("agent-%d", i))
+		if _, err := os.Stat(filepath.Join(td, fmt.Sprintf("dir-%d", i), "main.tf")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+// wrappedFileGetter overrides GetFile of the FileGetter it embeds.
+type wrappedFileGetter struct {
+	*FileGetter
+	calls int
+}
+
+func (g *wrappedFileGetter) GetFile(dst string, u *url.URL) error {
+	g.calls++
+	return g.FileGetter.GetFile(dst, u)
+}
+
+func TestGetFile_embeddedGetter(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The getter embeds a built-in getter but isn't one: it isn't copied
+	// without its GetFile
+	g := &wrappedFileGetter{FileGetter: new(FileGetter)}
+	client := &Client{
+		Src:     testModule("basic-file/foo.txt"),
+		Dst:     dst,
+		Mode:    ClientModeFile,
+		Getters: map[string]Getter{"file": g},
+	}
+	if err := client.Get(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
+	assertContents(t, dst, "Hello\n")
+	if g.calls != 1 {
+		t.Fatalf("expected the wrapper to be called once, got %d", g.calls)
+	}
+	if g.client != client {
+		t.Fatal("the client of the wrapper should be set")
+	}
 }
 
 func TestGetAny_file(t *testing.T) {
@@ -236,6 +929,111 @@ func TestGetFile(t *testing.T) {
 	assertContents(t, dst, "Hello\n")
 }
 
+func TestGetFile_stdout(t *testing.T) {
+	var buf bytes.Buffer
+	client := &Client{
+		Src:    testModule("basic-file/foo.txt") + "?checksum=md5:09f7e02f1290be211da707a266f153b3",
+		Dst:    StdoutDst,
+		Mode:   ClientModeFile,
+		Stdout: &buf,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if buf.String() != "Hello\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+	if _, err := os.Lstat(StdoutDst); !os.IsNotExist(err) {
+		t.Fatalf("expected no file named %q: %v", StdoutDst, err)
+	}
+
+	// Directories can't be written to stdout
+	client = &Client{
+		Src:    testModule("basic"),
+		Dst:    StdoutDst,
+		Mode:   ClientModeDir,
+		Stdout: &buf,
+	}
+	if err := client.Get(); err == nil || !strings.Contains(err.Error(), "single file") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+func TestGetFile_stdoutInterceptOnce(t *testing.T) {
+	var buf bytes.Buffer
+	var calls int
+	client := &Client{
+		Src:    testModule("basic-file/foo.txt") + "?checksum=md5:09f7e02f1290be211da707a266f153b3",
+		Dst:    StdoutDst,
+		Mode:   ClientModeFile,
+		Stdout: &buf,
+		Interceptor: func(u *url.URL) (*url.URL, error) {
+			calls++
+			return u, nil
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if buf.String() != "Hello\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	// The download to a temporary file reuses the resolved source
+	if calls != 1 {
+		t.Fatalf("expected the interceptor to be called once, got %d", calls)
+	}
+	if client.Dst != StdoutDst || client.Mode != ClientModeFile {
+		t.Fatalf("expected the client to be restored, got %q, %v", client.Dst, client.Mode)
+	}
+}
+
+// notifyWriter is a buffer closing written once it is first written to.
+type notifyWriter struct {
+	buf     bytes.Buffer
+	once    sync.Once
+	written chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.written) })
+	return w.buf.Write(p)
+}
+
+func TestGetFile_stdoutStream(t *testing.T) {
+	w := &notifyWriter{written: make(chan struct{})}
+	streamed := true
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello\n"))
+		rw.(http.Flusher).Flush()
+
+		// The first bytes reach the writer before the download completes
+		select {
+		case <-w.written:
+		case <-time.After(5 * time.Second):
+			streamed = false
+		}
+		rw.Write([]byte("World\n"))
+	}))
+	defer srv.Close()
+
+	client := &Client{
+		Src:    srv.URL + "/file.txt",
+		Dst:    StdoutDst,
+		Mode:   ClientModeFile,
+		Stdout: w,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if w.buf.String() != "Hello\nWorld\n" {
+		t.Fatalf("bad: %q", w.buf.String())
+	}
+	if !streamed {
+		t.Fatal("expected the file to be streamed to the writer")
+	}
+}
+
 func TestGetFile_archive(t *testing.T) {
 	dst := tempTestFile(t)
 	defer os.RemoveAll(filepath.Dir(dst))
@@ -249,6 +1047,26 @@ func TestGetFile_archive(t *testing.T) {
 	assertContents(t, dst, "Hello\n")
 }
 
+func TestGetFile_xz(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testModule("decompress-xz/single.xz")
+
+	if err := GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A plain xz file decompresses to dst itself, without a tar wrapper
+	assertContents(t, dst, "foo\n")
+
+	// It can't be unpacked to a directory
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := Get(dir, u+"?archive=xz"); err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestGetFile_archiveChecksum(t *testing.T) {
 	dst := tempTestFile(t)
 	defer os.RemoveAll(filepath.Dir(dst))
@@ -281,6 +1099,146 @@ func TestGetFile_archiveNoUnarchive(t *testing.T) {
 	}
 }
 
+func TestGetFile_archiveSubdir(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testModule("decompress-tgz/multiple_dir.tar.gz")
+	u += "//dir/test2"
+
+	if err := GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestGetFile_archiveSubdirWild(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testModule("decompress-tgz/multiple_dir.tar.gz")
+	u += "//dir/test*"
+
+	if err := GetFile(dst, u); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestGetFile_archiveSubdirBad(t *testing.T) {
+	cases := map[string]string{
+		"missing":   "//nope.txt",
+		"directory": "//dir",
+	}
+
+	for name, subDir := range cases {
+		t.Run(name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+			u := testModule("decompress-tgz/multiple_dir.tar.gz") + subDir
+
+			if err := GetFile(dst, u); err == nil {
+				t.Fatal("should error")
+			} else if !strings.Contains(err.Error(), "archive") {
+				t.Fatalf("err: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetFile_decompressorsNil(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	client := &Client{
+		Src: testModule("basic-file-archive/archive.tar.gz"),
+		Dst: dst,
+		Dir: false,
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The defaults are used
+	assertContents(t, dst, "Hello\n")
+	if !reflect.DeepEqual(client.Decompressors, Decompressors) {
+		t.Fatalf("expected default decompressors, got: %#v", client.Decompressors)
+	}
+
+	// Changing the client's decompressors must not change the defaults
+	delete(client.Decompressors, "tar.gz")
+	if _, ok := Decompressors["tar.gz"]; !ok {
+		t.Fatal("default decompressors were modified")
+	}
+}
+
+func TestGetFile_decompressorsPartial(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Decompressors map[string]Decompressor
+		Unarchived    bool
+	}{
+		{
+			"only tar.gz",
+			map[string]Decompressor{"tar.gz": new(TarGzipDecompressor)},
+			true,
+		},
+		{
+			"only zip",
+			map[string]Decompressor{"zip": new(ZipDecompressor)},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			client := &Client{
+				Src:           testModule("basic-file-archive/archive.tar.gz"),
+				Dst:           dst,
+				Dir:           false,
+				Decompressors: tc.Decompressors,
+			}
+			if err := client.Get(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			if tc.Unarchived {
+				assertContents(t, dst, "Hello\n")
+			} else if actual := testMD5(t, dst); actual != "fbd90037dacc4b1ab40811d610dde2f0" {
+				t.Fatalf("expected the archive to be left as is, got md5: %s", actual)
+			}
+		})
+	}
+}
+
+func TestGetFile_decompressorsEmpty(t *testing.T) {
+	for _, src := range []string{
+		testModule("basic-file-archive/archive.tar.gz"),
+		testModule("basic-file-archive/archive.tar.gz") + "?archive=tar.gz",
+	} {
+		dst := tempTestFile(t)
+		defer os.RemoveAll(filepath.Dir(dst))
+
+		client := &Client{
+			Src:           src,
+			Dst:           dst,
+			Dir:           false,
+			Decompressors: map[string]Decompressor{},
+		}
+		if err := client.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// Nothing is decompressed
+		if actual := testMD5(t, dst); actual != "fbd90037dacc4b1ab40811d610dde2f0" {
+			t.Fatalf("%s: expected the archive to be left as is, got md5: %s", src, actual)
+		}
+	}
+}
+
 func TestGetFile_checksum(t *testing.T) {
 	cases := []struct {
 		Append string
@@ -358,6 +1316,14 @@ func TestGetFile_checksum(t *testing.T) {
 				t.Fatalf("append: %s\n\nerr: %s", tc.Append, err)
 			}
 
+			if tc.Err {
+				// A file with a bad checksum is removed
+				if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+					t.Fatalf("append: %s\n\nexpected dst to be removed: %v", tc.Append, err)
+				}
+				return
+			}
+
 			// Verify the main file exists
 			assertContents(t, dst, "Hello\n")
 		}()
@@ -398,7 +1364,7 @@ func TestGetFile_checksum_from_file(t *testing.T) {
 		},
 		{
 			"?checksum=file:" + httpChecksums.URL + "/md5-bsd-wrong.sum",
-			true,
+			false,
 			true,
 		},
 
@@ -470,6 +1436,64 @@ func TestGetFile_checksumURL(t *testing.T) {
 	}
 }
 
+func TestGetFile_computeChecksums(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	c := &Client{
+		Src:              testModule("basic-file/foo.txt"),
+		Dst:              dst,
+		Mode:             ClientModeFile,
+		ComputeChecksums: []string{"sha256", "MD5"},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &FileChecksums{
+		Path: dst,
+		Digests: map[string]string{
+			"sha256": "66a045b452102c59d840ec097d59d9467e13a3f34f6494e539ffd32c1bb35f18",
+			"md5":    "09f7e02f1290be211da707a266f153b3",
+		},
+	}
+	if !reflect.DeepEqual(c.ComputedChecksums, expected) {
+		t.Fatalf("bad checksums: %#v", c.ComputedChecksums)
+	}
+
+	// Unknown types are rejected before downloading
+	os.Remove(dst)
+	c.ComputeChecksums = []string{"crc32"}
+	if err := c.Get(); err == nil {
+		t.Fatal("should error")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected no download, got %v", err)
+	}
+}
+
+func TestGetFile_computeChecksumsArchive(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	c := &Client{
+		Src:              testModule("basic-file-archive/archive.tar.gz"),
+		Dst:              dst,
+		Mode:             ClientModeFile,
+		ComputeChecksums: []string{"sha256"},
+	}
+	if err := c.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+
+	// The archive is checksummed, not its content
+	expected := "00f9922e0129afd630870014701f6cc72d0b03ab6d120e827b77cc4e9e58785b"
+	if actual := c.ComputedChecksums.Digests["sha256"]; actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+}
+
 func TestGetFile_filename(t *testing.T) {
 	dst := tempDir(t)
 	u := testModule("basic-file/foo.txt")
@@ -486,6 +1510,79 @@ func TestGetFile_filename(t *testing.T) {
 	}
 }
 
+func TestGetFile_checksumMismatchRemoves(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+	u := testModule("basic-file/foo.txt") + "?checksum=md5:09f7e02f1290be211da707a266f153b4"
+
+	client := &Client{
+		Src: u,
+		Dst: dst,
+		Dir: false,
+		Getters: map[string]Getter{
+			"file": &FileGetter{Copy: true},
+		},
+	}
+
+	err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "Checksums did not match") {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected dst to be removed, got %v", err)
+	}
+}
+
+// testRewriteGetter downloads "Hello\n" through Copy and then overwrites
+// the file, so that the checksum only matches when verified while copying.
+type testRewriteGetter struct {
+	getter
+}
+
+func (g *testRewriteGetter) Get(string, *url.URL) error {
+	return fmt.Errorf("not supported")
+}
+
+func (g *testRewriteGetter) GetFile(dst string, u *url.URL) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := Copy(g.Context(), f, strings.NewReader("Hello\n")); err != nil {
+		return err
+	}
+	_, err = f.WriteAt([]byte("J"), 0)
+	return err
+}
+
+func (g *testRewriteGetter) ClientMode(*url.URL) (ClientMode, error) {
+	return ClientModeFile, nil
+}
+
+func TestGetFile_checksumStreamed(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	client := &Client{
+		Src: "rewrite://foo.txt?checksum=md5:09f7e02f1290be211da707a266f153b3",
+		Dst: dst,
+		Dir: false,
+		Getters: map[string]Getter{
+			"rewrite": new(testRewriteGetter),
+		},
+	}
+
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// The file wasn't read again after the download
+	assertContents(t, dst, "Jello\n")
+}
+
 func TestGetFile_checksumSkip(t *testing.T) {
 	dst := tempTestFile(t)
 	defer os.RemoveAll(filepath.Dir(dst))
@@ -522,3 +1619,72 @@ func TestGetFile_checksumSkip(t *testing.T) {
 		t.Fatalf("get should not have been called")
 	}
 }
+
+func TestGetFile_interceptorRewrite(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foo.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "mirrored")
+	}))
+	defer mirror.Close()
+	mirrorURL, err := url.Parse(mirror.URL)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	client := &Client{
+		Src: "https://public.example.com/foo.txt",
+		Dst: dst,
+		Dir: false,
+		Interceptor: func(u *url.URL) (*url.URL, error) {
+			if u.Host != "public.example.com" {
+				return u, nil
+			}
+			nu := *u
+			nu.Scheme = mirrorURL.Scheme
+			nu.Host = mirrorURL.Host
+			return &nu, nil
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	assertContents(t, dst, "mirrored")
+}
+
+func TestGetFile_interceptorBlock(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	getter := &MockGetter{Proxy: new(HttpGetter)}
+	client := &Client{
+		Src: "https://blocked.example.com/foo.txt",
+		Dst: dst,
+		Dir: false,
+		Getters: map[string]Getter{
+			"https": getter,
+		},
+		Interceptor: func(u *url.URL) (*url.URL, error) {
+			if u.Host == "blocked.example.com" {
+				return nil, fmt.Errorf("host %q is not allowed", u.Host)
+			}
+			return u, nil
+		},
+	}
+	err := client.Get()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("bad: %s", err)
+	}
+	if getter.GetFileCalled {
+		t.Fatal("get should not have been called")
+	}
+}
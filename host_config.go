@@ -0,0 +1,94 @@
+package getter
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// HostConfig is the configuration applied to the requests sent to a host,
+// see Client.Hosts. The credentials given in the source URL always take
+// precedence over the ones of the HostConfig.
+type HostConfig struct {
+	// Header is added to the requests of the HTTP and GCS getters. The
+	// fields already set on a request, e.g. by HttpGetter.Header, are kept.
+	Header http.Header
+
+	// Username and Password are the basic authentication credentials of
+	// the HTTP getter, and of the Git getter for HTTP(S) remotes.
+	Username string
+	Password string
+
+	// AWSAccessKeyID, AWSSecretAccessKey and AWSSessionToken are the
+	// credentials of the S3 getter.
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+}
+
+// matchHostConfig returns the configuration of host, without its port: the
+// one of the longest key of hosts that is either host or one of its parent
+// domains, e.g. "example.com" matches "example.com" and
+// "releases.example.com". Host names are compared case-insensitively.
+func matchHostConfig(hosts map[string]HostConfig, host string) (HostConfig, bool) {
+	host = strings.ToLower(host)
+
+	var match string
+	var config HostConfig
+	found := false
+	for k, v := range hosts {
+		k = strings.ToLower(strings.TrimPrefix(k, "."))
+		if k == "" || (host != k && !strings.HasSuffix(host, "."+k)) {
+			continue
+		}
+		if !found || len(k) > len(match) {
+			match, config, found = k, v, true
+		}
+	}
+	return config, found
+}
+
+// addHeader adds the fields of c.Header that req doesn't set already.
+func (c HostConfig) addHeader(req *http.Request) {
+	for k, v := range c.Header {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		if _, ok := req.Header[k]; !ok {
+			req.Header[k] = v
+		}
+	}
+}
+
+// hostConfigTransport is an http.RoundTripper adding the headers configured
+// for the host of each request, in hosts or else by helper, to the requests
+// sent through base. Being applied to each request, including the ones
+// following a redirect, the configuration of a host is never sent to
+// another one.
+type hostConfigTransport struct {
+	base   http.RoundTripper
+	hosts  map[string]HostConfig
+	helper *CredentialHelper
+
+	// basicAuth also sets the Username and Password of the host as the
+	// basic authentication of the requests not authenticated already.
+	basicAuth bool
+}
+
+func (t *hostConfigTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hc, ok := matchHostConfig(t.hosts, req.URL.Hostname())
+	if !ok && t.helper != nil {
+		var err error
+		if hc, ok, err = t.helper.hostConfig(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	auth := t.basicAuth && hc.Username != "" && req.URL.User == nil && req.Header.Get("Authorization") == ""
+	if ok && (len(hc.Header) > 0 || auth) {
+		// A RoundTripper must not modify the request
+		req = req.Clone(req.Context())
+		hc.addHeader(req)
+		if auth {
+			req.SetBasicAuth(hc.Username, hc.Password)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
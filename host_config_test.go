@@ -0,0 +1,35 @@
+package getter
+
+import "testing"
+
+func TestMatchHostConfig(t *testing.T) {
+	hosts := map[string]HostConfig{
+		"example.com":          {Username: "example"},
+		"releases.example.com": {Username: "releases"},
+		".Other.org":           {Username: "other"},
+	}
+
+	cases := []struct {
+		Host     string
+		Expected string
+	}{
+		{"example.com", "example"},
+		{"www.example.com", "example"},
+		{"releases.example.com", "releases"},
+		{"eu.releases.example.com", "releases"},
+		{"RELEASES.example.com", "releases"},
+		{"other.org", "other"},
+		{"www.other.org", "other"},
+		{"notexample.com", ""},
+		{"example.com.evil.net", ""},
+		{"com", ""},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		config, ok := matchHostConfig(hosts, tc.Host)
+		if ok != (tc.Expected != "") || config.Username != tc.Expected {
+			t.Fatalf("%q: bad: %q %t, expected %q", tc.Host, config.Username, ok, tc.Expected)
+		}
+	}
+}
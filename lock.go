@@ -0,0 +1,147 @@
+package getter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	urlhelper "github.com/hashicorp/go-getter/helper/url"
+)
+
+// Lock records exactly what the entries of a manifest downloaded, e.g. to
+// download them again reproducibly. See NewLock.
+type Lock struct {
+	Entries []LockEntry `json:"entries"`
+}
+
+// LockEntry records the download of a ManifestEntry.
+type LockEntry struct {
+	// Dest and Mode are the ones of the entry.
+	Dest string `json:"dest"`
+	Mode string `json:"mode,omitempty"`
+
+	// URL is the source of the entry as resolved, see ResolvedSource,
+	// without its checksum parameter and its credentials: the password or
+	// token of the URL and the query parameters holding secrets, such as
+	// sshkey or aws_access_key_secret, aren't recorded so that the lock
+	// can be committed. They must be given again, e.g. with Client.Hosts,
+	// to download the entries of the lock.
+	URL string `json:"url"`
+
+	// Getter is the key of the getter of the download, e.g. "git".
+	Getter string `json:"getter"`
+
+	// Checksum is the checksum of the downloaded file, the one of the entry
+	// or else its SHA-256. Directories have none.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Commit is the SHA of the commit checked out by the git getter.
+	Commit string `json:"commit,omitempty"`
+}
+
+// NewLock returns the Lock of the entries downloaded by Client.GetManifest,
+// in the order of results. The failed entries are left out.
+func NewLock(results []ManifestResult) *Lock {
+	l := &Lock{Entries: []LockEntry{}}
+	for _, r := range results {
+		if r.Err == nil && r.Lock != nil {
+			l.Entries = append(l.Entries, *r.Lock)
+		}
+	}
+	return l
+}
+
+// ParseLock decodes a JSON lock from r, as written by Lock.Write.
+func ParseLock(r io.Reader) (*Lock, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var l Lock
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("error parsing lock: %s", err)
+	}
+	for i, e := range l.Entries {
+		if e.URL == "" || e.Getter == "" || e.Dest == "" {
+			return nil, fmt.Errorf("lock entry %d: url, getter and dest are required", i)
+		}
+	}
+	return &l, nil
+}
+
+// Write writes l to w as indented JSON.
+func (l *Lock) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// Manifest returns a Manifest downloading the entries of l again with the
+// same getter, URL and checksum. The git sources are pinned to the commit
+// checked out.
+func (l *Lock) Manifest() (*Manifest, error) {
+	m := &Manifest{Entries: make([]ManifestEntry, 0, len(l.Entries))}
+	for _, e := range l.Entries {
+		src, err := editSourceURL(e.URL, func(u *url.URL) {
+			if e.Commit == "" {
+				return
+			}
+			q := u.Query()
+			q.Set("ref", e.Commit)
+			q.Del("version")
+			u.RawQuery = q.Encode()
+			u.Fragment = ""
+			u.RawFragment = ""
+		})
+		if err != nil {
+			return nil, fmt.Errorf("lock entry %s: %s", e.Dest, err)
+		}
+		m.Entries = append(m.Entries, ManifestEntry{
+			Source:   e.Getter + "::" + src,
+			Dest:     e.Dest,
+			Checksum: e.Checksum,
+			Mode:     e.Mode,
+		})
+	}
+	return m, nil
+}
+
+// newLockEntry returns the LockEntry of the download of e by c.
+func newLockEntry(e ManifestEntry, c *Client) (*LockEntry, error) {
+	src, err := editSourceURL(c.Resolved.URL, func(u *url.URL) {
+		q := u.Query()
+		q.Del("checksum")
+		u.RawQuery = q.Encode()
+		stripCredentials(u)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LockEntry{
+		Dest:     e.Dest,
+		Mode:     e.Mode,
+		URL:      src,
+		Getter:   c.Resolved.Getter,
+		Checksum: e.Checksum,
+		Commit:   c.Resolved.Commit,
+	}
+	if l.Checksum == "" && c.ComputedChecksums != nil {
+		if sum, ok := c.ComputedChecksums.Digests["sha256"]; ok {
+			l.Checksum = "sha256:" + sum
+		}
+	}
+	return l, nil
+}
+
+// editSourceURL returns the source URL src, which may have a subdirectory,
+// once edited by edit.
+func editSourceURL(src string, edit func(*url.URL)) (string, error) {
+	src, subDir := SourceDirSubdir(src)
+	u, err := urlhelper.Parse(src)
+	if err != nil {
+		return "", err
+	}
+	edit(u)
+	return joinSourceSubdir(u.String(), subDir), nil
+}
@@ -0,0 +1,148 @@
+package getter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Manifest is a list of sources to download, e.g. to pin the dependencies
+// of a reproducible environment. See ParseManifest and Client.GetManifest.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is a source of a Manifest.
+type ManifestEntry struct {
+	// Source is the source to download, as Client.Src.
+	Source string `json:"source"`
+
+	// Dest is the path to download the source to, as Client.Dst. A
+	// relative path is relative to the Dst of the client downloading the
+	// manifest, if set.
+	Dest string `json:"dest"`
+
+	// Checksum, if set, is the expected checksum of the downloaded file,
+	// in the form of the checksum parameter of a source, e.g.
+	// "sha256:<value>" or "file:<url>".
+	Checksum string `json:"checksum,omitempty"`
+
+	// Mode is the mode of the download: "file", "dir", or "any", the
+	// default.
+	Mode string `json:"mode,omitempty"`
+}
+
+// ManifestResult is the outcome of the download of a ManifestEntry.
+type ManifestResult struct {
+	Entry ManifestEntry
+
+	// Lock records what was downloaded for the entry, nil if it failed.
+	// See NewLock.
+	Lock *LockEntry
+
+	// Err is the error of the download, nil if it succeeded.
+	Err error
+}
+
+// ParseManifest decodes a JSON manifest from r, such as:
+//
+//	{
+//	  "entries": [
+//	    {
+//	      "source": "https://example.com/app.tar.gz",
+//	      "dest": "app",
+//	      "checksum": "sha256:..."
+//	    }
+//	  ]
+//	}
+func ParseManifest(r io.Reader) (*Manifest, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %s", err)
+	}
+	for i, e := range m.Entries {
+		if e.Source == "" || e.Dest == "" {
+			return nil, fmt.Errorf("manifest entry %d: source and dest are required", i)
+		}
+		if _, err := e.clientMode(); err != nil {
+			return nil, fmt.Errorf("manifest entry %d: %s", i, err)
+		}
+	}
+	return &m, nil
+}
+
+// GetManifest downloads the entries of m one after the other, each with a
+// copy of c whose Src, Dst and Mode are set from the entry, and returns the
+// result of each entry in order. A failed entry doesn't stop the download of
+// the others.
+func (c *Client) GetManifest(m *Manifest) []ManifestResult {
+	results := make([]ManifestResult, len(m.Entries))
+	for i, e := range m.Entries {
+		lock, err := c.getManifestEntry(e)
+		results[i] = ManifestResult{Entry: e, Lock: lock, Err: err}
+	}
+	return results
+}
+
+func (c *Client) getManifestEntry(e ManifestEntry) (*LockEntry, error) {
+	mode, err := e.clientMode()
+	if err != nil {
+		return nil, err
+	}
+
+	ec := *c
+	ec.Src = e.Source
+	if e.Checksum != "" {
+		ec.Src = withChecksumParam(e.Source, e.Checksum)
+	}
+	ec.Dst = e.Dest
+	if c.Dst != "" && !filepath.IsAbs(e.Dest) {
+		ec.Dst = filepath.Join(c.Dst, e.Dest)
+	}
+	ec.Mode = mode
+	ec.Dir = false
+
+	// Checksum the files without one for the lock
+	if e.Checksum == "" && c.FS == nil {
+		ec.ComputeChecksums = append(append([]string(nil), c.ComputeChecksums...), "sha256")
+	}
+
+	if err := ec.Get(); err != nil {
+		return nil, err
+	}
+	return newLockEntry(e, &ec)
+}
+
+// clientMode returns the ClientMode of the Mode of e.
+func (e *ManifestEntry) clientMode() (ClientMode, error) {
+	switch e.Mode {
+	case "", "any":
+		return ClientModeAny, nil
+	case "file":
+		return ClientModeFile, nil
+	case "dir":
+		return ClientModeDir, nil
+	default:
+		return ClientModeInvalid, fmt.Errorf("invalid mode %q, expected file, dir or any", e.Mode)
+	}
+}
+
+// withChecksumParam returns src with the checksum parameter set to
+// checksum, before its fragment if any.
+func withChecksumParam(src, checksum string) string {
+	var fragment string
+	if i := strings.Index(src, "#"); i >= 0 {
+		src, fragment = src[:i], src[i:]
+	}
+	sep := "?"
+	if strings.Contains(src, "?") {
+		sep = "&"
+	}
+	return src + sep + "checksum=" + url.QueryEscape(checksum) + fragment
+}
@@ -0,0 +1,106 @@
+package getter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClient_GetManifest(t *testing.T) {
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"entries": []map[string]string{
+			{
+				"source":   testModule("basic-file/foo.txt"),
+				"dest":     "good.txt",
+				"checksum": "md5:09f7e02f1290be211da707a266f153b3",
+				"mode":     "file",
+			},
+			{
+				"source":   testModule("basic-file/foo.txt"),
+				"dest":     "bad.txt",
+				"checksum": "md5:00000000000000000000000000000000",
+				"mode":     "file",
+			},
+			{
+				"source": testModule("basic"),
+				"dest":   "module",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	m, err := ParseManifest(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client := &Client{Dst: dst}
+	results := client.GetManifest(m)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+
+	if results[0].Err != nil {
+		t.Fatalf("err: %s", results[0].Err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "good.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := results[1].Err; err == nil || !strings.Contains(err.Error(), "Checksums did not match") {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if results[1].Entry.Dest != "bad.txt" {
+		t.Fatalf("bad entry: %#v", results[1].Entry)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "bad.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected the corrupted file to be removed: %v", err)
+	}
+
+	// The failure doesn't stop the next entries
+	if results[2].Err != nil {
+		t.Fatalf("err: %s", results[2].Err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "module", "main.tf")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestParseManifest_invalid(t *testing.T) {
+	cases := map[string]string{
+		"syntax":        `{"entries": [`,
+		"unknown field": `{"entries": [{"source": "a", "dest": "b", "sha": "c"}]}`,
+		"no source":     `{"entries": [{"dest": "b"}]}`,
+		"no dest":       `{"entries": [{"source": "a"}]}`,
+		"bad mode":      `{"entries": [{"source": "a", "dest": "b", "mode": "tree"}]}`,
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseManifest(strings.NewReader(input)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestWithChecksumParam(t *testing.T) {
+	cases := []struct {
+		Src      string
+		Expected string
+	}{
+		{"https://example.com/foo", "https://example.com/foo?checksum=md5%3Aabc"},
+		{"https://example.com/foo?a=b", "https://example.com/foo?a=b&checksum=md5%3Aabc"},
+		{"git::https://example.com/repo.git//sub#v1", "git::https://example.com/repo.git//sub?checksum=md5%3Aabc#v1"},
+	}
+	for _, tc := range cases {
+		if actual := withChecksumParam(tc.Src, "md5:abc"); actual != tc.Expected {
+			t.Fatalf("%s: bad: %s", tc.Src, actual)
+		}
+	}
+}
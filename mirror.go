@@ -0,0 +1,109 @@
+package getter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// mirrorEntry returns the path of the entry of MirrorDir for the source u
+// downloaded by the getter force, and the mode of the entry,
+// ClientModeInvalid if there is none. The entry is named by the hex
+// encoded SHA-256 of "force::u".
+func (c *Client) mirrorEntry(force string, u *url.URL) (string, ClientMode) {
+	if c.MirrorDir == "" {
+		return "", ClientModeInvalid
+	}
+	sum := sha256.Sum256([]byte(force + "::" + u.String()))
+	path := filepath.Join(c.MirrorDir, hex.EncodeToString(sum[:]))
+
+	fi, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return path, ClientModeInvalid
+	case fi.IsDir():
+		return path, ClientModeDir
+	default:
+		return path, ClientModeFile
+	}
+}
+
+// getMirrorDir copies the directory entry of MirrorDir at path to dst,
+// replacing dst unless Merge is set.
+func (c *Client) getMirrorDir(dst, path string) error {
+	if !c.Merge {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dst, dirModeFromContext(c.Ctx)); err != nil {
+		return err
+	}
+	return copyDir(c.Ctx, dst, path, false)
+}
+
+// populateMirror copies the file or directory downloaded to dst to the
+// entry of MirrorDir at path, if PopulateMirror is set. The entry is
+// written aside and then renamed, so that it is never seen partially
+// written.
+func (c *Client) populateMirror(path, dst string, mode ClientMode) error {
+	if !c.PopulateMirror || path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.MirrorDir, dirModeFromContext(c.Ctx)); err != nil {
+		return err
+	}
+	td, err := ioutil.TempDir(c.MirrorDir, ".getter")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	// The copy doesn't count towards MaxBytes
+	ctx := withByteLimit(c.Ctx, nil)
+	tmp := filepath.Join(td, "entry")
+	if mode == ClientModeDir {
+		if err := os.Mkdir(tmp, dirModeFromContext(c.Ctx)); err != nil {
+			return err
+		}
+		err = copyDir(ctx, tmp, dst, false)
+	} else {
+		err = copyMirrorFile(ctx, tmp, dst)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Replace an entry of the other mode
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyMirrorFile copies the file src to dst, keeping its mode.
+func copyMirrorFile(ctx context.Context, dst, src string) error {
+	srcF, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcF.Close()
+
+	fi, err := srcF.Stat()
+	if err != nil {
+		return err
+	}
+	dstF, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fi.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := Copy(ctx, dstF, srcF); err != nil {
+		dstF.Close()
+		return err
+	}
+	return dstF.Close()
+}
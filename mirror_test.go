@@ -0,0 +1,100 @@
+package getter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_MirrorDir_file(t *testing.T) {
+	var downloads int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt32(&downloads, 1)
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	mirror := filepath.Join(td, "mirror")
+
+	get := func(dst string, populate bool) {
+		client := &Client{
+			Src:            srv.URL + "/file",
+			Dst:            dst,
+			Mode:           ClientModeFile,
+			MirrorDir:      mirror,
+			PopulateMirror: populate,
+		}
+		if err := client.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		assertContents(t, dst, "hello")
+	}
+
+	// A miss downloads the file, the mirror is only populated on request
+	get(filepath.Join(td, "a"), false)
+	if _, err := os.Stat(mirror); !os.IsNotExist(err) {
+		t.Fatalf("expected no mirror, got %v", err)
+	}
+	get(filepath.Join(td, "b"), true)
+	if n := atomic.LoadInt32(&downloads); n != 2 {
+		t.Fatalf("expected 2 downloads, got %d", n)
+	}
+
+	// A hit copies the file of the mirror
+	get(filepath.Join(td, "c"), true)
+	if n := atomic.LoadInt32(&downloads); n != 2 {
+		t.Fatalf("expected the mirror to be used, got %d downloads", n)
+	}
+	entries, err := ioutil.ReadDir(mirror)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 mirror entry, got %d", len(entries))
+	}
+}
+
+func TestClient_MirrorDir_dir(t *testing.T) {
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	mirror := filepath.Join(td, "mirror")
+
+	src := testModule("basic")
+	get := func(dst string) {
+		client := &Client{
+			Src:            src,
+			Dst:            dst,
+			Mode:           ClientModeAny,
+			MirrorDir:      mirror,
+			PopulateMirror: true,
+		}
+		if err := client.Get(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, "main.tf")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The file getter links a directory
+	dst := filepath.Join(td, "a")
+	get(dst)
+	if fi, err := os.Lstat(dst); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected a symlink, got %v", err)
+	}
+
+	// The mirror copies it
+	dst = filepath.Join(td, "b")
+	get(dst)
+	if fi, err := os.Lstat(dst); err != nil || !fi.IsDir() {
+		t.Fatalf("expected a directory, got %v", err)
+	}
+}
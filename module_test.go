@@ -32,6 +32,20 @@ func tempTestFile(t *testing.T) string {
 	return filepath.Join(dir, "foo")
 }
 
+// copyTestFile copies the file src to dst, creating its parent directory.
+func copyTestFile(t *testing.T, dst, src string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(dst, data, 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func testModule(n string) string {
 	p := filepath.Join(fixtureDir, n)
 	p, err := filepath.Abs(p)
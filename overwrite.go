@@ -0,0 +1,59 @@
+package getter
+
+import (
+	"os"
+	"time"
+)
+
+// OverwritePolicy tells what to do with the files that already exist at the
+// destination of a download. It is honored by FileGetter and by the built-in
+// decompressors, which apply it to every file they extract.
+type OverwritePolicy uint
+
+const (
+	// OverwriteAlways replaces existing files. This is the default.
+	OverwriteAlways OverwritePolicy = iota
+
+	// OverwriteNever keeps existing files untouched.
+	OverwriteNever
+
+	// OverwriteIfNewer replaces existing files only when the source was
+	// modified after them. Decompressors use the modification times stored
+	// in the archive, or the one of the archive itself for formats that
+	// don't store any.
+	OverwriteIfNewer
+)
+
+// shouldWrite reports whether the source, last modified at mtime, must be
+// written at dst.
+func (p OverwritePolicy) shouldWrite(dst string, mtime time.Time) (bool, error) {
+	return p.shouldWriteFS(OSFS, dst, mtime)
+}
+
+// shouldWriteFS is shouldWrite for a destination in fs.
+func (p OverwritePolicy) shouldWriteFS(fs FS, dst string, mtime time.Time) (bool, error) {
+	fi, err := fs.Lstat(dst)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch p {
+	case OverwriteNever:
+		return false, nil
+	case OverwriteIfNewer:
+		return mtime.After(fi.ModTime()), nil
+	default:
+		return true, nil
+	}
+}
+
+// overwritePolicy returns the OverwritePolicy of the getter's client.
+func (g *getter) overwritePolicy() OverwritePolicy {
+	if g == nil || g.client == nil {
+		return OverwriteAlways
+	}
+	return g.client.Overwrite
+}
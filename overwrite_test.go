@@ -0,0 +1,115 @@
+package getter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetFile_overwrite(t *testing.T) {
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Now().Add(time.Hour)
+
+	cases := []struct {
+		Name     string
+		Policy   OverwritePolicy
+		ModTime  time.Time
+		Expected string
+	}{
+		{"always", OverwriteAlways, future, "Hello\n"},
+		{"never", OverwriteNever, old, "local\n"},
+		{"if newer, older destination", OverwriteIfNewer, old, "Hello\n"},
+		{"if newer, newer destination", OverwriteIfNewer, future, "local\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			td, err := ioutil.TempDir("", "getter")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer os.RemoveAll(td)
+
+			dst := filepath.Join(td, "foo.txt")
+			if err := ioutil.WriteFile(dst, []byte("local\n"), 0644); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if err := os.Chtimes(dst, tc.ModTime, tc.ModTime); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			client := &Client{
+				Src:       testModule("basic-file/foo.txt"),
+				Dst:       dst,
+				Mode:      ClientModeFile,
+				Overwrite: tc.Policy,
+			}
+			if err := client.Get(); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			assertContents(t, dst, tc.Expected)
+		})
+	}
+}
+
+func TestTarGzipDecompressor_overwrite(t *testing.T) {
+	src := filepath.Join("./test-fixtures", "decompress-tgz", "multiple.tar.gz")
+
+	// The archive entries were modified on 2016-01-12
+	old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Name     string
+		Policy   OverwritePolicy
+		Expected map[string]string
+	}{
+		{
+			"always",
+			OverwriteAlways,
+			map[string]string{"file1": "foo\n", "file2": "foo\n"},
+		},
+		{
+			"never",
+			OverwriteNever,
+			map[string]string{"file1": "local\n", "file2": "local\n"},
+		},
+		{
+			"if newer",
+			OverwriteIfNewer,
+			map[string]string{"file1": "foo\n", "file2": "local\n"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			td, err := ioutil.TempDir("", "getter")
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			defer os.RemoveAll(td)
+
+			// file1 is older than its archived version, file2 newer
+			for name, mtime := range map[string]time.Time{"file1": old, "file2": recent} {
+				path := filepath.Join(td, name)
+				if err := ioutil.WriteFile(path, []byte("local\n"), 0644); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				if err := os.Chtimes(path, mtime, mtime); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+			}
+
+			d := new(TarGzipDecompressor)
+			if err := d.decompress(td, src, true, &decompressOptions{overwrite: tc.Policy}); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+
+			for name, expected := range tc.Expected {
+				assertContents(t, filepath.Join(td, name), expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package getter
+
+import "fmt"
+
+// PartialDownloadError is returned by the directory downloads of the GCS
+// and S3 getters with KeepPartial set when they are canceled. The objects
+// of Completed are kept in the destination, the ones of Pending, including
+// the object being downloaded when the download was canceled, aren't
+// written. Getting the source again with SyncMode set only downloads the
+// pending objects.
+type PartialDownloadError struct {
+	// Err is the error that stopped the download, e.g. context.Canceled.
+	Err error
+
+	// Completed and Pending are the names of the objects of the download
+	// that are downloaded and still to download.
+	Completed []string
+	Pending   []string
+}
+
+func (e *PartialDownloadError) Error() string {
+	return fmt.Sprintf("download stopped with %d objects completed and %d pending: %s",
+		len(e.Completed), len(e.Pending), e.Err)
+}
+
+func (e *PartialDownloadError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,82 @@
+package getter
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Plan is what a Get resolved to download, given to Client.OnPlan once the
+// source is detected and parsed, before anything is downloaded, checksum
+// and signature files included.
+type Plan struct {
+	// Src is the source as given to the client, before detection.
+	Src string
+
+	// Getter is the key of the getter of the download in Client.Getters,
+	// e.g. "git" or "https".
+	Getter string
+
+	// URL is the URL given to the getter, once intercepted and without the
+	// subdirectory and the magic query parameters, such as checksum. It may
+	// be changed by OnPlan, e.g. to add a query parameter, but the other
+	// decisions of the plan are kept.
+	URL *url.URL
+
+	// Subdir is the subdirectory of the source to copy to Dst, if any.
+	Subdir string
+
+	// Decompressor is the key in Client.Decompressors of the decompressor
+	// unpacking the download, or empty if it isn't unpacked as an archive.
+	// An archive only detected by SniffArchives is unpacked too.
+	Decompressor string
+
+	// Split reports whether the source is the first part of a split
+	// archive, whose next parts are downloaded too.
+	Split bool
+
+	// Checksum is the expected checksum of the file, as "type:value" with
+	// a hex encoded value, or empty. A checksum read from a checksum file,
+	// or found by the getter like the sidecar checksums of the HttpGetter,
+	// isn't known yet.
+	Checksum string
+
+	// ChecksumURL is the checksum file of a "file:" checksum parameter,
+	// fetched once the plan is approved.
+	ChecksumURL string
+
+	// Signed reports whether the file is verified against a signature.
+	Signed bool
+
+	// SignatureURL and PublicKeyURL are the signature file and the public
+	// key file the file is verified with, fetched once the plan is
+	// approved. PublicKeyURL is empty for a key inlined in the source.
+	SignatureURL string
+	PublicKeyURL string
+
+	// Dst is the destination of the download.
+	Dst string
+
+	// Mode is the client mode of the download: ClientModeAny when the
+	// getter hasn't been asked yet whether the source is a file or a
+	// directory. The mode of an archive is the one it is unpacked with.
+	Mode ClientMode
+}
+
+// plan calls OnPlan with p, if set, and returns the URL to download, as
+// changed by OnPlan.
+func (c *Client) plan(p *Plan) (*url.URL, error) {
+	if c.OnPlan == nil {
+		return p.URL, nil
+	}
+	u := p.URL
+	if err := c.OnPlan(p); err != nil {
+		return nil, fmt.Errorf("%s: %w", redactURL(u), err)
+	}
+	if p.URL == nil {
+		return nil, fmt.Errorf("%s: the plan has no URL", redactURL(u))
+	}
+	if c.Logger != nil && p.URL.String() != u.String() {
+		c.Logger.Printf("rewrote %s to %s", redactURL(u), redactURL(p.URL))
+	}
+	return p.URL, nil
+}
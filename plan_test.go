@@ -0,0 +1,204 @@
+package getter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testPlanServer serves the fixture multiple_dir.tar.gz, recording the
+// query strings of the requests.
+func testPlanServer(t *testing.T) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var queries []string
+	fixture := filepath.Join(fixtureDir, "decompress-tgz", "multiple_dir.tar.gz")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		http.ServeFile(w, r, fixture)
+	}))
+	return srv, &queries
+}
+
+func TestClient_OnPlan(t *testing.T) {
+	srv, _ := testPlanServer(t)
+	defer srv.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(fixtureDir, "decompress-tgz", "multiple_dir.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum := sha256.Sum256(data)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	src := fmt.Sprintf("http::%s/release/multiple_dir.tar.gz//dir?checksum=%s&token=abc", srv.URL, checksum)
+	var plans []Plan
+	client := &Client{
+		Src:  src,
+		Dst:  dst,
+		Mode: ClientModeAny,
+		OnPlan: func(p *Plan) error {
+			plans = append(plans, *p)
+			return nil
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "test2"), "Hello\n")
+
+	if len(plans) != 1 {
+		t.Fatalf("expected one plan, got %d", len(plans))
+	}
+	p := plans[0]
+	if p.Src != src || p.Getter != "http" || p.Subdir != "dir" || p.Dst != dst {
+		t.Fatalf("bad plan: %#v", p)
+	}
+	if p.URL.String() != srv.URL+"/release/multiple_dir.tar.gz?token=abc" {
+		t.Fatalf("bad URL: %s", p.URL)
+	}
+	if p.Decompressor != "tar.gz" || p.Checksum != checksum || p.Mode != ClientModeDir {
+		t.Fatalf("bad plan: %#v", p)
+	}
+	if p.Split || p.Signed {
+		t.Fatalf("bad plan: %#v", p)
+	}
+}
+
+func TestClient_OnPlan_abort(t *testing.T) {
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	getter := &MockGetter{Proxy: new(HttpGetter)}
+	client := &Client{
+		Src: "https://example.com/foo.txt",
+		Dst: dst,
+		Getters: map[string]Getter{
+			"https": getter,
+		},
+		OnPlan: func(p *Plan) error {
+			return fmt.Errorf("host %q is not allowed", p.URL.Host)
+		},
+	}
+	err := client.Get()
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("expected the plan to be rejected, got %v", err)
+	}
+	if getter.GetFileCalled {
+		t.Fatal("GetFile should not be called")
+	}
+}
+
+func TestClient_OnPlan_rewrite(t *testing.T) {
+	srv, queries := testPlanServer(t)
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	client := &Client{
+		Src:  srv.URL + "/multiple_dir.tar.gz",
+		Dst:  dst,
+		Mode: ClientModeDir,
+		OnPlan: func(p *Plan) error {
+			q := p.URL.Query()
+			q.Set("audited", "true")
+			p.URL.RawQuery = q.Encode()
+			return nil
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, filepath.Join(dst, "test1"), "Hello\n")
+
+	if len(*queries) == 0 {
+		t.Fatal("expected requests")
+	}
+	for _, q := range *queries {
+		if q != "audited=true" {
+			t.Fatalf("bad query: %q", q)
+		}
+	}
+}
+
+func TestClient_OnPlan_beforeChecksumFiles(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The plan is rejected before the checksum and signature files are
+	// fetched, and the error of OnPlan is kept
+	errDenied := errors.New("denied")
+	var plan Plan
+	client := &Client{
+		Src: fmt.Sprintf("%s/file?checksum=file:%s/SHA256SUMS&signature=%s/file.sig&pubkey=%s/key.asc",
+			srv.URL, srv.URL, srv.URL, srv.URL),
+		Dst:  dst,
+		Mode: ClientModeFile,
+		OnPlan: func(p *Plan) error {
+			plan = *p
+			return errDenied
+		},
+	}
+	if err := client.Get(); !errors.Is(err, errDenied) {
+		t.Fatalf("expected the error of OnPlan, got %v", err)
+	}
+	if len(paths) != 0 {
+		t.Fatalf("expected no request, got %q", paths)
+	}
+
+	if plan.ChecksumURL != srv.URL+"/SHA256SUMS" || plan.Checksum != "" {
+		t.Fatalf("bad checksum: %#v", plan)
+	}
+	if !plan.Signed || plan.SignatureURL != srv.URL+"/file.sig" || plan.PublicKeyURL != srv.URL+"/key.asc" {
+		t.Fatalf("bad signature: %#v", plan)
+	}
+}
+
+func TestClient_OnPlan_resolved(t *testing.T) {
+	srv, _ := testPlanServer(t)
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	// Resolved is the source as rewritten by OnPlan, with its archive
+	client := &Client{
+		Src:  srv.URL + "/release?archive=tar.gz",
+		Dst:  dst,
+		Mode: ClientModeDir,
+		OnPlan: func(p *Plan) error {
+			p.URL.Path = "/mirror" + p.URL.Path
+			return nil
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := srv.URL + "/mirror/release?archive=tar.gz"; client.Resolved.URL != expected {
+		t.Fatalf("expected the resolved URL %q, got %q", expected, client.Resolved.URL)
+	}
+}
@@ -0,0 +1,117 @@
+package getter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// probeTimeout bounds the time spent by the pre-flight check of a source.
+const probeTimeout = 10 * time.Second
+
+// probeGetters are the getters for which Client.ProbeBeforeGet is honored.
+// They all talk to their backend over HTTP(S).
+var probeGetters = map[string]bool{
+	"gcs":   true,
+	"http":  true,
+	"https": true,
+	"s3":    true,
+}
+
+// shouldProbe reports whether the source u of the getter g, whose key is
+// force, is probed with Client.ProbeBeforeGet. The probe dials the host
+// directly with the default TLS configuration, so it is skipped when the
+// getter would connect otherwise: through a proxy, with a custom HTTP
+// client or TLS configuration, or pinning certificates. A download that
+// works would fail at the probe otherwise.
+func shouldProbe(force string, g Getter, u *url.URL) bool {
+	if !probeGetters[force] {
+		return false
+	}
+	switch g := g.(type) {
+	case *HttpGetter:
+		if g.Client != nil || len(g.PinnedCertificates) > 0 {
+			return false
+		}
+	case *GCSGetter:
+		if g.HTTPClient != nil || (g.Transport != nil && g.Transport.TLSConfig != nil) {
+			return false
+		}
+	case *S3Getter:
+		if g.Transport != nil && g.Transport.TLSConfig != nil {
+			return false
+		}
+	}
+	proxy, err := httpproxy.FromEnvironment().ProxyFunc()(u)
+	return err == nil && proxy == nil
+}
+
+// probe checks that the host of u can be resolved, connected to and, for
+// https URLs, that a TLS handshake succeeds. The returned error explains
+// which of these steps failed in terms a user can act upon.
+func probe(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	if host == "" {
+		return nil
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	// Resolve the host first so that DNS issues aren't reported as
+	// connection issues.
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return fmt.Errorf("cannot resolve host %q, check the URL and your DNS configuration: %s", host, err)
+		}
+	}
+
+	addr := net.JoinHostPort(host, port)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return fmt.Errorf("connection to %s refused, check that the server is running and the port is correct", addr)
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return fmt.Errorf("timed out connecting to %s, check your network and proxy settings", addr)
+		default:
+			return fmt.Errorf("cannot connect to %s: %s", addr, err)
+		}
+	}
+	defer conn.Close()
+
+	if u.Scheme != "https" {
+		return nil
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("TLS handshake with %s failed, check the server certificate and your trusted CAs: %s", addr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package getter
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetFile_probe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello\n"))
+	}))
+	defer srv.Close()
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello\n"))
+	}))
+	defer tlsSrv.Close()
+
+	// Grab a free port and close it so that connecting to it is refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	refused := ln.Addr().String()
+	ln.Close()
+
+	cases := []struct {
+		Name string
+		Src  string
+		Err  string
+	}{
+		{
+			"reachable",
+			srv.URL + "/file",
+			"",
+		},
+		{
+			"dns failure",
+			"http://go-getter.invalid/file",
+			"cannot resolve host",
+		},
+		{
+			"connection refused",
+			"http://" + refused + "/file",
+			"refused",
+		},
+		{
+			"tls error",
+			tlsSrv.URL + "/file",
+			"TLS handshake",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			client := &Client{
+				Src:            tc.Src,
+				Dst:            dst,
+				Dir:            false,
+				ProbeBeforeGet: true,
+			}
+			err := client.Get()
+			if tc.Err == "" {
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				assertContents(t, dst, "Hello\n")
+				return
+			}
+
+			if err == nil {
+				t.Fatal("should error")
+			}
+			if !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected error containing %q, got: %s", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestGetFile_probeDisabled(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello\n"))
+	}))
+	defer tlsSrv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// Without the probe, the raw error of the getter is returned
+	client := &Client{
+		Src: tlsSrv.URL + "/file",
+		Dst: dst,
+		Dir: false,
+	}
+	err := client.Get()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if strings.Contains(err.Error(), "TLS handshake with") {
+		t.Fatalf("unexpected probe error: %s", err)
+	}
+}
+
+func TestGetFile_probeCustomClient(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello\n"))
+	}))
+	defer tlsSrv.Close()
+
+	dst := tempTestFile(t)
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The client of the getter trusts the server, the probe can't tell
+	client := &Client{
+		Src:            tlsSrv.URL + "/file",
+		Dst:            dst,
+		Dir:            false,
+		ProbeBeforeGet: true,
+		Getters: map[string]Getter{
+			"https": &HttpGetter{Client: tlsSrv.Client()},
+		},
+	}
+	if err := client.Get(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, "Hello\n")
+}
+
+func TestShouldProbe(t *testing.T) {
+	for _, k := range []string{"HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy"} {
+		defer tempEnv(t, k, "")()
+	}
+
+	u := testURL("https://example.com/file")
+	cases := []struct {
+		Name     string
+		Force    string
+		Getter   Getter
+		Expected bool
+	}{
+		{"default", "https", new(HttpGetter), true},
+		{"not probed", "git", new(GitGetter), false},
+		{"custom client", "https", &HttpGetter{Client: http.DefaultClient}, false},
+		{"pinned", "https", &HttpGetter{PinnedCertificates: []string{"00"}}, false},
+		{"gcs TLS config", "gcs", &GCSGetter{Transport: &TransportOptions{TLSConfig: &tls.Config{}}}, false},
+		{"s3 TLS config", "s3", &S3Getter{Transport: &TransportOptions{TLSConfig: &tls.Config{}}}, false},
+	}
+	for _, tc := range cases {
+		if got := shouldProbe(tc.Force, tc.Getter, u); got != tc.Expected {
+			t.Fatalf("%s: expected %t, got %t", tc.Name, tc.Expected, got)
+		}
+	}
+
+	// A proxy connects to the host instead
+	defer tempEnv(t, "HTTPS_PROXY", "http://proxy.example.com:3128")()
+	if shouldProbe("https", new(HttpGetter), u) {
+		t.Fatal("expected no probe through a proxy")
+	}
+	defer tempEnv(t, "NO_PROXY", "example.com")()
+	if !shouldProbe("https", new(HttpGetter), u) {
+		t.Fatal("expected a probe of a host not proxied")
+	}
+}
@@ -0,0 +1,167 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	urlhelper "github.com/hashicorp/go-getter/helper/url"
+)
+
+// ResumeToken records how far the download of a single file went before it
+// was interrupted, so that Client.Resume can continue it later, even from
+// another process: it is meant to be persisted, e.g. as JSON. See
+// Client.ResumeToken.
+type ResumeToken struct {
+	// Getter is the key of the getter of the download in Client.Getters.
+	Getter string `json:"getter"`
+
+	// URL is the URL of the file, as given to the getter, without its
+	// credentials: its userinfo and the query parameters holding secrets,
+	// such as the signature of a signed URL, aren't recorded since the
+	// token is persisted. They must be given again, e.g. with
+	// Client.Hosts, to resume a download needing them.
+	URL string `json:"url"`
+
+	// Offset is the number of bytes of the file already downloaded.
+	Offset int64 `json:"offset"`
+
+	// ETag and LastModified are the validators of the file served over
+	// HTTP, the ETag taking precedence.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Generation is the generation of the GCS object.
+	Generation int64 `json:"generation,omitempty"`
+}
+
+// Resume continues the download of the file of token to dst, the path the
+// interrupted download was writing to, from the recorded offset if the
+// remote file is unchanged. A changed file is downloaded again from the
+// start. Only the HTTP and GCS getters can resume a download.
+//
+// The URL of the token is given to the Interceptor, as the source of a Get.
+// Resume doesn't verify checksums or unpack archives. If it is interrupted
+// too, ResumeToken is set again.
+func (c *Client) Resume(token *ResumeToken, dst string) error {
+	if err := c.Configure(c.Options...); err != nil {
+		return err
+	}
+	c.ResumeToken = nil
+
+	u, err := urlhelper.Parse(token.URL)
+	if err != nil {
+		return err
+	}
+	if u, err = c.intercept(u); err != nil {
+		return err
+	}
+
+	g, ok := c.Getters[token.Getter]
+	if !ok {
+		return fmt.Errorf(
+			"download not supported for scheme '%s'", token.Getter)
+	}
+	g = bindGetter(g, c)
+	r, ok := g.(resumer)
+	if !ok {
+		return fmt.Errorf("resume not supported for scheme '%s'", token.Getter)
+	}
+
+	state := new(resumeState)
+	defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+	c.Ctx = withResumeState(c.Ctx, state)
+
+	if err := c.MaxConnections.acquire(c.Ctx); err != nil {
+		return err
+	}
+	err = r.resume(dst, u, token)
+	c.MaxConnections.release()
+	if err != nil {
+		c.ResumeToken = state.token(token.Getter, u, dst)
+		return err
+	}
+	return nil
+}
+
+// resumeState is filled by the getters implementing resumer with the
+// validators of the file they download, for the ResumeToken of an
+// interrupted download. It is carried by the context of the download.
+type resumeState struct {
+	etag, lastModified string
+	generation         int64
+}
+
+type resumeStateKey struct{}
+
+// withResumeState returns a copy of ctx carrying s, for the getters to fill.
+func withResumeState(ctx context.Context, s *resumeState) context.Context {
+	return context.WithValue(ctx, resumeStateKey{}, s)
+}
+
+func resumeStateFromContext(ctx context.Context) *resumeState {
+	s, _ := ctx.Value(resumeStateKey{}).(*resumeState)
+	return s
+}
+
+// setHTTP records the validators of the file sent in resp.
+func (s *resumeState) setHTTP(resp *http.Response) {
+	if s != nil {
+		s.etag = resp.Header.Get("ETag")
+		s.lastModified = resp.Header.Get("Last-Modified")
+	}
+}
+
+// setGeneration records the generation of the GCS object being read.
+func (s *resumeState) setGeneration(generation int64) {
+	if s != nil {
+		s.generation = generation
+	}
+}
+
+// token returns the ResumeToken of the interrupted download of u by the
+// getter to dst, or nil if the file can't be resumed: nothing was written
+// or the version of the remote file is unknown.
+func (s *resumeState) token(getter string, u *url.URL, dst string) *ResumeToken {
+	if s == nil || (s.etag == "" && s.lastModified == "" && s.generation == 0) {
+		return nil
+	}
+	fi, err := os.Stat(dst)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return nil
+	}
+	tu := *u
+	stripCredentials(&tu)
+	return &ResumeToken{
+		Getter:       getter,
+		URL:          tu.String(),
+		Offset:       fi.Size(),
+		ETag:         s.etag,
+		LastModified: s.lastModified,
+		Generation:   s.generation,
+	}
+}
+
+// resumeOffset returns the offset to resume the download to the file f at:
+// the one of token, or 0 if f is shorter. f is truncated and positioned at
+// the offset.
+func resumeOffset(f *os.File, token *ResumeToken) (int64, error) {
+	offset := token.Offset
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if fi.Size() < offset || offset < 0 {
+		offset = 0
+	}
+	if err := f.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
@@ -0,0 +1,237 @@
+package getter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// interruptTracker is a ProgressTracker canceling the download once its
+// first bytes are read.
+type interruptTracker struct {
+	cancel context.CancelFunc
+}
+
+func (p *interruptTracker) TrackProgress(_ string, _, _ int64, stream io.ReadCloser) io.ReadCloser {
+	return &closerFunc{
+		Reader: readerFunc(func(b []byte) (int, error) {
+			n, err := stream.Read(b)
+			p.cancel()
+			return n, err
+		}),
+		close: func() { stream.Close() },
+	}
+}
+
+// interruptedGet downloads src to dst with a client canceled once the first
+// bytes are read, and returns the ResumeToken, persisted and read back.
+func interruptedGet(t *testing.T, src, dst string) *ResumeToken {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Client{
+		Ctx:              ctx,
+		Src:              src,
+		Dst:              dst,
+		Mode:             ClientModeFile,
+		ProgressListener: &interruptTracker{cancel: cancel},
+	}
+	if err := c.Get(); err == nil {
+		t.Fatal("expected the download to be interrupted")
+	}
+	if c.ResumeToken == nil {
+		t.Fatal("expected a resume token")
+	}
+	if c.ResumeToken.Offset == 0 || c.ResumeToken.Offset >= int64(len(testResumeContents)) {
+		t.Fatalf("bad offset: %d", c.ResumeToken.Offset)
+	}
+
+	data, err := json.Marshal(c.ResumeToken)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var token ResumeToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return &token
+}
+
+var testResumeContents = strings.Repeat("0123456789abcdef", 64*1024)
+
+// testResumeServer serves the file /file with its ETag, recording the Range
+// header of the GET requests.
+type testResumeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	contents string
+	etag     string
+	ranges   []string
+}
+
+func newTestResumeServer() *testResumeServer {
+	s := &testResumeServer{contents: testResumeContents, etag: `"v1"`}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		contents, etag := s.contents, s.etag
+		if r.Method == "GET" {
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+		}
+		s.mu.Unlock()
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "file", time.Time{}, strings.NewReader(contents))
+	}))
+	return s
+}
+
+func TestClient_Resume_http(t *testing.T) {
+	srv := newTestResumeServer()
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	token := interruptedGet(t, srv.URL+"/file", dst)
+	if token.Getter != "http" || token.ETag != `"v1"` {
+		t.Fatalf("bad token: %#v", token)
+	}
+
+	srv.mu.Lock()
+	srv.ranges = nil
+	srv.mu.Unlock()
+	if err := new(Client).Resume(token, dst); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, testResumeContents)
+
+	// Only the rest of the file was requested
+	if len(srv.ranges) != 1 || !strings.HasPrefix(srv.ranges[0], "bytes=") || srv.ranges[0] == "bytes=0-" {
+		t.Fatalf("bad requests: %v", srv.ranges)
+	}
+}
+
+func TestClient_Resume_httpChanged(t *testing.T) {
+	srv := newTestResumeServer()
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	token := interruptedGet(t, srv.URL+"/file", dst)
+
+	srv.mu.Lock()
+	srv.contents = strings.ToUpper(testResumeContents)
+	srv.etag = `"v2"`
+	srv.mu.Unlock()
+
+	if err := new(Client).Resume(token, dst); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, strings.ToUpper(testResumeContents))
+}
+
+func TestClient_Resume_credentials(t *testing.T) {
+	srv := newTestResumeServer()
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	// The persisted token holds no secrets
+	u := testURL(srv.URL + "/file?token=secret&v=1")
+	u.User = url.UserPassword("user", "pass")
+	token := interruptedGet(t, u.String(), dst)
+	if token.URL != srv.URL+"/file?v=1" {
+		t.Fatalf("bad token URL: %s", token.URL)
+	}
+}
+
+func TestClient_Resume_interceptor(t *testing.T) {
+	srv := newTestResumeServer()
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "file")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	token := interruptedGet(t, srv.URL+"/file", dst)
+
+	srv.mu.Lock()
+	srv.ranges = nil
+	srv.mu.Unlock()
+	c := &Client{
+		Interceptor: func(u *url.URL) (*url.URL, error) {
+			return nil, fmt.Errorf("host %s is blocked", u.Host)
+		},
+	}
+	err := c.Resume(token, dst)
+	if err == nil || !strings.Contains(err.Error(), "is blocked") {
+		t.Fatalf("expected the URL to be blocked, got %v", err)
+	}
+	if len(srv.ranges) != 0 {
+		t.Fatalf("expected no requests, got %v", srv.ranges)
+	}
+}
+
+func TestClient_Resume_gcs(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": testResumeContents})
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "large.bin")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	token := interruptedGet(t, "gcs::https://www.googleapis.com/storage/v1/bucket/large.bin?anonymous=true", dst)
+	if token.Getter != "gcs" || token.Generation != 1 {
+		t.Fatalf("bad token: %#v", token)
+	}
+
+	if err := new(Client).Resume(token, dst); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, testResumeContents)
+
+	// The last read started at the offset of the token
+	var last *http.Request
+	for _, r := range srv.Requests() {
+		if r.URL.Path == "/bucket/large.bin" {
+			last = r
+		}
+	}
+	if last == nil || !strings.HasPrefix(last.Header.Get("Range"), "bytes=") {
+		t.Fatalf("expected a range read, got %v", last)
+	}
+}
+
+func TestClient_Resume_gcsChanged(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"large.bin": testResumeContents})
+	defer srv.Close()
+
+	dst := filepath.Join(tempDir(t), "large.bin")
+	defer os.RemoveAll(filepath.Dir(dst))
+
+	token := interruptedGet(t, "gcs::https://www.googleapis.com/storage/v1/bucket/large.bin?anonymous=true", dst)
+
+	srv.setObjects(map[string]string{"large.bin": strings.ToUpper(testResumeContents)}, 2)
+
+	if err := new(Client).Resume(token, dst); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertContents(t, dst, strings.ToUpper(testResumeContents))
+}
+
+func TestClient_Resume_unsupported(t *testing.T) {
+	token := &ResumeToken{Getter: "file", URL: "file:///foo", Offset: 1}
+	err := new(Client).Resume(token, filepath.Join(tempDir(t), "foo"))
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package getter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+const (
+	pgpPublicKeyHeader = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+)
+
+// fileSignature helps verifying the detached OpenPGP signature of a file.
+type fileSignature struct {
+	Signature []byte
+	KeyRing   openpgp.EntityList
+}
+
+// verify checks that the file at source is signed by one of the keys of the
+// key ring.
+func (s *fileSignature) verify(source string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("Failed to open file for signature verification: %s", err)
+	}
+	defer f.Close()
+
+	if bytes.HasPrefix(bytes.TrimSpace(s.Signature), []byte(pgpSignatureHeader)) {
+		_, err = openpgp.CheckArmoredDetachedSignature(s.KeyRing, f, bytes.NewReader(s.Signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(s.KeyRing, f, bytes.NewReader(s.Signature), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("Signature verification failed: %s", err)
+	}
+
+	return nil
+}
+
+// extractSignature will return a fileSignature based on the values sigV
+// and keyV of the 'signature' and 'pubkey' parameters of a source.
+// ex:
+//
+//	http://hashicorp.com/terraform.zip?signature=<signature_url>&pubkey=<pubkey_url>
+//	http://hashicorp.com/terraform.zip?signature=<signature_url>&pubkey=<armored_pubkey>
+//
+// The signature is downloaded with the same configuration as the Client and
+// may be armored (.asc) or binary (.sig). The public key can be inlined as an
+// armored key block or downloaded from a URL.
+// Both parameters must be set together.
+func (c *Client) extractSignature(sigV, keyV string) (*fileSignature, error) {
+	if sigV == "" && keyV == "" {
+		return nil, nil
+	}
+	if sigV == "" || keyV == "" {
+		return nil, fmt.Errorf("signature and pubkey must be specified together")
+	}
+
+	sig, err := c.getTempFileContents(sigV)
+	if err != nil {
+		return nil, fmt.Errorf("Error downloading signature: %s", err)
+	}
+
+	var key []byte
+	if isArmoredPublicKey(keyV) {
+		key = []byte(keyV)
+	} else {
+		key, err = c.getTempFileContents(keyV)
+		if err != nil {
+			return nil, fmt.Errorf("Error downloading public key: %s", err)
+		}
+	}
+
+	var keyRing openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte(pgpPublicKeyHeader)) {
+		keyRing, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	} else {
+		keyRing, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading public key: %s", err)
+	}
+
+	return &fileSignature{
+		Signature: sig,
+		KeyRing:   keyRing,
+	}, nil
+}
+
+// isArmoredPublicKey reports whether the value of a 'pubkey' parameter is
+// an inlined armored key block rather than the URL of a key.
+func isArmoredPublicKey(keyV string) bool {
+	return strings.HasPrefix(strings.TrimSpace(keyV), pgpPublicKeyHeader)
+}
+
+// getTempFileContents downloads the single file at src into a temporary
+// file, using the same configuration as c, and returns its contents. The
+// temporary file is removed afterwards.
+func (c *Client) getTempFileContents(src string) ([]byte, error) {
+	tempfile, err := tmpFile(c.TmpDir, filepath.Base(src))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tempfile)
+
+	// The file is fetched like the source, with the same credentials,
+	// but none of the settings of the download of the source itself
+	c2 := *c
+	c2.Src = src
+	c2.Dst = tempfile
+	c2.Mode = ClientModeFile
+	c2.Dir = false
+	c2.ExpandEnv = false
+	c2.OnPlan = nil
+	c2.Merge = false
+	c2.Overwrite = OverwriteAlways
+	c2.ComputeChecksums = nil
+	c2.TreeChecksums = nil
+	c2.FlattenArchive = false
+	c2.ExtractToNamedDir = false
+	c2.SniffArchives = false
+	c2.OnFileComplete = nil
+	c2.MirrorDir = ""
+	c2.PopulateMirror = false
+	c2.FS = nil
+	c2.ProgressListener = nil
+	c2.Stdout = nil
+	if err = c2.Get(); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(tempfile)
+}
@@ -0,0 +1,136 @@
+package getter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// testPGPKey generates a signing key and writes its armored public key to
+// dir/pubkey.asc.
+func testPGPKey(t *testing.T, dir string) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity("go-getter", "", "go-getter@hashicorp.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	w.Close()
+
+	path := filepath.Join(dir, "pubkey.asc")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return entity, path
+}
+
+// testPGPSign writes an armored detached signature of data to path.
+func testPGPSign(t *testing.T, entity *openpgp.Entity, data, path string) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, entity, strings.NewReader(data), nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestGetFile_signature(t *testing.T) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	entity, pubkey := testPGPKey(t, td)
+	valid := filepath.Join(td, "valid.asc")
+	testPGPSign(t, entity, "Hello\n", valid)
+	tampered := filepath.Join(td, "tampered.asc")
+	testPGPSign(t, entity, "Goodbye\n", tampered)
+
+	pubkeyData, err := ioutil.ReadFile(pubkey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Name   string
+		Append string
+		Err    bool
+	}{
+		{
+			"valid signature",
+			"?signature=" + url.QueryEscape(valid) + "&pubkey=" + url.QueryEscape(pubkey),
+			false,
+		},
+		{
+			"valid signature with inline key",
+			"?signature=" + url.QueryEscape(valid) + "&pubkey=" + url.QueryEscape(string(pubkeyData)),
+			false,
+		},
+		{
+			"tampered signature",
+			"?signature=" + url.QueryEscape(tampered) + "&pubkey=" + url.QueryEscape(pubkey),
+			true,
+		},
+		{
+			"missing pubkey",
+			"?signature=" + url.QueryEscape(valid),
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempTestFile(t)
+			defer os.RemoveAll(filepath.Dir(dst))
+
+			source := testModule("basic-file/foo.txt") + tc.Append
+			err := GetFile(dst, source)
+			if (err != nil) != tc.Err {
+				t.Fatalf("expected error: %t, got: %v", tc.Err, err)
+			}
+
+			if tc.Err {
+				if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+					t.Fatalf("dst should not exist: %v", err)
+				}
+				return
+			}
+			assertContents(t, dst, "Hello\n")
+		})
+	}
+}
+
+func TestGet_signatureDir(t *testing.T) {
+	td, err := ioutil.TempDir("", "getter")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(td)
+
+	entity, pubkey := testPGPKey(t, td)
+	sig := filepath.Join(td, "sig.asc")
+	testPGPSign(t, entity, "Hello\n", sig)
+
+	dst := tempDir(t)
+	source := testModule("basic") + "?signature=" + url.QueryEscape(sig) + "&pubkey=" + url.QueryEscape(pubkey)
+	if err := Get(dst, source); err == nil {
+		t.Fatal("should error")
+	}
+}
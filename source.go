@@ -13,8 +13,13 @@ import (
 //   dom.com/path/?q=p               => dom.com/path/?q=p, ""
 //   proto://dom.com/path//*?q=p     => proto://dom.com/path?q=p, "*"
 //   proto://dom.com/path//path2?q=p => proto://dom.com/path?q=p, "path2"
+//   proto://dom.com/path//path2#v1  => proto://dom.com/path#v1, "path2"
 //
 func SourceDirSubdir(src string) (string, string) {
+	// Data URIs have no directories, and their payload may contain "//"
+	if len(src) >= 5 && strings.EqualFold(src[:5], "data:") {
+		return src, ""
+	}
 
 	// URL might contains another url in query parameters
 	stop := len(src)
@@ -39,9 +44,9 @@ func SourceDirSubdir(src string) (string, string) {
 	subdir := src[idx+2:]
 	src = src[:idx]
 
-	// Next, check if we have query parameters and push them onto the
-	// URL.
-	if idx = strings.Index(subdir, "?"); idx > -1 {
+	// Next, check if we have query parameters or a fragment and push them
+	// onto the URL.
+	if idx = strings.IndexAny(subdir, "?#"); idx > -1 {
 		query := subdir[idx:]
 		subdir = subdir[:idx]
 		src += query
@@ -50,6 +55,39 @@ func SourceDirSubdir(src string) (string, string) {
 	return src, subdir
 }
 
+// joinSourceSubdir is the reverse of SourceDirSubdir: it returns the source
+// URL src with the subdir subDir, if not empty, before its query parameters
+// and fragment.
+//
+// ex:
+//   proto://dom.com/path?q=p, path2 => proto://dom.com/path//path2?q=p
+//
+func joinSourceSubdir(src, subDir string) string {
+	if subDir == "" {
+		return src
+	}
+	idx := strings.IndexAny(src, "?#")
+	if idx < 0 {
+		idx = len(src)
+	}
+	return src[:idx] + "//" + subDir + src[idx:]
+}
+
+// ResolvedSource is the source downloaded by Client.Get, see
+// Client.Resolved.
+type ResolvedSource struct {
+	// URL is the source URL after detection and interception, with the
+	// subdirectory and the magic query parameters, such as checksum.
+	URL string
+
+	// Getter is the key of the getter of the download in Client.Getters,
+	// e.g. "git" or "https".
+	Getter string
+
+	// Commit is the SHA of the commit checked out by the git getter.
+	Commit string
+}
+
 // SubdirGlob returns the actual subdir with globbing processed.
 //
 // dst should be a destination directory that is already populated (the
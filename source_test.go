@@ -36,10 +36,22 @@ func TestSourceDirSubdir(t *testing.T) {
 			"https://hashicorp.com/path//*?checksum=file:http://url.com/....iso.sha256",
 			"https://hashicorp.com/path?checksum=file:http://url.com/....iso.sha256", "*",
 		},
+		{
+			"data:;base64,///+",
+			"data:;base64,///+", "",
+		},
 		{
 			"file://foo//bar",
 			"file://foo", "bar",
 		},
+		{
+			"https://hashicorp.com/repo.git//foo#v1.2.3",
+			"https://hashicorp.com/repo.git#v1.2.3", "foo",
+		},
+		{
+			"https://hashicorp.com/repo.git//foo?ref=v1#v2",
+			"https://hashicorp.com/repo.git?ref=v1#v2", "foo",
+		},
 	}
 
 	for i, tc := range cases {
@@ -50,6 +62,11 @@ func TestSourceDirSubdir(t *testing.T) {
 		if asub != tc.Sub {
 			t.Fatalf("%d: bad sub: %#v", i, asub)
 		}
+
+		// joinSourceSubdir reverses the split
+		if actual := joinSourceSubdir(adir, asub); actual != tc.Input {
+			t.Fatalf("%d: bad join: %#v", i, actual)
+		}
 	}
 }
 
@@ -0,0 +1,163 @@
+package getter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// splitArchiveRe matches the suffixes of the first part of a split
+// archive: ".001" as written by 7-Zip, or ".partaa" and ".part00" as
+// written by "split".
+var splitArchiveRe = regexp.MustCompile(`\.(?:(0*[01])|part(a+|0+))$`)
+
+// splitArchive is an archive split in parts by naming convention, e.g.
+// "release.zip.001", "release.zip.002", ... or "release.tar.gz.partaa",
+// "release.tar.gz.partab", ...
+type splitArchive struct {
+	// name is the path of the archive, without the suffix of its parts.
+	name string
+
+	// prefix is what comes before the number of a part, e.g. ".part".
+	prefix string
+
+	// first is the number of the first part, e.g. "001" or "aa".
+	first string
+}
+
+// parseSplitArchive returns the split archive whose first part has the
+// path p, or nil if p doesn't name the first part of a split archive.
+func parseSplitArchive(p string) *splitArchive {
+	m := splitArchiveRe.FindStringSubmatchIndex(p)
+	if m == nil {
+		return nil
+	}
+	if m[2] >= 0 {
+		// 7-Zip numbers the parts from 1, with at least 3 digits
+		if m[3]-m[2] < 3 || p[m[3]-1] != '1' {
+			return nil
+		}
+		return &splitArchive{name: p[:m[0]], prefix: ".", first: p[m[2]:m[3]]}
+	}
+	return &splitArchive{name: p[:m[0]], prefix: ".part", first: p[m[4]:m[5]]}
+}
+
+// part returns the path of the part i, counting from 0, or false if the
+// parts can't be numbered that far.
+func (s *splitArchive) part(i int) (string, bool) {
+	width := len(s.first)
+	var n string
+	if s.first[0] == 'a' {
+		// Base 26 numbers of width letters
+		b := []byte(strings.Repeat("a", width))
+		for d := width - 1; d >= 0 && i > 0; d-- {
+			b[d] = byte('a' + i%26)
+			i /= 26
+		}
+		if i > 0 {
+			return "", false
+		}
+		n = string(b)
+	} else {
+		first, _ := strconv.Atoi(s.first)
+		n = fmt.Sprintf("%0*d", width, first+i)
+		if len(n) > width {
+			return "", false
+		}
+	}
+	return s.name + s.prefix + n, true
+}
+
+// splitGetter downloads the parts of a split archive with the getter of
+// its first part, joined in a single file. The parts are downloaded in
+// order until one is not found.
+type splitGetter struct {
+	Getter
+
+	split  *splitArchive
+	client *Client
+}
+
+func (g *splitGetter) GetFile(dst string, u *url.URL) error {
+	ctx := g.client.Ctx
+
+	// Create all the parent directories
+	if err := os.MkdirAll(filepath.Dir(dst), dirModeFromContext(ctx)); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileModeFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for i := 0; ; i++ {
+		// Stop probing for parts once the download is canceled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p, ok := g.split.part(i)
+		if !ok {
+			break
+		}
+		pu := *u
+		pu.Path = p
+		pu.RawPath = ""
+
+		if err := g.appendPart(out, &pu); err != nil {
+			if i > 0 && isNotFound(err) {
+				break
+			}
+			return fmt.Errorf("error downloading part %d of the split archive: %w", i+1, err)
+		}
+	}
+	return out.Close()
+}
+
+// appendPart downloads the part at u and appends it to out. The part is
+// downloaded to a temporary file first since some getters, like the
+// FileGetter, link dst to the source instead of writing it.
+func (g *splitGetter) appendPart(out *os.File, u *url.URL) error {
+	td, err := ioutil.TempDir(g.client.TmpDir, "getter")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(td)
+
+	part := filepath.Join(td, "part")
+	if err := g.Getter.GetFile(part, u); err != nil {
+		return err
+	}
+
+	f, err := os.Open(part)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(out, f)
+	return err
+}
+
+// isNotFound reports whether err is a getter failing because the remote
+// file doesn't exist.
+func isNotFound(err error) bool {
+	var nf *NotFoundError
+	var aerr awserr.Error
+	return errors.As(err, &nf) ||
+		errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, storage.ErrObjectNotExist) ||
+		errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey
+}
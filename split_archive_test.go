@@ -0,0 +1,167 @@
+package getter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSplitArchive(t *testing.T) {
+	cases := []struct {
+		Path  string
+		Parts []string
+	}{
+		{"/foo.zip.001", []string{"/foo.zip.001", "/foo.zip.002", "/foo.zip.011"}},
+		{"/foo.tar.gz.partaa", []string{"/foo.tar.gz.partaa", "/foo.tar.gz.partab", "/foo.tar.gz.partak"}},
+		{"/foo.tar.gz.part00", []string{"/foo.tar.gz.part00", "/foo.tar.gz.part01", "/foo.tar.gz.part10"}},
+		{"/foo.zip.002", nil},
+		{"/foo.zip.1", nil},
+		{"/foo.tar.gz.partab", nil},
+		{"/foo.tar.gz", nil},
+	}
+	for _, tc := range cases {
+		s := parseSplitArchive(tc.Path)
+		if tc.Parts == nil {
+			if s != nil {
+				t.Fatalf("%s: expected no split archive, got %#v", tc.Path, s)
+			}
+			continue
+		}
+		if s == nil {
+			t.Fatalf("%s: expected a split archive", tc.Path)
+		}
+		for i, n := range []int{0, 1, 10} {
+			if p, ok := s.part(n); !ok || p != tc.Parts[i] {
+				t.Fatalf("%s: bad part %d: %s", tc.Path, n, p)
+			}
+		}
+	}
+
+	// The numbers of the parts are as wide as the first one
+	s := parseSplitArchive("/foo.tar.gz.partaa")
+	if p, ok := s.part(26*26 - 1); !ok || p != "/foo.tar.gz.partzz" {
+		t.Fatalf("bad last part: %s", p)
+	}
+	if _, ok := s.part(26 * 26); ok {
+		t.Fatal("expected no more parts")
+	}
+}
+
+// testSplitArchive splits the archive multiple_dir.tar.gz in 3 parts named
+// by suffix in a new directory, and returns the path of the archive
+// without the suffixes.
+func testSplitArchive(t *testing.T, suffixes ...string) string {
+	data, err := ioutil.ReadFile(filepath.Join(fixtureDir, "decompress-tgz", "multiple_dir.tar.gz"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	dir := tempDir(t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	name := filepath.Join(dir, "multiple_dir.tar.gz")
+	size := len(data)/len(suffixes) + 1
+	for i, suffix := range suffixes {
+		part := data[i*size:]
+		if len(part) > size {
+			part = part[:size]
+		}
+		if err := ioutil.WriteFile(name+suffix, part, 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	return name
+}
+
+func assertMultipleDir(t *testing.T, dst string) {
+	t.Helper()
+	assertContents(t, filepath.Join(dst, "test1"), "Hello\n")
+	assertContents(t, filepath.Join(dst, "dir", "test2"), "Hello\n")
+}
+
+func TestGet_splitArchive(t *testing.T) {
+	name := testSplitArchive(t, ".001", ".002", ".003")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	if err := Get(dst, name+".001"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertMultipleDir(t, dst)
+}
+
+func TestGet_splitArchiveHTTP(t *testing.T) {
+	name := testSplitArchive(t, ".partaa", ".partab", ".partac")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(name))))
+	defer srv.Close()
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	if err := Get(dst, srv.URL+"/multiple_dir.tar.gz.partaa"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertMultipleDir(t, dst)
+}
+
+func TestGet_splitArchiveMissingFirstPart(t *testing.T) {
+	name := testSplitArchive(t, ".002", ".003")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	if err := Get(dst, name+".001"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// testCancelGetter is a FileGetter canceling the download after every file.
+type testCancelGetter struct {
+	*FileGetter
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (g *testCancelGetter) GetFile(dst string, u *url.URL) error {
+	g.calls++
+	defer g.cancel()
+	return g.FileGetter.GetFile(dst, u)
+}
+
+func TestGet_splitArchiveCanceled(t *testing.T) {
+	name := testSplitArchive(t, ".001", ".002", ".003")
+	defer os.RemoveAll(filepath.Dir(name))
+
+	dst := tempDir(t)
+	defer os.RemoveAll(dst)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g := &testCancelGetter{FileGetter: new(FileGetter), cancel: cancel}
+	client := &Client{
+		Ctx:     ctx,
+		Src:     name + ".001",
+		Dst:     dst,
+		Mode:    ClientModeDir,
+		Getters: map[string]Getter{"file": g},
+	}
+	if err := client.Get(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the download to be canceled, got %v", err)
+	}
+
+	// No part is fetched once canceled
+	if g.calls != 1 {
+		t.Fatalf("expected 1 part, got %d", g.calls)
+	}
+}
@@ -0,0 +1,63 @@
+package getter
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+)
+
+// TransportOptions tunes the HTTP transport of the S3 and GCS getters, for
+// example to download many objects concurrently. Zero values keep the
+// defaults of cleanhttp.DefaultPooledTransport.
+//
+// The transport is created on first use and then shared by all the
+// downloads of the getter, so that connections are reused.
+type TransportOptions struct {
+	// MaxIdleConns is the maximum number of idle connections across all
+	// hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept to
+	// each host.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+
+	// ForceAttemptHTTP2, if true, negotiates HTTP/2 with the servers
+	// supporting it.
+	ForceAttemptHTTP2 bool
+
+	// TLSConfig, if set, is the TLS configuration of the connections, e.g.
+	// to trust the internal CA of a private endpoint or to present a client
+	// certificate. It must not be modified after the first download.
+	TLSConfig *tls.Config
+
+	once      sync.Once
+	transport *http.Transport
+}
+
+// httpTransport returns the transport configured by o.
+func (o *TransportOptions) httpTransport() *http.Transport {
+	o.once.Do(func() {
+		t := cleanhttp.DefaultPooledTransport()
+		if o.MaxIdleConns > 0 {
+			t.MaxIdleConns = o.MaxIdleConns
+		}
+		if o.MaxIdleConnsPerHost > 0 {
+			t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+		}
+		if o.IdleConnTimeout > 0 {
+			t.IdleConnTimeout = o.IdleConnTimeout
+		}
+		t.ForceAttemptHTTP2 = o.ForceAttemptHTTP2
+		if o.TLSConfig != nil {
+			t.TLSClientConfig = o.TLSConfig.Clone()
+		}
+		o.transport = t
+	})
+	return o.transport
+}
@@ -0,0 +1,43 @@
+package getter
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTransportOptions(t *testing.T) {
+	o := &TransportOptions{
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     time.Minute,
+		ForceAttemptHTTP2:   true,
+	}
+
+	tr := o.httpTransport()
+	if tr.MaxIdleConns != 100 {
+		t.Fatalf("expected the default MaxIdleConns, got %d", tr.MaxIdleConns)
+	}
+	if tr.MaxIdleConnsPerHost != 32 {
+		t.Fatalf("bad MaxIdleConnsPerHost: %d", tr.MaxIdleConnsPerHost)
+	}
+	if tr.IdleConnTimeout != time.Minute {
+		t.Fatalf("bad IdleConnTimeout: %s", tr.IdleConnTimeout)
+	}
+	if !tr.ForceAttemptHTTP2 {
+		t.Fatal("expected ForceAttemptHTTP2")
+	}
+
+	if o.httpTransport() != tr {
+		t.Fatal("expected the transport to be reused")
+	}
+}
+
+func TestTransportOptions_defaults(t *testing.T) {
+	tr := new(TransportOptions).httpTransport()
+	if tr.MaxIdleConnsPerHost != runtime.GOMAXPROCS(0)+1 {
+		t.Fatalf("bad MaxIdleConnsPerHost: %d", tr.MaxIdleConnsPerHost)
+	}
+	if tr.ForceAttemptHTTP2 {
+		t.Fatal("unexpected ForceAttemptHTTP2")
+	}
+}
@@ -0,0 +1,75 @@
+package getter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// verifyTreeChecksums checks the files of the directory dir against
+// checksums, which maps their slash-separated paths relative to dir to
+// their hex encoded SHA-256 checksums, see Client.TreeChecksums. The files
+// of dir that aren't listed are only an error if strict is set.
+func verifyTreeChecksums(dir string, checksums map[string]string, strict bool) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("tree checksums can only be verified for a directory: %s", dir)
+	}
+
+	var problems []string
+	seen := make(map[string]bool, len(checksums))
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		expected, ok := checksums[rel]
+		if !ok {
+			if strict {
+				problems = append(problems, fmt.Sprintf("unexpected file: %s", rel))
+			}
+			return nil
+		}
+		seen[rel] = true
+
+		if !fi.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("not a regular file: %s", rel))
+			return nil
+		}
+		c, err := newChecksumFromType("sha256", expected, rel)
+		if err != nil {
+			return fmt.Errorf("invalid checksum of %s: %s", rel, err)
+		}
+		if err := c.checksum(path); err != nil {
+			problems = append(problems, fmt.Sprintf("checksum of %s did not match", rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for rel := range checksums {
+		if !seen[rel] {
+			problems = append(problems, fmt.Sprintf("missing file: %s", rel))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("tree checksums of %s did not match:\n%s", dir, strings.Join(problems, "\n"))
+}
@@ -0,0 +1,82 @@
+package getter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClient_TreeChecksums(t *testing.T) {
+	const sum = "66a045b452102c59d840ec097d59d9467e13a3f34f6494e539ffd32c1bb35f18"
+
+	cases := []struct {
+		Name      string
+		Checksums map[string]string
+		Strict    bool
+		Err       string
+	}{
+		{
+			"match",
+			map[string]string{"test1": sum, "dir/test2": sum},
+			true,
+			"",
+		},
+		{
+			"missing file",
+			map[string]string{"test1": sum, "dir/test2": sum, "dir/test3": sum},
+			false,
+			"missing file: dir/test3",
+		},
+		{
+			"mismatched file",
+			map[string]string{"test1": sum, "dir/test2": strings.Repeat("0", 64)},
+			false,
+			"checksum of dir/test2 did not match",
+		},
+		{
+			"extra file",
+			map[string]string{"test1": sum},
+			false,
+			"",
+		},
+		{
+			"extra file strict",
+			map[string]string{"test1": sum},
+			true,
+			"unexpected file: dir/test2",
+		},
+		{
+			"invalid checksum",
+			map[string]string{"test1": "nothex"},
+			false,
+			"invalid tree checksum of test1",
+		},
+	}
+
+	src, _ := filepath.Abs(filepath.Join("./test-fixtures", "decompress-tgz", "multiple_dir.tar.gz"))
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			dst := tempDir(t)
+			defer os.RemoveAll(dst)
+
+			client := &Client{
+				Src:                 src,
+				Dst:                 dst,
+				Mode:                ClientModeDir,
+				TreeChecksums:       tc.Checksums,
+				TreeChecksumsStrict: tc.Strict,
+			}
+			err := client.Get()
+			if tc.Err == "" {
+				if err != nil {
+					t.Fatalf("err: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("expected an error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package getter
+
+import "fmt"
+
+// Validate checks that src can be downloaded without transferring its
+// contents, e.g. to make sure all the sources of a configuration are
+// reachable before downloading any of them. src is detected and parsed as
+// Client.Src; its subdirectory, if any, isn't checked. Dst and Mode are
+// ignored.
+//
+// The getter makes the cheapest check it can: a HEAD request for HTTP, the
+// attributes of the object, or of the first object under the prefix, for
+// GCS, git ls-remote for Git and a stat for local files. The other getters
+// can't validate a source.
+func (c *Client) Validate(src string) error {
+	if err := c.Configure(c.Options...); err != nil {
+		return err
+	}
+
+	r, err := c.resolve(src)
+	if err != nil {
+		return err
+	}
+	src, force, u, g := r.src, r.force, r.u, r.g
+	v, ok := g.(validator)
+	if !ok {
+		return fmt.Errorf("validate not supported for scheme '%s'", force)
+	}
+
+	if c.ProbeBeforeGet && shouldProbe(force, g, u) {
+		if err := probe(c.Ctx, u); err != nil {
+			return err
+		}
+	}
+
+	// Delete the magic query parameters, they aren't part of the source
+	q := u.Query()
+	for _, k := range []string{"archive", "checksum", "signature", "pubkey"} {
+		q.Del(k)
+	}
+	u.RawQuery = q.Encode()
+
+	if err := v.validate(u); err != nil {
+		return fmt.Errorf("error validating '%s': %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package getter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClient_Validate_http(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/file":
+			w.Write([]byte("Hello\n"))
+		case "/no-head":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("Hello\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		Path    string
+		Methods []string
+		Err     string
+	}{
+		{"/file?checksum=md5:bad", []string{"HEAD"}, ""},
+		{"/no-head", []string{"HEAD", "GET"}, ""},
+		{"/missing", []string{"HEAD"}, "404"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Path, func(t *testing.T) {
+			methods = nil
+
+			err := new(Client).Validate(srv.URL + tc.Path)
+			if tc.Err == "" && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if tc.Err != "" && (err == nil || !strings.Contains(err.Error(), tc.Err)) {
+				t.Fatalf("expected error containing %q, got %v", tc.Err, err)
+			}
+			if strings.Join(methods, ",") != strings.Join(tc.Methods, ",") {
+				t.Fatalf("expected requests %v, got %v", tc.Methods, methods)
+			}
+		})
+	}
+}
+
+func TestClient_Validate_gcs(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{
+		"foo.txt":     "Hello\n",
+		"dir/bar.txt": "World\n",
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		Object string
+		Err    string
+	}{
+		{"foo.txt", ""},
+		{"dir", ""},
+		{"dir/*.txt", ""},
+		{"missing.txt", "no objects found"},
+		{"dir/*.json", "no objects found"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Object, func(t *testing.T) {
+			src := "gcs::https://www.googleapis.com/storage/v1/bucket/" + tc.Object + "?anonymous=true"
+			err := new(Client).Validate(src)
+			if tc.Err == "" && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if tc.Err != "" && (err == nil || !strings.Contains(err.Error(), tc.Err)) {
+				t.Fatalf("expected error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r.URL.Path, "/bucket/") {
+			t.Fatalf("unexpected download of %s", r.URL.Path)
+		}
+	}
+}
+
+func TestClient_Validate_git(t *testing.T) {
+	if !testHasGit {
+		t.Skip("git not found, skipping")
+	}
+
+	repo := testGitRepo(t, "validate")
+	defer os.RemoveAll(filepath.Dir(repo.dir))
+	repo.commitFile("foo.txt", "Hello\n")
+	repo.git("tag", "v1.0.0")
+
+	cases := []struct {
+		Src string
+		Err string
+	}{
+		{"git::" + repo.url.String(), ""},
+		{"git::" + repo.url.String() + "?ref=v1.0.0", ""},
+		{"git::" + repo.url.String() + "?ref=missing", `ref "missing" not found`},
+		{"git::file://" + filepath.Join(repo.dir, "missing"), "exited with an error"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Src, func(t *testing.T) {
+			err := new(Client).Validate(tc.Src)
+			if tc.Err == "" && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if tc.Err != "" && (err == nil || !strings.Contains(err.Error(), tc.Err)) {
+				t.Fatalf("expected error containing %q, got %v", tc.Err, err)
+			}
+		})
+	}
+}
+
+func TestClient_Validate_file(t *testing.T) {
+	c := new(Client)
+	if err := c.Validate(testModule("basic-file/foo.txt")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := c.Validate(testModule("basic-file/missing.txt")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestClient_Validate_unsupported(t *testing.T) {
+	err := new(Client).Validate("data:,Hello")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
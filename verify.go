@@ -0,0 +1,74 @@
+package getter
+
+import (
+	"context"
+	"fmt"
+)
+
+// Verify downloads the single file at Src and checks it against its
+// checksum without writing anything, e.g. to health check a mirror. Dst is
+// ignored. The checksum is required, either in the "checksum" parameter of
+// Src or found by the getter, and the getter must be able to stream the
+// file: the HTTP and GCS getters can.
+func (c *Client) Verify() error {
+	if err := c.Configure(c.Options...); err != nil {
+		return err
+	}
+
+	limit := newByteLimit(c.MaxBytes)
+	if limit != nil {
+		defer func(ctx context.Context) { c.Ctx = ctx }(c.Ctx)
+		c.Ctx = withByteLimit(c.Ctx, limit)
+	}
+
+	r, err := c.resolve(c.Src)
+	if err != nil {
+		return err
+	}
+	if r.subDir != "" {
+		return fmt.Errorf("subdirectories cannot be verified: %s",
+			joinSourceSubdir(r.src, r.subDir))
+	}
+	src, force, u, g := r.src, r.force, r.u, r.g
+	o, ok := g.(fileOpener)
+	if !ok {
+		return fmt.Errorf("verify not supported for scheme '%s'", force)
+	}
+
+	if c.ProbeBeforeGet && shouldProbe(force, g, u) {
+		if err := probe(c.Ctx, u); err != nil {
+			return err
+		}
+	}
+
+	checksum, err := c.extractChecksum(u)
+	if err != nil {
+		return fmt.Errorf("invalid checksum: %s", err)
+	}
+
+	// Delete the magic query parameters, the file is verified as downloaded.
+	q := u.Query()
+	q.Del("archive")
+	q.Del("checksum")
+	u.RawQuery = q.Encode()
+
+	if checksum == nil {
+		if a, ok := g.(autoChecksummer); ok {
+			checksum, err = a.autoChecksum(u)
+			if err != nil {
+				return fmt.Errorf("invalid checksum: %s", err)
+			}
+		}
+	}
+	if checksum == nil {
+		return fmt.Errorf("a checksum is required to verify '%s'", src)
+	}
+
+	f, err := o.openFile(u)
+	if err != nil {
+		return fmt.Errorf("error downloading '%s': %s", src, err)
+	}
+	defer f.Close()
+
+	return checksum.verify(c.Ctx, f)
+}
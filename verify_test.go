@@ -0,0 +1,81 @@
+package getter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testVerifySHA256 = "66a045b452102c59d840ec097d59d9467e13a3f34f6494e539ffd32c1bb35f18"
+
+func TestClient_Verify_http(t *testing.T) {
+	ln := testHttpServer(t)
+	defer ln.Close()
+
+	cases := map[string]struct {
+		Checksum string
+		Err      string
+	}{
+		"good":    {"sha256:" + testVerifySHA256, ""},
+		"bad":     {"md5:b7d96c89d09d9e204f5fedc4d5d55b21", "Checksums did not match"},
+		"missing": {"", "a checksum is required"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			td := tempDir(t)
+			defer os.RemoveAll(td)
+			dst := filepath.Join(td, "file")
+
+			src := "http://" + ln.Addr().String() + "/file"
+			if tc.Checksum != "" {
+				src += "?checksum=" + tc.Checksum
+			}
+			c := &Client{Src: src, Dst: dst}
+
+			err := c.Verify()
+			if tc.Err == "" && err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if tc.Err != "" && (err == nil || !strings.Contains(err.Error(), tc.Err)) {
+				t.Fatalf("expected error containing %q, got %v", tc.Err, err)
+			}
+
+			if _, err := os.Stat(dst); !os.IsNotExist(err) {
+				t.Fatalf("expected nothing to be written, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_Verify_gcs(t *testing.T) {
+	srv := testGCSServer(t, "bucket", map[string]string{"foo.txt": "Hello\n"})
+	defer srv.Close()
+
+	td := tempDir(t)
+	defer os.RemoveAll(td)
+	dst := filepath.Join(td, "foo.txt")
+
+	c := &Client{
+		Src: "gcs::https://www.googleapis.com/storage/v1/bucket/foo.txt?anonymous=true&checksum=" + testVerifySHA256,
+		Dst: dst,
+	}
+	if err := c.Verify(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestClient_Verify_unsupported(t *testing.T) {
+	c := &Client{
+		Src: testModule("basic-file/foo.txt") + "?checksum=md5:09f7e02f1290be211da707a266f153b3",
+		Dst: filepath.Join(tempDir(t), "foo.txt"),
+	}
+	if err := c.Verify(); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expected an unsupported error, got %v", err)
+	}
+}
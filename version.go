@@ -0,0 +1,37 @@
+package getter
+
+import (
+	"reflect"
+	"runtime/debug"
+)
+
+// DefaultUserAgent is the User-Agent sent by the HTTP, S3 and GCS getters
+// when Client.UserAgent is empty: "go-getter/" followed by the version of
+// the module in the build, or just "go-getter" if it isn't known, e.g. in a
+// development build.
+var DefaultUserAgent = buildUserAgent(debug.ReadBuildInfo())
+
+// buildUserAgent returns the default User-Agent for the build info of the
+// binary.
+func buildUserAgent(bi *debug.BuildInfo, ok bool) string {
+	const name = "go-getter"
+	if !ok {
+		return name
+	}
+
+	// The root package of the module has the path of the module
+	path := reflect.TypeOf(Client{}).PkgPath()
+	var version string
+	if bi.Main.Path == path {
+		version = bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == path {
+			version = dep.Version
+		}
+	}
+	if version == "" || version == "(devel)" {
+		return name
+	}
+	return name + "/" + version
+}
@@ -0,0 +1,51 @@
+package getter
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildUserAgent(t *testing.T) {
+	const path = "github.com/hashicorp/go-getter"
+	cases := []struct {
+		Name      string
+		Info      *debug.BuildInfo
+		UserAgent string
+	}{
+		{
+			"dependency",
+			&debug.BuildInfo{
+				Main: debug.Module{Path: "example.com/app", Version: "v0.1.0"},
+				Deps: []*debug.Module{
+					{Path: "example.com/other", Version: "v2.0.0"},
+					{Path: path, Version: "v1.7.3"},
+				},
+			},
+			"go-getter/v1.7.3",
+		},
+		{
+			"main module",
+			&debug.BuildInfo{Main: debug.Module{Path: path, Version: "v1.7.3"}},
+			"go-getter/v1.7.3",
+		},
+		{
+			"development build",
+			&debug.BuildInfo{Main: debug.Module{Path: path, Version: "(devel)"}},
+			"go-getter",
+		},
+		{
+			"not a dependency",
+			&debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: "v0.1.0"}},
+			"go-getter",
+		},
+	}
+	for _, tc := range cases {
+		if v := buildUserAgent(tc.Info, true); v != tc.UserAgent {
+			t.Fatalf("%s: expected %q, got %q", tc.Name, tc.UserAgent, v)
+		}
+	}
+
+	if v := buildUserAgent(nil, false); v != "go-getter" {
+		t.Fatalf("without build info: expected %q, got %q", "go-getter", v)
+	}
+}